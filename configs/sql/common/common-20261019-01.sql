@@ -0,0 +1,3 @@
+-- +migrate Up
+
+ALTER TABLE `app_config` ADD COLUMN edit_second int not null DEFAULT 0 COMMENT '消息可编辑时长（秒） 0.不限制';
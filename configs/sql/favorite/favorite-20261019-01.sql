@@ -0,0 +1,13 @@
+-- +migrate Up
+
+ALTER TABLE `favorite` ADD COLUMN channel_id VARCHAR(100) not null DEFAULT '' COMMENT '收藏消息所在频道ID';
+ALTER TABLE `favorite` ADD COLUMN channel_type smallint not null DEFAULT 0 COMMENT '收藏消息所在频道类型';
+ALTER TABLE `favorite` ADD COLUMN message_id VARCHAR(40) not null DEFAULT '' COMMENT '收藏的消息ID 收藏自定义内容时为空';
+ALTER TABLE `favorite` ADD COLUMN message_seq bigint not null DEFAULT 0 COMMENT '收藏的消息序号';
+ALTER TABLE `favorite` ADD COLUMN is_deleted smallint not null DEFAULT 0 COMMENT '是否已删除';
+ALTER TABLE `favorite` ADD COLUMN version bigint not null DEFAULT 0 COMMENT '同步版本号';
+-- 旧数据unique_key为空的补齐唯一值，相同(uid,unique_key)的重复收藏只保留最新一条，否则无法建立唯一索引
+UPDATE `favorite` SET unique_key = CONCAT('legacy-', id) WHERE unique_key = '';
+DELETE f1 FROM `favorite` f1 JOIN `favorite` f2 ON f1.uid = f2.uid AND f1.unique_key = f2.unique_key AND f1.id < f2.id;
+CREATE UNIQUE INDEX favorite_uid_unique_key on `favorite` (uid, unique_key);
+CREATE INDEX favorite_uid_version on `favorite` (uid, version);
@@ -0,0 +1,4 @@
+-- +migrate Up
+
+-- 作者名字与用户名长度保持一致
+ALTER TABLE `favorite` MODIFY COLUMN author_name VARCHAR(100) not null DEFAULT '' COMMENT '作者名字';
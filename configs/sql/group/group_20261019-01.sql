@@ -0,0 +1,25 @@
+-- +migrate Up
+
+ALTER TABLE `group` ADD COLUMN join_mode smallint not null DEFAULT 0 COMMENT '入群方式 0.公开 1.仅限邀请 2.需要审批';
+
+-- 入群申请
+create table `group_join_request`
+(
+  id            bigint         not null primary key AUTO_INCREMENT,
+  request_no    VARCHAR(40)    not null default '' COMMENT '申请编号',
+  group_no      VARCHAR(40)    not null default '' COMMENT '群编号',
+  uid           VARCHAR(40)    not null default '' COMMENT '申请者uid',
+  remark        VARCHAR(255)   not null default '' COMMENT '申请留言',
+  source        VARCHAR(40)    not null default '' COMMENT '申请来源 qrcode.扫码 search.搜索 link.链接',
+  inviter_uid   VARCHAR(40)    not null default '' COMMENT '分享者uid（如二维码生成者）',
+  status        smallint       not null default 0  COMMENT '状态 0.待审批 1.已同意 2.已拒绝 3.已过期',
+  handler_uid   VARCHAR(40)    not null default '' COMMENT '审批者uid',
+  handled_at    bigint         not null default 0  COMMENT '审批时间',
+  expire_at     bigint         not null default 0  COMMENT '过期时间',
+  created_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX group_join_request_request_no on `group_join_request` (request_no);
+CREATE INDEX group_join_request_group_no_status on `group_join_request` (group_no, status);
+CREATE INDEX group_join_request_uid_group_no on `group_join_request` (uid, group_no);
+CREATE INDEX group_join_request_status_expire_at on `group_join_request` (status, expire_at);
@@ -0,0 +1,32 @@
+-- +migrate Up
+
+-- 群公告
+create table `group_announcement`
+(
+  id               bigint         not null primary key AUTO_INCREMENT,
+  announcement_no  VARCHAR(40)    not null default '' COMMENT '公告编号',
+  group_no         VARCHAR(40)    not null default '' COMMENT '群编号',
+  author_uid       VARCHAR(40)    not null default '' COMMENT '发布者uid',
+  editor_uid       VARCHAR(40)    not null default '' COMMENT '最后编辑者uid',
+  content          text                                COMMENT '公告内容',
+  is_pinned        smallint       not null default 0  COMMENT '是否置顶',
+  require_confirm  smallint       not null default 0  COMMENT '是否需要群成员确认',
+  is_deleted       smallint       not null default 0  COMMENT '是否已删除',
+  created_at       timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at       timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX group_announcement_announcement_no on `group_announcement` (announcement_no);
+CREATE INDEX group_announcement_group_no on `group_announcement` (group_no);
+
+-- 群公告已读/确认记录
+create table `group_announcement_ack`
+(
+  id               bigint         not null primary key AUTO_INCREMENT,
+  announcement_no  VARCHAR(40)    not null default '' COMMENT '公告编号',
+  group_no         VARCHAR(40)    not null default '' COMMENT '群编号',
+  uid              VARCHAR(40)    not null default '' COMMENT '群成员uid',
+  is_confirmed     smallint       not null default 0  COMMENT '是否已确认',
+  created_at       timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 阅读时间
+  updated_at       timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX group_announcement_ack_no_uid on `group_announcement_ack` (announcement_no, uid);
@@ -0,0 +1,4 @@
+-- +migrate Up
+
+ALTER TABLE `group` ADD COLUMN slow_mode integer not null DEFAULT 0 COMMENT '慢速模式 每位成员发言间隔秒数 0.关闭';
+ALTER TABLE `group` ADD COLUMN new_member_probation integer not null DEFAULT 0 COMMENT '新成员观察期秒数 观察期内不能发送链接和媒体消息 0.关闭';
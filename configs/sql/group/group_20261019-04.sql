@@ -0,0 +1,4 @@
+-- +migrate Up
+
+ALTER TABLE `group_member` ADD COLUMN title VARCHAR(40) not null DEFAULT '' COMMENT '成员头衔';
+ALTER TABLE `group_member` ADD COLUMN permissions integer not null DEFAULT 63 COMMENT '管理员权限位 1.邀请 2.移除 4.禁言 8.置顶 16.修改群信息 32.撤回他人消息';
@@ -0,0 +1,3 @@
+-- +migrate Up
+
+ALTER TABLE `group` ADD COLUMN forbidden_forward smallint not null DEFAULT 0 COMMENT '禁止转发和保存群消息 0.否 1.是';
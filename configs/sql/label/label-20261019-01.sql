@@ -0,0 +1,18 @@
+-- +migrate Up
+
+ALTER TABLE `label` ADD COLUMN is_deleted smallint not null DEFAULT 0 COMMENT '是否已删除';
+ALTER TABLE `label` ADD COLUMN version bigint not null DEFAULT 0 COMMENT '同步版本号';
+CREATE INDEX label_uid_version on `label` (uid, version);
+
+-- 标签成员（替代label.member_uids）
+create table `label_member`
+(
+  id            bigint         not null primary key AUTO_INCREMENT,
+  label_id      bigint         not null default 0  COMMENT '标签ID',
+  uid           VARCHAR(40)    not null default '' COMMENT '标签所属用户uid',
+  member_uid    VARCHAR(40)    not null default '' COMMENT '成员uid',
+  created_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX label_member_label_id_member_uid on `label_member` (label_id, member_uid);
+CREATE INDEX label_member_uid_member_uid on `label_member` (uid, member_uid);
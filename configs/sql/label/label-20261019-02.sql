@@ -0,0 +1,18 @@
+-- +migrate Up
+
+-- 将旧的label.member_uids（逗号分隔或json数组）迁移到label_member表
+SET SESSION cte_max_recursion_depth = 100000;
+
+INSERT IGNORE INTO `label_member` (label_id, uid, member_uid)
+WITH RECURSIVE legacy_member (label_id, uid, rest, member_uid) AS (
+    SELECT id, uid, CONCAT(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(member_uids, '[', ''), ']', ''), '"', ''), ' ', ''), '\r', ''), '\n', ''), ','), CAST('' AS CHAR(40))
+    FROM `label` WHERE member_uids IS NOT NULL AND member_uids <> ''
+    UNION ALL
+    SELECT label_id, uid, SUBSTRING(rest, LOCATE(',', rest) + 1), CAST(SUBSTRING(rest, 1, LOCATE(',', rest) - 1) AS CHAR(40))
+    FROM legacy_member WHERE rest <> ''
+)
+SELECT label_id, uid, member_uid FROM legacy_member WHERE member_uid <> '';
+
+-- 所有旧标签（包括没有成员的）使用比已分配的同步序号更大的版本号 客户端重新同步
+UPDATE `label` LEFT JOIN `seq` ON `seq`.`key` = CONCAT('seq:label:', `label`.uid)
+SET `label`.version = IFNULL(`seq`.min_seq, 1000000), `label`.member_uids = '';
@@ -0,0 +1,20 @@
+-- +migrate Up
+
+-- 阅后即焚销毁任务
+create table `message_flame`
+(
+  id           bigint         not null primary key AUTO_INCREMENT,
+  message_id   bigint         not null default 0  COMMENT '消息唯一ID',
+  message_seq  bigint         not null default 0  COMMENT '消息序列号',
+  from_uid     VARCHAR(40)    not null default '' COMMENT '消息发送者',
+  uid          VARCHAR(40)    not null default '' COMMENT '阅读者',
+  channel_id   VARCHAR(100)   not null default '' COMMENT '频道ID（个人频道为fake channel id）',
+  channel_type smallint       not null default 0  COMMENT '频道类型',
+  flame_second int            not null default 0  COMMENT '阅后即焚秒数',
+  expire_at    bigint         not null default 0  COMMENT '销毁时间（时间戳 秒）',
+  status       smallint       not null default 0  COMMENT '状态 0.待销毁 1.已销毁',
+  created_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_flame_message_uid on `message_flame` (message_id, uid);
+CREATE INDEX message_flame_status_expire on `message_flame` (status, expire_at);
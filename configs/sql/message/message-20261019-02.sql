@@ -0,0 +1,18 @@
+-- +migrate Up
+
+-- 消息编辑历史
+create table `message_edit_history`
+(
+  id                bigint         not null primary key AUTO_INCREMENT,
+  message_id        bigint         not null default 0  COMMENT '消息唯一ID',
+  message_seq       bigint         not null default 0  COMMENT '消息序列号',
+  channel_id        VARCHAR(100)   not null default '' COMMENT '频道ID（个人频道为fake channel id）',
+  channel_type      smallint       not null default 0  COMMENT '频道类型',
+  editor_uid        VARCHAR(40)    not null default '' COMMENT '编辑者uid',
+  content_edit      TEXT                               COMMENT '编辑后的正文',
+  content_edit_hash VARCHAR(40)    not null default '' COMMENT '编辑后正文的hash',
+  edited_at         integer        not null default 0  COMMENT '编辑时间 时间戳（秒）',
+  created_at        timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at        timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE INDEX message_edit_history_message_id on `message_edit_history` (message_id);
@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- 定时消息
+create table `message_scheduled`
+(
+  id            bigint         not null primary key AUTO_INCREMENT,
+  uid           VARCHAR(40)    not null default '' COMMENT '创建者uid（后台创建的为操作员uid）',
+  creator_type  smallint       not null default 0  COMMENT '创建者类型 0.用户 1.后台',
+  from_uid      VARCHAR(40)    not null default '' COMMENT '消息发送者uid',
+  channel_id    VARCHAR(100)   not null default '' COMMENT '频道ID',
+  channel_type  smallint       not null default 0  COMMENT '频道类型',
+  payload       TEXT                               COMMENT '消息内容',
+  send_at       bigint         not null default 0  COMMENT '下次发送时间 时间戳（秒）',
+  cron          VARCHAR(100)   not null default '' COMMENT '重复发送的cron表达式 为空则只发送一次',
+  status        smallint       not null default 0  COMMENT '状态 0.待发送 1.已发送 2.已取消 3.发送失败',
+  sent_count    integer        not null default 0  COMMENT '已发送次数',
+  last_sent_at  bigint         not null default 0  COMMENT '最后一次发送时间',
+  fail_reason   VARCHAR(255)   not null default '' COMMENT '失败原因',
+  version       bigint         not null default 0  COMMENT '同步版本号',
+  created_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE INDEX message_scheduled_status_send_at on `message_scheduled` (status, send_at);
+CREATE INDEX message_scheduled_uid_version on `message_scheduled` (uid, version);
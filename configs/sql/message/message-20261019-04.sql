@@ -0,0 +1,18 @@
+-- +migrate Up
+
+-- 置顶消息
+create table `pinned_message`
+(
+  id            bigint         not null primary key AUTO_INCREMENT,
+  message_id    bigint         not null default 0  COMMENT '消息唯一ID',
+  message_seq   bigint         not null default 0  COMMENT '消息序列号',
+  channel_id    VARCHAR(100)   not null default '' COMMENT '频道ID（个人频道为fake channel id）',
+  channel_type  smallint       not null default 0  COMMENT '频道类型',
+  pinner_uid    VARCHAR(40)    not null default '' COMMENT '置顶操作者uid',
+  is_deleted    smallint       not null default 0  COMMENT '是否已取消置顶',
+  version       bigint         not null default 0  COMMENT '同步版本号',
+  created_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX pinned_message_message_id on `pinned_message` (message_id);
+CREATE INDEX pinned_message_channel_version on `pinned_message` (channel_id, channel_type, version);
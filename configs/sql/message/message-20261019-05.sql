@@ -0,0 +1,48 @@
+-- +migrate Up
+
+-- 话题回复（回复消息存储在分区消息表中，通过root_message_id关联话题根消息）
+ALTER TABLE `message` ADD COLUMN root_message_id VARCHAR(20) NOT NULL DEFAULT '' COMMENT '话题根消息ID';
+ALTER TABLE `message1` ADD COLUMN root_message_id VARCHAR(20) NOT NULL DEFAULT '' COMMENT '话题根消息ID';
+ALTER TABLE `message2` ADD COLUMN root_message_id VARCHAR(20) NOT NULL DEFAULT '' COMMENT '话题根消息ID';
+ALTER TABLE `message3` ADD COLUMN root_message_id VARCHAR(20) NOT NULL DEFAULT '' COMMENT '话题根消息ID';
+ALTER TABLE `message4` ADD COLUMN root_message_id VARCHAR(20) NOT NULL DEFAULT '' COMMENT '话题根消息ID';
+CREATE INDEX message_root_message_id on `message` (root_message_id, message_seq);
+CREATE INDEX message1_root_message_id on `message1` (root_message_id, message_seq);
+CREATE INDEX message2_root_message_id on `message2` (root_message_id, message_seq);
+CREATE INDEX message3_root_message_id on `message3` (root_message_id, message_seq);
+CREATE INDEX message4_root_message_id on `message4` (root_message_id, message_seq);
+
+-- 话题
+create table `message_thread`
+(
+  id                     bigint         not null primary key AUTO_INCREMENT,
+  root_message_id        bigint         not null default 0  COMMENT '话题根消息ID',
+  root_message_seq       bigint         not null default 0  COMMENT '话题根消息序列号',
+  channel_id             VARCHAR(100)   not null default '' COMMENT '频道ID（个人频道为fake channel id）',
+  channel_type           smallint       not null default 0  COMMENT '频道类型',
+  creator_uid            VARCHAR(40)    not null default '' COMMENT '根消息发送者uid',
+  reply_count            integer        not null default 0  COMMENT '回复数量',
+  last_reply_message_id  bigint         not null default 0  COMMENT '最后一条回复的消息ID',
+  last_reply_message_seq bigint         not null default 0  COMMENT '最后一条回复的消息序列号',
+  last_reply_uid         VARCHAR(40)    not null default '' COMMENT '最后一条回复的发送者uid',
+  last_reply_at          bigint         not null default 0  COMMENT '最后回复时间 时间戳（秒）',
+  version                bigint         not null default 0  COMMENT '同步版本号',
+  created_at             timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at             timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_thread_root_message_id on `message_thread` (root_message_id);
+
+-- 话题参与者
+create table `message_thread_member`
+(
+  id                bigint         not null primary key AUTO_INCREMENT,
+  root_message_id   bigint         not null default 0  COMMENT '话题根消息ID',
+  uid               VARCHAR(40)    not null default '' COMMENT '参与者uid',
+  read_message_seq  bigint         not null default 0  COMMENT '已读到的回复消息序列号',
+  unread_count      integer        not null default 0  COMMENT '未读回复数量',
+  version           bigint         not null default 0  COMMENT '同步版本号',
+  created_at        timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at        timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_thread_member_root_uid on `message_thread_member` (root_message_id, uid);
+CREATE INDEX message_thread_member_uid_version on `message_thread_member` (uid, version);
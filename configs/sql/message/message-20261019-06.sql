@@ -0,0 +1,41 @@
+-- +migrate Up
+
+-- 投票
+create table `message_poll`
+(
+  id            bigint         not null primary key AUTO_INCREMENT,
+  poll_no       VARCHAR(40)    not null default '' COMMENT '投票唯一编号',
+  message_id    bigint         not null default 0  COMMENT '投票消息ID',
+  message_seq   bigint         not null default 0  COMMENT '投票消息序列号',
+  channel_id    VARCHAR(100)   not null default '' COMMENT '频道ID（个人频道为fake channel id）',
+  channel_type  smallint       not null default 0  COMMENT '频道类型',
+  creator_uid   VARCHAR(40)    not null default '' COMMENT '发起人uid',
+  title         VARCHAR(255)   not null default '' COMMENT '投票标题',
+  options       TEXT                               COMMENT '选项 json数组',
+  multiple      smallint       not null default 0  COMMENT '是否多选',
+  anonymous     smallint       not null default 0  COMMENT '是否匿名',
+  deadline      bigint         not null default 0  COMMENT '截止时间 时间戳（秒） 0为不限',
+  is_closed     smallint       not null default 0  COMMENT '是否已结束',
+  closer_uid    VARCHAR(40)    not null default '' COMMENT '结束投票的操作者uid 到期自动结束为空',
+  closed_at     bigint         not null default 0  COMMENT '结束时间 时间戳（秒）',
+  created_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_poll_poll_no on `message_poll` (poll_no);
+CREATE INDEX message_poll_message_id on `message_poll` (message_id);
+CREATE INDEX message_poll_closed_deadline on `message_poll` (is_closed, deadline);
+
+-- 投票记录
+create table `message_poll_vote`
+(
+  id            bigint         not null primary key AUTO_INCREMENT,
+  poll_no       VARCHAR(40)    not null default '' COMMENT '投票唯一编号',
+  uid           VARCHAR(40)    not null default '' COMMENT '投票人uid',
+  option_id     integer        not null default 0  COMMENT '选项ID',
+  created_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_poll_vote_uid_option on `message_poll_vote` (poll_no, uid, option_id);
+
+-- 投票统计（通过消息扩展同步给客户端）
+ALTER TABLE `message_extra` ADD COLUMN poll TEXT COMMENT '投票统计 json';
@@ -0,0 +1,21 @@
+-- +migrate Up
+
+-- 最近会话归档
+ALTER TABLE `conversation_extra` ADD COLUMN archived smallint not null default 0 COMMENT '是否已归档 有新的@我时自动取消归档';
+
+-- 最近会话分组
+create table `conversation_folder`
+(
+  id            bigint         not null primary key AUTO_INCREMENT,
+  uid           VARCHAR(40)    not null default '' COMMENT '用户uid',
+  folder_no     VARCHAR(40)    not null default '' COMMENT '分组唯一编号',
+  name          VARCHAR(40)    not null default '' COMMENT '分组名称',
+  rules         TEXT                               COMMENT '包含规则 json',
+  sort          integer        not null default 0  COMMENT '排序 越小越靠前',
+  is_deleted    smallint       not null default 0  COMMENT '是否已删除',
+  version       bigint         not null default 0  COMMENT '同步版本号',
+  created_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at    timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX conversation_folder_folder_no on `conversation_folder` (folder_no);
+CREATE INDEX conversation_folder_uid_version on `conversation_folder` (uid, version);
@@ -0,0 +1,16 @@
+-- +migrate Up
+
+-- 最近会话计数（未读的@我、回复我、回应我的数量）
+create table `conversation_counter`
+(
+  id              bigint         not null primary key AUTO_INCREMENT,
+  uid             VARCHAR(40)    not null default '' COMMENT '用户uid',
+  channel_id      VARCHAR(100)   not null default '' COMMENT '用户视角下的频道ID 个人频道为对方uid',
+  channel_type    smallint       not null default 0  COMMENT '频道类型',
+  mention_count   integer        not null default 0  COMMENT '未读的@我数量',
+  reply_count     integer        not null default 0  COMMENT '未读的回复我数量',
+  reaction_count  integer        not null default 0  COMMENT '未读的回应我数量',
+  created_at      timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at      timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX conversation_counter_uid_channel on `conversation_counter` (uid, channel_id, channel_type);
@@ -0,0 +1,41 @@
+-- +migrate Up
+
+-- 最近会话自动翻译
+ALTER TABLE `conversation_extra` ADD COLUMN auto_translate smallint not null default 0 COMMENT '是否自动翻译此会话的消息';
+
+-- 消息翻译缓存
+CREATE TABLE `message_translation`(
+    id              bigint          not null primary key AUTO_INCREMENT,
+    message_id      VARCHAR(20)     not null default '' COMMENT '消息唯一ID',
+    target_lang     VARCHAR(20)     not null default '' COMMENT '目标语言',
+    source_lang     VARCHAR(20)     not null default '' COMMENT '源语言',
+    text            TEXT                                COMMENT '译文',
+    provider        VARCHAR(20)     not null default '' COMMENT '翻译提供商',
+    created_at      timeStamp       not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+    updated_at      timeStamp       not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_target_lang_uidx on `message_translation` (message_id,target_lang);
+
+CREATE TABLE `message_translation1`(
+    id              bigint          not null primary key AUTO_INCREMENT,
+    message_id      VARCHAR(20)     not null default '' COMMENT '消息唯一ID',
+    target_lang     VARCHAR(20)     not null default '' COMMENT '目标语言',
+    source_lang     VARCHAR(20)     not null default '' COMMENT '源语言',
+    text            TEXT                                COMMENT '译文',
+    provider        VARCHAR(20)     not null default '' COMMENT '翻译提供商',
+    created_at      timeStamp       not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+    updated_at      timeStamp       not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_target_lang_uidx on `message_translation1` (message_id,target_lang);
+
+CREATE TABLE `message_translation2`(
+    id              bigint          not null primary key AUTO_INCREMENT,
+    message_id      VARCHAR(20)     not null default '' COMMENT '消息唯一ID',
+    target_lang     VARCHAR(20)     not null default '' COMMENT '目标语言',
+    source_lang     VARCHAR(20)     not null default '' COMMENT '源语言',
+    text            TEXT                                COMMENT '译文',
+    provider        VARCHAR(20)     not null default '' COMMENT '翻译提供商',
+    created_at      timeStamp       not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+    updated_at      timeStamp       not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_target_lang_uidx on `message_translation2` (message_id,target_lang);
@@ -0,0 +1,20 @@
+-- +migrate Up
+
+-- 消息的链接预览
+ALTER TABLE `message_extra` ADD COLUMN link_preview TEXT COMMENT '链接预览 json';
+
+-- 链接预览缓存
+CREATE TABLE `link_preview`(
+    id              bigint          not null primary key AUTO_INCREMENT,
+    url_hash        VARCHAR(40)     not null default '' COMMENT '链接的md5',
+    url             VARCHAR(2000)   not null default '' COMMENT '链接',
+    title           VARCHAR(255)    not null default '' COMMENT '标题',
+    description     VARCHAR(1000)   not null default '' COMMENT '描述',
+    image           VARCHAR(255)    not null default '' COMMENT '预览图（已转存）',
+    site_name       VARCHAR(100)    not null default '' COMMENT '站点名称',
+    status          smallint        not null default 0  COMMENT '抓取状态 0.失败 1.成功',
+    fetched_at      bigint          not null default 0  COMMENT '抓取时间 时间戳（秒）',
+    created_at      timeStamp       not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+    updated_at      timeStamp       not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX link_preview_url_hash on `link_preview` (url_hash);
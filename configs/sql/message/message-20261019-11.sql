@@ -0,0 +1,5 @@
+-- +migrate Up
+
+-- 语音消息转文字
+ALTER TABLE `message_extra` ADD COLUMN transcript TEXT COMMENT '语音转写的文本';
+ALTER TABLE `message_extra` ADD COLUMN transcript_status smallint not null default 0 COMMENT '语音转写状态 0.未转写 1.转写成功 2.转写失败';
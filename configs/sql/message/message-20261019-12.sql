@@ -0,0 +1,6 @@
+-- +migrate Up
+
+-- 译文缓存记录原文的hash 消息编辑后原文变化则缓存失效
+ALTER TABLE `message_translation` ADD COLUMN content_hash VARCHAR(40) not null default '' COMMENT '原文的md5';
+ALTER TABLE `message_translation1` ADD COLUMN content_hash VARCHAR(40) not null default '' COMMENT '原文的md5';
+ALTER TABLE `message_translation2` ADD COLUMN content_hash VARCHAR(40) not null default '' COMMENT '原文的md5';
@@ -0,0 +1,6 @@
+-- +migrate Up
+
+-- 语音转写开始处理的时间 用于恢复服务重启时中断的转写任务
+ALTER TABLE `message_extra` ADD COLUMN transcript_at bigint not null default 0 COMMENT '开始转写的时间 时间戳（秒）';
+
+CREATE INDEX message_extra_transcript_status_at on `message_extra` (transcript_status, transcript_at);
@@ -0,0 +1,4 @@
+-- +migrate Up
+
+-- 话题参与者最后一次计入未读数的回复消息ID 防止webhook重复通知时重复计数
+ALTER TABLE `message_thread_member` ADD COLUMN counted_message_id bigint not null default 0 COMMENT '最后计入未读数的回复消息ID';
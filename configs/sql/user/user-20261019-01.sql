@@ -0,0 +1,15 @@
+-- +migrate Up
+
+-- 账号数据导出任务
+create table `user_export`
+(
+  id          bigint         not null primary key AUTO_INCREMENT,
+  uid         VARCHAR(40)    not null default '' COMMENT '用户uid',
+  status      smallint       not null default 0 COMMENT '状态 0.等待中 1.导出中 2.已完成 3.失败',
+  path        VARCHAR(255)   not null default '' COMMENT '导出文件存储路径',
+  size        bigint         not null default 0 COMMENT '导出文件大小',
+  fail_reason VARCHAR(255)   not null default '' COMMENT '失败原因',
+  created_at  timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at  timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE INDEX user_export_uid on `user_export` (uid);
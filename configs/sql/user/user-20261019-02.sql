@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- 账号注销申请（冷静期）
+create table `user_destroy`
+(
+  id         bigint         not null primary key AUTO_INCREMENT,
+  uid        VARCHAR(40)    not null default '' COMMENT '用户uid',
+  status     smallint       not null default 0 COMMENT '状态 0.冷静期中 1.已撤销 2.已清除',
+  purge_at   bigint         not null default 0 COMMENT '数据清除时间（时间戳 秒）',
+  created_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE INDEX user_destroy_uid on `user_destroy` (uid);
+CREATE INDEX user_destroy_status_purge_at on `user_destroy` (status,purge_at);
+
+-- 已注销账号墓碑
+create table `user_tombstone`
+(
+  id         bigint         not null primary key AUTO_INCREMENT,
+  uid        VARCHAR(40)    not null default '' COMMENT '用户uid',
+  created_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at timeStamp      not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX user_tombstone_uid on `user_tombstone` (uid);
@@ -0,0 +1,16 @@
+-- +migrate Up
+
+-- 登录日志增加设备和地理位置信息
+ALTER TABLE `login_log` ADD COLUMN device_id VARCHAR(40) NOT NULL DEFAULT '' COMMENT '设备ID';
+ALTER TABLE `login_log` ADD COLUMN device_name VARCHAR(100) NOT NULL DEFAULT '' COMMENT '设备名称';
+ALTER TABLE `login_log` ADD COLUMN device_model VARCHAR(100) NOT NULL DEFAULT '' COMMENT '设备型号';
+ALTER TABLE `login_log` ADD COLUMN device_flag smallint NOT NULL DEFAULT 0 COMMENT '设备标记 0.APP 1.WEB 2.PC';
+ALTER TABLE `login_log` ADD COLUMN country VARCHAR(20) NOT NULL DEFAULT '' COMMENT '国家代码';
+ALTER TABLE `login_log` ADD COLUMN province VARCHAR(100) NOT NULL DEFAULT '' COMMENT '省/州';
+ALTER TABLE `login_log` ADD COLUMN city VARCHAR(100) NOT NULL DEFAULT '' COMMENT '城市';
+ALTER TABLE `login_log` ADD COLUMN latitude DECIMAL(10,6) NOT NULL DEFAULT 0 COMMENT '纬度';
+ALTER TABLE `login_log` ADD COLUMN longitude DECIMAL(10,6) NOT NULL DEFAULT 0 COMMENT '经度';
+ALTER TABLE `login_log` ADD COLUMN new_device smallint NOT NULL DEFAULT 0 COMMENT '是否新设备';
+ALTER TABLE `login_log` ADD COLUMN new_country smallint NOT NULL DEFAULT 0 COMMENT '是否新国家';
+ALTER TABLE `login_log` ADD COLUMN impossible_travel smallint NOT NULL DEFAULT 0 COMMENT '是否异常位移（短时间内不可能到达的距离）';
+CREATE INDEX login_log_uid on `login_log` (uid);
@@ -0,0 +1,4 @@
+-- +migrate Up
+
+-- 用户偏好语言（消息翻译的目标语言）
+ALTER TABLE `user` ADD COLUMN language VARCHAR(20) NOT NULL DEFAULT '' COMMENT '偏好语言 如: en zh';
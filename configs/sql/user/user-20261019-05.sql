@@ -0,0 +1,6 @@
+-- +migrate Up
+
+-- 隐私设置：已读回执、输入中状态、最后在线时间可见范围
+ALTER TABLE `user` ADD COLUMN read_receipt smallint NOT NULL DEFAULT 1 COMMENT '是否发送已读回执 0.否 1.是';
+ALTER TABLE `user` ADD COLUMN typing_indicator smallint NOT NULL DEFAULT 1 COMMENT '是否发送输入中状态 0.否 1.是';
+ALTER TABLE `user` ADD COLUMN last_seen_visibility smallint NOT NULL DEFAULT 0 COMMENT '最后在线时间可见范围 0.所有人 1.好友 2.没有人';
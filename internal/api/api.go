@@ -4,8 +4,10 @@ import (
 	"github.com/WuKongIM/WuKongChatServer/internal/api/base/event"
 	"github.com/WuKongIM/WuKongChatServer/internal/api/channel"
 	"github.com/WuKongIM/WuKongChatServer/internal/api/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/api/favorite"
 	"github.com/WuKongIM/WuKongChatServer/internal/api/file"
 	"github.com/WuKongIM/WuKongChatServer/internal/api/group"
+	"github.com/WuKongIM/WuKongChatServer/internal/api/label"
 	"github.com/WuKongIM/WuKongChatServer/internal/api/message"
 	"github.com/WuKongIM/WuKongChatServer/internal/api/qrcode"
 	"github.com/WuKongIM/WuKongChatServer/internal/api/report"
@@ -67,6 +69,10 @@ func Init(ctx *config.Context) {
 	register.Add(robot.New(ctx))
 	// 机器人管理
 	register.Add(robot.NewManager(ctx))
+	// 收藏
+	register.Add(favorite.New(ctx))
+	// 联系人标签
+	register.Add(label.New(ctx))
 
 	//开始定时处理事件
 	cn := cron.New()
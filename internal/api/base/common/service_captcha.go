@@ -0,0 +1,287 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/log"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"go.uber.org/zap"
+)
+
+// CaptchaScene 图形验证场景
+type CaptchaScene string
+
+const (
+	// CaptchaSceneRegister 注册短信
+	CaptchaSceneRegister CaptchaScene = "register"
+	// CaptchaSceneForgetPwd 忘记密码短信
+	CaptchaSceneForgetPwd CaptchaScene = "forgetpwd"
+	// CaptchaSceneLoginCheckPhone 登录设备验证短信
+	CaptchaSceneLoginCheckPhone CaptchaScene = "login_check_phone"
+	// CaptchaSceneLogin 登录
+	CaptchaSceneLogin CaptchaScene = "login"
+)
+
+// Valid 是否为支持的场景
+func (c CaptchaScene) Valid() bool {
+	switch c {
+	case CaptchaSceneRegister, CaptchaSceneForgetPwd, CaptchaSceneLoginCheckPhone, CaptchaSceneLogin:
+		return true
+	}
+	return false
+}
+
+// CaptchaBind 图形验证绑定的请求对象 注册和忘记密码绑定手机号，登录设备验证绑定uid，登录绑定用户名
+func CaptchaBind(scene CaptchaScene, zone, phone, uid, username string) string {
+	switch scene {
+	case CaptchaSceneRegister, CaptchaSceneForgetPwd:
+		return fmt.Sprintf("%s%s", zone, phone)
+	case CaptchaSceneLoginCheckPhone:
+		return uid
+	case CaptchaSceneLogin:
+		return username
+	}
+	return ""
+}
+
+const (
+	captchaWidth     = 280 // 背景图宽
+	captchaHeight    = 160 // 背景图高
+	captchaPieceSize = 48  // 滑块边长
+)
+
+// ErrCaptchaInvalid 图形验证不通过
+var ErrCaptchaInvalid = errors.New("图形验证失败！")
+
+// Captcha 滑块验证
+type Captcha struct {
+	Token      string `json:"token"`       // 验证令牌
+	Background string `json:"background"`  // 带缺口的背景图（base64 png）
+	Piece      string `json:"piece"`       // 滑块图（base64 png）
+	PieceY     int    `json:"piece_y"`     // 滑块的纵坐标
+	Width      int    `json:"width"`       // 背景图宽
+	Height     int    `json:"height"`      // 背景图高
+	PieceSize  int    `json:"piece_size"`  // 滑块边长
+	ExpireSecs int    `json:"expire_secs"` // 有效期（秒）
+}
+
+// ICaptchaService 图形验证服务
+type ICaptchaService interface {
+	// 生成滑块验证 bind为验证绑定的请求对象（手机号、uid等）
+	Generate(scene CaptchaScene, bind string) (*Captcha, error)
+	// 校验滑块位置（一次性，校验后令牌失效）
+	Verify(scene CaptchaScene, bind string, token string, x int) error
+	// 当前请求是否需要图形验证
+	Need(ip string) (bool, error)
+	// 记录一次失败（密码错误、验证码错误等）
+	AddFailure(ip string)
+}
+
+// CaptchaService 图形验证服务
+type CaptchaService struct {
+	ctx *config.Context
+	log.Log
+}
+
+// NewCaptchaService 创建图形验证服务
+func NewCaptchaService(ctx *config.Context) *CaptchaService {
+	return &CaptchaService{
+		ctx: ctx,
+		Log: log.NewTLog("CaptchaService"),
+	}
+}
+
+// Generate 生成滑块验证
+func (s *CaptchaService) Generate(scene CaptchaScene, bind string) (*Captcha, error) {
+	bg, piece, x, y := newSliderCaptcha(rand.New(rand.NewSource(time.Now().UnixNano())))
+	bgStr, err := encodePNGBase64(bg)
+	if err != nil {
+		return nil, err
+	}
+	pieceStr, err := encodePNGBase64(piece)
+	if err != nil {
+		return nil, err
+	}
+	token := util.GenerUUID()
+	expire := s.ctx.GetConfig().CaptchaExpire
+	err = s.ctx.GetRedisConn().SetAndExpire(s.tokenKey(token), fmt.Sprintf("%s@%s@%d", scene, bind, x), expire)
+	if err != nil {
+		return nil, err
+	}
+	return &Captcha{
+		Token:      token,
+		Background: bgStr,
+		Piece:      pieceStr,
+		PieceY:     y,
+		Width:      captchaWidth,
+		Height:     captchaHeight,
+		PieceSize:  captchaPieceSize,
+		ExpireSecs: int(expire.Seconds()),
+	}, nil
+}
+
+// Verify 校验滑块位置
+func (s *CaptchaService) Verify(scene CaptchaScene, bind string, token string, x int) error {
+	if strings.TrimSpace(token) == "" {
+		return ErrCaptchaInvalid
+	}
+	cacheKey := s.tokenKey(token)
+	value, err := s.ctx.GetRedisConn().GetString(cacheKey)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return errors.New("图形验证已过期！")
+	}
+	err = s.ctx.GetRedisConn().Del(cacheKey)
+	if err != nil {
+		s.Warn("删除图形验证令牌失败！", zap.Error(err))
+	}
+	index := strings.LastIndex(value, "@")
+	if index == -1 || value[:index] != fmt.Sprintf("%s@%s", scene, bind) {
+		return ErrCaptchaInvalid
+	}
+	answer, _ := strconv.Atoi(value[index+1:])
+	diff := answer - x
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > s.ctx.GetConfig().CaptchaTolerance {
+		return ErrCaptchaInvalid
+	}
+	return nil
+}
+
+// Need 当前请求是否需要图形验证
+func (s *CaptchaService) Need(ip string) (bool, error) {
+	cfg := s.ctx.GetConfig()
+	if !cfg.CaptchaOn {
+		return false, nil
+	}
+	if cfg.CaptchaAlways {
+		return true, nil
+	}
+	risk, err := s.ctx.IsRiskIP(ip)
+	if err != nil {
+		return false, err
+	}
+	if risk {
+		return true, nil
+	}
+	countStr, err := s.ctx.GetRedisConn().GetString(s.failureKey(ip))
+	if err != nil {
+		return false, err
+	}
+	count, _ := strconv.Atoi(countStr)
+	return cfg.CaptchaFailThreshold > 0 && count >= cfg.CaptchaFailThreshold, nil
+}
+
+// AddFailure 记录一次失败
+func (s *CaptchaService) AddFailure(ip string) {
+	if ip == "" {
+		return
+	}
+	cacheKey := s.failureKey(ip)
+	count, err := s.ctx.GetRedisConn().Incr(cacheKey)
+	if err != nil {
+		s.Warn("记录失败次数失败！", zap.Error(err), zap.String("ip", ip))
+		return
+	}
+	if count == 1 {
+		err = s.ctx.GetRedisConn().Expire(cacheKey, s.ctx.GetConfig().CaptchaRiskExpire)
+		if err != nil {
+			s.Warn("设置失败次数有效期失败！", zap.Error(err), zap.String("ip", ip))
+		}
+	}
+}
+
+func (s *CaptchaService) tokenKey(token string) string {
+	return fmt.Sprintf("%stoken:%s", s.ctx.GetConfig().CaptchaPrefix, token)
+}
+
+func (s *CaptchaService) failureKey(ip string) string {
+	return fmt.Sprintf("%sfail:%s", s.ctx.GetConfig().CaptchaPrefix, ip)
+}
+
+// newSliderCaptcha 生成滑块验证图片 返回带缺口的背景图、滑块图以及缺口坐标
+func newSliderCaptcha(r *rand.Rand) (*image.RGBA, *image.RGBA, int, int) {
+	bg := image.NewRGBA(image.Rect(0, 0, captchaWidth, captchaHeight))
+
+	// 随机渐变底色
+	from := randColor(r)
+	to := randColor(r)
+	for px := 0; px < captchaWidth; px++ {
+		for py := 0; py < captchaHeight; py++ {
+			t := float64(px+py) / float64(captchaWidth+captchaHeight)
+			bg.Set(px, py, color.RGBA{
+				R: uint8(float64(from.R)*(1-t) + float64(to.R)*t),
+				G: uint8(float64(from.G)*(1-t) + float64(to.G)*t),
+				B: uint8(float64(from.B)*(1-t) + float64(to.B)*t),
+				A: 255,
+			})
+		}
+	}
+	// 随机色块干扰
+	for i := 0; i < 12; i++ {
+		w := 10 + r.Intn(50)
+		h := 10 + r.Intn(50)
+		px := r.Intn(captchaWidth - w)
+		py := r.Intn(captchaHeight - h)
+		draw.Draw(bg, image.Rect(px, py, px+w, py+h), &image.Uniform{C: randColor(r)}, image.Point{}, draw.Src)
+	}
+	// 随机噪点
+	for i := 0; i < captchaWidth*captchaHeight/20; i++ {
+		bg.Set(r.Intn(captchaWidth), r.Intn(captchaHeight), randColor(r))
+	}
+
+	// 缺口位置 横坐标避开起始区域
+	x := captchaPieceSize*2 + r.Intn(captchaWidth-captchaPieceSize*3)
+	y := r.Intn(captchaHeight - captchaPieceSize)
+	pieceRect := image.Rect(x, y, x+captchaPieceSize, y+captchaPieceSize)
+
+	piece := image.NewRGBA(image.Rect(0, 0, captchaPieceSize, captchaPieceSize))
+	draw.Draw(piece, piece.Bounds(), bg, pieceRect.Min, draw.Src)
+	drawBorder(piece, piece.Bounds(), color.RGBA{R: 255, G: 255, B: 255, A: 255})
+
+	// 缺口处变暗
+	draw.Draw(bg, pieceRect, &image.Uniform{C: color.RGBA{A: 150}}, image.Point{}, draw.Over)
+	drawBorder(bg, pieceRect, color.RGBA{R: 255, G: 255, B: 255, A: 180})
+
+	return bg, piece, x, y
+}
+
+func drawBorder(img *image.RGBA, rect image.Rectangle, c color.Color) {
+	for px := rect.Min.X; px < rect.Max.X; px++ {
+		img.Set(px, rect.Min.Y, c)
+		img.Set(px, rect.Max.Y-1, c)
+	}
+	for py := rect.Min.Y; py < rect.Max.Y; py++ {
+		img.Set(rect.Min.X, py, c)
+		img.Set(rect.Max.X-1, py, c)
+	}
+}
+
+func randColor(r *rand.Rand) color.RGBA {
+	return color.RGBA{R: uint8(r.Intn(256)), G: uint8(r.Intn(256)), B: uint8(r.Intn(256)), A: 255}
+}
+
+func encodePNGBase64(img image.Image) (string, error) {
+	buff := bytes.NewBuffer(nil)
+	err := png.Encode(buff, img)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("data:image/png;base64,%s", base64.StdEncoding.EncodeToString(buff.Bytes())), nil
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSliderCaptcha(t *testing.T) {
+	bg, piece, x, y := newSliderCaptcha(rand.New(rand.NewSource(1)))
+	assert.Equal(t, captchaWidth, bg.Bounds().Dx())
+	assert.Equal(t, captchaHeight, bg.Bounds().Dy())
+	assert.Equal(t, captchaPieceSize, piece.Bounds().Dx())
+	assert.True(t, x >= captchaPieceSize*2 && x+captchaPieceSize <= captchaWidth)
+	assert.True(t, y >= 0 && y+captchaPieceSize <= captchaHeight)
+
+	data, err := encodePNGBase64(piece)
+	assert.NoError(t, err)
+	assert.Contains(t, data, "data:image/png;base64,")
+}
+
+func TestCaptchaSceneValid(t *testing.T) {
+	assert.True(t, CaptchaSceneRegister.Valid())
+	assert.False(t, CaptchaScene("unknown").Valid())
+}
@@ -50,6 +50,8 @@ const (
 	FriendSure string = "friend.sure"
 	// FriendDelete 好友删除
 	FriendDelete string = "friend.delete"
+	// EventUserDestroy 用户注销（数据清除）
+	EventUserDestroy string = "user.destroy"
 )
 
 // Event 事件
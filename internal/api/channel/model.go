@@ -119,6 +119,7 @@ func newChannelRespWithGroupResp(groupResp *group.GroupResp) *channelResp {
 	extraMap["join_group_remind"] = groupResp.JoinGroupRemind
 	extraMap["chat_pwd_on"] = groupResp.ChatPwdOn
 	extraMap["allow_view_history_msg"] = groupResp.AllowViewHistoryMsg
+	extraMap["forbidden_forward"] = groupResp.ForbiddenForward
 	extraMap["group_type"] = groupResp.GroupType
 
 	if groupResp.MemberCount != 0 {
@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"time"
 
+	commonapi "github.com/WuKongIM/WuKongChatServer/internal/api/base/common"
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
 	"github.com/WuKongIM/WuKongChatServer/pkg/log"
 	"github.com/WuKongIM/WuKongChatServer/pkg/util"
@@ -23,17 +24,19 @@ import (
 type Common struct {
 	ctx *config.Context
 	log.Log
-	db          *db
-	appConfigDB *appConfigDB
+	db             *db
+	appConfigDB    *appConfigDB
+	captchaService commonapi.ICaptchaService
 }
 
 // New New
 func New(ctx *config.Context) *Common {
 	return &Common{
-		ctx:         ctx,
-		db:          newDB(ctx.DB()),
-		appConfigDB: newAppConfigDB(ctx),
-		Log:         log.NewTLog("common"),
+		ctx:            ctx,
+		db:             newDB(ctx.DB()),
+		appConfigDB:    newAppConfigDB(ctx),
+		captchaService: commonapi.NewCaptchaService(ctx),
+		Log:            log.NewTLog("common"),
 	}
 }
 
@@ -54,6 +57,8 @@ func (cn *Common) Route(r *wkhttp.WKHttp) {
 		commonNoAuth.GET("/appconfig", cn.appConfig) // app配置
 
 		commonNoAuth.GET("/updater/:os/:version", cn.updater) // 版本更新检查（兼容tauri）
+
+		commonNoAuth.POST("/captcha", cn.ctx.RateLimit("common.captcha"), cn.captchaGet) // 获取图形验证
 	}
 
 	r.GET("/v1/health", func(c *wkhttp.Context) {
@@ -247,6 +252,7 @@ func (cn *Common) appConfig(c *wkhttp.Context) {
 	var phoneSearchOff int
 	var shortnoEditOff int
 	var revokeSecond int
+	var editSecond int
 	if cn.ctx.GetConfig().PhoneSearchOff {
 		phoneSearchOff = 1
 	}
@@ -258,12 +264,18 @@ func (cn *Common) appConfig(c *wkhttp.Context) {
 	} else {
 		revokeSecond = appConfigM.RevokeSecond
 	}
+	if appConfigM.EditSecond == 0 {
+		editSecond = -1
+	} else {
+		editSecond = appConfigM.EditSecond
+	}
 	c.JSON(http.StatusOK, &appConfigResp{
 		Version:        appConfigM.Version,
 		PhoneSearchOff: phoneSearchOff,
 		ShortnoEditOff: shortnoEditOff,
 		WebURL:         cn.ctx.GetConfig().WebLoginURL,
 		RevokeSecond:   revokeSecond,
+		EditSecond:     editSecond,
 	})
 }
 
@@ -417,6 +429,7 @@ type appConfigResp struct {
 	PhoneSearchOff int    `json:"phone_search_off"`
 	ShortnoEditOff int    `json:"shortno_edit_off"`
 	RevokeSecond   int    `json:"revoke_second"`
+	EditSecond     int    `json:"edit_second"`
 }
 
 type appVersionReq struct {
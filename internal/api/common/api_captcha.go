@@ -0,0 +1,42 @@
+package common
+
+import (
+	"errors"
+	"strings"
+
+	commonapi "github.com/WuKongIM/WuKongChatServer/internal/api/base/common"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 获取图形验证（滑块）
+func (cn *Common) captchaGet(c *wkhttp.Context) {
+	var req struct {
+		Scene    string `json:"scene"`    // 场景 register.注册 forgetpwd.忘记密码 login_check_phone.登录设备验证 login.登录
+		Zone     string `json:"zone"`     // 区号（register、forgetpwd）
+		Phone    string `json:"phone"`    // 手机号（register、forgetpwd）
+		UID      string `json:"uid"`      // 用户uid（login_check_phone）
+		Username string `json:"username"` // 用户名（login）
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	scene := commonapi.CaptchaScene(req.Scene)
+	if !scene.Valid() {
+		c.ResponseError(errors.New("不支持的验证场景！"))
+		return
+	}
+	bind := commonapi.CaptchaBind(scene, strings.TrimSpace(req.Zone), strings.TrimSpace(req.Phone), strings.TrimSpace(req.UID), strings.TrimSpace(req.Username))
+	if bind == "" {
+		c.ResponseError(errors.New("验证对象不能为空！"))
+		return
+	}
+	captcha, err := cn.captchaService.Generate(scene, bind)
+	if err != nil {
+		cn.Error("生成图形验证失败！", zap.Error(err))
+		c.ResponseError(errors.New("生成图形验证失败！"))
+		return
+	}
+	c.Response(captcha)
+}
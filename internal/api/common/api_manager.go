@@ -195,6 +195,7 @@ func (m *Manager) updateConfig(c *wkhttp.Context) {
 	}
 	type reqVO struct {
 		RevokeSecond           int    `json:"revoke_second"`
+		EditSecond             int    `json:"edit_second"`
 		WelcomeMessage         string `json:"welcome_message"`
 		NewUserJoinSystemGroup int    `json:"new_user_join_system_group"`
 		SearchByPhone          int    `json:"search_by_phone"`
@@ -212,6 +213,7 @@ func (m *Manager) updateConfig(c *wkhttp.Context) {
 	}
 	configMap := map[string]interface{}{}
 	configMap["revoke_second"] = req.RevokeSecond
+	configMap["edit_second"] = req.EditSecond
 	configMap["welcome_message"] = req.WelcomeMessage
 	configMap["new_user_join_system_group"] = req.NewUserJoinSystemGroup
 	configMap["search_by_phone"] = req.SearchByPhone
@@ -236,11 +238,13 @@ func (m *Manager) appconfig(c *wkhttp.Context) {
 		return
 	}
 	var revokeSecond = 0
+	var editSecond = 0
 	var newUserJoinSystemGroup = 1
 	var welcomeMessage = ""
 	var searchByPhone = 1
 	if appconfig != nil {
 		revokeSecond = appconfig.RevokeSecond
+		editSecond = appconfig.EditSecond
 		welcomeMessage = appconfig.WelcomeMessage
 		newUserJoinSystemGroup = appconfig.NewUserJoinSystemGroup
 		searchByPhone = appconfig.SearchByPhone
@@ -253,6 +257,7 @@ func (m *Manager) appconfig(c *wkhttp.Context) {
 	}
 	c.Response(&managerAppConfigResp{
 		RevokeSecond:           revokeSecond,
+		EditSecond:             editSecond,
 		WelcomeMessage:         welcomeMessage,
 		NewUserJoinSystemGroup: newUserJoinSystemGroup,
 		SearchByPhone:          searchByPhone,
@@ -261,6 +266,7 @@ func (m *Manager) appconfig(c *wkhttp.Context) {
 
 type managerAppConfigResp struct {
 	RevokeSecond           int    `json:"revoke_second"`
+	EditSecond             int    `json:"edit_second"` // 0.不限制
 	WelcomeMessage         string `json:"welcome_message"`
 	NewUserJoinSystemGroup int    `json:"new_user_join_system_group"`
 	SearchByPhone          int    `json:"search_by_phone"`
@@ -42,6 +42,7 @@ type appConfigModel struct {
 	SuperToken             string
 	SuperTokenOn           int
 	RevokeSecond           int    // 消息可撤回时长
+	EditSecond             int    // 消息可编辑时长 0.不限制
 	WelcomeMessage         string // 登录欢迎语
 	NewUserJoinSystemGroup int    // 新用户是否加入系统群聊
 	SearchByPhone          int    // 是否可通过手机号搜索
@@ -59,6 +59,8 @@ func (s *service) GetAppConfig() (*AppConfigResp, error) {
 		Version:                appConfigM.Version,
 		SuperToken:             appConfigM.SuperToken,
 		SuperTokenOn:           appConfigM.SuperTokenOn,
+		RevokeSecond:           appConfigM.RevokeSecond,
+		EditSecond:             appConfigM.EditSecond,
 		WelcomeMessage:         appConfigM.WelcomeMessage,
 		NewUserJoinSystemGroup: appConfigM.NewUserJoinSystemGroup,
 		SearchByPhone:          appConfigM.SearchByPhone,
@@ -127,6 +129,8 @@ type AppConfigResp struct {
 	Version                int
 	SuperToken             string
 	SuperTokenOn           int
+	RevokeSecond           int    // 消息可撤回时长
+	EditSecond             int    // 消息可编辑时长 0.不限制
 	WelcomeMessage         string // 登录欢迎语
 	NewUserJoinSystemGroup int    // 新用户是否加入系统群聊
 	SearchByPhone          int    // 是否可通过手机号搜索
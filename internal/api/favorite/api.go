@@ -0,0 +1,333 @@
+package favorite
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/api/group"
+	"github.com/WuKongIM/WuKongChatServer/internal/api/message"
+	"github.com/WuKongIM/WuKongChatServer/internal/api/user"
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/log"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// Favorite 收藏
+type Favorite struct {
+	ctx *config.Context
+	log.Log
+	db             *db
+	messageService message.IService
+	userService    user.IService
+	groupService   group.IService
+}
+
+// New 创建收藏对象
+func New(ctx *config.Context) *Favorite {
+	return &Favorite{
+		ctx:            ctx,
+		Log:            log.NewTLog("Favorite"),
+		db:             newDB(ctx),
+		messageService: message.NewService(ctx),
+		userService:    user.NewService(ctx),
+		groupService:   group.NewService(ctx),
+	}
+}
+
+// Route 配置路由规则
+func (f *Favorite) Route(r *wkhttp.WKHttp) {
+	favorites := r.Group("/v1/favorites", r.AuthMiddleware(f.ctx.Cache(), f.ctx.GetConfig().TokenCachePrefix))
+	{
+		favorites.POST("", f.add)          // 添加收藏
+		favorites.GET("", f.list)          // 收藏列表
+		favorites.DELETE("/:id", f.delete) // 删除收藏
+	}
+	favorite := r.Group("/v1/favorite", r.AuthMiddleware(f.ctx.Cache(), f.ctx.GetConfig().TokenCachePrefix))
+	{
+		favorite.POST("/sync", f.sync) // 同步收藏
+	}
+}
+
+// 添加收藏 传message_id则收藏消息，否则收藏自定义内容
+func (f *Favorite) add(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req addReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	var m *model
+	var err error
+	if strings.TrimSpace(req.MessageID) != "" {
+		m, err = f.newMessageFavorite(&req, loginUID)
+	} else {
+		m, err = newPayloadFavorite(&req, loginUID, c.GetLoginName())
+	}
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	m.Version = f.genFavoriteSeq(loginUID)
+	err = f.db.insertOrUpdate(m)
+	if err != nil {
+		f.Error("添加收藏失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加收藏失败！"))
+		return
+	}
+	m, err = f.db.queryWithUniqueKey(loginUID, m.UniqueKey)
+	if err != nil {
+		f.Error("查询收藏失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询收藏失败！"))
+		return
+	}
+	f.sendSyncFavoriteCMD(loginUID)
+	c.Response(newFavoriteResp(m))
+}
+
+// 收藏列表
+func (f *Favorite) list(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	pageIndex, pageSize := c.GetPage()
+	favoriteType, _ := strconv.Atoi(c.Query("type"))
+	keyword := strings.TrimSpace(c.Query("keyword"))
+	models, err := f.db.queryWithPage(loginUID, favoriteType, keyword, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		f.Error("查询收藏失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询收藏失败！"))
+		return
+	}
+	count, err := f.db.queryCount(loginUID, favoriteType, keyword)
+	if err != nil {
+		f.Error("查询收藏数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询收藏数量失败！"))
+		return
+	}
+	list := make([]*favoriteResp, 0, len(models))
+	for _, m := range models {
+		list = append(list, newFavoriteResp(m))
+	}
+	c.Response(map[string]interface{}{
+		"list":  list,
+		"count": count,
+	})
+}
+
+// 删除收藏
+func (f *Favorite) delete(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.ResponseError(errors.New("收藏ID格式有误！"))
+		return
+	}
+	m, err := f.db.queryWithID(id)
+	if err != nil {
+		f.Error("查询收藏失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询收藏失败！"))
+		return
+	}
+	if m == nil || m.UID != loginUID {
+		c.ResponseError(errors.New("收藏不存在！"))
+		return
+	}
+	if m.IsDeleted == 1 {
+		c.ResponseOK()
+		return
+	}
+	err = f.db.updateDeleted(id, f.genFavoriteSeq(loginUID))
+	if err != nil {
+		f.Error("删除收藏失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除收藏失败！"))
+		return
+	}
+	f.sendSyncFavoriteCMD(loginUID)
+	c.ResponseOK()
+}
+
+// 同步收藏
+func (f *Favorite) sync(c *wkhttp.Context) {
+	var req struct {
+		Version int64  `json:"version"`
+		Limit   uint64 `json:"limit"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 500
+	}
+	models, err := f.db.sync(c.GetLoginUID(), req.Version, req.Limit)
+	if err != nil {
+		f.Error("同步收藏失败！", zap.Error(err))
+		c.ResponseError(errors.New("同步收藏失败！"))
+		return
+	}
+	list := make([]*favoriteResp, 0, len(models))
+	for _, m := range models {
+		if req.Version == 0 && m.IsDeleted == 1 { // 首次同步不需要已删除的
+			continue
+		}
+		list = append(list, newFavoriteResp(m))
+	}
+	c.Response(list)
+}
+
+// newMessageFavorite 收藏消息 只能收藏自己可见的消息
+func (f *Favorite) newMessageFavorite(req *addReq, loginUID string) (*model, error) {
+	if strings.TrimSpace(req.ChannelID) == "" || req.ChannelType == 0 {
+		return nil, errors.New("频道信息不能为空！")
+	}
+	if req.ChannelType == common.ChannelTypeGroup.Uint8() {
+		isMember, err := f.groupService.ExistMember(req.ChannelID, loginUID)
+		if err != nil {
+			f.Error("查询是否是群成员失败！", zap.Error(err))
+			return nil, errors.New("查询是否是群成员失败！")
+		}
+		if !isMember {
+			return nil, errors.New("不是群成员，不能收藏该消息！")
+		}
+		groupResp, err := f.groupService.GetGroupWithGroupNo(req.ChannelID)
+		if err != nil {
+			f.Error("查询群信息失败！", zap.Error(err))
+			return nil, errors.New("查询群信息失败！")
+		}
+		if groupResp != nil && groupResp.ForbiddenForward == 1 {
+			return nil, errors.New("该群已开启禁止转发，不能收藏群消息！")
+		}
+	}
+	messageResp, err := f.messageService.GetMessage(loginUID, req.ChannelID, req.ChannelType, req.MessageID)
+	if err != nil {
+		f.Error("查询消息失败！", zap.Error(err))
+		return nil, errors.New("查询消息失败！")
+	}
+	if messageResp == nil {
+		return nil, errors.New("消息不存在！")
+	}
+	if config.SettingFromUint8(messageResp.Setting).Signal {
+		return nil, errors.New("加密消息不支持收藏！")
+	}
+	var payload map[string]interface{}
+	if err := util.ReadJsonByByte(messageResp.Payload, &payload); err != nil {
+		return nil, errors.New("消息内容格式有误！")
+	}
+	authorName := ""
+	userResp, err := f.userService.GetUser(messageResp.FromUID)
+	if err != nil {
+		f.Warn("查询消息发送者失败！", zap.Error(err), zap.String("uid", messageResp.FromUID))
+	} else if userResp != nil {
+		authorName = userResp.Name
+	}
+	return &model{
+		Type:        payloadType(payload),
+		UID:         loginUID,
+		UniqueKey:   strconv.FormatInt(messageResp.MessageID, 10),
+		AuthorUID:   messageResp.FromUID,
+		AuthorName:  authorName,
+		Payload:     string(messageResp.Payload),
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		MessageID:   strconv.FormatInt(messageResp.MessageID, 10),
+		MessageSeq:  messageResp.MessageSeq,
+	}, nil
+}
+
+// newPayloadFavorite 收藏自定义内容
+func newPayloadFavorite(req *addReq, loginUID string, loginName string) (*model, error) {
+	if len(req.Payload) == 0 {
+		return nil, errors.New("收藏内容不能为空！")
+	}
+	uniqueKey := strings.TrimSpace(req.UniqueKey)
+	if uniqueKey == "" {
+		uniqueKey = util.GenerUUID()
+	}
+	if len(uniqueKey) > 40 {
+		return nil, errors.New("unique_key长度不能超过40！")
+	}
+	return &model{
+		Type:       payloadType(req.Payload),
+		UID:        loginUID,
+		UniqueKey:  uniqueKey,
+		AuthorUID:  loginUID,
+		AuthorName: loginName,
+		Payload:    util.ToJson(req.Payload),
+	}, nil
+}
+
+// payloadType 收藏内容的正文类型
+func payloadType(payload map[string]interface{}) int {
+	if payload == nil {
+		return 0
+	}
+	switch v := payload["type"].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+func (f *Favorite) sendSyncFavoriteCMD(uid string) {
+	err := f.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   uid,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		CMD:         common.CMDSyncFavorite,
+	})
+	if err != nil {
+		f.Error("发送同步收藏cmd失败！", zap.Error(err))
+	}
+}
+
+func (f *Favorite) genFavoriteSeq(uid string) int64 {
+	return f.ctx.GenSeq(fmt.Sprintf("%s:%s", common.FavoriteSeqKey, uid))
+}
+
+type addReq struct {
+	MessageID   string                 `json:"message_id"`   // 收藏的消息ID
+	ChannelID   string                 `json:"channel_id"`   // 消息所在频道
+	ChannelType uint8                  `json:"channel_type"` // 消息所在频道类型
+	UniqueKey   string                 `json:"unique_key"`   // 自定义收藏的唯一key（可选）
+	Payload     map[string]interface{} `json:"payload"`      // 自定义收藏内容
+}
+
+type favoriteResp struct {
+	ID          int64                  `json:"id"`
+	Type        int                    `json:"type"`
+	UniqueKey   string                 `json:"unique_key"`
+	AuthorUID   string                 `json:"author_uid"`
+	AuthorName  string                 `json:"author_name"`
+	Payload     map[string]interface{} `json:"payload"`
+	ChannelID   string                 `json:"channel_id,omitempty"`
+	ChannelType uint8                  `json:"channel_type,omitempty"`
+	MessageID   string                 `json:"message_id,omitempty"`
+	MessageSeq  uint32                 `json:"message_seq,omitempty"`
+	IsDeleted   int                    `json:"is_deleted"`
+	Version     int64                  `json:"version"`
+	CreatedAt   string                 `json:"created_at"`
+}
+
+func newFavoriteResp(m *model) *favoriteResp {
+	payload, _ := util.JsonToMap(m.Payload)
+	return &favoriteResp{
+		ID:          m.Id,
+		Type:        m.Type,
+		UniqueKey:   m.UniqueKey,
+		AuthorUID:   m.AuthorUID,
+		AuthorName:  m.AuthorName,
+		Payload:     payload,
+		ChannelID:   m.ChannelID,
+		ChannelType: m.ChannelType,
+		MessageID:   m.MessageID,
+		MessageSeq:  m.MessageSeq,
+		IsDeleted:   m.IsDeleted,
+		Version:     m.Version,
+		CreatedAt:   m.CreatedAt.String(),
+	}
+}
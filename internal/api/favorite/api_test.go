@@ -0,0 +1,44 @@
+package favorite
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/testutil"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddAndList(t *testing.T) {
+	s, ctx := testutil.NewTestServer()
+	f := New(ctx)
+	f.Route(s.GetRoute())
+
+	req, _ := http.NewRequest("POST", "/v1/favorites", bytes.NewReader([]byte(util.ToJson(map[string]interface{}{
+		"unique_key": "note1",
+		"payload": map[string]interface{}{
+			"type":    1,
+			"content": "hello favorite",
+		},
+	}))))
+	w := httptest.NewRecorder()
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/v1/favorites?type=1&keyword=hello", nil)
+	w = httptest.NewRecorder()
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, bytes.Contains(w.Body.Bytes(), []byte(`"count":1`)))
+}
+
+func TestPayloadType(t *testing.T) {
+	assert.Equal(t, 1, payloadType(map[string]interface{}{"type": float64(1)}))
+	assert.Equal(t, 2, payloadType(map[string]interface{}{"type": 2}))
+	assert.Equal(t, 0, payloadType(map[string]interface{}{"content": "x"}))
+	assert.Equal(t, 0, payloadType(nil))
+}
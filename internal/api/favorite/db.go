@@ -0,0 +1,94 @@
+package favorite
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	dba "github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type db struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newDB(ctx *config.Context) *db {
+	return &db{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+// insertOrUpdate 添加收藏 相同unique_key的收藏覆盖（已删除的恢复）
+func (d *db) insertOrUpdate(m *model) error {
+	_, err := d.session.InsertBySql("INSERT INTO favorite (type,uid,unique_key,author_uid,author_name,payload,channel_id,channel_type,message_id,message_seq,is_deleted,version) VALUES (?,?,?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE type=VALUES(type),author_uid=VALUES(author_uid),author_name=VALUES(author_name),payload=VALUES(payload),channel_id=VALUES(channel_id),channel_type=VALUES(channel_type),message_id=VALUES(message_id),message_seq=VALUES(message_seq),is_deleted=VALUES(is_deleted),version=VALUES(version)", m.Type, m.UID, m.UniqueKey, m.AuthorUID, m.AuthorName, m.Payload, m.ChannelID, m.ChannelType, m.MessageID, m.MessageSeq, m.IsDeleted, m.Version).Exec()
+	return err
+}
+
+func (d *db) queryWithUniqueKey(uid string, uniqueKey string) (*model, error) {
+	var m *model
+	_, err := d.session.Select("*").From("favorite").Where("uid=? and unique_key=?", uid, uniqueKey).Load(&m)
+	return m, err
+}
+
+func (d *db) queryWithID(id int64) (*model, error) {
+	var m *model
+	_, err := d.session.Select("*").From("favorite").Where("id=?", id).Load(&m)
+	return m, err
+}
+
+func (d *db) updateDeleted(id int64, version int64) error {
+	_, err := d.session.Update("favorite").SetMap(map[string]interface{}{
+		"is_deleted": 1,
+		"version":    version,
+	}).Where("id=?", id).Exec()
+	return err
+}
+
+// queryWithPage 分页查询收藏 type为0不过滤类型 keyword不为空则过滤收藏内容
+func (d *db) queryWithPage(uid string, favoriteType int, keyword string, pageSize, page uint64) ([]*model, error) {
+	var models []*model
+	_, err := d.buildQuery(d.session.Select("*"), uid, favoriteType, keyword).Offset((page-1)*pageSize).Limit(pageSize).OrderDir("id", false).Load(&models)
+	return models, err
+}
+
+func (d *db) queryCount(uid string, favoriteType int, keyword string) (int64, error) {
+	var count int64
+	_, err := d.buildQuery(d.session.Select("count(*)"), uid, favoriteType, keyword).Load(&count)
+	return count, err
+}
+
+func (d *db) buildQuery(builder *dbr.SelectStmt, uid string, favoriteType int, keyword string) *dbr.SelectStmt {
+	builder = builder.From("favorite").Where("uid=? and is_deleted=0", uid)
+	if favoriteType != 0 {
+		builder = builder.Where("type=?", favoriteType)
+	}
+	if keyword != "" {
+		likeKeyword := "%" + util.EscapeLike(keyword) + "%"
+		builder = builder.Where("(payload like ? or author_name like ?)", likeKeyword, likeKeyword)
+	}
+	return builder
+}
+
+// sync 同步收藏（包含已删除的，客户端据此移除）
+func (d *db) sync(uid string, version int64, limit uint64) ([]*model, error) {
+	var models []*model
+	_, err := d.session.Select("*").From("favorite").Where("uid=? and version>?", uid, version).OrderAsc("version").Limit(limit).Load(&models)
+	return models, err
+}
+
+type model struct {
+	Type        int    // 收藏类型（收藏内容的正文类型）
+	UID         string // 收藏者uid
+	UniqueKey   string // 唯一key 收藏消息时为消息ID
+	AuthorUID   string // 作者uid
+	AuthorName  string // 作者名字
+	Payload     string // 收藏内容
+	ChannelID   string
+	ChannelType uint8
+	MessageID   string
+	MessageSeq  uint32
+	IsDeleted   int
+	Version     int64
+	dba.BaseModel
+}
@@ -0,0 +1,430 @@
+package group
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 发布群公告
+func (g *Group) announcementAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req announcementReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if err := g.checkAnnouncementManager(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model := &AnnouncementModel{
+		AnnouncementNo: util.GenerUUID(),
+		GroupNo:        groupNo,
+		AuthorUID:      loginUID,
+		EditorUID:      loginUID,
+		Content:        req.Content,
+		IsPinned:       req.IsPinned,
+		RequireConfirm: req.RequireConfirm,
+	}
+	err := g.db.insertAnnouncement(model)
+	if err != nil {
+		g.Error("发布群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("发布群公告失败！"))
+		return
+	}
+	// 群公告消息推送时忽略群免打扰
+	err = g.ctx.SendMessage(&config.MsgSendReq{
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"content": "{0}发布了群公告",
+			"extra": []config.UserBaseVo{
+				{
+					UID:  loginUID,
+					Name: c.GetLoginName(),
+				},
+			},
+			"announcement_no": model.AnnouncementNo,
+			"text":            model.Content,
+			"require_confirm": model.RequireConfirm,
+			"type":            common.GroupAnnouncement,
+		})),
+	})
+	if err != nil {
+		g.Error("发送群公告消息失败！", zap.Error(err))
+	}
+	c.Response(map[string]interface{}{
+		"announcement_no": model.AnnouncementNo,
+	})
+}
+
+// 群公告列表
+func (g *Group) announcementList(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	if err := g.checkAnnouncementMember(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pageIndex, pageSize := c.GetPage()
+	models, err := g.db.queryAnnouncementsWithPage(groupNo, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		g.Error("查询群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群公告失败！"))
+		return
+	}
+	count, err := g.db.queryAnnouncementCount(groupNo)
+	if err != nil {
+		g.Error("查询群公告数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群公告数量失败！"))
+		return
+	}
+	announcementNos := make([]string, 0, len(models))
+	for _, model := range models {
+		announcementNos = append(announcementNos, model.AnnouncementNo)
+	}
+	acks, err := g.db.queryAnnouncementAcksWithUID(announcementNos, loginUID)
+	if err != nil {
+		g.Error("查询群公告已读记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群公告已读记录失败！"))
+		return
+	}
+	ackMap := make(map[string]*AnnouncementAckModel, len(acks))
+	for _, ack := range acks {
+		ackMap[ack.AnnouncementNo] = ack
+	}
+	list := make([]*announcementResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newAnnouncementResp(model, ackMap[model.AnnouncementNo]))
+	}
+	c.Response(map[string]interface{}{
+		"list":  list,
+		"count": count,
+	})
+}
+
+// 编辑群公告
+func (g *Group) announcementUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req announcementReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := g.checkAnnouncementManage(groupNo, c.Param("announcement_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	// 需要确认的公告内容有变化时，之前的已读/确认作废，成员需重新确认
+	resetAcks := req.RequireConfirm == 1 && req.Content != model.Content
+	tx, _ := g.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = g.db.updateAnnouncementContentTx(model.AnnouncementNo, req.Content, req.RequireConfirm, loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("编辑群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("编辑群公告失败！"))
+		return
+	}
+	if resetAcks {
+		err = g.db.deleteAnnouncementAcksTx(model.AnnouncementNo, tx)
+		if err != nil {
+			tx.Rollback()
+			g.Error("重置群公告确认记录失败！", zap.Error(err))
+			c.ResponseError(errors.New("重置群公告确认记录失败！"))
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	g.sendAnnouncementUpdateCMD(groupNo, model.AnnouncementNo)
+	c.ResponseOK()
+}
+
+// 删除群公告
+func (g *Group) announcementDelete(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	model, err := g.checkAnnouncementManage(groupNo, c.Param("announcement_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = g.db.deleteAnnouncement(model.AnnouncementNo)
+	if err != nil {
+		g.Error("删除群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除群公告失败！"))
+		return
+	}
+	g.sendAnnouncementUpdateCMD(groupNo, model.AnnouncementNo)
+	c.ResponseOK()
+}
+
+// 置顶或取消置顶群公告
+func (g *Group) announcementPin(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	on := c.Param("on")
+	model, err := g.checkAnnouncementManage(groupNo, c.Param("announcement_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	isPinned := 0
+	if on == "1" {
+		isPinned = 1
+	}
+	if model.IsPinned == isPinned {
+		c.ResponseOK()
+		return
+	}
+	err = g.db.updateAnnouncementPinned(model.AnnouncementNo, isPinned)
+	if err != nil {
+		g.Error("置顶群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("置顶群公告失败！"))
+		return
+	}
+	g.sendAnnouncementUpdateCMD(groupNo, model.AnnouncementNo)
+	c.ResponseOK()
+}
+
+// 标记群公告已读
+func (g *Group) announcementRead(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	model, err := g.checkAnnouncementAck(groupNo, c.Param("announcement_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = g.db.insertAnnouncementRead(model.AnnouncementNo, groupNo, loginUID)
+	if err != nil {
+		g.Error("标记群公告已读失败！", zap.Error(err))
+		c.ResponseError(errors.New("标记群公告已读失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 确认群公告
+func (g *Group) announcementConfirm(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	model, err := g.checkAnnouncementAck(groupNo, c.Param("announcement_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if model.RequireConfirm != 1 {
+		c.ResponseError(errors.New("该公告无需确认！"))
+		return
+	}
+	err = g.db.insertOrUpdateAnnouncementConfirm(model.AnnouncementNo, groupNo, loginUID)
+	if err != nil {
+		g.Error("确认群公告失败！", zap.Error(err))
+		c.ResponseError(errors.New("确认群公告失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 群公告已读/确认成员列表
+func (g *Group) announcementAcks(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	model, err := g.checkAnnouncementManage(groupNo, c.Param("announcement_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	acks, err := g.db.queryAnnouncementAcks(model.AnnouncementNo)
+	if err != nil {
+		g.Error("查询群公告已读记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群公告已读记录失败！"))
+		return
+	}
+	memberCount, err := g.db.QueryMemberCount(groupNo)
+	if err != nil {
+		g.Error("查询群成员数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群成员数量失败！"))
+		return
+	}
+	confirmedCount := 0
+	list := make([]*announcementAckResp, 0, len(acks))
+	for _, ack := range acks {
+		if ack.IsConfirmed == 1 {
+			confirmedCount++
+		}
+		list = append(list, &announcementAckResp{
+			UID:         ack.UID,
+			Name:        ack.Name,
+			IsConfirmed: ack.IsConfirmed,
+			ReadAt:      ack.CreatedAt.String(),
+		})
+	}
+	c.Response(map[string]interface{}{
+		"member_count":    memberCount,
+		"read_count":      len(acks),
+		"confirmed_count": confirmedCount,
+		"list":            list,
+	})
+}
+
+// checkAnnouncementManager 只有群主或管理员才能管理群公告
+func (g *Group) checkAnnouncementManager(groupNo string, uid string) error {
+	isManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, uid)
+	if err != nil {
+		g.Error("查询是否是群管理者失败！", zap.Error(err))
+		return errors.New("查询是否是群管理者失败！")
+	}
+	if !isManager {
+		return errors.New("只有群主或管理员才能管理群公告！")
+	}
+	return nil
+}
+
+func (g *Group) checkAnnouncementMember(groupNo string, uid string) error {
+	isMember, err := g.db.ExistMember(uid, groupNo)
+	if err != nil {
+		g.Error("查询是否是群成员失败！", zap.Error(err))
+		return errors.New("查询是否是群成员失败！")
+	}
+	if !isMember {
+		return errors.New("不是群成员！")
+	}
+	return nil
+}
+
+func (g *Group) queryAnnouncement(groupNo string, announcementNo string) (*AnnouncementModel, error) {
+	model, err := g.db.queryAnnouncementWithNo(announcementNo)
+	if err != nil {
+		g.Error("查询群公告失败！", zap.Error(err))
+		return nil, errors.New("查询群公告失败！")
+	}
+	if model == nil || model.GroupNo != groupNo {
+		return nil, errors.New("群公告不存在！")
+	}
+	return model, nil
+}
+
+func (g *Group) checkAnnouncementManage(groupNo string, announcementNo string, uid string) (*AnnouncementModel, error) {
+	if err := g.checkAnnouncementManager(groupNo, uid); err != nil {
+		return nil, err
+	}
+	return g.queryAnnouncement(groupNo, announcementNo)
+}
+
+func (g *Group) checkAnnouncementAck(groupNo string, announcementNo string, uid string) (*AnnouncementModel, error) {
+	if err := g.checkAnnouncementMember(groupNo, uid); err != nil {
+		return nil, err
+	}
+	return g.queryAnnouncement(groupNo, announcementNo)
+}
+
+// sendAnnouncementUpdateCMD 通知群成员群公告有变化
+func (g *Group) sendAnnouncementUpdateCMD(groupNo string, announcementNo string) {
+	err := g.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		CMD:         common.CMDGroupAnnouncementUpdate,
+		Param: map[string]interface{}{
+			"group_no":        groupNo,
+			"announcement_no": announcementNo,
+		},
+	})
+	if err != nil {
+		g.Error("发送群公告更新命令失败！", zap.Error(err))
+	}
+}
+
+type announcementReq struct {
+	Content        string `json:"content"`         // 公告内容
+	IsPinned       int    `json:"is_pinned"`       // 是否置顶（仅发布时有效）
+	RequireConfirm int    `json:"require_confirm"` // 是否需要群成员确认
+}
+
+func (a *announcementReq) check() error {
+	if strings.TrimSpace(a.Content) == "" {
+		return errors.New("公告内容不能为空！")
+	}
+	if len([]rune(a.Content)) > 5000 {
+		return errors.New("公告内容不能超过5000个字！")
+	}
+	if a.IsPinned != 0 && a.IsPinned != 1 {
+		return errors.New("is_pinned有误！")
+	}
+	if a.RequireConfirm != 0 && a.RequireConfirm != 1 {
+		return errors.New("require_confirm有误！")
+	}
+	return nil
+}
+
+type announcementResp struct {
+	AnnouncementNo string `json:"announcement_no"`
+	GroupNo        string `json:"group_no"`
+	AuthorUID      string `json:"author_uid"`
+	EditorUID      string `json:"editor_uid"`
+	Content        string `json:"content"`
+	IsPinned       int    `json:"is_pinned"`
+	RequireConfirm int    `json:"require_confirm"`
+	IsRead         int    `json:"is_read"`      // 当前用户是否已读
+	IsConfirmed    int    `json:"is_confirmed"` // 当前用户是否已确认
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+func newAnnouncementResp(m *AnnouncementModel, ack *AnnouncementAckModel) *announcementResp {
+	resp := &announcementResp{
+		AnnouncementNo: m.AnnouncementNo,
+		GroupNo:        m.GroupNo,
+		AuthorUID:      m.AuthorUID,
+		EditorUID:      m.EditorUID,
+		Content:        m.Content,
+		IsPinned:       m.IsPinned,
+		RequireConfirm: m.RequireConfirm,
+		CreatedAt:      m.CreatedAt.String(),
+		UpdatedAt:      m.UpdatedAt.String(),
+	}
+	if ack != nil {
+		resp.IsRead = 1
+		resp.IsConfirmed = ack.IsConfirmed
+	}
+	return resp
+}
+
+type announcementAckResp struct {
+	UID         string `json:"uid"`
+	Name        string `json:"name"`
+	IsConfirmed int    `json:"is_confirmed"`
+	ReadAt      string `json:"read_at"`
+}
@@ -0,0 +1,119 @@
+package group
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+// insertAnnouncement 添加群公告
+func (d *DB) insertAnnouncement(model *AnnouncementModel) error {
+	_, err := d.session.InsertInto("group_announcement").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// queryAnnouncementWithNo 通过公告编号查询公告
+func (d *DB) queryAnnouncementWithNo(announcementNo string) (*AnnouncementModel, error) {
+	var model *AnnouncementModel
+	_, err := d.session.Select("*").From("group_announcement").Where("announcement_no=? and is_deleted=0", announcementNo).Load(&model)
+	return model, err
+}
+
+// queryAnnouncementsWithPage 分页查询群公告 置顶的在前
+func (d *DB) queryAnnouncementsWithPage(groupNo string, pageSize, page uint64) ([]*AnnouncementModel, error) {
+	var models []*AnnouncementModel
+	_, err := d.session.Select("*").From("group_announcement").Where("group_no=? and is_deleted=0", groupNo).OrderDir("is_pinned", false).OrderDir("id", false).Offset((page - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// queryAnnouncementCount 查询群公告数量
+func (d *DB) queryAnnouncementCount(groupNo string) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_announcement").Where("group_no=? and is_deleted=0", groupNo).Load(&count)
+	return count, err
+}
+
+// updateAnnouncementContentTx 修改公告内容
+func (d *DB) updateAnnouncementContentTx(announcementNo string, content string, requireConfirm int, editorUID string, tx *dbr.Tx) error {
+	_, err := tx.Update("group_announcement").SetMap(map[string]interface{}{
+		"content":         content,
+		"require_confirm": requireConfirm,
+		"editor_uid":      editorUID,
+	}).Where("announcement_no=?", announcementNo).Exec()
+	return err
+}
+
+// deleteAnnouncementAcksTx 清空公告的已读/确认记录
+func (d *DB) deleteAnnouncementAcksTx(announcementNo string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("group_announcement_ack").Where("announcement_no=?", announcementNo).Exec()
+	return err
+}
+
+// updateAnnouncementPinned 置顶或取消置顶公告
+func (d *DB) updateAnnouncementPinned(announcementNo string, isPinned int) error {
+	_, err := d.session.Update("group_announcement").Set("is_pinned", isPinned).Where("announcement_no=?", announcementNo).Exec()
+	return err
+}
+
+// deleteAnnouncement 删除公告
+func (d *DB) deleteAnnouncement(announcementNo string) error {
+	_, err := d.session.Update("group_announcement").Set("is_deleted", 1).Where("announcement_no=?", announcementNo).Exec()
+	return err
+}
+
+// insertAnnouncementRead 记录成员已读公告
+func (d *DB) insertAnnouncementRead(announcementNo string, groupNo string, uid string) error {
+	_, err := d.session.InsertBySql("INSERT IGNORE INTO group_announcement_ack (announcement_no,group_no,uid) VALUES (?,?,?)", announcementNo, groupNo, uid).Exec()
+	return err
+}
+
+// insertOrUpdateAnnouncementConfirm 记录成员已确认公告
+func (d *DB) insertOrUpdateAnnouncementConfirm(announcementNo string, groupNo string, uid string) error {
+	_, err := d.session.InsertBySql("INSERT INTO group_announcement_ack (announcement_no,group_no,uid,is_confirmed) VALUES (?,?,?,1) ON DUPLICATE KEY UPDATE is_confirmed=1", announcementNo, groupNo, uid).Exec()
+	return err
+}
+
+// queryAnnouncementAcks 查询公告的已读/确认记录
+func (d *DB) queryAnnouncementAcks(announcementNo string) ([]*AnnouncementAckDetailModel, error) {
+	var models []*AnnouncementAckDetailModel
+	_, err := d.session.Select("group_announcement_ack.*,IFNULL(user.name,'') name").From("group_announcement_ack").LeftJoin("user", "group_announcement_ack.uid=user.uid").Where("group_announcement_ack.announcement_no=?", announcementNo).OrderAsc("group_announcement_ack.id").Load(&models)
+	return models, err
+}
+
+// queryAnnouncementAcksWithUID 查询某个成员对一批公告的已读/确认记录
+func (d *DB) queryAnnouncementAcksWithUID(announcementNos []string, uid string) ([]*AnnouncementAckModel, error) {
+	if len(announcementNos) == 0 {
+		return nil, nil
+	}
+	var models []*AnnouncementAckModel
+	_, err := d.session.Select("*").From("group_announcement_ack").Where("announcement_no in ? and uid=?", announcementNos, uid).Load(&models)
+	return models, err
+}
+
+// AnnouncementModel 群公告
+type AnnouncementModel struct {
+	AnnouncementNo string // 公告编号
+	GroupNo        string // 群编号
+	AuthorUID      string // 发布者
+	EditorUID      string // 最后编辑者
+	Content        string // 公告内容
+	IsPinned       int    // 是否置顶
+	RequireConfirm int    // 是否需要确认
+	IsDeleted      int    // 是否已删除
+	db.BaseModel
+}
+
+// AnnouncementAckModel 群公告已读/确认记录
+type AnnouncementAckModel struct {
+	AnnouncementNo string // 公告编号
+	GroupNo        string // 群编号
+	UID            string // 成员uid
+	IsConfirmed    int    // 是否已确认
+	db.BaseModel
+}
+
+// AnnouncementAckDetailModel 群公告已读/确认记录详情
+type AnnouncementAckDetailModel struct {
+	AnnouncementAckModel
+	Name string // 成员名字
+}
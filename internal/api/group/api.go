@@ -53,6 +53,7 @@ func New(ctx *config.Context) *Group {
 	}
 	g.ctx.AddEventListener(event.EventUserRegister, g.handleRegisterUserEvent)
 	g.ctx.AddEventListener(event.GroupMemberAdd, g.handleGroupMemberAddEvent)
+	g.ctx.AddEventListener(event.EventUserDestroy, g.handleUserDestroyEvent)
 	source.SetGroupMemberProvider(g)
 	return g
 }
@@ -68,26 +69,39 @@ func (g *Group) Route(r *wkhttp.WKHttp) {
 	groups := r.Group("/v1/groups", r.AuthMiddleware(g.ctx.Cache(), g.ctx.GetConfig().TokenCachePrefix))
 	{
 
-		groups.POST("/:group_no/members", g.memberAdd)                                     // 添加群成员
-		groups.DELETE("/:group_no/members", g.memberRemove)                                // 移除群成员
-		groups.GET("/:group_no/members", g.membersGet)                                     // 获取群成员
-		groups.POST("/:group_no/members_delete", g.memberRemove)                           // 移除群成员
-		groups.GET("/:group_no/membersync", g.syncMembers)                                 // 同步群成员
-		groups.GET("/:group_no", g.groupGet)                                               // 获取群信息
-		groups.PUT("/:group_no/setting", g.groupSettingUpdate)                             // 修改群设置
-		groups.PUT("/:group_no", g.groupUpdate)                                            // 修改群信息
-		groups.PUT("/:group_no/members/:uid", g.memberUpdate)                              // 修改群的群成员信息
-		groups.POST("/:group_no/exit", g.groupExit)                                        // 退出群聊
-		groups.POST("/:group_no/managers", g.managerAdd)                                   // 添加群管理员
-		groups.DELETE("/:group_no/managers", g.managerRemove)                              // 移除群管理员
-		groups.POST("/:group_no/forbidden/:on", g.groupForbidden)                          // 群全员禁言
-		groups.GET("/:group_no/qrcode", g.groupQRCode)                                     // 获取群二维码信息
-		groups.POST("/:group_no/transfer/:to_uid", g.transferGrouper)                      // 群主转让
-		groups.POST("/:group_no/member/invite", g.groupMemberInviteAdd)                    // 群成员邀请
-		groups.GET("/:group_no/member/h5confirm", g.getToGroupMemberConfirmInviteDetailH5) // 获取确认邀请的h5页面
-		groups.POST("/:group_no/blacklist/:action", g.blacklist)                           // 添加或移除黑名单
-		groups.POST("/:group_no/forbidden_with_member", g.forbiddenWithGroupMember)        // 禁言或解禁某个群成员
-		groups.POST("/:group_no/avatar", g.avatarUpload)                                   // 上传群头像
+		groups.POST("/:group_no/members", g.memberAdd)                                          // 添加群成员
+		groups.DELETE("/:group_no/members", g.memberRemove)                                     // 移除群成员
+		groups.GET("/:group_no/members", g.membersGet)                                          // 获取群成员
+		groups.POST("/:group_no/members_delete", g.memberRemove)                                // 移除群成员
+		groups.GET("/:group_no/membersync", g.syncMembers)                                      // 同步群成员
+		groups.GET("/:group_no", g.groupGet)                                                    // 获取群信息
+		groups.PUT("/:group_no/setting", g.groupSettingUpdate)                                  // 修改群设置
+		groups.PUT("/:group_no", g.groupUpdate)                                                 // 修改群信息
+		groups.PUT("/:group_no/members/:uid", g.memberUpdate)                                   // 修改群的群成员信息
+		groups.POST("/:group_no/exit", g.groupExit)                                             // 退出群聊
+		groups.POST("/:group_no/managers", g.managerAdd)                                        // 添加群管理员
+		groups.DELETE("/:group_no/managers", g.managerRemove)                                   // 移除群管理员
+		groups.PUT("/:group_no/managers/:uid/permissions", g.managerPermissionsUpdate)          // 修改管理员权限
+		groups.POST("/:group_no/forbidden/:on", g.groupForbidden)                               // 群全员禁言
+		groups.GET("/:group_no/qrcode", g.groupQRCode)                                          // 获取群二维码信息
+		groups.POST("/:group_no/transfer/:to_uid", g.transferGrouper)                           // 群主转让
+		groups.POST("/:group_no/member/invite", g.groupMemberInviteAdd)                         // 群成员邀请
+		groups.GET("/:group_no/member/h5confirm", g.getToGroupMemberConfirmInviteDetailH5)      // 获取确认邀请的h5页面
+		groups.POST("/:group_no/blacklist/:action", g.blacklist)                                // 添加或移除黑名单
+		groups.POST("/:group_no/forbidden_with_member", g.forbiddenWithGroupMember)             // 禁言或解禁某个群成员
+		groups.POST("/:group_no/avatar", g.avatarUpload)                                        // 上传群头像
+		groups.POST("/:group_no/join_requests", g.joinRequestAdd)                               // 申请入群
+		groups.GET("/:group_no/join_requests", g.joinRequestList)                               // 入群申请列表
+		groups.POST("/:group_no/join_requests/:request_no/approve", g.joinRequestApprove)       // 同意入群申请
+		groups.POST("/:group_no/join_requests/:request_no/reject", g.joinRequestReject)         // 拒绝入群申请
+		groups.POST("/:group_no/announcements", g.announcementAdd)                              // 发布群公告
+		groups.GET("/:group_no/announcements", g.announcementList)                              // 群公告列表
+		groups.PUT("/:group_no/announcements/:announcement_no", g.announcementUpdate)           // 编辑群公告
+		groups.DELETE("/:group_no/announcements/:announcement_no", g.announcementDelete)        // 删除群公告
+		groups.POST("/:group_no/announcements/:announcement_no/pin/:on", g.announcementPin)     // 置顶或取消置顶群公告
+		groups.POST("/:group_no/announcements/:announcement_no/read", g.announcementRead)       // 标记群公告已读
+		groups.POST("/:group_no/announcements/:announcement_no/confirm", g.announcementConfirm) // 确认群公告
+		groups.GET("/:group_no/announcements/:announcement_no/acks", g.announcementAcks)        // 群公告已读/确认成员
 	}
 	openGroups := r.Group("/v1/groups")
 	{ // 获取群头像
@@ -102,6 +116,7 @@ func (g *Group) Route(r *wkhttp.WKHttp) {
 		openGroup.POST("invite/sure", g.groupMemberInviteSure)         // 确认邀请
 	}
 	go g.CheckForbiddenLoop()
+	g.ctx.Schedule(g.ctx.GetConfig().GroupJoinRequestCheckInterval, g.joinRequestExpireCheck)
 }
 
 func (g *Group) membersGet(c *wkhttp.Context) {
@@ -552,16 +567,18 @@ func (g *Group) groupUpdate(c *wkhttp.Context) {
 		c.ResponseError(errors.New("群不存在！"))
 		return
 	}
-	// 查询是否是管理者
-	isManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
-	if err != nil {
-		g.Error("查询是否是群管理者失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询是否是群管理者失败！"))
-		return
-	}
-	if !isManager {
-		c.ResponseError(errors.New("只有群管理者才能修改！"))
-		return
+	// 查询是否有修改群信息的权限 发言限制类设置与设置接口一致需要禁言权限
+	for _, permission := range groupUpdatePermissions(groupMap) {
+		hasPermission, err := g.db.QueryHasManagerPermission(groupNo, loginUID, permission)
+		if err != nil {
+			g.Error("查询是否是群管理者失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询是否是群管理者失败！"))
+			return
+		}
+		if !hasPermission {
+			c.ResponseError(errors.New("没有修改群信息的权限！"))
+			return
+		}
 	}
 
 	version := g.ctx.GenSeq(common.GroupSeqKey)
@@ -582,6 +599,30 @@ func (g *Group) groupUpdate(c *wkhttp.Context) {
 			invite, _ := strconv.ParseInt(value, 10, 64)
 			group.Invite = int(invite)
 			break
+		case common.GroupAttrKeyJoinMode:
+			joinMode, _ := strconv.ParseInt(value, 10, 64)
+			if !JoinMode(joinMode).Valid() {
+				c.ResponseError(errors.New("入群方式有误！"))
+				return
+			}
+			group.JoinMode = int(joinMode)
+			break
+		case common.GroupAttrKeySlowMode:
+			slowMode, _ := strconv.ParseInt(value, 10, 64)
+			if slowMode < 0 || slowMode > SlowModeMax {
+				c.ResponseError(errors.New("慢速模式间隔有误！"))
+				return
+			}
+			group.SlowMode = int(slowMode)
+			break
+		case common.GroupAttrKeyNewMemberProbation:
+			probation, _ := strconv.ParseInt(value, 10, 64)
+			if probation < 0 || probation > NewMemberProbationMax {
+				c.ResponseError(errors.New("新成员观察期有误！"))
+				return
+			}
+			group.NewMemberProbation = int(probation)
+			break
 		}
 	}
 	tx, err := g.ctx.DB().Begin()
@@ -619,10 +660,31 @@ func (g *Group) groupUpdate(c *wkhttp.Context) {
 		return
 	}
 	g.ctx.EventCommit(eventID)
+	deleteSendLimitCache(g.ctx, groupNo)
 
 	c.ResponseOK()
 }
 
+// groupUpdatePermissions 修改群信息需要的管理权限
+func groupUpdatePermissions(groupMap map[string]string) []ManagerPermission {
+	var editInfo, mute bool
+	for key := range groupMap {
+		if key == common.GroupAttrKeySlowMode || key == common.GroupAttrKeyNewMemberProbation {
+			mute = true
+		} else {
+			editInfo = true
+		}
+	}
+	permissions := make([]ManagerPermission, 0, 2)
+	if editInfo {
+		permissions = append(permissions, ManagerPermissionEditInfo)
+	}
+	if mute {
+		permissions = append(permissions, ManagerPermissionMute)
+	}
+	return permissions
+}
+
 // 添加成员
 func (g *Group) memberAdd(c *wkhttp.Context) {
 	operator := c.MustGet("uid").(string)
@@ -655,7 +717,7 @@ func (g *Group) memberAdd(c *wkhttp.Context) {
 	判断群是否开启了邀请模式 如果开启了 再判断邀请的人是否是群主或管理员 如果不是则不允许直接添加群成员
 	**/
 	if group.Invite == 1 {
-		creatorOrManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, operator)
+		creatorOrManager, err := g.db.QueryHasManagerPermission(groupNo, operator, ManagerPermissionInvite)
 		if err != nil {
 			g.Error("查询是否是创建者和管理者失败！", zap.Error(err))
 			c.ResponseError(errors.New("查询是否是创建者和管理者失败！"))
@@ -1126,14 +1188,14 @@ func (g *Group) groupForbidden(c *wkhttp.Context) {
 	loginName := c.MustGet("name").(string)
 	groupNo := c.Param("group_no")
 	on := c.Param("on")
-	isCreatorOrManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
+	isCreatorOrManager, err := g.db.QueryHasManagerPermission(groupNo, loginUID, ManagerPermissionMute)
 	if err != nil {
 		g.Error("查询是否是创建者失败！", zap.Error(err))
 		c.ResponseError(errors.New("查询是否是创建者失败！"))
 		return
 	}
 	if !isCreatorOrManager {
-		c.ResponseError(errors.New("只有创建者或管理员才能禁言！"))
+		c.ResponseError(errors.New("只有创建者或有禁言权限的管理员才能禁言！"))
 		return
 	}
 	groupModel, err := g.db.QueryWithGroupNo(groupNo)
@@ -1320,6 +1382,31 @@ func (g *Group) groupScanJoin(c *wkhttp.Context) {
 		c.ResponseError(errors.New("已经在群内，不能再加入！"))
 		return
 	}
+	group, err := g.db.QueryWithGroupNo(groupNo)
+	if err != nil {
+		g.Error("查询群信息失败！", zap.Error(err), zap.String("groupNo", groupNo))
+		c.ResponseError(errors.New("查询群信息失败！"))
+		return
+	}
+	if group == nil {
+		c.ResponseError(errors.New("群不存在！"))
+		return
+	}
+	switch JoinMode(group.JoinMode) {
+	case JoinModeInvite:
+		c.ResponseError(errors.New("该群仅限邀请加入！"))
+		return
+	case JoinModeApproval: // 需要审批则转为入群申请
+		requestNo, err := g.createJoinRequest(groupNo, scaner, "", joinRequestSourceQRCode, generator)
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+		c.Response(map[string]interface{}{
+			"request_no": requestNo,
+		})
+		return
+	}
 	// 查询生成二维码信息
 	generatorInfo, err := g.userDB.QueryByUID(generator)
 	if err != nil {
@@ -1663,6 +1750,18 @@ func (g *Group) memberUpdate(c *wkhttp.Context) {
 		case "remark":
 			memberModel.Remark = value.(string)
 			break
+		case "title": // 头衔只能由群主或有修改群信息权限的管理员设置
+			title, _ := value.(string)
+			if len([]rune(title)) > MemberTitleMaxLen {
+				c.ResponseError(fmt.Errorf("头衔不能超过%d个字！", MemberTitleMaxLen))
+				return
+			}
+			if err := g.checkManagerPermission(groupNo, loginUID, ManagerPermissionEditInfo); err != nil {
+				c.ResponseError(err)
+				return
+			}
+			memberModel.Title = title
+			break
 		}
 	}
 	memberModel.Version = g.ctx.GenSeq(common.GroupMemberSeqKey)
@@ -1733,18 +1832,30 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 			c.ResponseError(errors.New("普通成员无法删除群成员"))
 			return
 		}
+		if member.Role == int(common.GroupMemberRoleManager) && !ManagerPermission(member.Permissions).Has(ManagerPermissionRemove) {
+			c.ResponseError(errors.New("没有移除群成员的权限"))
+			return
+		}
 	}
-	realDeleteMemberModels, err := g.userDB.QueryByUIDs(req.Members)
+	err = g.removeMembers(groupNo, operator, operatorName, req.Members)
 	if err != nil {
-		g.Error("查询成员用户信息失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询成员用户信息失败！"))
+		c.ResponseError(err)
 		return
 	}
+	c.ResponseOK()
+}
+
+// removeMembers 移除群成员
+func (g *Group) removeMembers(groupNo string, operator string, operatorName string, members []string) error {
+	realDeleteMemberModels, err := g.userDB.QueryByUIDs(members)
+	if err != nil {
+		g.Error("查询成员用户信息失败！", zap.Error(err))
+		return errors.New("查询成员用户信息失败！")
+	}
 	memberCount, err := g.db.QueryMemberCount(groupNo)
 	if err != nil {
 		g.Error("查询群成员数量失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询群成员数量失败！"))
-		return
+		return errors.New("查询群成员数量失败！")
 	}
 
 	userBaseVos := make([]*config.UserBaseVo, 0, len(realDeleteMemberModels))
@@ -1762,11 +1873,10 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 		needGenGroupAvatar = true
 	}
 	if !needGenGroupAvatar {
-		needGenGroupAvatar, err = g.db.membersInFirstNine(groupNo, req.Members)
+		needGenGroupAvatar, err = g.db.membersInFirstNine(groupNo, members)
 		if err != nil {
 			g.Error("查询最早加入的成员信息失败！", zap.Error(err))
-			c.ResponseError(errors.New("查询最早加入的成员信息失败！"))
-			return
+			return errors.New("查询最早加入的成员信息失败！")
 		}
 	}
 	groupIsUploadAvatar, err := g.db.queryGroupAvatarIsUpload(groupNo)
@@ -1793,8 +1903,7 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 		if err != nil {
 			tx.RollbackUnlessCommitted()
 			g.Error("删除群成员失败！", zap.Error(err))
-			c.ResponseError(errors.New("删除群成员失败！"))
-			return
+			return errors.New("删除群成员失败！")
 		}
 	}
 
@@ -1813,19 +1922,17 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 	if err != nil {
 		tx.RollbackUnlessCommitted()
 		g.Error("开启事件失败！", zap.Error(err))
-		c.ResponseError(errors.New("开启事件失败！"))
-		return
+		return errors.New("开启事件失败！")
 	}
 
 	var groupAvatarEventID int64
 	if needGenGroupAvatar {
 		nineMemberUIDs := make([]string, 0, 9)
-		nownineMembers, err := g.db.QueryMembersFirstNineExclude(groupNo, req.Members)
+		nownineMembers, err := g.db.QueryMembersFirstNineExclude(groupNo, members)
 		if err != nil {
 			tx.Rollback()
 			g.Error("查询先存成员信息失败！", zap.String("group_no", groupNo), zap.Error(err))
-			c.ResponseError(errors.New("查询先存成员信息失败！"))
-			return
+			return errors.New("查询先存成员信息失败！")
 		}
 		if len(nownineMembers) > 0 {
 			for _, nowninceMember := range nownineMembers {
@@ -1844,16 +1951,14 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 			if err != nil {
 				tx.Rollback()
 				g.Error("开启群成员头像更新事件失败！", zap.Error(err))
-				c.ResponseError(errors.New("开启群成员头像更新事件失败！"))
-				return
+				return errors.New("开启群成员头像更新事件失败！")
 			}
 		}
 	}
 	if err := tx.Commit(); err != nil {
 		tx.RollbackUnlessCommitted()
 		g.Error("提交事务失败！", zap.Error(err))
-		c.ResponseError(errors.New("提交事务失败！"))
-		return
+		return errors.New("提交事务失败！")
 	}
 	// 提交事件
 	g.ctx.EventCommit(eventID)
@@ -1865,13 +1970,12 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 	err = g.ctx.IMRemoveSubscriber(&config.SubscriberRemoveReq{
 		ChannelID:   groupNo,
 		ChannelType: common.ChannelTypeGroup.Uint8(),
-		Subscribers: req.Members,
+		Subscribers: members,
 	})
 	if err != nil {
 		tx.RollbackUnlessCommitted()
 		g.Error("调用IM的移除订阅者接口失败！", zap.Error(err))
-		c.ResponseError(errors.New("调用IM的移除订阅者接口失败！"))
-		return
+		return errors.New("调用IM的移除订阅者接口失败！")
 	}
 
 	//给被踢的成员发送被踢消息
@@ -1879,8 +1983,7 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 	if err != nil {
 		g.Warn("发送群成员被踢消息失败！", zap.Error(err))
 	}
-
-	c.ResponseOK()
+	return nil
 }
 
 // 修改群设置
@@ -2329,6 +2432,10 @@ func (g *Group) forbiddenWithGroupMember(c *wkhttp.Context) {
 		c.ResponseError(errors.New("操作用户权限不够"))
 		return
 	}
+	if loginGroupMember.Role == MemberRoleManager && !ManagerPermission(loginGroupMember.Permissions).Has(ManagerPermissionMute) {
+		c.ResponseError(errors.New("没有禁言权限"))
+		return
+	}
 	member.Version = g.ctx.GenSeq(common.GroupMemberSeqKey)
 	if req.Action == 0 {
 		// 解禁
@@ -2507,6 +2614,8 @@ type memberDetailResp struct {
 	InviteUID          string `json:"invite_uid"`           // 邀请人
 	Robot              int    `json:"robot"`                // 机器人
 	ForbiddenExpirTime int64  `json:"forbidden_expir_time"` // 禁言时长
+	Title              string `json:"title"`                // 头衔
+	Permissions        int    `json:"permissions"`          // 管理员权限位（仅管理员有效）
 	CreatedAt          string `json:"created_at"`
 	UpdatedAt          string `json:"updated_at"`
 }
@@ -2526,6 +2635,8 @@ func (r memberDetailResp) from(model *MemberDetailModel) memberDetailResp {
 		InviteUID:          model.InviteUID,
 		Robot:              model.Robot,
 		ForbiddenExpirTime: model.ForbiddenExpirTime,
+		Title:              model.Title,
+		Permissions:        memberPermissions(model.Role, model.Permissions),
 		CreatedAt:          model.CreatedAt.String(),
 		UpdatedAt:          model.UpdatedAt.String(),
 	}
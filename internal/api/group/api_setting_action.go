@@ -68,21 +68,19 @@ func (g *groupUpdateContext) isManager() (bool, error) {
 	return isManager, nil
 }
 
-func (g *groupUpdateContext) checkPermissions() error {
-	isManager, err := g.isManager()
+func (g *groupUpdateContext) checkPermissions(permission ManagerPermission) error {
+	return g.g.checkManagerPermission(g.groupModel.GroupNo, g.loginUID, permission)
+}
+
+func (g *groupUpdateContext) updateGroup() error {
+	err := g.g.db.Update(g.groupModel)
 	if err != nil {
 		return err
 	}
-	if !isManager {
-		return errors.New("没有权限！")
-	}
+	deleteSendLimitCache(g.g.ctx, g.groupModel.GroupNo)
 	return nil
 }
 
-func (g *groupUpdateContext) updateGroup() error {
-	return g.g.db.Update(g.groupModel)
-}
-
 func (g *groupUpdateContext) commmitGroupUpdateEvent(key, value string) error {
 	tx, err := g.g.ctx.DB().Begin()
 	util.CheckErr(err)
@@ -176,7 +174,7 @@ var settingActionMap = map[string]groupSettingActionFnc{
 
 var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 	common.GroupAttrKeyForbidden: func(ctx *groupUpdateContext, value interface{}) error { // 群内禁言
-		if err := ctx.checkPermissions(); err != nil {
+		if err := ctx.checkPermissions(ManagerPermissionMute); err != nil {
 			return err
 		}
 		ctx.groupModel.Forbidden = int(value.(float64))
@@ -213,7 +211,7 @@ var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 		return nil
 	},
 	common.GroupAttrKeyForbiddenAddFriend: func(ctx *groupUpdateContext, value interface{}) error { // 群内禁止加好友
-		if err := ctx.checkPermissions(); err != nil {
+		if err := ctx.checkPermissions(ManagerPermissionEditInfo); err != nil {
 			return err
 		}
 		ctx.groupModel.ForbiddenAddFriend = int(value.(float64))
@@ -228,7 +226,7 @@ var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 		return err
 	},
 	common.GroupAttrKeyInvite: func(ctx *groupUpdateContext, value interface{}) error { // 邀请开关
-		if err := ctx.checkPermissions(); err != nil {
+		if err := ctx.checkPermissions(ManagerPermissionEditInfo); err != nil {
 			return err
 		}
 		ctx.groupModel.Invite = int(value.(float64))
@@ -240,8 +238,72 @@ var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 
 		return ctx.commmitGroupUpdateEvent(common.GroupAttrKeyInvite, fmt.Sprintf("%d", ctx.groupModel.Invite))
 	},
+	common.GroupAttrKeyJoinMode: func(ctx *groupUpdateContext, value interface{}) error { // 入群方式
+		if err := ctx.checkPermissions(ManagerPermissionEditInfo); err != nil {
+			return err
+		}
+		joinMode := JoinMode(value.(float64))
+		if !joinMode.Valid() {
+			return errors.New("入群方式有误！")
+		}
+		ctx.groupModel.JoinMode = int(joinMode)
+
+		err := ctx.updateGroup()
+		if err != nil {
+			return err
+		}
+
+		return ctx.commmitGroupUpdateEvent(common.GroupAttrKeyJoinMode, fmt.Sprintf("%d", ctx.groupModel.JoinMode))
+	},
+	common.GroupAttrKeySlowMode: func(ctx *groupUpdateContext, value interface{}) error { // 慢速模式
+		if err := ctx.checkPermissions(ManagerPermissionMute); err != nil {
+			return err
+		}
+		slowMode := int(value.(float64))
+		if slowMode < 0 || slowMode > SlowModeMax {
+			return errors.New("慢速模式间隔有误！")
+		}
+		ctx.groupModel.SlowMode = slowMode
+
+		err := ctx.updateGroup()
+		if err != nil {
+			return err
+		}
+
+		return ctx.commmitGroupUpdateEvent(common.GroupAttrKeySlowMode, fmt.Sprintf("%d", ctx.groupModel.SlowMode))
+	},
+	common.GroupAttrKeyNewMemberProbation: func(ctx *groupUpdateContext, value interface{}) error { // 新成员观察期
+		if err := ctx.checkPermissions(ManagerPermissionMute); err != nil {
+			return err
+		}
+		probation := int(value.(float64))
+		if probation < 0 || probation > NewMemberProbationMax {
+			return errors.New("新成员观察期有误！")
+		}
+		ctx.groupModel.NewMemberProbation = probation
+
+		err := ctx.updateGroup()
+		if err != nil {
+			return err
+		}
+
+		return ctx.commmitGroupUpdateEvent(common.GroupAttrKeyNewMemberProbation, fmt.Sprintf("%d", ctx.groupModel.NewMemberProbation))
+	},
+	common.GroupAttrKeyForbiddenForward: func(ctx *groupUpdateContext, value interface{}) error { // 禁止转发和保存群消息
+		if err := ctx.checkPermissions(ManagerPermissionEditInfo); err != nil {
+			return err
+		}
+		ctx.groupModel.ForbiddenForward = int(value.(float64))
+
+		err := ctx.updateGroup()
+		if err != nil {
+			return err
+		}
+
+		return ctx.commmitGroupUpdateEvent(common.GroupAttrKeyForbiddenForward, fmt.Sprintf("%d", ctx.groupModel.ForbiddenForward))
+	},
 	common.GroupAllowViewHistoryMsg: func(ctx *groupUpdateContext, value interface{}) error {
-		if err := ctx.checkPermissions(); err != nil {
+		if err := ctx.checkPermissions(ManagerPermissionEditInfo); err != nil {
 			return err
 		}
 		ctx.groupModel.AllowViewHistoryMsg = int(value.(float64))
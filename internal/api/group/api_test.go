@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/WuKongIM/WuKongChatServer/internal/api/user"
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
 	"github.com/WuKongIM/WuKongChatServer/internal/testutil"
 	"github.com/WuKongIM/WuKongChatServer/pkg/util"
 	"github.com/stretchr/testify/assert"
@@ -320,3 +321,122 @@ func TestList(t *testing.T) {
 	assert.Equal(t, true, strings.Contains(w.Body.String(), `"name":`))
 
 }
+
+func TestJoinRequestReqCheck(t *testing.T) {
+	req := &joinRequestReq{Remark: "你好"}
+	assert.NoError(t, req.check())
+	assert.Equal(t, joinRequestSourceSearch, req.Source)
+
+	req = &joinRequestReq{Source: joinRequestSourceQRCode}
+	assert.NoError(t, req.check())
+
+	req = &joinRequestReq{Source: "unknown"}
+	assert.Error(t, req.check())
+
+	req = &joinRequestReq{Remark: strings.Repeat("字", 101)}
+	assert.Error(t, req.check())
+
+	assert.True(t, JoinModeApproval.Valid())
+	assert.False(t, JoinMode(3).Valid())
+}
+
+func TestAnnouncementReqCheck(t *testing.T) {
+	req := &announcementReq{Content: "明天开会", RequireConfirm: 1}
+	assert.NoError(t, req.check())
+
+	req = &announcementReq{Content: "  "}
+	assert.Error(t, req.check())
+
+	req = &announcementReq{Content: "明天开会", IsPinned: 2}
+	assert.Error(t, req.check())
+
+	resp := newAnnouncementResp(&AnnouncementModel{AnnouncementNo: "1", RequireConfirm: 1}, &AnnouncementAckModel{IsConfirmed: 1})
+	assert.Equal(t, 1, resp.IsRead)
+	assert.Equal(t, 1, resp.IsConfirmed)
+}
+
+func TestAnnouncementUpdateResetAcks(t *testing.T) {
+	s, ctx := testutil.NewTestServer()
+	f := New(ctx)
+	f.Route(s.GetRoute())
+
+	// 先清空旧数据
+	err := testutil.CleanAllTables(ctx)
+	assert.NoError(t, err)
+
+	err = f.db.InsertMember(&MemberModel{
+		UID:     testutil.UID,
+		GroupNo: "1",
+		Role:    MemberRoleCreator,
+	})
+	assert.NoError(t, err)
+	err = f.db.insertAnnouncement(&AnnouncementModel{
+		AnnouncementNo: "a1",
+		GroupNo:        "1",
+		AuthorUID:      testutil.UID,
+		Content:        "明天开会",
+		RequireConfirm: 1,
+	})
+	assert.NoError(t, err)
+	err = f.db.insertOrUpdateAnnouncementConfirm("a1", "1", "10009")
+	assert.NoError(t, err)
+
+	// 内容未变化，确认记录保留
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/v1/groups/1/announcements/a1", bytes.NewReader([]byte(util.ToJson(map[string]interface{}{
+		"content":         "明天开会",
+		"require_confirm": 1,
+	}))))
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	acks, err := f.db.queryAnnouncementAcks("a1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(acks))
+
+	// 内容变化，确认记录清空
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/v1/groups/1/announcements/a1", bytes.NewReader([]byte(util.ToJson(map[string]interface{}{
+		"content":         "后天开会",
+		"require_confirm": 1,
+	}))))
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	acks, err = f.db.queryAnnouncementAcks("a1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(acks))
+}
+
+func TestSendLimit(t *testing.T) {
+	now := time.Now()
+	assert.True(t, inProbation(3600, now.Add(-time.Minute), now))
+	assert.False(t, inProbation(3600, now.Add(-time.Hour*2), now))
+	assert.False(t, inProbation(0, now, now))
+
+	assert.True(t, isLinkOrMedia(common.Image, ""))
+	assert.True(t, isLinkOrMedia(common.Text, "看看 https://example.com/a"))
+	assert.True(t, isLinkOrMedia(common.Text, "www.example.com"))
+	assert.False(t, isLinkOrMedia(common.Text, "大家好"))
+
+	req := NewCheckSendReq("g1", "u1", []byte(`{"type":1,"content":"www.example.com"}`))
+	assert.Equal(t, common.Text, req.ContentType)
+	assert.Equal(t, "www.example.com", req.Content)
+	req = NewCheckSendReq("g1", "u1", []byte("encrypted"))
+	assert.Equal(t, common.ContentType(0), req.ContentType)
+}
+
+func TestManagerPermission(t *testing.T) {
+	assert.Equal(t, []ManagerPermission{ManagerPermissionMute}, groupUpdatePermissions(map[string]string{common.GroupAttrKeySlowMode: "10"}))
+	assert.Equal(t, []ManagerPermission{ManagerPermissionEditInfo, ManagerPermissionMute}, groupUpdatePermissions(map[string]string{common.GroupAttrKeyName: "群", common.GroupAttrKeyNewMemberProbation: "60"}))
+
+	p := ManagerPermissionInvite | ManagerPermissionMute
+	assert.True(t, p.Has(ManagerPermissionMute))
+	assert.False(t, p.Has(ManagerPermissionRevoke))
+	assert.True(t, ManagerPermissionAll.Has(ManagerPermissionRevoke|ManagerPermissionPin))
+	assert.Equal(t, 63, int(ManagerPermissionAll))
+
+	assert.Equal(t, int(ManagerPermissionAll), memberPermissions(MemberRoleCreator, 0))
+	assert.Equal(t, int(p), memberPermissions(MemberRoleManager, int(p)))
+	assert.Equal(t, 0, memberPermissions(MemberRoleCommon, int(ManagerPermissionAll)))
+}
@@ -25,6 +25,60 @@ const (
 	InviteStatusOK = 1
 )
 
+// JoinMode 入群方式
+type JoinMode int
+
+const (
+	JoinModeOpen     JoinMode = iota // 公开（扫码等可直接加入）
+	JoinModeInvite                   // 仅限邀请
+	JoinModeApproval                 // 需要审批
+)
+
+// Valid 是否是有效的入群方式
+func (j JoinMode) Valid() bool {
+	return j >= JoinModeOpen && j <= JoinModeApproval
+}
+
+const (
+	// SlowModeMax 慢速模式最大间隔（秒）
+	SlowModeMax = 60 * 60
+	// NewMemberProbationMax 新成员观察期最大时长（秒）
+	NewMemberProbationMax = 60 * 60 * 24 * 30
+)
+
+// ManagerPermission 管理员权限位
+type ManagerPermission int
+
+const (
+	ManagerPermissionInvite   ManagerPermission = 1 << iota // 邀请成员
+	ManagerPermissionRemove                                 // 移除成员
+	ManagerPermissionMute                                   // 禁言
+	ManagerPermissionPin                                    // 置顶消息
+	ManagerPermissionEditInfo                               // 修改群信息
+	ManagerPermissionRevoke                                 // 撤回他人消息
+
+	// ManagerPermissionAll 全部权限
+	ManagerPermissionAll = ManagerPermissionInvite | ManagerPermissionRemove | ManagerPermissionMute | ManagerPermissionPin | ManagerPermissionEditInfo | ManagerPermissionRevoke
+)
+
+// Has 是否拥有指定权限
+func (m ManagerPermission) Has(permission ManagerPermission) bool {
+	return m&permission == permission
+}
+
+// MemberTitleMaxLen 群成员头衔最大长度
+const MemberTitleMaxLen = 16
+
+// JoinRequestStatus 入群申请状态
+type JoinRequestStatus int
+
+const (
+	JoinRequestStatusWait     JoinRequestStatus = iota // 待审批
+	JoinRequestStatusApproved                          // 已同意
+	JoinRequestStatusRejected                          // 已拒绝
+	JoinRequestStatusExpired                           // 已过期
+)
+
 // 群类型
 type GroupType int
 
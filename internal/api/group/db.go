@@ -100,6 +100,19 @@ func (d *DB) QueryIsGroupManagerOrCreator(groupNo string, uid string) (bool, err
 	return count > 0, err
 }
 
+// QueryHasManagerPermission 是否是创建者或拥有指定权限的管理者
+func (d *DB) QueryHasManagerPermission(groupNo string, uid string, permission ManagerPermission) (bool, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_member").Where("group_no=? and uid=? and is_deleted=0 and (role=? or (role=? and permissions&?=?))", groupNo, uid, MemberRoleCreator, MemberRoleManager, permission, permission).Load(&count)
+	return count > 0, err
+}
+
+// UpdateManagerPermissions 修改管理者权限
+func (d *DB) UpdateManagerPermissions(groupNo string, uid string, permissions ManagerPermission, version int64) error {
+	_, err := d.session.Update("group_member").Set("permissions", permissions).Set("version", version).Where("group_no=? and uid=? and role=? and is_deleted=0", groupNo, uid, MemberRoleManager).Exec()
+	return err
+}
+
 // QueryIsGroupCreator 是否是群创建者
 func (d *DB) QueryIsGroupCreator(groupNo string, uid string) (bool, error) {
 	var count int64
@@ -137,7 +150,7 @@ func (d *DB) UpdateMembersToManager(groupNo string, members []string, version in
 	if len(members) <= 0 {
 		return nil
 	}
-	_, err := d.session.Update("group_member").Set("role", MemberRoleManager).Set("version", version).Where("group_no=? and uid in ? and is_deleted=0", groupNo, members).Exec()
+	_, err := d.session.Update("group_member").Set("role", MemberRoleManager).Set("permissions", ManagerPermissionAll).Set("version", version).Where("group_no=? and uid in ? and is_deleted=0", groupNo, members).Exec()
 	return err
 }
 
@@ -204,6 +217,7 @@ func (d *DB) UpdateMember(member *MemberModel) error {
 		"is_deleted":           member.IsDeleted,
 		"invite_uid":           member.InviteUID,
 		"forbidden_expir_time": member.ForbiddenExpirTime,
+		"title":                member.Title,
 	}).Where("group_no=? and uid=?", member.GroupNo, member.UID).Exec()
 	return err
 }
@@ -240,13 +254,16 @@ func (d *DB) queryUserSupers(uid string) ([]*Model, error) {
 // UpdateTx 更新群信息（带事务）
 func (d *DB) UpdateTx(model *Model, tx *dbr.Tx) error {
 	_, err := tx.Update("group").SetMap(map[string]interface{}{
-		"name":      model.Name,
-		"notice":    model.Notice,
-		"creator":   model.Creator,
-		"status":    model.Status,
-		"version":   model.Version,
-		"forbidden": model.Forbidden,
-		"invite":    model.Invite,
+		"name":                 model.Name,
+		"notice":               model.Notice,
+		"creator":              model.Creator,
+		"status":               model.Status,
+		"version":              model.Version,
+		"forbidden":            model.Forbidden,
+		"invite":               model.Invite,
+		"join_mode":            model.JoinMode,
+		"slow_mode":            model.SlowMode,
+		"new_member_probation": model.NewMemberProbation,
 	}).Where("id=?", model.Id).Exec()
 	return err
 }
@@ -263,6 +280,10 @@ func (d *DB) Update(model *Model) error {
 		"invite":                 model.Invite,
 		"forbidden_add_friend":   model.ForbiddenAddFriend,
 		"allow_view_history_msg": model.AllowViewHistoryMsg,
+		"join_mode":              model.JoinMode,
+		"slow_mode":              model.SlowMode,
+		"new_member_probation":   model.NewMemberProbation,
+		"forbidden_forward":      model.ForbiddenForward,
 	}).Where("id=?", model.Id).Exec()
 	return err
 }
@@ -330,7 +351,7 @@ func (d *DB) QueryMembersWithStatus(groupNo string, status int) ([]*MemberModel,
 func (d *DB) SyncMembers(groupNo string, version int64, limit uint64) ([]*MemberDetailModel, error) {
 
 	var details []*MemberDetailModel
-	builder := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=?", groupNo).OrderDir("group_member.version", true)
+	builder := d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.title,group_member.permissions,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=?", groupNo).OrderDir("group_member.version", true)
 	var err error
 	if version <= 0 {
 		_, err = builder.Limit(limit).Load(&details)
@@ -346,9 +367,9 @@ func (d *DB) queryMembersWithKeyword(groupNo string, loginUID string, keyword st
 	var details []*MemberDetailModel
 	var builder *dbr.SelectStmt
 	if keyword != "" {
-		builder = d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").LeftJoin("user_setting", fmt.Sprintf("user_setting.uid='%s' and user_setting.to_uid=group_member.uid", loginUID)).Where("group_member.group_no=? and group_member.is_deleted=0 and (group_member.remark like ? or user.name like ? or user_setting.remark like ?)", groupNo, "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%").OrderAsc("group_member.created_at")
+		builder = d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.title,group_member.permissions,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").LeftJoin("user_setting", fmt.Sprintf("user_setting.uid='%s' and user_setting.to_uid=group_member.uid", loginUID)).Where("group_member.group_no=? and group_member.is_deleted=0 and (group_member.remark like ? or user.name like ? or user_setting.remark like ?)", groupNo, "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%").OrderAsc("group_member.created_at")
 	} else {
-		builder = d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=? and group_member.is_deleted=0", groupNo).OrderDesc(fmt.Sprintf("group_member.role=%d", MemberRoleCreator)).OrderDesc(fmt.Sprintf("group_member.role=%d", MemberRoleManager)).OrderAsc("group_member.created_at")
+		builder = d.session.Select("group_member.id,group_member.vercode,group_member.uid,group_member.status,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.is_deleted,group_member.robot,group_member.version,group_member.invite_uid,group_member.forbidden_expir_time,group_member.title,group_member.permissions,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=? and group_member.is_deleted=0", groupNo).OrderDesc(fmt.Sprintf("group_member.role=%d", MemberRoleCreator)).OrderDesc(fmt.Sprintf("group_member.role=%d", MemberRoleManager)).OrderAsc("group_member.created_at")
 	}
 	var err error
 	_, err = builder.Offset((page - 1) * limit).Limit(limit).Load(&details)
@@ -484,6 +505,10 @@ type Model struct {
 	Invite              int    // 是否开启邀请确认 0.否 1.是
 	ForbiddenAddFriend  int    //群内禁止加好友
 	AllowViewHistoryMsg int    // 是否允许新成员查看历史消息
+	JoinMode            int    // 入群方式 0.公开 1.仅限邀请 2.需要审批
+	SlowMode            int    // 慢速模式 每位成员发言间隔秒数 0.关闭
+	NewMemberProbation  int    // 新成员观察期秒数 观察期内不能发送链接和媒体消息 0.关闭
+	ForbiddenForward    int    // 禁止转发和保存群消息 0.否 1.是
 	db.BaseModel
 }
 
@@ -500,6 +525,8 @@ type MemberModel struct {
 	InviteUID          string // 邀请者
 	Robot              int    // 机器人
 	ForbiddenExpirTime int64  // 禁言时长
+	Title              string // 头衔
+	Permissions        int    // 管理员权限位
 	db.BaseModel
 }
 
@@ -517,7 +544,9 @@ type MemberDetailModel struct {
 	Status             int    // 1.正常 2.黑名单
 	Username           string
 	Robot              int   // 机器人标识0.否1.是
-	ForbiddenExpirTime int64 // 禁言时长
+	ForbiddenExpirTime int64  // 禁言时长
+	Title              string // 头衔
+	Permissions        int    // 管理员权限位
 	db.BaseModel
 }
 
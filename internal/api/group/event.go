@@ -135,3 +135,72 @@ func (g *Group) handleGroupMemberAddEvent(data []byte, commit config.EventCommit
 		},
 	}
 }
+
+// handleUserDestroyEvent 用户注销后将其移出所有群
+func (g *Group) handleUserDestroyEvent(data []byte, commit config.EventCommit) {
+	var req map[string]interface{}
+	err := util.ReadJsonByByte(data, &req)
+	if err != nil {
+		g.Error("处理用户注销参数有误", zap.Error(err))
+		commit(err)
+		return
+	}
+	uid, _ := req["uid"].(string)
+	if uid == "" {
+		g.Error("处理用户注销UID不能为空")
+		commit(errors.New("处理用户注销UID不能为空"))
+		return
+	}
+	groups, err := g.db.queryGroupsWithMemberUID(uid)
+	if err != nil {
+		g.Error("查询用户所在群失败！", zap.Error(err))
+		commit(err)
+		return
+	}
+	for _, group := range groups {
+		if group.GroupNo == "" {
+			continue
+		}
+		member, err := g.db.QueryMemberWithUID(uid, group.GroupNo)
+		if err != nil {
+			g.Error("查询群成员信息失败！", zap.Error(err))
+			commit(err)
+			return
+		}
+		if member == nil {
+			continue
+		}
+		if member.Role == MemberRoleCreator { // 群主注销则转让给第二个入群的人
+			newGrouper, err := g.db.QuerySecondOldestMember(group.GroupNo)
+			if err != nil {
+				g.Error("查询第二元老成员失败！", zap.Error(err))
+				commit(err)
+				return
+			}
+			if newGrouper != nil {
+				tx, _ := g.db.session.Begin()
+				version := g.ctx.GenSeq(common.GroupMemberSeqKey)
+				err = g.db.UpdateMemberRoleTx(group.GroupNo, newGrouper.UID, MemberRoleCreator, version, tx)
+				if err != nil {
+					tx.Rollback()
+					g.Error("更换新的群主失败！", zap.Error(err))
+					commit(err)
+					return
+				}
+				if err = tx.Commit(); err != nil {
+					tx.RollbackUnlessCommitted()
+					g.Error("提交事务失败！", zap.Error(err))
+					commit(err)
+					return
+				}
+			}
+		}
+		err = g.removeMembers(group.GroupNo, g.ctx.GetConfig().SystemUID, "系统账号", []string{uid})
+		if err != nil {
+			g.Error("移除注销用户失败！", zap.Error(err), zap.String("groupNo", group.GroupNo))
+			commit(err)
+			return
+		}
+	}
+	commit(nil)
+}
@@ -113,7 +113,7 @@ func (g *Group) getToGroupMemberConfirmInviteDetailH5(c *wkhttp.Context) {
 	inviteNo := c.Query("invite_no")
 	loginUID := c.MustGet("uid").(string)
 
-	managerOrCreator, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
+	managerOrCreator, err := g.db.QueryHasManagerPermission(groupNo, loginUID, ManagerPermissionInvite)
 	if err != nil {
 		g.Error("查询是否管理者或创建者失败！")
 		c.ResponseError(errors.New("查询是否管理者或创建者失败！"))
@@ -0,0 +1,390 @@
+package group
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 入群申请来源
+const (
+	joinRequestSourceQRCode = "qrcode" // 扫码
+	joinRequestSourceSearch = "search" // 搜索
+	joinRequestSourceLink   = "link"   // 链接
+)
+
+// 申请入群
+func (g *Group) joinRequestAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	var req joinRequestReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	group, err := g.db.QueryWithGroupNo(groupNo)
+	if err != nil {
+		g.Error("查询群信息失败！", zap.Error(err), zap.String("groupNo", groupNo))
+		c.ResponseError(errors.New("查询群信息失败！"))
+		return
+	}
+	if group == nil {
+		c.ResponseError(errors.New("群不存在！"))
+		return
+	}
+	switch JoinMode(group.JoinMode) {
+	case JoinModeInvite:
+		c.ResponseError(errors.New("该群仅限邀请加入！"))
+		return
+	case JoinModeOpen:
+		c.ResponseError(errors.New("该群无需审批，可直接扫码加入！"))
+		return
+	}
+	requestNo, err := g.createJoinRequest(groupNo, loginUID, req.Remark, req.Source, req.InviterUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.Response(map[string]interface{}{
+		"request_no": requestNo,
+	})
+}
+
+// 入群申请列表
+func (g *Group) joinRequestList(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	if err := g.checkJoinRequestHandler(groupNo, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	status := -1
+	if strings.TrimSpace(c.Query("status")) != "" {
+		status, _ = strconv.Atoi(c.Query("status"))
+	}
+	pageIndex, pageSize := c.GetPage()
+	models, err := g.db.queryJoinRequestsWithPage(groupNo, status, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		g.Error("查询入群申请失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询入群申请失败！"))
+		return
+	}
+	count, err := g.db.queryJoinRequestCount(groupNo, status)
+	if err != nil {
+		g.Error("查询入群申请数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询入群申请数量失败！"))
+		return
+	}
+	list := make([]*joinRequestResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newJoinRequestResp(model))
+	}
+	c.Response(map[string]interface{}{
+		"list":  list,
+		"count": count,
+	})
+}
+
+// 同意入群申请
+func (g *Group) joinRequestApprove(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	requestNo := c.Param("request_no")
+	model, err := g.checkJoinRequestHandle(groupNo, requestNo, loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, _ := g.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	ok, err := g.db.updateJoinRequestHandledTx(requestNo, JoinRequestStatusApproved, loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("修改入群申请状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改入群申请状态失败！"))
+		return
+	}
+	if !ok {
+		tx.Rollback()
+		c.ResponseError(errors.New("申请已处理或已过期！"))
+		return
+	}
+	commitCallback, err := g.addMembersTx([]string{model.UID}, groupNo, loginUID, c.GetLoginName(), tx)
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		c.ResponseError(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	if commitCallback != nil {
+		commitCallback()
+	}
+	g.sendJoinRequestCMD(groupNo, requestNo, JoinRequestStatusApproved)
+	c.ResponseOK()
+}
+
+// 拒绝入群申请
+func (g *Group) joinRequestReject(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	requestNo := c.Param("request_no")
+	model, err := g.checkJoinRequestHandle(groupNo, requestNo, loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, _ := g.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	ok, err := g.db.updateJoinRequestHandledTx(requestNo, JoinRequestStatusRejected, loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("修改入群申请状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改入群申请状态失败！"))
+		return
+	}
+	if !ok {
+		tx.Rollback()
+		c.ResponseError(errors.New("申请已处理或已过期！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	g.sendJoinRequestCMD(groupNo, requestNo, JoinRequestStatusRejected)
+	// 通知申请者
+	err = g.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   model.UID,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		CMD:         common.CMDGroupJoinRequest,
+		Param: map[string]interface{}{
+			"group_no":   groupNo,
+			"request_no": requestNo,
+			"status":     JoinRequestStatusRejected,
+		},
+	})
+	if err != nil {
+		g.Error("发送入群申请拒绝命令失败！", zap.Error(err))
+	}
+	c.ResponseOK()
+}
+
+// createJoinRequest 创建入群申请 已有待审批的申请则刷新留言和过期时间
+func (g *Group) createJoinRequest(groupNo, uid, remark, source, inviterUID string) (string, error) {
+	existMember, err := g.db.ExistMember(uid, groupNo)
+	if err != nil {
+		g.Error("查询是否存在群内时失败！", zap.Error(err))
+		return "", errors.New("查询是否存在群内时失败！")
+	}
+	if existMember {
+		return "", errors.New("已经在群内，不能再加入！")
+	}
+	blacklist, err := g.db.QueryMembersWithStatus(groupNo, int(common.GroupMemberStatusBlacklist))
+	if err != nil {
+		g.Error("查询群黑名单成员错误", zap.Error(err))
+		return "", errors.New("查询群黑名单成员错误")
+	}
+	for _, member := range blacklist {
+		if member.UID == uid {
+			return "", errors.New("你已被移出群聊，无法申请加入！")
+		}
+	}
+	expireAt := time.Now().Add(g.ctx.GetConfig().GroupJoinRequestExpire).Unix()
+	model, err := g.db.queryWaitJoinRequest(groupNo, uid)
+	if err != nil {
+		g.Error("查询入群申请失败！", zap.Error(err))
+		return "", errors.New("查询入群申请失败！")
+	}
+	if model != nil && model.ExpireAt > time.Now().Unix() {
+		model.Remark = remark
+		model.Source = source
+		model.InviterUID = inviterUID
+		model.ExpireAt = expireAt
+		err = g.db.updateJoinRequestContent(model)
+		if err != nil {
+			g.Error("修改入群申请失败！", zap.Error(err))
+			return "", errors.New("修改入群申请失败！")
+		}
+	} else {
+		model = &JoinRequestModel{
+			RequestNo:  util.GenerUUID(),
+			GroupNo:    groupNo,
+			UID:        uid,
+			Remark:     remark,
+			Source:     source,
+			InviterUID: inviterUID,
+			Status:     int(JoinRequestStatusWait),
+			ExpireAt:   expireAt,
+		}
+		err = g.db.insertJoinRequest(model)
+		if err != nil {
+			g.Error("添加入群申请失败！", zap.Error(err))
+			return "", errors.New("添加入群申请失败！")
+		}
+	}
+	g.sendJoinRequestCMD(groupNo, model.RequestNo, JoinRequestStatusWait)
+	return model.RequestNo, nil
+}
+
+// checkJoinRequestHandler 只有群主或管理员才能处理入群申请
+func (g *Group) checkJoinRequestHandler(groupNo string, uid string) error {
+	isManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, uid)
+	if err != nil {
+		g.Error("查询是否是群管理者失败！", zap.Error(err))
+		return errors.New("查询是否是群管理者失败！")
+	}
+	if !isManager {
+		return errors.New("只有群主或管理员才能处理入群申请！")
+	}
+	return nil
+}
+
+func (g *Group) checkJoinRequestHandle(groupNo string, requestNo string, loginUID string) (*JoinRequestModel, error) {
+	if err := g.checkJoinRequestHandler(groupNo, loginUID); err != nil {
+		return nil, err
+	}
+	model, err := g.db.queryJoinRequestWithRequestNo(requestNo)
+	if err != nil {
+		g.Error("查询入群申请失败！", zap.Error(err))
+		return nil, errors.New("查询入群申请失败！")
+	}
+	if model == nil || model.GroupNo != groupNo {
+		return nil, errors.New("入群申请不存在！")
+	}
+	if model.Status != int(JoinRequestStatusWait) || model.ExpireAt <= time.Now().Unix() {
+		return nil, errors.New("申请已处理或已过期！")
+	}
+	return model, nil
+}
+
+// sendJoinRequestCMD 通知群主和管理员入群申请有变化
+func (g *Group) sendJoinRequestCMD(groupNo string, requestNo string, status JoinRequestStatus) {
+	managerUIDs, err := g.db.QueryGroupManagerOrCreatorUIDS(groupNo)
+	if err != nil {
+		g.Error("查询群主和管理员失败！", zap.Error(err))
+		return
+	}
+	if len(managerUIDs) == 0 {
+		return
+	}
+	err = g.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		Subscribers: managerUIDs,
+		CMD:         common.CMDGroupJoinRequest,
+		Param: map[string]interface{}{
+			"group_no":   groupNo,
+			"request_no": requestNo,
+			"status":     status,
+		},
+	})
+	if err != nil {
+		g.Error("发送入群申请命令失败！", zap.Error(err))
+	}
+}
+
+// joinRequestExpireCheck 将过期未处理的申请标记为已过期
+func (g *Group) joinRequestExpireCheck() {
+	models, err := g.db.queryExpiredJoinRequests(100)
+	if err != nil {
+		g.Error("查询过期入群申请失败！", zap.Error(err))
+		return
+	}
+	if len(models) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(models))
+	for _, model := range models {
+		ids = append(ids, model.Id)
+	}
+	err = g.db.updateJoinRequestsExpired(ids)
+	if err != nil {
+		g.Error("修改入群申请为过期失败！", zap.Error(err))
+		return
+	}
+	for _, model := range models {
+		g.sendJoinRequestCMD(model.GroupNo, model.RequestNo, JoinRequestStatusExpired)
+	}
+}
+
+type joinRequestReq struct {
+	Remark     string `json:"remark"`      // 申请留言
+	Source     string `json:"source"`      // 申请来源
+	InviterUID string `json:"inviter_uid"` // 分享者uid
+}
+
+func (j *joinRequestReq) check() error {
+	if len([]rune(j.Remark)) > 100 {
+		return errors.New("申请留言不能超过100个字！")
+	}
+	switch j.Source {
+	case "":
+		j.Source = joinRequestSourceSearch
+	case joinRequestSourceQRCode, joinRequestSourceSearch, joinRequestSourceLink:
+	default:
+		return errors.New("申请来源有误！")
+	}
+	return nil
+}
+
+type joinRequestResp struct {
+	RequestNo  string `json:"request_no"`
+	GroupNo    string `json:"group_no"`
+	UID        string `json:"uid"`
+	Name       string `json:"name"`
+	Remark     string `json:"remark"`
+	Source     string `json:"source"`
+	InviterUID string `json:"inviter_uid"`
+	Status     int    `json:"status"`
+	HandlerUID string `json:"handler_uid"`
+	HandledAt  int64  `json:"handled_at"`
+	ExpireAt   int64  `json:"expire_at"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func newJoinRequestResp(m *JoinRequestDetailModel) *joinRequestResp {
+	return &joinRequestResp{
+		RequestNo:  m.RequestNo,
+		GroupNo:    m.GroupNo,
+		UID:        m.UID,
+		Name:       m.Name,
+		Remark:     m.Remark,
+		Source:     m.Source,
+		InviterUID: m.InviterUID,
+		Status:     m.Status,
+		HandlerUID: m.HandlerUID,
+		HandledAt:  m.HandledAt,
+		ExpireAt:   m.ExpireAt,
+		CreatedAt:  m.CreatedAt.String(),
+	}
+}
@@ -0,0 +1,114 @@
+package group
+
+import (
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+// insertJoinRequest 添加入群申请
+func (d *DB) insertJoinRequest(model *JoinRequestModel) error {
+	_, err := d.session.InsertInto("group_join_request").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// queryWaitJoinRequest 查询用户在群内待审批的申请
+func (d *DB) queryWaitJoinRequest(groupNo string, uid string) (*JoinRequestModel, error) {
+	var model *JoinRequestModel
+	_, err := d.session.Select("*").From("group_join_request").Where("group_no=? and uid=? and status=?", groupNo, uid, JoinRequestStatusWait).OrderDir("id", false).Limit(1).Load(&model)
+	return model, err
+}
+
+// queryJoinRequestWithRequestNo 通过申请编号查询申请
+func (d *DB) queryJoinRequestWithRequestNo(requestNo string) (*JoinRequestModel, error) {
+	var model *JoinRequestModel
+	_, err := d.session.Select("*").From("group_join_request").Where("request_no=?", requestNo).Load(&model)
+	return model, err
+}
+
+// updateJoinRequestContent 刷新待审批申请的留言、来源和过期时间
+func (d *DB) updateJoinRequestContent(model *JoinRequestModel) error {
+	_, err := d.session.Update("group_join_request").SetMap(map[string]interface{}{
+		"remark":      model.Remark,
+		"source":      model.Source,
+		"inviter_uid": model.InviterUID,
+		"expire_at":   model.ExpireAt,
+	}).Where("id=?", model.Id).Exec()
+	return err
+}
+
+// updateJoinRequestHandledTx 处理申请 只有待审批且未过期的申请才能处理成功
+func (d *DB) updateJoinRequestHandledTx(requestNo string, status JoinRequestStatus, handlerUID string, tx *dbr.Tx) (bool, error) {
+	now := time.Now().Unix()
+	result, err := tx.Update("group_join_request").SetMap(map[string]interface{}{
+		"status":      status,
+		"handler_uid": handlerUID,
+		"handled_at":  now,
+	}).Where("request_no=? and status=? and expire_at>?", requestNo, JoinRequestStatusWait, now).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// queryJoinRequestsWithPage 分页查询群的入群申请 status小于0则不过滤状态
+func (d *DB) queryJoinRequestsWithPage(groupNo string, status int, pageSize, page uint64) ([]*JoinRequestDetailModel, error) {
+	var models []*JoinRequestDetailModel
+	builder := d.session.Select("group_join_request.*,IFNULL(user.name,'') name").From("group_join_request").LeftJoin("user", "group_join_request.uid=user.uid").Where("group_join_request.group_no=?", groupNo)
+	if status >= 0 {
+		builder = builder.Where("group_join_request.status=?", status)
+	}
+	_, err := builder.OrderDir("group_join_request.id", false).Offset((page - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// queryJoinRequestCount 查询群的入群申请数量
+func (d *DB) queryJoinRequestCount(groupNo string, status int) (int64, error) {
+	var count int64
+	builder := d.session.Select("count(*)").From("group_join_request").Where("group_no=?", groupNo)
+	if status >= 0 {
+		builder = builder.Where("status=?", status)
+	}
+	_, err := builder.Load(&count)
+	return count, err
+}
+
+// queryExpiredJoinRequests 查询已过期但还是待审批状态的申请
+func (d *DB) queryExpiredJoinRequests(limit uint64) ([]*JoinRequestModel, error) {
+	var models []*JoinRequestModel
+	_, err := d.session.Select("*").From("group_join_request").Where("status=? and expire_at<=?", JoinRequestStatusWait, time.Now().Unix()).Limit(limit).Load(&models)
+	return models, err
+}
+
+// updateJoinRequestsExpired 将申请标记为已过期
+func (d *DB) updateJoinRequestsExpired(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := d.session.Update("group_join_request").Set("status", JoinRequestStatusExpired).Where("id in ? and status=?", ids, JoinRequestStatusWait).Exec()
+	return err
+}
+
+// JoinRequestModel 入群申请
+type JoinRequestModel struct {
+	RequestNo  string // 申请编号
+	GroupNo    string // 群编号
+	UID        string // 申请者uid
+	Remark     string // 申请留言
+	Source     string // 申请来源
+	InviterUID string // 分享者uid
+	Status     int    // 状态
+	HandlerUID string // 审批者uid
+	HandledAt  int64  // 审批时间
+	ExpireAt   int64  // 过期时间
+	db.BaseModel
+}
+
+// JoinRequestDetailModel 入群申请详情
+type JoinRequestDetailModel struct {
+	JoinRequestModel
+	Name string // 申请者名字
+}
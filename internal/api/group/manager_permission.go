@@ -0,0 +1,91 @@
+package group
+
+import (
+	"errors"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 修改管理员权限 只有群主可以修改
+func (g *Group) managerPermissionsUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	groupNo := c.Param("group_no")
+	memberUID := c.Param("uid")
+	var req struct {
+		Permissions int `json:"permissions"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	permissions := ManagerPermission(req.Permissions)
+	if permissions < 0 || permissions&^ManagerPermissionAll != 0 {
+		c.ResponseError(errors.New("权限有误！"))
+		return
+	}
+	isCreator, err := g.db.QueryIsGroupCreator(groupNo, loginUID)
+	if err != nil {
+		g.Error("查询是否是创建者失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是创建者失败！"))
+		return
+	}
+	if !isCreator {
+		c.ResponseError(errors.New("只有群主才能修改管理员权限！"))
+		return
+	}
+	member, err := g.db.QueryMemberWithUID(memberUID, groupNo)
+	if err != nil {
+		g.Error("查询成员信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询成员信息失败！"))
+		return
+	}
+	if member == nil || member.Role != MemberRoleManager {
+		c.ResponseError(errors.New("该成员不是管理员！"))
+		return
+	}
+	err = g.db.UpdateManagerPermissions(groupNo, memberUID, permissions, g.ctx.GenSeq(common.GroupMemberSeqKey))
+	if err != nil {
+		g.Error("修改管理员权限失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改管理员权限失败！"))
+		return
+	}
+	err = g.ctx.SendCMD(config.MsgCMDReq{
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		CMD:         common.CMDGroupMemberUpdate,
+		Param: map[string]interface{}{
+			"group_no": groupNo,
+		},
+	})
+	if err != nil {
+		g.Error("发送命令消息失败！", zap.Error(err))
+	}
+	c.ResponseOK()
+}
+
+// checkManagerPermission 检查是否是群主或拥有指定权限的管理员
+func (g *Group) checkManagerPermission(groupNo string, uid string, permission ManagerPermission) error {
+	has, err := g.db.QueryHasManagerPermission(groupNo, uid, permission)
+	if err != nil {
+		g.Error("查询管理权限失败！", zap.Error(err))
+		return errors.New("查询管理权限失败！")
+	}
+	if !has {
+		return errors.New("没有权限！")
+	}
+	return nil
+}
+
+// memberPermissions 成员的管理权限 群主拥有全部权限 普通成员没有权限
+func memberPermissions(role int, permissions int) int {
+	switch role {
+	case MemberRoleCreator:
+		return int(ManagerPermissionAll)
+	case MemberRoleManager:
+		return permissions
+	}
+	return 0
+}
@@ -0,0 +1,188 @@
+package group
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/log"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"go.uber.org/zap"
+)
+
+var linkRegexp = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+// CheckSendReq 群成员发送消息检查请求
+type CheckSendReq struct {
+	GroupNo     string
+	UID         string
+	ContentType common.ContentType
+	Content     string // 文本消息的内容
+}
+
+// NewCheckSendReq 根据消息payload创建发送检查请求 加密等无法解析的消息只做慢速模式检查
+func NewCheckSendReq(groupNo string, uid string, payload []byte) *CheckSendReq {
+	req := &CheckSendReq{
+		GroupNo: groupNo,
+		UID:     uid,
+	}
+	if len(payload) == 0 {
+		return req
+	}
+	payloadMap, err := util.JsonToMap(string(payload))
+	if err != nil {
+		return req
+	}
+	if contentType, ok := payloadMap["type"].(json.Number); ok {
+		contentTypeInt64, _ := contentType.Int64()
+		req.ContentType = common.ContentType(contentTypeInt64)
+	}
+	req.Content, _ = payloadMap["content"].(string)
+	return req
+}
+
+// CheckSendResp 群成员发送消息检查结果
+type CheckSendResp struct {
+	Allow      bool   `json:"allow"`
+	Reason     string `json:"reason,omitempty"`
+	RetryAfter int64  `json:"retry_after,omitempty"` // 慢速模式下多少秒后可再次发送
+}
+
+const sendLimitCacheExpire = time.Minute // 发送限制相关数据的缓存时间
+
+// sendLimit 群的发送限制设置
+type sendLimit struct {
+	SlowMode           int `json:"slow_mode"`
+	NewMemberProbation int `json:"new_member_probation"`
+}
+
+// sendLimitMember 发送限制需要的成员信息
+type sendLimitMember struct {
+	Exempt   bool  `json:"exempt"`    // 不受限制（非成员、群主、管理员、机器人）
+	JoinedAt int64 `json:"joined_at"` // 入群时间
+}
+
+// CheckSend 检查群成员是否可以发送消息（慢速模式、新成员观察期） 群主和管理员不受限制
+// 每条消息都会检查 群设置和成员信息优先从缓存读取
+func (s *Service) CheckSend(req *CheckSendReq) (*CheckSendResp, error) {
+	allowResp := &CheckSendResp{Allow: true}
+	limit, err := s.getSendLimit(req.GroupNo)
+	if err != nil {
+		s.Error("查询群信息失败！", zap.Error(err))
+		return nil, errors.New("查询群信息失败！")
+	}
+	if limit.SlowMode <= 0 && limit.NewMemberProbation <= 0 {
+		return allowResp, nil
+	}
+	member, err := s.getSendLimitMember(req.GroupNo, req.UID)
+	if err != nil {
+		s.Error("查询群成员失败！", zap.Error(err))
+		return nil, errors.New("查询群成员失败！")
+	}
+	if member.Exempt {
+		return allowResp, nil
+	}
+	if inProbation(limit.NewMemberProbation, time.Unix(member.JoinedAt, 0), time.Now()) && isLinkOrMedia(req.ContentType, req.Content) {
+		return &CheckSendResp{
+			Reason: "新成员入群未满观察期，不能发送链接、图片等消息！",
+		}, nil
+	}
+	if limit.SlowMode > 0 {
+		key := fmt.Sprintf("groupSlowMode:%s:%s", req.GroupNo, req.UID)
+		allow, retryAfter, err := s.ctx.GetRateLimiter().Allow(key, 1, time.Duration(limit.SlowMode)*time.Second)
+		if err != nil {
+			s.Error("慢速模式限流检查失败！", zap.Error(err))
+			return allowResp, nil
+		}
+		if !allow {
+			return &CheckSendResp{
+				Reason:     "群已开启慢速模式，发言过于频繁！",
+				RetryAfter: int64(retryAfter.Seconds()) + 1,
+			}, nil
+		}
+	}
+	return allowResp, nil
+}
+
+// getSendLimit 获取群的发送限制设置 群不存在时没有限制
+func (s *Service) getSendLimit(groupNo string) (*sendLimit, error) {
+	cacheKey := sendLimitCacheKey(groupNo)
+	if value, err := s.ctx.Cache().Get(cacheKey); err == nil && value != "" {
+		var limit sendLimit
+		if err = util.ReadJsonByByte([]byte(value), &limit); err == nil {
+			return &limit, nil
+		}
+	}
+	group, err := s.db.QueryWithGroupNo(groupNo)
+	if err != nil {
+		return nil, err
+	}
+	limit := &sendLimit{}
+	if group != nil {
+		limit.SlowMode = group.SlowMode
+		limit.NewMemberProbation = group.NewMemberProbation
+	}
+	if err = s.ctx.Cache().SetAndExpire(cacheKey, util.ToJson(limit), sendLimitCacheExpire); err != nil {
+		s.Warn("缓存群发送限制失败！", zap.Error(err))
+	}
+	return limit, nil
+}
+
+// getSendLimitMember 获取发送限制需要的成员信息
+func (s *Service) getSendLimitMember(groupNo string, uid string) (*sendLimitMember, error) {
+	cacheKey := fmt.Sprintf("groupSendLimitMember:%s:%s", groupNo, uid)
+	if value, err := s.ctx.Cache().Get(cacheKey); err == nil && value != "" {
+		var member sendLimitMember
+		if err = util.ReadJsonByByte([]byte(value), &member); err == nil {
+			return &member, nil
+		}
+	}
+	memberModel, err := s.db.QueryMemberWithUID(uid, groupNo)
+	if err != nil {
+		return nil, err
+	}
+	member := &sendLimitMember{Exempt: true}
+	if memberModel != nil {
+		member.Exempt = memberModel.Role == MemberRoleCreator || memberModel.Role == MemberRoleManager || memberModel.Robot == 1
+		member.JoinedAt = time.Time(memberModel.CreatedAt).Unix()
+	}
+	if err = s.ctx.Cache().SetAndExpire(cacheKey, util.ToJson(member), sendLimitCacheExpire); err != nil {
+		s.Warn("缓存群成员发送限制信息失败！", zap.Error(err))
+	}
+	return member, nil
+}
+
+// sendLimitCacheKey 群发送限制设置的缓存key
+func sendLimitCacheKey(groupNo string) string {
+	return fmt.Sprintf("groupSendLimit:%s", groupNo)
+}
+
+// deleteSendLimitCache 群设置修改后删除发送限制缓存
+func deleteSendLimitCache(ctx *config.Context, groupNo string) {
+	if err := ctx.Cache().Delete(sendLimitCacheKey(groupNo)); err != nil {
+		log.Warn("删除群发送限制缓存失败！", zap.Error(err), zap.String("groupNo", groupNo))
+	}
+}
+
+// inProbation 成员是否还在新成员观察期内
+func inProbation(probationSecond int, joinedAt time.Time, now time.Time) bool {
+	if probationSecond <= 0 {
+		return false
+	}
+	return now.Before(joinedAt.Add(time.Duration(probationSecond) * time.Second))
+}
+
+// isLinkOrMedia 是否是链接或媒体消息
+func isLinkOrMedia(contentType common.ContentType, content string) bool {
+	switch contentType {
+	case common.Image, common.GIF, common.Voice, common.Video, common.File:
+		return true
+	case common.Text:
+		return linkRegexp.MatchString(content)
+	}
+	return false
+}
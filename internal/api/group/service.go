@@ -44,12 +44,16 @@ type IService interface {
 	GetMemberUIDsOfManager(groupNo string) ([]string, error)
 	// 是否是创建者或管理者
 	IsCreatorOrManager(groupNo string, uid string) (bool, error)
+	// 是否是创建者或拥有指定权限的管理者
+	HasManagerPermission(groupNo string, uid string, permission ManagerPermission) (bool, error)
 	// 获取成员总数量和在线数量
 	// 第一个返回参数为成员总数量
 	// 第二个返回参数为在线数量
 	GetMemberTotalAndOnlineCount(groupNo string) (int, int, error)
 	// 是否存在群成员
 	ExistMember(groupNo string, uid string) (bool, error)
+	// 查询成员入群时间（秒） 不是群成员返回0
+	GetMemberJoinedAt(groupNo string, uid string) (int64, error)
 	// 成员是否在某群里存在 返回对应在群里的群编号
 	ExistMembers(groupNos []string, uid string) ([]string, error)
 	// GetGroupsWithMemberUID 获取某个用户的所有群
@@ -58,6 +62,8 @@ type IService interface {
 	GetGroupMemberMaxVersion(groupNo string) (int64, error)
 	// 获取用户所有超级群信息
 	GetUserSupers(uid string) ([]*InfoResp, error)
+	// CheckSend 检查群成员是否可以发送消息（慢速模式、新成员观察期）
+	CheckSend(req *CheckSendReq) (*CheckSendResp, error)
 }
 
 // Service Service
@@ -272,6 +278,10 @@ func (s *Service) IsCreatorOrManager(groupNo string, uid string) (bool, error) {
 	return s.db.QueryIsGroupManagerOrCreator(groupNo, uid)
 }
 
+func (s *Service) HasManagerPermission(groupNo string, uid string, permission ManagerPermission) (bool, error) {
+	return s.db.QueryHasManagerPermission(groupNo, uid, permission)
+}
+
 func (s *Service) GetMemberTotalAndOnlineCount(groupNo string) (int, int, error) {
 	var onlineCount, memberCount int64
 	var err error
@@ -290,6 +300,17 @@ func (s *Service) ExistMember(groupNo string, uid string) (bool, error) {
 	return s.db.ExistMember(uid, groupNo)
 }
 
+func (s *Service) GetMemberJoinedAt(groupNo string, uid string) (int64, error) {
+	member, err := s.db.QueryMemberWithUID(uid, groupNo)
+	if err != nil {
+		return 0, err
+	}
+	if member == nil {
+		return 0, nil
+	}
+	return time.Time(member.CreatedAt).Unix(), nil
+}
+
 func (s *Service) ExistMembers(groupNos []string, uid string) ([]string, error) {
 	return s.db.existMembers(groupNos, uid)
 }
@@ -341,6 +362,10 @@ type InfoResp struct {
 	Invite              int       `json:"invite"`                 // 是否开启邀请确认 0.否 1.是
 	ForbiddenAddFriend  int       `json:"forbidden_add_friend"`   //群内禁止加好友
 	AllowViewHistoryMsg int       `json:"allow_view_history_msg"` // 是否允许新成员查看历史记录
+	JoinMode            int       `json:"join_mode"`              // 入群方式 0.公开 1.仅限邀请 2.需要审批
+	SlowMode            int       `json:"slow_mode"`              // 慢速模式 每位成员发言间隔秒数
+	NewMemberProbation  int       `json:"new_member_probation"`   // 新成员观察期秒数
+	ForbiddenForward    int       `json:"forbidden_forward"`      // 禁止转发和保存群消息
 	CreatedAt           string    `json:"created_at"`
 	UpdatedAt           string    `json:"updated_at"`
 	Version             int64     `json:"version"` // 群数据版本
@@ -358,6 +383,10 @@ func toInfoResp(m *Model) *InfoResp {
 		Invite:              m.Invite,
 		ForbiddenAddFriend:  m.ForbiddenAddFriend,
 		AllowViewHistoryMsg: m.AllowViewHistoryMsg,
+		JoinMode:            m.JoinMode,
+		SlowMode:            m.SlowMode,
+		NewMemberProbation:  m.NewMemberProbation,
+		ForbiddenForward:    m.ForbiddenForward,
 		CreatedAt:           m.CreatedAt.String(),
 		UpdatedAt:           m.UpdatedAt.String(),
 		Version:             m.Version,
@@ -372,6 +401,7 @@ type MemberResp struct {
 	Role    int    // 成员角色
 	Version int64
 	Vercode string //验证码
+	Title   string // 头衔
 }
 
 func newMemberResp(m *MemberDetailModel) *MemberResp {
@@ -383,6 +413,7 @@ func newMemberResp(m *MemberDetailModel) *MemberResp {
 		Role:    m.Role,
 		Version: m.Version,
 		Vercode: m.Vercode,
+		Title:   m.Title,
 	}
 }
 
@@ -399,6 +430,8 @@ type SettingResp struct {
 	RevokeRemind    int    //撤回通知
 	JoinGroupRemind int    //进群提醒
 	Receipt         int    //消息是否回执
+	Flame           int    // 是否开启阅后即焚
+	FlameSecond     int    // 阅后即焚秒数
 	Remark          string // 群备注
 	Version         int64  // 版本
 }
@@ -415,6 +448,8 @@ func toSettingResp(m *Setting) *SettingResp {
 		RevokeRemind:    m.RevokeRemind,
 		JoinGroupRemind: m.JoinGroupRemind,
 		Receipt:         m.Receipt,
+		Flame:           m.Flame,
+		FlameSecond:     m.FlameSecond,
 		Remark:          m.Remark,
 		Version:         m.Version,
 		UID:             m.UID,
@@ -443,6 +478,10 @@ type GroupResp struct {
 	Flame               int       `json:"flame"`                  // 阅后即焚
 	FlameSecond         int       `json:"flame_second"`           // 阅后即焚秒数
 	AllowViewHistoryMsg int       `json:"allow_view_history_msg"` // 是否允许新成员查看历史消息
+	JoinMode            int       `json:"join_mode"`              // 入群方式 0.公开 1.仅限邀请 2.需要审批
+	SlowMode            int       `json:"slow_mode"`              // 慢速模式 每位成员发言间隔秒数
+	NewMemberProbation  int       `json:"new_member_probation"`   // 新成员观察期秒数
+	ForbiddenForward    int       `json:"forbidden_forward"`      // 禁止转发和保存群消息
 	MemberCount         int       `json:"member_count"`           // 成员数量
 	OnlineCount         int       `json:"online_count"`           // 在线数量
 	Quit                int       `json:"quit"`                   // 我是否已退出群聊
@@ -477,6 +516,10 @@ func (g *GroupResp) from(model *DetailModel) *GroupResp {
 		FlameSecond:         model.FlameSecond,
 		Status:              model.Status,
 		AllowViewHistoryMsg: model.AllowViewHistoryMsg,
+		JoinMode:            model.JoinMode,
+		SlowMode:            model.SlowMode,
+		NewMemberProbation:  model.NewMemberProbation,
+		ForbiddenForward:    model.ForbiddenForward,
 		CreatedAt:           model.CreatedAt.String(),
 		UpdatedAt:           model.UpdatedAt.String(),
 	}
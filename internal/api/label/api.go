@@ -0,0 +1,567 @@
+package label
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/api/message"
+	"github.com/WuKongIM/WuKongChatServer/internal/api/user"
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/log"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	labelNameMaxLen = 20  // 标签名最大长度
+	labelMaxCount   = 100 // 每个用户最多可创建的标签数量
+)
+
+// Label 联系人标签
+type Label struct {
+	ctx *config.Context
+	log.Log
+	db             *db
+	userService    user.IService
+	messageService message.IService
+}
+
+// New 创建标签对象
+func New(ctx *config.Context) *Label {
+	return &Label{
+		ctx:            ctx,
+		Log:            log.NewTLog("Label"),
+		db:             newDB(ctx),
+		userService:    user.NewService(ctx),
+		messageService: message.NewService(ctx),
+	}
+}
+
+// Route 配置路由规则
+func (l *Label) Route(r *wkhttp.WKHttp) {
+	labels := r.Group("/v1/labels", r.AuthMiddleware(l.ctx.Cache(), l.ctx.GetConfig().TokenCachePrefix))
+	{
+		labels.POST("", l.add)                          // 创建标签
+		labels.GET("", l.list)                          // 标签列表
+		labels.PUT("/:id", l.rename)                    // 修改标签名
+		labels.DELETE("/:id", l.delete)                 // 删除标签
+		labels.GET("/:id/members", l.members)           // 标签下的好友
+		labels.POST("/:id/members", l.addMembers)       // 添加好友到标签
+		labels.DELETE("/:id/members", l.removeMembers)  // 从标签移除好友
+		labels.POST("/message", l.sendMessageToMembers) // 给标签内的好友群发消息
+	}
+	label := r.Group("/v1/label", r.AuthMiddleware(l.ctx.Cache(), l.ctx.GetConfig().TokenCachePrefix))
+	{
+		label.POST("/sync", l.sync) // 同步标签
+	}
+}
+
+// 创建标签
+func (l *Label) add(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		Name       string   `json:"name"`
+		MemberUIDs []string `json:"member_uids"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	name, err := l.checkName(loginUID, req.Name, 0)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	count, err := l.db.queryCount(loginUID)
+	if err != nil {
+		l.Error("查询标签数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询标签数量失败！"))
+		return
+	}
+	if count >= labelMaxCount {
+		c.ResponseError(fmt.Errorf("最多只能创建%d个标签！", labelMaxCount))
+		return
+	}
+	memberUIDs, err := l.filterFriends(loginUID, req.MemberUIDs)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, _ := l.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	id, err := l.db.insertTx(&model{
+		UID:     loginUID,
+		Name:    name,
+		Version: l.genLabelSeq(loginUID),
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		l.Error("创建标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("创建标签失败！"))
+		return
+	}
+	err = l.db.insertMembersTx(id, loginUID, memberUIDs, tx)
+	if err != nil {
+		tx.Rollback()
+		l.Error("添加标签成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加标签成员失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		l.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("创建标签失败！"))
+		return
+	}
+	l.sendSyncLabelCMD(loginUID)
+	c.Response(map[string]interface{}{
+		"id": id,
+	})
+}
+
+// 标签列表
+func (l *Label) list(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	models, err := l.db.queryWithUID(loginUID)
+	if err != nil {
+		l.Error("查询标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询标签失败！"))
+		return
+	}
+	resps, err := l.toLabelResps(models)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.Response(resps)
+}
+
+// 修改标签名
+func (l *Label) rename(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	labelM, err := l.getLabel(c.Param("id"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	name, err := l.checkName(loginUID, req.Name, labelM.Id)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = l.db.updateName(labelM.Id, name, l.genLabelSeq(loginUID))
+	if err != nil {
+		l.Error("修改标签名失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改标签名失败！"))
+		return
+	}
+	l.sendSyncLabelCMD(loginUID)
+	c.ResponseOK()
+}
+
+// 删除标签
+func (l *Label) delete(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	labelM, err := l.getLabel(c.Param("id"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, _ := l.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = l.db.updateDeletedTx(labelM.Id, l.genLabelSeq(loginUID), tx)
+	if err != nil {
+		tx.Rollback()
+		l.Error("删除标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除标签失败！"))
+		return
+	}
+	err = l.db.deleteAllMembersTx(labelM.Id, tx)
+	if err != nil {
+		tx.Rollback()
+		l.Error("删除标签成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除标签成员失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		l.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除标签失败！"))
+		return
+	}
+	l.sendSyncLabelCMD(loginUID)
+	c.ResponseOK()
+}
+
+// 标签下的好友
+func (l *Label) members(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	labelM, err := l.getLabel(c.Param("id"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	memberModels, err := l.db.queryMembers([]int64{labelM.Id})
+	if err != nil {
+		l.Error("查询标签成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询标签成员失败！"))
+		return
+	}
+	memberUIDs := make([]string, 0, len(memberModels))
+	for _, memberM := range memberModels {
+		memberUIDs = append(memberUIDs, memberM.MemberUID)
+	}
+	resps := make([]*memberResp, 0, len(memberUIDs))
+	if len(memberUIDs) > 0 {
+		friends, err := l.userService.GetFriendsWithToUIDs(loginUID, memberUIDs)
+		if err != nil {
+			l.Error("查询好友失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询好友失败！"))
+			return
+		}
+		for _, friend := range friends {
+			resps = append(resps, &memberResp{
+				UID:  friend.UID,
+				Name: friend.Name,
+			})
+		}
+	}
+	c.Response(resps)
+}
+
+// 添加好友到标签
+func (l *Label) addMembers(c *wkhttp.Context) {
+	l.updateMembers(c, true)
+}
+
+// 从标签移除好友
+func (l *Label) removeMembers(c *wkhttp.Context) {
+	l.updateMembers(c, false)
+}
+
+func (l *Label) updateMembers(c *wkhttp.Context, add bool) {
+	loginUID := c.GetLoginUID()
+	labelM, err := l.getLabel(c.Param("id"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req struct {
+		UIDs []string `json:"uids"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if len(req.UIDs) == 0 {
+		c.ResponseError(errors.New("uids不能为空！"))
+		return
+	}
+	uids := util.RemoveRepeatedElement(req.UIDs)
+	if add {
+		uids, err = l.filterFriends(loginUID, uids)
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+	}
+	tx, _ := l.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	if add {
+		err = l.db.insertMembersTx(labelM.Id, loginUID, uids, tx)
+	} else {
+		err = l.db.deleteMembersTx(labelM.Id, uids, tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		l.Error("修改标签成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改标签成员失败！"))
+		return
+	}
+	err = l.db.updateVersionTx(labelM.Id, l.genLabelSeq(loginUID), tx)
+	if err != nil {
+		tx.Rollback()
+		l.Error("更新标签版本失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改标签成员失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		l.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改标签成员失败！"))
+		return
+	}
+	l.sendSyncLabelCMD(loginUID)
+	c.ResponseOK()
+}
+
+// 给标签内的好友群发消息
+func (l *Label) sendMessageToMembers(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		LabelIDs []int64                `json:"label_ids"`
+		Payload  map[string]interface{} `json:"payload"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if len(req.LabelIDs) == 0 {
+		c.ResponseError(errors.New("标签不能为空！"))
+		return
+	}
+	if len(req.Payload) == 0 {
+		c.ResponseError(errors.New("消息内容不能为空！"))
+		return
+	}
+	labelModels, err := l.db.queryWithIDs(loginUID, req.LabelIDs)
+	if err != nil {
+		l.Error("查询标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询标签失败！"))
+		return
+	}
+	labelIDs := make([]int64, 0, len(labelModels))
+	for _, labelM := range labelModels {
+		labelIDs = append(labelIDs, labelM.Id)
+	}
+	memberModels, err := l.db.queryMembers(labelIDs)
+	if err != nil {
+		l.Error("查询标签成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询标签成员失败！"))
+		return
+	}
+	memberUIDs := make([]string, 0, len(memberModels))
+	for _, memberM := range memberModels {
+		memberUIDs = append(memberUIDs, memberM.MemberUID)
+	}
+	// 只给仍是好友的成员发送
+	friendUIDs, err := l.filterFriends(loginUID, util.RemoveRepeatedElement(memberUIDs))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	// 服务端代发不经过IM的权限检查 跳过存在黑名单等不能发送的成员
+	toUIDs := make([]string, 0, len(friendUIDs))
+	for _, friendUID := range friendUIDs {
+		if err := l.messageService.CheckSendPermission(loginUID, friendUID, common.ChannelTypePerson.Uint8()); err != nil {
+			continue
+		}
+		toUIDs = append(toUIDs, friendUID)
+	}
+	if len(toUIDs) == 0 {
+		c.ResponseError(errors.New("标签内没有可发送的好友！"))
+		return
+	}
+	go l.sendMessageBatch(loginUID, toUIDs, []byte(util.ToJson(req.Payload)))
+	c.Response(map[string]interface{}{
+		"count": len(toUIDs),
+	})
+}
+
+func (l *Label) sendMessageBatch(fromUID string, toUIDs []string, payload []byte) {
+	for _, uids := range splitUIDs(toUIDs, 1000) {
+		err := l.ctx.SendMessageBatch(&config.MsgSendBatch{
+			Header: config.MsgHeader{
+				RedDot: 1,
+			},
+			FromUID:     fromUID,
+			Payload:     payload,
+			Subscribers: uids,
+		})
+		if err != nil {
+			l.Error("发送标签群发消息失败！", zap.Error(err))
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// 同步标签
+func (l *Label) sync(c *wkhttp.Context) {
+	var req struct {
+		Version int64  `json:"version"`
+		Limit   uint64 `json:"limit"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 200 {
+		req.Limit = 200
+	}
+	models, err := l.db.sync(c.GetLoginUID(), req.Version, req.Limit)
+	if err != nil {
+		l.Error("同步标签失败！", zap.Error(err))
+		c.ResponseError(errors.New("同步标签失败！"))
+		return
+	}
+	syncModels := make([]*model, 0, len(models))
+	for _, m := range models {
+		if req.Version == 0 && m.IsDeleted == 1 { // 首次同步不需要已删除的
+			continue
+		}
+		syncModels = append(syncModels, m)
+	}
+	resps, err := l.toLabelResps(syncModels)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.Response(resps)
+}
+
+func (l *Label) getLabel(idStr string, loginUID string) (*model, error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, errors.New("标签ID格式有误！")
+	}
+	m, err := l.db.queryWithID(id)
+	if err != nil {
+		l.Error("查询标签失败！", zap.Error(err))
+		return nil, errors.New("查询标签失败！")
+	}
+	if m == nil || m.UID != loginUID || m.IsDeleted == 1 {
+		return nil, errors.New("标签不存在！")
+	}
+	return m, nil
+}
+
+func (l *Label) checkName(loginUID string, name string, excludeID int64) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("标签名不能为空！")
+	}
+	if utf8.RuneCountInString(name) > labelNameMaxLen {
+		return "", fmt.Errorf("标签名不能超过%d个字！", labelNameMaxLen)
+	}
+	exist, err := l.db.existName(loginUID, name, excludeID)
+	if err != nil {
+		l.Error("查询标签名是否存在失败！", zap.Error(err))
+		return "", errors.New("查询标签名是否存在失败！")
+	}
+	if exist {
+		return "", errors.New("标签名已存在！")
+	}
+	return name, nil
+}
+
+// filterFriends 过滤出是好友的uid
+func (l *Label) filterFriends(loginUID string, uids []string) ([]string, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	friends, err := l.userService.GetFriendsWithToUIDs(loginUID, uids)
+	if err != nil {
+		l.Error("查询好友失败！", zap.Error(err))
+		return nil, errors.New("查询好友失败！")
+	}
+	friendUIDs := make([]string, 0, len(friends))
+	for _, friend := range friends {
+		friendUIDs = append(friendUIDs, friend.UID)
+	}
+	return friendUIDs, nil
+}
+
+func (l *Label) toLabelResps(models []*model) ([]*labelResp, error) {
+	labelIDs := make([]int64, 0, len(models))
+	for _, m := range models {
+		if m.IsDeleted == 0 {
+			labelIDs = append(labelIDs, m.Id)
+		}
+	}
+	memberModels, err := l.db.queryMembers(labelIDs)
+	if err != nil {
+		l.Error("查询标签成员失败！", zap.Error(err))
+		return nil, errors.New("查询标签成员失败！")
+	}
+	memberMap := map[int64][]string{}
+	for _, memberM := range memberModels {
+		memberMap[memberM.LabelID] = append(memberMap[memberM.LabelID], memberM.MemberUID)
+	}
+	resps := make([]*labelResp, 0, len(models))
+	for _, m := range models {
+		memberUIDs := memberMap[m.Id]
+		if memberUIDs == nil {
+			memberUIDs = make([]string, 0)
+		}
+		resps = append(resps, &labelResp{
+			ID:         m.Id,
+			Name:       m.Name,
+			MemberUIDs: memberUIDs,
+			Count:      len(memberUIDs),
+			IsDeleted:  m.IsDeleted,
+			Version:    m.Version,
+		})
+	}
+	return resps, nil
+}
+
+func splitUIDs(uids []string, size int) [][]string {
+	groups := make([][]string, 0, len(uids)/size+1)
+	for len(uids) > size {
+		groups = append(groups, uids[:size])
+		uids = uids[size:]
+	}
+	if len(uids) > 0 {
+		groups = append(groups, uids)
+	}
+	return groups
+}
+
+func (l *Label) sendSyncLabelCMD(uid string) {
+	err := l.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   uid,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		CMD:         common.CMDSyncLabel,
+	})
+	if err != nil {
+		l.Error("发送同步标签cmd失败！", zap.Error(err))
+	}
+}
+
+func (l *Label) genLabelSeq(uid string) int64 {
+	return l.ctx.GenSeq(fmt.Sprintf("%s:%s", common.LabelSeqKey, uid))
+}
+
+type labelResp struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	MemberUIDs []string `json:"member_uids"`
+	Count      int      `json:"count"`
+	IsDeleted  int      `json:"is_deleted"`
+	Version    int64    `json:"version"`
+}
+
+type memberResp struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+}
@@ -0,0 +1,39 @@
+package label
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/testutil"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddAndList(t *testing.T) {
+	s, ctx := testutil.NewTestServer()
+	l := New(ctx)
+	l.Route(s.GetRoute())
+
+	req, _ := http.NewRequest("POST", "/v1/labels", bytes.NewReader([]byte(util.ToJson(map[string]interface{}{
+		"name": "同事",
+	}))))
+	w := httptest.NewRecorder()
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/v1/labels", nil)
+	w = httptest.NewRecorder()
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, bytes.Contains(w.Body.Bytes(), []byte(`"name":"同事"`)))
+}
+
+func TestSplitUIDs(t *testing.T) {
+	groups := splitUIDs([]string{"1", "2", "3", "4", "5"}, 2)
+	assert.Equal(t, 3, len(groups))
+	assert.Equal(t, []string{"5"}, groups[2])
+}
@@ -0,0 +1,136 @@
+package label
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	dba "github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type db struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newDB(ctx *config.Context) *db {
+	return &db{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+func (d *db) insertTx(m *model, tx *dbr.Tx) (int64, error) {
+	result, err := tx.InsertInto("label").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (d *db) queryWithID(id int64) (*model, error) {
+	var m *model
+	_, err := d.session.Select("*").From("label").Where("id=?", id).Load(&m)
+	return m, err
+}
+
+func (d *db) queryWithIDs(uid string, ids []int64) ([]*model, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var models []*model
+	_, err := d.session.Select("*").From("label").Where("uid=? and is_deleted=0 and id in ?", uid, ids).Load(&models)
+	return models, err
+}
+
+func (d *db) existName(uid string, name string, excludeID int64) (bool, error) {
+	var count int
+	_, err := d.session.Select("count(*)").From("label").Where("uid=? and name=? and is_deleted=0 and id<>?", uid, name, excludeID).Load(&count)
+	return count > 0, err
+}
+
+func (d *db) queryCount(uid string) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("label").Where("uid=? and is_deleted=0", uid).Load(&count)
+	return count, err
+}
+
+func (d *db) queryWithUID(uid string) ([]*model, error) {
+	var models []*model
+	_, err := d.session.Select("*").From("label").Where("uid=? and is_deleted=0", uid).OrderAsc("id").Load(&models)
+	return models, err
+}
+
+// sync 同步标签（包含已删除的，客户端据此移除）
+func (d *db) sync(uid string, version int64, limit uint64) ([]*model, error) {
+	var models []*model
+	_, err := d.session.Select("*").From("label").Where("uid=? and version>?", uid, version).OrderAsc("version").Limit(limit).Load(&models)
+	return models, err
+}
+
+func (d *db) updateName(id int64, name string, version int64) error {
+	_, err := d.session.Update("label").SetMap(map[string]interface{}{
+		"name":    name,
+		"version": version,
+	}).Where("id=?", id).Exec()
+	return err
+}
+
+func (d *db) updateVersionTx(id int64, version int64, tx *dbr.Tx) error {
+	_, err := tx.Update("label").Set("version", version).Where("id=?", id).Exec()
+	return err
+}
+
+func (d *db) updateDeletedTx(id int64, version int64, tx *dbr.Tx) error {
+	_, err := tx.Update("label").SetMap(map[string]interface{}{
+		"is_deleted": 1,
+		"version":    version,
+	}).Where("id=?", id).Exec()
+	return err
+}
+
+func (d *db) insertMembersTx(labelID int64, uid string, memberUIDs []string, tx *dbr.Tx) error {
+	for _, memberUID := range memberUIDs {
+		_, err := tx.InsertBySql("INSERT IGNORE INTO label_member (label_id,uid,member_uid) VALUES (?,?,?)", labelID, uid, memberUID).Exec()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *db) deleteMembersTx(labelID int64, memberUIDs []string, tx *dbr.Tx) error {
+	if len(memberUIDs) == 0 {
+		return nil
+	}
+	_, err := tx.DeleteFrom("label_member").Where("label_id=? and member_uid in ?", labelID, memberUIDs).Exec()
+	return err
+}
+
+func (d *db) deleteAllMembersTx(labelID int64, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("label_member").Where("label_id=?", labelID).Exec()
+	return err
+}
+
+func (d *db) queryMembers(labelIDs []int64) ([]*memberModel, error) {
+	if len(labelIDs) == 0 {
+		return nil, nil
+	}
+	var models []*memberModel
+	_, err := d.session.Select("*").From("label_member").Where("label_id in ?", labelIDs).OrderAsc("id").Load(&models)
+	return models, err
+}
+
+type model struct {
+	UID       string // 标签所属用户
+	Name      string // 标签名称
+	IsDeleted int
+	Version   int64
+	dba.BaseModel
+}
+
+type memberModel struct {
+	LabelID   int64
+	UID       string
+	MemberUID string
+	dba.BaseModel
+}
@@ -8,7 +8,6 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/WuKongIM/WuKongChatServer/internal/api/base/event"
 	commonapi "github.com/WuKongIM/WuKongChatServer/internal/api/common"
@@ -21,32 +20,46 @@ import (
 	"github.com/WuKongIM/WuKongChatServer/pkg/network"
 	"github.com/WuKongIM/WuKongChatServer/pkg/util"
 	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
-	"github.com/gin-gonic/gin"
-	"github.com/gocraft/dbr/v2"
 	"github.com/pkg/errors"
 	"github.com/sendgrid/rest"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 // Message 消息相关API
 type Message struct {
 	ctx *config.Context
 	log.Log
-	db                  *DB
-	messageReactionDB   *messageReactionDB
-	userDB              *user.DB
-	messageExtraDB      *messageExtraDB
-	memberChangeDB      *memberChangeDB
-	memberReadedDB      *memberReadedDB
-	channelOffsetDB     *channelOffsetDB
-	deviceOffsetDB      *deviceOffsetDB
-	conversationExtradb *conversationExtraDB
-	messageUserExtraDB  *messageUserExtraDB
-	remindersDB         *remindersDB
-	userService         user.IService
-	groupService        group.IService
-	commonService       commonapi.IService
-	fileService         file.IService
+	db                    *DB
+	messageReactionDB     *messageReactionDB
+	userDB                *user.DB
+	messageExtraDB        *messageExtraDB
+	memberChangeDB        *memberChangeDB
+	memberReadedDB        *memberReadedDB
+	channelOffsetDB       *channelOffsetDB
+	deviceOffsetDB        *deviceOffsetDB
+	conversationExtradb   *conversationExtraDB
+	messageUserExtraDB    *messageUserExtraDB
+	remindersDB           *remindersDB
+	flameDB               *flameDB
+	messageEditHistoryDB  *messageEditHistoryDB
+	scheduledMessageDB    *scheduledMessageDB
+	pinnedMessageDB       *pinnedMessageDB
+	threadDB              *threadDB
+	pollDB                *pollDB
+	conversationCounterDB *conversationCounterDB
+	messageTranslationDB  *messageTranslationDB
+	linkPreviewDB         *linkPreviewDB
+	linkPreviewFetcher    *linkPreviewFetcher
+	linkPreviewQueue      *taskQueue
+	linkPreviewCalls      *singleflight.Group // 同一链接的并发抓取只执行一次
+	transcribeQueue       *taskQueue
+	translateQueue        *taskQueue
+	messageService        IService
+	userService           user.IService
+	groupService          group.IService
+	commonService         commonapi.IService
+	fileService           file.IService
 }
 
 // New New
@@ -54,23 +67,38 @@ func New(ctx *config.Context) *Message {
 
 	m := &Message{
 
-		ctx:                 ctx,
-		Log:                 log.NewTLog("Message"),
-		db:                  NewDB(ctx),
-		userDB:              user.NewDB(ctx),
-		messageExtraDB:      newMessageExtraDB(ctx),
-		groupService:        group.NewService(ctx),
-		memberChangeDB:      newMemberChangeDB(ctx),
-		memberReadedDB:      newMemberReadedDB(ctx),
-		conversationExtradb: newConversationExtraDB(ctx),
-		messageReactionDB:   newMessageReactionDB(ctx),
-		messageUserExtraDB:  newMessageUserExtraDB(ctx),
-		channelOffsetDB:     newChannelOffsetDB(ctx),
-		deviceOffsetDB:      newDeviceOffsetDB(ctx.DB()),
-		remindersDB:         newRemindersDB(ctx),
-		userService:         user.NewService(ctx),
-		commonService:       commonapi.NewService(ctx),
-		fileService:         file.NewService(ctx),
+		ctx:                   ctx,
+		Log:                   log.NewTLog("Message"),
+		db:                    NewDB(ctx),
+		userDB:                user.NewDB(ctx),
+		messageExtraDB:        newMessageExtraDB(ctx),
+		groupService:          group.NewService(ctx),
+		memberChangeDB:        newMemberChangeDB(ctx),
+		memberReadedDB:        newMemberReadedDB(ctx),
+		conversationExtradb:   newConversationExtraDB(ctx),
+		messageReactionDB:     newMessageReactionDB(ctx),
+		messageUserExtraDB:    newMessageUserExtraDB(ctx),
+		channelOffsetDB:       newChannelOffsetDB(ctx),
+		deviceOffsetDB:        newDeviceOffsetDB(ctx.DB()),
+		remindersDB:           newRemindersDB(ctx),
+		flameDB:               newFlameDB(ctx),
+		messageEditHistoryDB:  newMessageEditHistoryDB(ctx),
+		scheduledMessageDB:    newScheduledMessageDB(ctx),
+		pinnedMessageDB:       newPinnedMessageDB(ctx),
+		threadDB:              newThreadDB(ctx),
+		pollDB:                newPollDB(ctx),
+		conversationCounterDB: newConversationCounterDB(ctx),
+		messageTranslationDB:  newMessageTranslationDB(ctx),
+		linkPreviewDB:         newLinkPreviewDB(ctx),
+		linkPreviewFetcher:    newLinkPreviewFetcher(ctx.GetConfig().LinkPreviewTimeout, ctx.GetConfig().LinkPreviewMaxHTMLSize, ctx.GetConfig().LinkPreviewMaxImageSize),
+		linkPreviewQueue:      newTaskQueue("linkPreview", 10, 1000),
+		linkPreviewCalls:      &singleflight.Group{},
+		transcribeQueue:       newTaskQueue("transcribe", 2, 500),
+		translateQueue:        newTaskQueue("translate", 4, 1000),
+		messageService:        NewService(ctx),
+		userService:           user.NewService(ctx),
+		commonService:         commonapi.NewService(ctx),
+		fileService:           file.NewService(ctx),
 	}
 	m.ctx.AddEventListener(event.GroupMemberAdd, m.handleGroupMemberAddEvent)
 	return m
@@ -88,7 +116,6 @@ func (m *Message) Route(r *wkhttp.WKHttp) {
 		message.POST("/offset", m.offset)                         // 清除某频道消息
 		message.PUT("/voicereaded", m.voiceReaded)                // 语音消息设置为已读
 		message.POST("/search", m.search)                         // 消息搜索
-		message.POST("/typing", m.typing)                         // 发送typing消息
 		message.POST("/channel/sync", m.syncChannelMessage)       // 同步频道消息
 		message.POST("/extra/sync", m.syncMessageExtra)           // 同步消息扩展
 		message.POST("/readed", m.messageReaded)                  // 消息已读
@@ -99,12 +126,38 @@ func (m *Message) Route(r *wkhttp.WKHttp) {
 		message.GET("/prohibit_words/sync", m.synccProhibitWords) // 同步违禁词
 		message.POST("/backup", m.backup)                         // 消息备份
 		message.GET("/recovery", m.recovery)                      // 消息回复
+
+		message.POST("/scheduled", m.scheduledMessageAdd)          // 添加定时消息
+		message.PUT("/scheduled/:id", m.scheduledMessageUpdate)    // 修改定时消息
+		message.DELETE("/scheduled/:id", m.scheduledMessageCancel) // 取消定时消息
+		message.POST("/scheduled/sync", m.scheduledMessageSync)    // 同步定时消息
+
+		message.POST("/pinned", m.pinMessage)             // 置顶消息
+		message.DELETE("/pinned", m.unpinMessage)         // 取消置顶消息
+		message.POST("/pinned/sync", m.syncPinnedMessage) // 同步置顶消息
+
+		message.POST("/poll", m.pollCreate)                  // 发起投票
+		message.GET("/poll/:poll_no", m.pollDetail)          // 投票详情
+		message.POST("/poll/:poll_no/vote", m.pollVote)      // 投票
+		message.DELETE("/poll/:poll_no/vote", m.pollRetract) // 撤回投票
+		message.POST("/poll/:poll_no/close", m.pollClose)    // 结束投票
+		message.GET("/poll/:poll_no/export", m.pollExport)   // 导出投票结果
+
+		message.POST("/translate", m.ctx.RateLimit("message.translate"), m.translate) // 翻译消息
+
+		message.POST("/forward", m.forward) // 转发消息
+
+		message.GET("/link_preview", m.ctx.RateLimit("message.linkpreview"), m.linkPreview) // 获取链接预览
+
+		// 发送typing消息
+		message.POST("/typing", m.ctx.RateLimit("message.typing"), m.typing)
 	}
 	messages := r.Group("/v1/messages", r.AuthMiddleware(m.ctx.Cache(), m.ctx.GetConfig().TokenCachePrefix))
 	{
-		messages.GET("/:message_id/replies", m.syncMessageReplies) // 获取消息回复详情
+		messages.GET("/:message_id/replies", m.syncMessageReplies) // 获取话题回复详情
 		// messages.PUT("/:message_id/voicereaded", m.voiceReaded)
 		messages.GET("/:message_id/receipt", m.messageReceiptList) // 消息回执列表
+		messages.GET("/:message_id/edits", m.messageEditHistory)   // 消息编辑历史
 	}
 	messageNoAuth := r.Group("/v1/message")
 	{
@@ -129,7 +182,17 @@ func (m *Message) Route(r *wkhttp.WKHttp) {
 	{
 		replyTotal.POST("/sync", m.syncReplyTotal) // 同步回复统计数据
 	}
+	thread := r.Group("/v1/thread", r.AuthMiddleware(m.ctx.Cache(), m.ctx.GetConfig().TokenCachePrefix))
+	{
+		thread.POST("/sync", m.syncThread) // 同步我参与的话题
+		thread.POST("/read", m.threadRead) // 话题已读
+	}
 	m.ctx.AddMessagesListener(m.listenerMessages) // 监听消息
+
+	m.ctx.Schedule(m.ctx.GetConfig().FlameCheckInterval, m.flameCheck)                       // 销毁到期的阅后即焚消息
+	m.ctx.Schedule(m.ctx.GetConfig().ScheduledMessageCheckInterval, m.scheduledMessageCheck) // 发送到期的定时消息
+	m.ctx.Schedule(m.ctx.GetConfig().PollCheckInterval, m.pollExpireCheck)                   // 结束到期的投票
+	m.ctx.Schedule(m.ctx.GetConfig().TranscribeCheckInterval, m.transcribeRecoverCheck)      // 恢复中断的语音转写
 }
 
 // 聊天消息回复
@@ -204,79 +267,65 @@ func (m *Message) backup(c *wkhttp.Context) {
 
 // 消息编辑
 func (m *Message) messageEdit(c *wkhttp.Context) {
-	var req struct {
-		MessageID   string `json:"message_id"`
-		MessageSeq  uint32 `json:"message_seq"`
-		ChannelID   string `json:"channel_id"`
-		ChannelType uint8  `json:"channel_type"`
-		ContentEdit string `json:"content_edit"`
-	}
+	var req EditMessageReq
 	if err := c.BindJSON(&req); err != nil {
 		c.ResponseErrorf("数据格式有误！", err)
 		return
 	}
-	if req.MessageID == "" {
-		c.ResponseError(errors.New("消息ID不能为空！"))
-		return
-	}
-	if req.MessageSeq == 0 {
-		c.ResponseError(errors.New("消息序号不能为空！"))
-		return
-	}
-	if req.ChannelID == "" {
-		c.ResponseError(errors.New("频道ID不能为空！"))
+	req.EditorUID = c.GetLoginUID()
+	if err := m.messageService.EditMessage(&req); err != nil {
+		c.ResponseError(err)
 		return
 	}
-	contentEdit := dbr.NewNullString(req.ContentEdit).String
-	contentMD5 := util.MD5(contentEdit)
+	c.ResponseOK()
+}
 
-	exist, err := m.messageExtraDB.existContentEdit(req.MessageID, contentMD5)
+// 消息编辑历史
+func (m *Message) messageEditHistory(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	messageID, err := strconv.ParseInt(c.Param("message_id"), 10, 64)
 	if err != nil {
-		m.Error("查询是否存在相同正文失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询是否存在相同正文失败！"))
+		c.ResponseError(errors.New("消息ID格式有误！"))
 		return
 	}
-	if exist {
-		m.Warn("存在相同编辑正文，不再处理！")
-		c.ResponseOK()
+	channelID := c.Query("channel_id")
+	channelType, _ := strconv.ParseInt(c.Query("channel_type"), 10, 64)
+	if channelID == "" {
+		c.ResponseError(errors.New("频道ID不能为空！"))
 		return
 	}
-	fakeChannelID := req.ChannelID
-	if req.ChannelType == common.ChannelTypePerson.Uint8() {
-		fakeChannelID = common.GetFakeChannelIDWith(c.GetLoginUID(), req.ChannelID)
-	}
-
-	version := m.genMessageExtraSeq(fakeChannelID)
-	err = m.messageExtraDB.insertOrUpdateContentEdit(&messageExtraModel{
-		MessageID:       req.MessageID,
-		MessageSeq:      req.MessageSeq,
-		ChannelID:       fakeChannelID,
-		ChannelType:     req.ChannelType,
-		ContentEdit:     dbr.NewNullString(req.ContentEdit),
-		ContentEditHash: contentMD5,
-		EditedAt:        int(time.Now().Unix()),
-		Version:         version,
-	})
-	if err != nil {
-		m.Error("添加或修改编辑内容失败！", zap.Error(err))
-		c.ResponseError(errors.New("添加或修改编辑内容失败！"))
+	fakeChannelID := channelID
+	if uint8(channelType) == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(loginUID, channelID)
+	} else if uint8(channelType) == common.ChannelTypeGroup.Uint8() {
+		isMember, err := m.groupService.ExistMember(channelID, loginUID)
+		if err != nil {
+			m.Error("查询是否是群成员失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询是否是群成员失败！"))
+			return
+		}
+		if !isMember {
+			c.ResponseError(errors.New("不是群成员，不能查看编辑历史！"))
+			return
+		}
+	} else { // 其他频道类型无法校验访问权限
+		c.ResponseError(errors.New("不支持的频道类型！"))
 		return
 	}
-
-	err = m.ctx.SendCMD(config.MsgCMDReq{
-		NoPersist:   true,
-		ChannelID:   req.ChannelID,
-		ChannelType: req.ChannelType,
-		FromUID:     c.GetLoginUID(),
-		CMD:         common.CMDSyncMessageExtra,
-	})
-
+	models, err := m.messageEditHistoryDB.queryWithMessageID(messageID)
 	if err != nil {
-		m.Error("发送cmd失败！", zap.Error(err))
-		c.ResponseError(err)
+		m.Error("查询消息编辑历史失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询消息编辑历史失败！"))
 		return
 	}
-	c.ResponseOK()
+	list := make([]*messageEditHistoryResp, 0, len(models))
+	for _, model := range models {
+		if model.ChannelID != fakeChannelID || model.ChannelType != uint8(channelType) {
+			continue
+		}
+		list = append(list, newMessageEditHistoryResp(model))
+	}
+	c.Response(list)
 }
 
 // 消息已读
@@ -315,6 +364,26 @@ func (m *Message) messageReaded(c *wkhttp.Context) {
 		c.ResponseError(errors.New("没有读取到消息！"))
 		return
 	}
+	readReceiptOn, err := m.readReceiptOn(c.GetLoginUID())
+	if err != nil {
+		m.Error("查询用户已读回执设置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户已读回执设置失败！"))
+		return
+	}
+	receiptMessages := messages
+	if req.ChannelType == common.ChannelTypePerson.Uint8() { // 单聊只回执对方发送的消息
+		receiptMessages = make([]*messageModel, 0, len(messages))
+		for _, message := range messages {
+			if message.FromUID != c.GetLoginUID() {
+				receiptMessages = append(receiptMessages, message)
+			}
+		}
+	}
+	if !readReceiptOn || len(receiptMessages) == 0 { // 关闭了已读回执 不通知发送者
+		m.addFlameIfNeed(messages, fakeChannelID, req.ChannelType, c.GetLoginUID())
+		c.ResponseOK()
+		return
+	}
 
 	tx, _ := m.ctx.DB().Begin()
 	defer func() {
@@ -324,8 +393,8 @@ func (m *Message) messageReaded(c *wkhttp.Context) {
 		}
 	}()
 
-	fromUIDs := make([]string, 0, len(messages)) // 消息发送者
-	for _, message := range messages {
+	fromUIDs := make([]string, 0, len(receiptMessages)) // 消息发送者
+	for _, message := range receiptMessages {
 		fromUIDs = append(fromUIDs, message.FromUID)
 		err := m.memberReadedDB.insertOrUpdateTx(&memberReadedModel{
 			MessageID:   message.MessageID,
@@ -362,7 +431,7 @@ func (m *Message) messageReaded(c *wkhttp.Context) {
 		}
 	}()
 
-	for _, message := range messages {
+	for _, message := range receiptMessages {
 		version := m.genMessageExtraSeq(fakeChannelID)
 		count := messageReadedCountMap[message.MessageID]
 		if req.ChannelType == common.ChannelTypePerson.Uint8() {
@@ -414,10 +483,31 @@ func (m *Message) messageReaded(c *wkhttp.Context) {
 		return
 	}
 
+	// 阅后即焚
+	m.addFlameIfNeed(messages, fakeChannelID, req.ChannelType, c.GetLoginUID())
+
 	c.ResponseOK()
 
 }
 
+// readReceiptOn 用户是否开启了已读回执
+func (m *Message) readReceiptOn(uid string) (bool, error) {
+	userResp, err := m.userService.GetUser(uid)
+	if err != nil {
+		return false, err
+	}
+	return userResp == nil || userResp.ReadReceipt == 1, nil
+}
+
+// typingIndicatorOn 用户是否开启了输入中状态
+func (m *Message) typingIndicatorOn(uid string) (bool, error) {
+	userResp, err := m.userService.GetUser(uid)
+	if err != nil {
+		return false, err
+	}
+	return userResp == nil || userResp.TypingIndicator == 1, nil
+}
+
 // 消息回执列表
 func (m *Message) messageReceiptList(c *wkhttp.Context) {
 	messageIDStr := c.Param("message_id")
@@ -427,6 +517,7 @@ func (m *Message) messageReceiptList(c *wkhttp.Context) {
 
 	resps := make([]memberReceiptResp, 0)
 	uids := make([]string, 0)
+	readedAtMap := map[string]string{} // 已读时间
 	if readed == "1" {
 		memberReadedModels, err := m.memberReadedDB.queryWithMessageIDAndPage(messageIDStr, uint64(pIndex), uint64(pSize))
 		if err != nil {
@@ -436,6 +527,7 @@ func (m *Message) messageReceiptList(c *wkhttp.Context) {
 		if len(memberReadedModels) > 0 {
 			for _, memberReadedM := range memberReadedModels {
 				uids = append(uids, memberReadedM.UID)
+				readedAtMap[memberReadedM.UID] = memberReadedM.CreatedAt.String()
 			}
 		}
 	}
@@ -458,8 +550,9 @@ func (m *Message) messageReceiptList(c *wkhttp.Context) {
 			name = userResp.Name
 		}
 		resps = append(resps, memberReceiptResp{
-			UID:  uid,
-			Name: name,
+			UID:      uid,
+			Name:     name,
+			ReadedAt: readedAtMap[uid],
 		})
 	}
 	c.Response(resps)
@@ -592,7 +685,9 @@ func (m *Message) syncChannelMessage(c *wkhttp.Context) {
 	}
 	fmt.Println("resp----messages-->", len(resp.Messages))
 
-	c.Response(newSyncChannelMessageResp(resp, c.GetLoginUID(), req.DeviceUUID, req.ChannelID, req.ChannelType, m.messageExtraDB, m.messageUserExtraDB, m.messageReactionDB, m.channelOffsetDB, m.deviceOffsetDB))
+	syncResp := newSyncChannelMessageResp(resp, c.GetLoginUID(), req.DeviceUUID, req.ChannelID, req.ChannelType, m.messageExtraDB, m.messageUserExtraDB, m.messageReactionDB, m.channelOffsetDB, m.deviceOffsetDB)
+	m.attachAutoTranslations(c.GetLoginUID(), req.ChannelID, req.ChannelType, syncResp.Messages) // 自动翻译
+	c.Response(syncResp)
 }
 
 // 输入中
@@ -607,13 +702,23 @@ func (m *Message) typing(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	typingOn, err := m.typingIndicatorOn(loginUID)
+	if err != nil {
+		m.Error("查询用户输入中设置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户输入中设置失败！"))
+		return
+	}
+	if !typingOn { // 关闭了输入中状态 不通知对方
+		c.ResponseOK()
+		return
+	}
 	channelID := req.ChannelID
 	channelType := req.ChannelType
 	if req.ChannelType == common.ChannelTypePerson.Uint8() {
 		channelID = loginUID
 	}
 	// 发送输入中的命令
-	err := m.ctx.SendCMD(config.MsgCMDReq{
+	err = m.ctx.SendCMD(config.MsgCMDReq{
 		NoPersist:   true,
 		CMD:         common.CMDTyping,
 		ChannelID:   req.ChannelID,
@@ -668,114 +773,14 @@ func (m *Message) search(c *wkhttp.Context) {
 		c.ResponseError(errors.New("解析搜索数据失败！"))
 		return
 	}
-	c.JSON(http.StatusOK, results)
-}
-
-// 同步回复统计数据
-func (m *Message) syncMessageReplies(c *wkhttp.Context) {
-	messageID := c.Param("message_id")
-	seq := c.Query("seq")
-	resp, err := network.Get(fmt.Sprintf("%s/messages/%s/replies?seq=%s", m.ctx.GetConfig().IMURL, messageID, seq), nil, nil)
-	if err != nil {
-		m.Error("调用IM扩展服务失败！", zap.Error(err))
-		c.ResponseError(errors.New("调用IM扩展服务失败！"))
-		return
-	}
-	err = m.handlerIMError(resp)
-	if err != nil {
-		c.ResponseError(err)
-		return
-	}
-	var replyMsgSyncResp replyMsgSyncResp
-	err = util.ReadJsonByByte([]byte(resp.Body), &replyMsgSyncResp)
-	if err != nil {
-		m.Error("返回数据格式有误！", zap.Error(err))
-		c.ResponseError(errors.New("返回数据格式有误！"))
-		return
-	}
-	rootmsgResp := &MsgSyncResp{}
-	rootmsgResp.from(replyMsgSyncResp.Root, c.GetLoginUID(), nil, nil, nil)
-
-	messages := make([]*MsgSyncResp, 0, len(replyMsgSyncResp.Messages))
-	if len(replyMsgSyncResp.Messages) > 0 {
-		for _, message := range replyMsgSyncResp.Messages {
-			msgResp := &MsgSyncResp{}
-			msgResp.from(message, c.GetLoginUID(), nil, nil, nil)
-			messages = append(messages, msgResp)
+	if strings.TrimSpace(req.Keyword) != "" && (req.ContentType == 0 || req.ContentType == common.Voice.Int()) { // 语音转写的文本也参与搜索
+		transcriptResults, err := m.searchTranscripts(uid, req.ChannelID, req.ChannelType, strings.TrimSpace(req.Keyword))
+		if err != nil {
+			m.Warn("搜索语音转写文本失败！", zap.Error(err))
 		}
+		results = mergeSearchResults(results, transcriptResults)
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"root":     rootmsgResp,
-		"messages": messages,
-	})
-}
-
-// 同步回复统计数据
-func (m *Message) syncReplyTotal(c *wkhttp.Context) {
-	var req struct {
-		MessageID string `json:"message_id"` // 消息唯一ID
-		Seq       string `json:"seq"`
-		Limit     uint64 `json:"limit"`
-	}
-	if err := c.BindJSON(&req); err != nil {
-		m.Error("数据格式有误！", zap.Error(err))
-		c.ResponseError(errors.New("数据格式有误！"))
-		return
-	}
-	resp, err := network.Post(m.ctx.GetConfig().IMURL+"/reply_total/sync", []byte(util.ToJson(req)), nil)
-	if err != nil {
-		m.Error("调用IM扩展服务失败！", zap.Error(err))
-		c.ResponseError(errors.New("调用IM扩展服务失败！"))
-		return
-	}
-	err = m.handlerIMError(resp)
-	if err != nil {
-		c.ResponseError(err)
-		return
-	}
-	var syncTotalResp syncTotalResp
-	err = util.ReadJsonByByte([]byte(resp.Body), &syncTotalResp)
-	if err != nil {
-		m.Error("返回数据格式有误！", zap.Error(err))
-		c.ResponseError(errors.New("返回数据格式有误！"))
-		return
-	}
-	c.JSON(http.StatusOK, syncTotalResp)
-}
-
-// 添加回复数据
-func (m *Message) addReply(c *wkhttp.Context) {
-	var req struct {
-		MessageID   string `json:"message_id"`   // 消息唯一ID
-		ChannelID   string `json:"channel_id"`   // 频道唯一ID
-		ChannelType uint8  `json:"channel_type"` // 频道类型
-		Type        int    `json:"type"`         // 回复数据类型
-		Payload     string `json:"payload"`      // 回复数据
-		UID         string `json:"uid"`          // 回复用户UID
-		Name        string `json:"name"`         // 回复者名字
-	}
-	if err := c.BindJSON(&req); err != nil {
-		m.Error("数据格式有误！", zap.Error(err))
-		c.ResponseError(errors.New("数据格式有误！"))
-		return
-	}
-	loginUID := c.MustGet("uid").(string)
-	loginName := c.MustGet("name").(string)
-	req.UID = loginUID
-	req.Name = loginName
-	resp, err := network.Post(m.ctx.GetConfig().IMURL+"/replies", []byte(util.ToJson(req)), nil)
-	if err != nil {
-		m.Error("调用IM扩展服务失败！", zap.Error(err))
-		c.ResponseError(errors.New("调用IM扩展服务失败！"))
-		return
-	}
-	err = m.handlerIMError(resp)
-	if err != nil {
-		c.ResponseError(err)
-		return
-	}
-	c.ResponseOK()
+	c.JSON(http.StatusOK, results)
 }
 
 // 语音消息设置为已读
@@ -896,7 +901,9 @@ func (m *Message) addOrCancelReaction(c *wkhttp.Context) {
 		fakeChannelID = common.GetFakeChannelIDWith(req.ChannelID, loginUID)
 	}
 	seq := m.genMessageReactionSeq(fakeChannelID) // 下次回复seq
+	reactionDelta := 0                            // 消息作者的回应数变化
 	if model == nil {
+		reactionDelta = 1
 		//新增回应
 		err = m.messageReactionDB.insertReaction(&reactionModel{
 			ChannelID:   fakeChannelID,
@@ -917,12 +924,14 @@ func (m *Message) addOrCancelReaction(c *wkhttp.Context) {
 		model.Seq = seq
 		if model.IsDeleted == 1 {
 			model.IsDeleted = 0
+			reactionDelta = 1
 			if model.Emoji != req.Emoji {
 				model.Emoji = req.Emoji
 			}
 		} else {
 			if model.Emoji == req.Emoji {
 				model.IsDeleted = 1
+				reactionDelta = -1
 			} else {
 				model.Emoji = req.Emoji
 			}
@@ -934,6 +943,9 @@ func (m *Message) addOrCancelReaction(c *wkhttp.Context) {
 			return
 		}
 	}
+	if reactionDelta != 0 {
+		m.updateReactionCounter(fakeChannelID, req.ChannelID, req.ChannelType, req.MessageID, loginUID, reactionDelta)
+	}
 
 	//发送同步消息cmd
 	err = m.ctx.SendCMD(config.MsgCMDReq{
@@ -951,6 +963,31 @@ func (m *Message) addOrCancelReaction(c *wkhttp.Context) {
 
 	c.ResponseOK()
 }
+
+// updateReactionCounter 更新消息作者会话的回应我数量
+func (m *Message) updateReactionCounter(fakeChannelID string, channelID string, channelType uint8, messageID string, loginUID string, delta int) {
+	messageM, err := m.db.queryMessageWithMessageID(fakeChannelID, channelType, messageID)
+	if err != nil {
+		m.Error("查询消息失败！", zap.Error(err), zap.String("messageID", messageID))
+		return
+	}
+	if messageM == nil || messageM.FromUID == "" || messageM.FromUID == loginUID {
+		return
+	}
+	authorChannelID := channelID
+	if channelType == common.ChannelTypePerson.Uint8() {
+		authorChannelID = loginUID // 个人频道对于消息作者来说频道是回应者
+	}
+	if delta > 0 {
+		err = m.conversationCounterDB.increase(counterFieldReaction, authorChannelID, channelType, []string{messageM.FromUID})
+	} else {
+		err = m.conversationCounterDB.decrease(counterFieldReaction, messageM.FromUID, authorChannelID, channelType, -delta)
+	}
+	if err != nil {
+		m.Error("更新会话回应数量失败！", zap.Error(err))
+	}
+}
+
 func (m *Message) handlerIMError(resp *rest.Response) error {
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusBadRequest {
@@ -1209,8 +1246,8 @@ func (m *Message) hasRevokePermission(messageM *messageModel, loginUID string) (
 	if messageM.FromUID == loginUID { // 自己发的消息允许被撤回
 		return true, nil
 	}
-	if messageM.ChannelType == common.ChannelTypeGroup.Uint8() { // 管理者或创建者可以撤回其他成员的消息
-		creatorOrManager, err := m.groupService.IsCreatorOrManager(messageM.ChannelID, loginUID)
+	if messageM.ChannelType == common.ChannelTypeGroup.Uint8() { // 创建者或有撤回权限的管理者可以撤回其他成员的消息
+		creatorOrManager, err := m.groupService.HasManagerPermission(messageM.ChannelID, loginUID, group.ManagerPermissionRevoke)
 		if err != nil {
 			return false, err
 		}
@@ -1795,11 +1832,6 @@ type syncReq struct {
 // 	}
 // }
 
-type replyMsgSyncResp struct {
-	Root     *config.MessageResp   `json:"root"`
-	Messages []*config.MessageResp `json:"messages"`
-}
-
 // MgSyncResp 消息同步请求
 type MsgSyncResp struct {
 	Header        messageHeader          `json:"header"`                    // 消息头部
@@ -1832,6 +1864,8 @@ type MsgSyncResp struct {
 	// 消息扩展字段
 	MessageExtra *messageExtraResp `json:"message_extra,omitempty"` // 消息扩展
 
+	Translation *translationResp `json:"translation,omitempty"` // 自动翻译的译文
+
 }
 
 func (m *MsgSyncResp) from(msgResp *config.MessageResp, loginUID string, messageExtraM *messageExtraDetailModel, messageUserExtraM *messageUserExtraModel, reactionModels []*reactionModel) {
@@ -1978,18 +2012,22 @@ type syncTotalResp struct {
 }
 
 type messageExtraResp struct {
-	MessageID       int64                  `json:"message_id"`
-	MessageIDStr    string                 `json:"message_id_str"`
-	Revoke          int                    `json:"revoke,omitempty"`
-	Revoker         string                 `json:"revoker,omitempty"`
-	VoiceStatus     int                    `json:"voice_status,omitempty"`
-	Readed          int                    `json:"readed,omitempty"`            // 是否已读（针对于自己）
-	ReadedCount     int                    `json:"readed_count,omitempty"`      // 已读数量
-	ReadedAt        int64                  `json:"readed_at,omitempty"`         // 已读时间
-	IsMutualDeleted int                    `json:"is_mutual_deleted,omitempty"` // 双向删除
-	ContentEdit     map[string]interface{} `json:"content_edit,omitempty"`      // 编辑后的正文
-	EditedAt        int                    `json:"edited_at,omitempty"`         // 编辑时间 例如 12:23
-	ExtraVersion    int64                  `json:"extra_version"`               // 数据版本
+	MessageID        int64                  `json:"message_id"`
+	MessageIDStr     string                 `json:"message_id_str"`
+	Revoke           int                    `json:"revoke,omitempty"`
+	Revoker          string                 `json:"revoker,omitempty"`
+	VoiceStatus      int                    `json:"voice_status,omitempty"`
+	Readed           int                    `json:"readed,omitempty"`            // 是否已读（针对于自己）
+	ReadedCount      int                    `json:"readed_count,omitempty"`      // 已读数量
+	ReadedAt         int64                  `json:"readed_at,omitempty"`         // 已读时间
+	IsMutualDeleted  int                    `json:"is_mutual_deleted,omitempty"` // 双向删除
+	ContentEdit      map[string]interface{} `json:"content_edit,omitempty"`      // 编辑后的正文
+	EditedAt         int                    `json:"edited_at,omitempty"`         // 编辑时间 例如 12:23
+	Poll             map[string]interface{} `json:"poll,omitempty"`              // 投票统计
+	LinkPreview      map[string]interface{} `json:"link_preview,omitempty"`      // 链接预览
+	Transcript       string                 `json:"transcript,omitempty"`        // 语音转写的文本
+	TranscriptStatus int                    `json:"transcript_status,omitempty"` // 语音转写状态 1.转写成功 2.转写失败
+	ExtraVersion     int64                  `json:"extra_version"`               // 数据版本
 }
 
 func newMessageExtraResp(m *messageExtraDetailModel) *messageExtraResp {
@@ -2004,29 +2042,50 @@ func newMessageExtraResp(m *messageExtraDetailModel) *messageExtraResp {
 		}
 	}
 
+	var pollMap map[string]interface{}
+	if m.Poll.String != "" {
+		err := util.ReadJsonByByte([]byte(m.Poll.String), &pollMap)
+		if err != nil {
+			log.Warn("投票统计数据不是json格式！", zap.Error(err), zap.String("poll", m.Poll.String))
+		}
+	}
+
+	var linkPreviewMap map[string]interface{}
+	if m.LinkPreview.String != "" {
+		err := util.ReadJsonByByte([]byte(m.LinkPreview.String), &linkPreviewMap)
+		if err != nil {
+			log.Warn("链接预览数据不是json格式！", zap.Error(err), zap.String("linkPreview", m.LinkPreview.String))
+		}
+	}
+
 	var readedAt int64 = 0
 	if m.ReadedAt.Valid {
 		readedAt = m.ReadedAt.Time.Unix()
 	}
 
 	return &messageExtraResp{
-		MessageID:       messageID,
-		MessageIDStr:    m.MessageID,
-		Revoke:          m.Revoke,
-		Revoker:         m.Revoker,
-		Readed:          m.Readed,
-		ReadedAt:        readedAt,
-		ReadedCount:     m.ReadedCount,
-		ContentEdit:     contentEditMap,
-		EditedAt:        m.EditedAt,
-		IsMutualDeleted: m.IsDeleted,
-		ExtraVersion:    m.Version,
+		MessageID:        messageID,
+		MessageIDStr:     m.MessageID,
+		Revoke:           m.Revoke,
+		Revoker:          m.Revoker,
+		Readed:           m.Readed,
+		ReadedAt:         readedAt,
+		ReadedCount:      m.ReadedCount,
+		ContentEdit:      contentEditMap,
+		EditedAt:         m.EditedAt,
+		IsMutualDeleted:  m.IsDeleted,
+		Poll:             pollMap,
+		LinkPreview:      linkPreviewMap,
+		Transcript:       m.Transcript.String,
+		TranscriptStatus: m.TranscriptStatus,
+		ExtraVersion:     m.Version,
 	}
 }
 
 type memberReceiptResp struct {
-	UID  string `json:"uid"`  // 成员uid
-	Name string `json:"name"` // 成员名称
+	UID      string `json:"uid"`       // 成员uid
+	Name     string `json:"name"`      // 成员名称
+	ReadedAt string `json:"readed_at"` // 已读时间
 }
 
 type ProhibitWordResp struct {
@@ -25,19 +25,23 @@ import (
 type Conversation struct {
 	ctx *config.Context
 	log.Log
-	userDB              *user.DB
-	groupDB             *group.DB
-	messageExtraDB      *messageExtraDB
-	messageReactionDB   *messageReactionDB
-	messageUserExtraDB  *messageUserExtraDB
-	channelOffsetDB     *channelOffsetDB
-	deviceOffsetDB      *deviceOffsetDB
-	userLastOffsetDB    *userLastOffsetDB
-	userService         user.IService
-	groupService        group.IService
-	service             IService
-	channelService      channel.IService
-	conversationExtraDB *conversationExtraDB
+	userDB                *user.DB
+	groupDB               *group.DB
+	messageExtraDB        *messageExtraDB
+	messageReactionDB     *messageReactionDB
+	messageUserExtraDB    *messageUserExtraDB
+	channelOffsetDB       *channelOffsetDB
+	deviceOffsetDB        *deviceOffsetDB
+	userLastOffsetDB      *userLastOffsetDB
+	userService           user.IService
+	groupService          group.IService
+	service               IService
+	channelService        channel.IService
+	conversationExtraDB   *conversationExtraDB
+	conversationFolderDB  *conversationFolderDB
+	conversationCounterDB *conversationCounterDB
+	remindersDB           *remindersDB
+	badgeQueue            *taskQueue // 异步重新计算用户红点
 
 	syncConversationResultCacheMap  map[string][]string
 	syncConversationVersionMap      map[string]int64
@@ -58,6 +62,10 @@ func NewConversation(ctx *config.Context) *Conversation {
 		deviceOffsetDB:                 newDeviceOffsetDB(ctx.DB()),
 		userLastOffsetDB:               newUserLastOffsetDB(ctx),
 		conversationExtraDB:            newConversationExtraDB(ctx),
+		conversationFolderDB:           newConversationFolderDB(ctx),
+		conversationCounterDB:          newConversationCounterDB(ctx),
+		remindersDB:                    newRemindersDB(ctx),
+		badgeQueue:                     newTaskQueue("badge", 2, 1000),
 		userService:                    user.NewService(ctx),
 		groupService:                   group.NewService(ctx),
 		channelService:                 channel.NewService(ctx),
@@ -91,11 +99,20 @@ func (co *Conversation) Route(r *wkhttp.WKHttp) {
 		conversation.POST("/sync", co.syncUserConversation)
 		conversation.POST("/syncack", co.syncUserConversationAck)
 		conversation.POST("/extra/sync", co.conversationExtraSync) // 同步最近会话扩展
+
+		conversation.POST("/folders", co.folderAdd)                 // 添加会话分组
+		conversation.PUT("/folders/:folder_no", co.folderUpdate)    // 修改会话分组
+		conversation.DELETE("/folders/:folder_no", co.folderDelete) // 删除会话分组
+		conversation.POST("/folders/sort", co.folderSort)           // 会话分组排序
+		conversation.POST("/folders/sync", co.folderSync)           // 同步会话分组
 	}
 	conversations := r.Group("/v1/conversations", r.AuthMiddleware(co.ctx.Cache(), co.ctx.GetConfig().TokenCachePrefix))
 	{
-		conversations.DELETE("/:channel_id/:channel_type", co.deleteConversation)          // 删除最近会话
-		conversations.POST("/:channel_id/:channel_type/extra", co.conversationExtraUpdate) // 添加或更新最近会话扩展
+		conversations.DELETE("/:channel_id/:channel_type", co.deleteConversation)                    // 删除最近会话
+		conversations.POST("/:channel_id/:channel_type/extra", co.conversationExtraUpdate)           // 添加或更新最近会话扩展
+		conversations.POST("/:channel_id/:channel_type/archive", co.conversationArchive)             // 归档最近会话
+		conversations.DELETE("/:channel_id/:channel_type/archive", co.conversationUnarchive)         // 取消归档最近会话
+		conversations.PUT("/:channel_id/:channel_type/auto_translate", co.conversationAutoTranslate) // 设置会话自动翻译
 	}
 
 	co.ctx.AddEventListener(event.ConversationDelete, func(data []byte, commit config.EventCommit) {
@@ -209,6 +226,7 @@ func (co *Conversation) deleteConversation(c *wkhttp.Context) {
 		c.ResponseError(errors.New("删除最近会话失败！"))
 		return
 	}
+	co.refreshUserBadge(c.GetLoginUID())
 	c.ResponseOK()
 }
 
@@ -381,6 +399,23 @@ func (co *Conversation) syncUserConversation(c *wkhttp.Context) {
 		}
 	}
 
+	// ---------- 会话计数 ----------
+	counterMap, err := co.getConversationCounterMap(loginUID, channelIDs)
+	if err != nil {
+		co.Error("查询会话计数失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询会话计数失败！"))
+		return
+	}
+
+	// ---------- 会话分组 ----------
+	folderModels, err := co.conversationFolderDB.queryWithUID(loginUID)
+	if err != nil {
+		co.Error("查询会话分组失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询会话分组失败！"))
+		return
+	}
+	folders := parseFolders(folderModels)
+
 	// ---------- 用户设置 ----------
 	users := make([]*user.UserDetailResp, 0)
 	if len(uids) > 0 {
@@ -466,11 +501,13 @@ func (co *Conversation) syncUserConversation(c *wkhttp.Context) {
 
 			var mute = 0
 			var stick = 0
+			var robot = false
 			if conversation.ChannelType == common.ChannelTypePerson.Uint8() {
 				userDetail := userMap[conversation.ChannelID]
 				if userDetail != nil {
 					mute = userDetail.Mute
 					stick = userDetail.Top
+					robot = userDetail.Robot == 1
 				}
 			} else {
 				group := groupMap[conversation.ChannelID]
@@ -487,6 +524,22 @@ func (co *Conversation) syncUserConversation(c *wkhttp.Context) {
 			deviceOffsetM := deviceOffsetModelMap[channelKey]
 			extra := conversationExtraMap[channelKey]
 			syncUserConversationResp := newSyncUserConversationResp(conversation, extra, loginUID, co.messageExtraDB, co.messageReactionDB, co.messageUserExtraDB, mute, stick, channelOffsetM, deviceOffsetM)
+			if extra != nil {
+				syncUserConversationResp.Archived = extra.Archived
+			}
+			if counter := counterMap[channelKey]; counter != nil {
+				syncUserConversationResp.MentionCount = counter.MentionCount
+				syncUserConversationResp.ReplyCount = counter.ReplyCount
+				syncUserConversationResp.ReactionCount = counter.ReactionCount
+			}
+			syncUserConversationResp.FolderNos = getFolderNos(folders, folderConversation{
+				ChannelID:   conversation.ChannelID,
+				ChannelType: conversation.ChannelType,
+				Unread:      syncUserConversationResp.Unread,
+				Robot:       robot,
+				Mute:        mute == 1,
+				Archived:    syncUserConversationResp.Archived == 1,
+			})
 			if len(syncUserConversationResp.Recents) > 0 {
 				syncUserConversationResps = append(syncUserConversationResps, syncUserConversationResp)
 			}
@@ -708,9 +761,40 @@ func (co *Conversation) getConversations(c *wkhttp.Context) {
 		userUIDs := make([]string, 0)
 		groupNos := make([]string, 0)
 		visitorNos := make([]string, 0)
+		channelIDs := make([]string, 0, len(resps))
+		for _, resp := range resps {
+			channelIDs = append(channelIDs, resp.ChannelID)
+		}
+		counterMap, err := co.getConversationCounterMap(loginUID, channelIDs)
+		if err != nil {
+			co.Error("查询会话计数失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询会话计数失败！"))
+			return
+		}
+		conversationExtras, err := co.conversationExtraDB.queryWithChannelIDs(loginUID, channelIDs)
+		if err != nil {
+			co.Error("查询最近会话扩展失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询最近会话扩展失败！"))
+			return
+		}
+		archivedMap := make(map[string]bool, len(conversationExtras))
+		for _, conversationExtra := range conversationExtras {
+			if conversationExtra.Archived == 1 {
+				archivedMap[fmt.Sprintf("%s-%d", conversationExtra.ChannelID, conversationExtra.ChannelType)] = true
+			}
+		}
 		for _, resp := range resps {
 			conversationResp := &conversationResp{}
 			conversationResp.from(resp, loginUID, nil, nil)
+			channelKey := fmt.Sprintf("%s-%d", resp.ChannelID, resp.ChannelType)
+			if counter := counterMap[channelKey]; counter != nil {
+				conversationResp.MentionCount = counter.MentionCount
+				conversationResp.ReplyCount = counter.ReplyCount
+				conversationResp.ReactionCount = counter.ReactionCount
+			}
+			if archivedMap[channelKey] {
+				conversationResp.Archived = 1
+			}
 			conversationResps = append(conversationResps, *conversationResp)
 			if resp.ChannelType == common.ChannelTypePerson.Uint8() {
 				userUIDs = append(userUIDs, resp.ChannelID)
@@ -737,6 +821,40 @@ func (co *Conversation) getConversations(c *wkhttp.Context) {
 			return
 		}
 
+		folderModels, err := co.conversationFolderDB.queryWithUID(loginUID)
+		if err != nil {
+			co.Error("查询会话分组失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询会话分组失败！"))
+			return
+		}
+		folders := parseFolders(folderModels)
+		userDetailMap := make(map[string]*user.Detail, len(userDetails))
+		for _, userDetail := range userDetails {
+			userDetailMap[userDetail.UID] = userDetail
+		}
+		groupDetailMap := make(map[string]*group.DetailModel, len(groupDetails))
+		for _, groupDetail := range groupDetails {
+			groupDetailMap[groupDetail.GroupNo] = groupDetail
+		}
+		for i := range conversationResps {
+			conversationResp := &conversationResps[i]
+			folderConv := folderConversation{
+				ChannelID:   conversationResp.ChannelID,
+				ChannelType: conversationResp.ChannelType,
+				Unread:      int(conversationResp.Unread),
+				Archived:    conversationResp.Archived == 1,
+			}
+			if conversationResp.ChannelType == common.ChannelTypePerson.Uint8() {
+				if userDetail := userDetailMap[conversationResp.ChannelID]; userDetail != nil {
+					folderConv.Mute = userDetail.Mute == 1
+					folderConv.Robot = userDetail.Robot == 1
+				}
+			} else if groupDetail := groupDetailMap[conversationResp.ChannelID]; groupDetail != nil {
+				folderConv.Mute = groupDetail.Mute == 1
+			}
+			conversationResp.FolderNos = getFolderNos(folders, folderConv)
+		}
+
 		if len(userDetails) > 0 {
 			for _, userDetail := range userDetails {
 				userResp := userResp{}.from(userDetail, co.ctx.GetConfig().GetAvatarPath(userDetail.UID))
@@ -799,6 +917,24 @@ func (co *Conversation) clearConversationUnread(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	doneCount, err := co.clearConversationCounter(loginUID, req.ChannelID, req.ChannelType)
+	if err != nil {
+		co.Error("清空会话计数失败！", zap.Error(err))
+		c.ResponseError(errors.New("清空会话计数失败！"))
+		return
+	}
+	co.refreshUserBadge(loginUID)
+	if doneCount > 0 {
+		err = co.ctx.SendCMD(config.MsgCMDReq{
+			NoPersist:   true,
+			ChannelID:   loginUID,
+			ChannelType: common.ChannelTypePerson.Uint8(),
+			CMD:         common.CMDSyncReminders,
+		})
+		if err != nil {
+			co.Error("发送同步提醒项cmd失败！", zap.Error(err))
+		}
+	}
 	// 发送清空红点的命令
 	err = co.ctx.SendCMD(config.MsgCMDReq{
 		NoPersist:   true,
@@ -819,6 +955,144 @@ func (co *Conversation) clearConversationUnread(c *wkhttp.Context) {
 	c.ResponseOK()
 }
 
+// clearConversationCounter 清空会话计数 并将会话内计入计数的提醒项标记为已完成（避免之后完成提醒项时从新的计数里减去） 返回完成的提醒项数量
+func (co *Conversation) clearConversationCounter(uid string, channelID string, channelType uint8) (int, error) {
+	tx, _ := co.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	reminders, err := co.remindersDB.queryUndoneWithChannelTx(uid, channelID, channelType, []int{ReminderTypeMentionMe, ReminderTypeReplyMe, ReminderTypeThreadReply}, tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	ids := make([]int64, 0, len(reminders))
+	for _, reminder := range reminders {
+		ids = append(ids, reminder.Id)
+	}
+	doneIDs, err := co.remindersDB.insertDonesTx(ids, uid, tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	for _, id := range doneIDs {
+		err = co.remindersDB.updateVersionTx(co.ctx.GenSeq(common.RemindersKey), id, tx)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	err = co.conversationCounterDB.clearTx(uid, channelID, channelType, tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		tx.RollbackUnlessCommitted()
+		return 0, err
+	}
+	return len(doneIDs), nil
+}
+
+// getConversationCounterMap 查询会话计数 key为channelID-channelType
+func (co *Conversation) getConversationCounterMap(uid string, channelIDs []string) (map[string]*conversationCounterModel, error) {
+	counterMap := map[string]*conversationCounterModel{}
+	counters, err := co.conversationCounterDB.queryWithChannelIDs(uid, channelIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, counter := range counters {
+		counterMap[fmt.Sprintf("%s-%d", counter.ChannelID, counter.ChannelType)] = counter
+	}
+	return counterMap, nil
+}
+
+// refreshUserBadge 异步根据最近会话的未读数重新计算用户推送红点 需要请求IM 不阻塞接口
+func (co *Conversation) refreshUserBadge(uid string) {
+	co.badgeQueue.submit(func() {
+		co.updateUserBadge(uid)
+	})
+}
+
+// updateUserBadge 根据最近会话的未读数重新计算用户推送红点
+func (co *Conversation) updateUserBadge(uid string) {
+	badge, err := co.computeUserBadge(uid)
+	if err != nil {
+		co.Error("计算用户红点失败！", zap.Error(err), zap.String("uid", uid))
+		return
+	}
+	err = co.ctx.GetRedisConn().Hset(common.UserDeviceBadgePrefix, uid, fmt.Sprintf("%d", badge))
+	if err != nil {
+		co.Error("设置用户红点失败！", zap.Error(err), zap.String("uid", uid))
+	}
+}
+
+// computeUserBadge 计算用户红点 关闭新消息通知的用户为0 免打扰的会话不计入
+func (co *Conversation) computeUserBadge(uid string) (int, error) {
+	userResp, err := co.userService.GetUser(uid)
+	if err != nil {
+		return 0, err
+	}
+	if userResp.NewMsgNotice == 0 {
+		return 0, nil
+	}
+	conversations, err := co.ctx.IMGetConversations(uid)
+	if err != nil {
+		return 0, err
+	}
+	uids := make([]string, 0)
+	groupNos := make([]string, 0)
+	for _, conversation := range conversations {
+		if conversation.Unread <= 0 {
+			continue
+		}
+		if conversation.ChannelType == common.ChannelTypePerson.Uint8() {
+			uids = append(uids, conversation.ChannelID)
+		} else if conversation.ChannelType == common.ChannelTypeGroup.Uint8() {
+			groupNos = append(groupNos, conversation.ChannelID)
+		}
+	}
+	mutedMap := map[string]bool{}
+	if len(uids) > 0 {
+		users, err := co.userService.GetUserDetails(uids, uid)
+		if err != nil {
+			return 0, err
+		}
+		for _, user := range users {
+			if user.Mute == 1 {
+				mutedMap[fmt.Sprintf("%s-%d", user.UID, common.ChannelTypePerson.Uint8())] = true
+			}
+		}
+	}
+	if len(groupNos) > 0 {
+		groups, err := co.groupService.GetGroupDetails(groupNos, uid)
+		if err != nil {
+			return 0, err
+		}
+		for _, group := range groups {
+			if group.Mute == 1 {
+				mutedMap[fmt.Sprintf("%s-%d", group.GroupNo, common.ChannelTypeGroup.Uint8())] = true
+			}
+		}
+	}
+	return sumBadge(conversations, mutedMap), nil
+}
+
+// sumBadge 累加未免打扰会话的未读数 mutedMap的key为channelID-channelType
+func sumBadge(conversations []*config.ConversationResp, mutedMap map[string]bool) int {
+	var badge int64
+	for _, conversation := range conversations {
+		if conversation.Unread <= 0 || mutedMap[fmt.Sprintf("%s-%d", conversation.ChannelID, conversation.ChannelType)] {
+			continue
+		}
+		badge += conversation.Unread
+	}
+	return int(badge)
+}
+
 // ---------- vo ----------
 
 // SyncUserConversationRespWrap SyncUserConversationRespWrap
@@ -837,11 +1111,16 @@ type clearConversationUnreadReq struct {
 }
 
 type conversationResp struct {
-	ChannelID   string       `json:"channel_id"`   // 频道ID
-	ChannelType uint8        `json:"channel_type"` // 频道类型
-	Unread      int64        `json:"unread"`       // 未读数
-	Timestamp   int64        `json:"timestamp"`    // 最后一次会话时间戳
-	LastMessage *MsgSyncResp `json:"last_message"` // 最后一条消息
+	ChannelID     string       `json:"channel_id"`               // 频道ID
+	ChannelType   uint8        `json:"channel_type"`             // 频道类型
+	Unread        int64        `json:"unread"`                   // 未读数
+	Timestamp     int64        `json:"timestamp"`                // 最后一次会话时间戳
+	LastMessage   *MsgSyncResp `json:"last_message"`             // 最后一条消息
+	MentionCount  int          `json:"mention_count,omitempty"`  // 未读的@我数量
+	ReplyCount    int          `json:"reply_count,omitempty"`    // 未读的回复我数量
+	ReactionCount int          `json:"reaction_count,omitempty"` // 未读的回应我数量
+	Archived      int          `json:"archived,omitempty"`       // 是否已归档
+	FolderNos     []string     `json:"folder_nos,omitempty"`     // 所属的会话分组
 }
 
 type conversationWrapResp struct {
@@ -866,7 +1145,9 @@ type conversationExtraResp struct {
 	BrowseTo       uint32 `json:"browse_to"`
 	KeepMessageSeq uint32 `json:"keep_message_seq"`
 	KeepOffsetY    int    `json:"keep_offset_y"`
-	Draft          string `json:"draft"` // 草稿
+	Draft          string `json:"draft"`          // 草稿
+	Archived       int    `json:"archived"`       // 是否已归档
+	AutoTranslate  int    `json:"auto_translate"` // 是否自动翻译
 	Version        int64  `json:"version"`
 }
 
@@ -879,6 +1160,8 @@ func newConversationExtraResp(m *conversationExtraModel) *conversationExtraResp
 		KeepMessageSeq: m.KeepMessageSeq,
 		KeepOffsetY:    m.KeepOffsetY,
 		Draft:          m.Draft,
+		Archived:       m.Archived,
+		AutoTranslate:  m.AutoTranslate,
 		Version:        m.Version,
 	}
 }
@@ -988,18 +1271,23 @@ func (u userResp) from(user *user.Detail, avatarPath string) userResp {
 
 // SyncUserConversationResp 最近会话离线返回
 type SyncUserConversationResp struct {
-	ChannelID       string                 `json:"channel_id"`         // 频道ID
-	ChannelType     uint8                  `json:"channel_type"`       // 频道类型
-	Unread          int                    `json:"unread,omitempty"`   // 未读消息
-	Mute            int                    `json:"mute,omitempty"`     // 免打扰
-	Stick           int                    `json:"stick,omitempty"`    //  置顶
-	Timestamp       int64                  `json:"timestamp"`          // 最后一次会话时间
-	LastMsgSeq      int64                  `json:"last_msg_seq"`       // 最后一条消息seq
-	LastClientMsgNo string                 `json:"last_client_msg_no"` // 最后一条客户端消息编号
-	OffsetMsgSeq    int64                  `json:"offset_msg_seq"`     // 偏移位的消息seq
-	Version         int64                  `json:"version,omitempty"`  // 数据版本
-	Recents         []*MsgSyncResp         `json:"recents,omitempty"`  // 最近N条消息
-	Extra           *conversationExtraResp `json:"extra,omitempty"`    // 扩展
+	ChannelID       string                 `json:"channel_id"`               // 频道ID
+	ChannelType     uint8                  `json:"channel_type"`             // 频道类型
+	Unread          int                    `json:"unread,omitempty"`         // 未读消息
+	Mute            int                    `json:"mute,omitempty"`           // 免打扰
+	Stick           int                    `json:"stick,omitempty"`          //  置顶
+	Timestamp       int64                  `json:"timestamp"`                // 最后一次会话时间
+	LastMsgSeq      int64                  `json:"last_msg_seq"`             // 最后一条消息seq
+	LastClientMsgNo string                 `json:"last_client_msg_no"`       // 最后一条客户端消息编号
+	OffsetMsgSeq    int64                  `json:"offset_msg_seq"`           // 偏移位的消息seq
+	Version         int64                  `json:"version,omitempty"`        // 数据版本
+	Recents         []*MsgSyncResp         `json:"recents,omitempty"`        // 最近N条消息
+	Extra           *conversationExtraResp `json:"extra,omitempty"`          // 扩展
+	Archived        int                    `json:"archived,omitempty"`       // 是否已归档
+	FolderNos       []string               `json:"folder_nos,omitempty"`     // 所属的会话分组
+	MentionCount    int                    `json:"mention_count,omitempty"`  // 未读的@我数量
+	ReplyCount      int                    `json:"reply_count,omitempty"`    // 未读的回复我数量
+	ReactionCount   int                    `json:"reaction_count,omitempty"` // 未读的回应我数量
 }
 
 func newSyncUserConversationResp(resp *config.SyncUserConversationResp, extra *conversationExtraResp, loginUID string, messageExtraDB *messageExtraDB, messageReactionDB *messageReactionDB, messageUserExtraDB *messageUserExtraDB, mute int, stick int, channelOffsetM *channelOffsetModel, deviceOffsetM *deviceOffsetModel) *SyncUserConversationResp {
@@ -0,0 +1,447 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	conversationFolderMaxCount   = 20 // 每个用户最多可创建的分组数量
+	conversationFolderNameMaxLen = 20 // 分组名称最大长度
+)
+
+// 分组包含的会话类型
+const (
+	folderIncludeUnread  = "unread"  // 有未读消息的
+	folderIncludeGroups  = "groups"  // 群聊
+	folderIncludePersons = "persons" // 单聊（不含机器人）
+	folderIncludeRobots  = "robots"  // 机器人
+	folderIncludeMuted   = "muted"   // 免打扰的
+)
+
+// 添加会话分组
+func (co *Conversation) folderAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req folderReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	count, err := co.conversationFolderDB.queryCount(loginUID)
+	if err != nil {
+		co.Error("查询会话分组数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询会话分组数量失败！"))
+		return
+	}
+	if count >= conversationFolderMaxCount {
+		c.ResponseError(fmt.Errorf("最多只能创建%d个分组！", conversationFolderMaxCount))
+		return
+	}
+	model := &conversationFolderModel{
+		UID:      loginUID,
+		FolderNo: util.GenerUUID(),
+		Name:     strings.TrimSpace(req.Name),
+		Rules:    util.ToJson(req.rules()),
+		Sort:     int(count),
+		Version:  co.ctx.GenSeq(common.SyncConversationExtraKey),
+	}
+	err = co.conversationFolderDB.insert(model)
+	if err != nil {
+		co.Error("添加会话分组失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加会话分组失败！"))
+		return
+	}
+	co.sendSyncConversationExtraCMD(loginUID)
+	c.Response(newConversationFolderResp(model))
+}
+
+// 修改会话分组
+func (co *Conversation) folderUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	folderNo := c.Param("folder_no")
+	var req folderReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := co.conversationFolderDB.queryWithFolderNo(loginUID, folderNo)
+	if err != nil {
+		co.Error("查询会话分组失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询会话分组失败！"))
+		return
+	}
+	if model == nil {
+		c.ResponseError(errors.New("分组不存在！"))
+		return
+	}
+	model.Name = strings.TrimSpace(req.Name)
+	model.Rules = util.ToJson(req.rules())
+	model.Version = co.ctx.GenSeq(common.SyncConversationExtraKey)
+	err = co.conversationFolderDB.update(model)
+	if err != nil {
+		co.Error("修改会话分组失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改会话分组失败！"))
+		return
+	}
+	co.sendSyncConversationExtraCMD(loginUID)
+	c.Response(newConversationFolderResp(model))
+}
+
+// 删除会话分组
+func (co *Conversation) folderDelete(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	folderNo := c.Param("folder_no")
+	model, err := co.conversationFolderDB.queryWithFolderNo(loginUID, folderNo)
+	if err != nil {
+		co.Error("查询会话分组失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询会话分组失败！"))
+		return
+	}
+	if model == nil {
+		c.ResponseOK()
+		return
+	}
+	err = co.conversationFolderDB.updateDeleted(loginUID, folderNo, co.ctx.GenSeq(common.SyncConversationExtraKey))
+	if err != nil {
+		co.Error("删除会话分组失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除会话分组失败！"))
+		return
+	}
+	co.sendSyncConversationExtraCMD(loginUID)
+	c.ResponseOK()
+}
+
+// 会话分组排序
+func (co *Conversation) folderSort(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		FolderNos []string `json:"folder_nos"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if len(req.FolderNos) == 0 {
+		c.ResponseError(errors.New("分组编号不能为空！"))
+		return
+	}
+	tx, _ := co.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	for i, folderNo := range req.FolderNos {
+		err := co.conversationFolderDB.updateSortTx(loginUID, folderNo, i, co.ctx.GenSeq(common.SyncConversationExtraKey), tx)
+		if err != nil {
+			tx.Rollback()
+			co.Error("修改分组排序失败！", zap.Error(err))
+			c.ResponseError(errors.New("修改分组排序失败！"))
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		c.ResponseErrorf("提交事务失败！", err)
+		return
+	}
+	co.sendSyncConversationExtraCMD(loginUID)
+	c.ResponseOK()
+}
+
+// 同步会话分组
+func (co *Conversation) folderSync(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		Version int64 `json:"version"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	models, err := co.conversationFolderDB.sync(loginUID, req.Version)
+	if err != nil {
+		co.Error("同步会话分组失败！", zap.Error(err))
+		c.ResponseError(errors.New("同步会话分组失败！"))
+		return
+	}
+	resps := make([]*conversationFolderResp, 0, len(models))
+	for _, model := range models {
+		if req.Version == 0 && model.IsDeleted == 1 { // 首次同步不需要已删除的
+			continue
+		}
+		resps = append(resps, newConversationFolderResp(model))
+	}
+	c.JSON(http.StatusOK, resps)
+}
+
+// 归档最近会话
+func (co *Conversation) conversationArchive(c *wkhttp.Context) {
+	co.updateConversationArchived(c, 1)
+}
+
+// 取消归档最近会话
+func (co *Conversation) conversationUnarchive(c *wkhttp.Context) {
+	co.updateConversationArchived(c, 0)
+}
+
+func (co *Conversation) updateConversationArchived(c *wkhttp.Context, archived int) {
+	loginUID := c.GetLoginUID()
+	channelID := c.Param("channel_id")
+	channelType, _ := strconv.ParseInt(c.Param("channel_type"), 10, 64)
+	if strings.TrimSpace(channelID) == "" || channelType == 0 {
+		c.ResponseError(errors.New("频道信息不能为空！"))
+		return
+	}
+	version := co.ctx.GenSeq(common.SyncConversationExtraKey)
+	err := co.conversationExtraDB.insertOrUpdateArchived(&conversationExtraModel{
+		UID:         loginUID,
+		ChannelID:   channelID,
+		ChannelType: uint8(channelType),
+		Archived:    archived,
+		Version:     version,
+	})
+	if err != nil {
+		co.Error("修改会话归档状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改会话归档状态失败！"))
+		return
+	}
+	co.sendSyncConversationExtraCMD(loginUID)
+	c.Response(map[string]interface{}{
+		"version": version,
+	})
+}
+
+func (co *Conversation) sendSyncConversationExtraCMD(uid string) {
+	err := co.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   uid,
+		ChannelType: uint8(common.ChannelTypePerson),
+		CMD:         common.CMDSyncConversationExtra,
+	})
+	if err != nil {
+		co.Error("发送同步扩展会话cmd失败！", zap.Error(err))
+	}
+}
+
+// parsedFolder 已解析规则的会话分组
+type parsedFolder struct {
+	folderNo string
+	rules    folderRules
+}
+
+// parseFolders 解析分组规则 每次请求只解析一次 规则有误的分组跳过
+func parseFolders(folders []*conversationFolderModel) []*parsedFolder {
+	parsedFolders := make([]*parsedFolder, 0, len(folders))
+	for _, folder := range folders {
+		var rules folderRules
+		if err := util.ReadJsonByByte([]byte(folder.Rules), &rules); err != nil {
+			continue
+		}
+		parsedFolders = append(parsedFolders, &parsedFolder{
+			folderNo: folder.FolderNo,
+			rules:    rules,
+		})
+	}
+	return parsedFolders
+}
+
+// getFolderNos 获取会话所属的分组（已归档的会话不进入分组）
+func getFolderNos(folders []*parsedFolder, conversation folderConversation) []string {
+	if conversation.Archived {
+		return nil
+	}
+	var folderNos []string
+	for _, folder := range folders {
+		if folder.rules.match(conversation) {
+			folderNos = append(folderNos, folder.folderNo)
+		}
+	}
+	return folderNos
+}
+
+// unarchiveMentioned 有人@我时取消会话归档
+func (m *Message) unarchiveMentioned(reminders []*remindersModel) {
+	uids := make([]string, 0)
+	for _, reminder := range reminders {
+		if reminder.ReminderType != ReminderTypeMentionMe {
+			continue
+		}
+		channelID := reminderChannelID(reminder)
+		var mentionUIDs []string
+		if reminder.UID != "" {
+			mentionUIDs = []string{reminder.UID}
+		}
+		archivedUIDs, err := m.conversationExtradb.queryArchivedUIDs(channelID, reminder.ChannelType, mentionUIDs)
+		if err != nil {
+			m.Error("查询已归档会话的用户失败！", zap.Error(err))
+			continue
+		}
+		for _, uid := range archivedUIDs {
+			if uid == reminder.Publisher {
+				continue
+			}
+			err = m.conversationExtradb.updateUnarchived(uid, channelID, reminder.ChannelType, m.ctx.GenSeq(common.SyncConversationExtraKey))
+			if err != nil {
+				m.Error("取消会话归档失败！", zap.Error(err), zap.String("uid", uid))
+				continue
+			}
+			uids = append(uids, uid)
+		}
+	}
+	if len(uids) == 0 {
+		return
+	}
+	err := m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		Subscribers: uids,
+		CMD:         common.CMDSyncConversationExtra,
+	})
+	if err != nil {
+		m.Error("发送同步扩展会话cmd失败！", zap.Error(err))
+	}
+}
+
+type folderChannel struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+}
+
+// folderRules 分组包含规则
+type folderRules struct {
+	IncludeTypes    []string        `json:"include_types"`    // 包含的会话类型 unread,groups,persons,robots,muted
+	Channels        []folderChannel `json:"channels"`         // 指定包含的会话
+	ExcludeChannels []folderChannel `json:"exclude_channels"` // 指定排除的会话
+}
+
+// folderConversation 用于匹配分组规则的会话信息
+type folderConversation struct {
+	ChannelID   string
+	ChannelType uint8
+	Unread      int
+	Robot       bool
+	Mute        bool
+	Archived    bool
+}
+
+func (r folderRules) match(conversation folderConversation) bool {
+	for _, channel := range r.ExcludeChannels {
+		if channel.ChannelID == conversation.ChannelID && channel.ChannelType == conversation.ChannelType {
+			return false
+		}
+	}
+	for _, channel := range r.Channels {
+		if channel.ChannelID == conversation.ChannelID && channel.ChannelType == conversation.ChannelType {
+			return true
+		}
+	}
+	for _, includeType := range r.IncludeTypes {
+		switch includeType {
+		case folderIncludeUnread:
+			if conversation.Unread > 0 {
+				return true
+			}
+		case folderIncludeGroups:
+			if conversation.ChannelType == common.ChannelTypeGroup.Uint8() {
+				return true
+			}
+		case folderIncludePersons:
+			if conversation.ChannelType == common.ChannelTypePerson.Uint8() && !conversation.Robot {
+				return true
+			}
+		case folderIncludeRobots:
+			if conversation.Robot {
+				return true
+			}
+		case folderIncludeMuted:
+			if conversation.Mute {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type folderReq struct {
+	Name            string          `json:"name"`
+	IncludeTypes    []string        `json:"include_types"`
+	Channels        []folderChannel `json:"channels"`
+	ExcludeChannels []folderChannel `json:"exclude_channels"`
+}
+
+func (f folderReq) check() error {
+	name := strings.TrimSpace(f.Name)
+	if name == "" {
+		return errors.New("分组名称不能为空！")
+	}
+	if utf8.RuneCountInString(name) > conversationFolderNameMaxLen {
+		return fmt.Errorf("分组名称不能超过%d个字！", conversationFolderNameMaxLen)
+	}
+	for _, includeType := range f.IncludeTypes {
+		switch includeType {
+		case folderIncludeUnread, folderIncludeGroups, folderIncludePersons, folderIncludeRobots, folderIncludeMuted:
+		default:
+			return fmt.Errorf("不支持的会话类型[%s]！", includeType)
+		}
+	}
+	if len(f.IncludeTypes) == 0 && len(f.Channels) == 0 {
+		return errors.New("分组至少需要包含一种会话！")
+	}
+	for _, channel := range append(f.Channels, f.ExcludeChannels...) {
+		if strings.TrimSpace(channel.ChannelID) == "" || channel.ChannelType == 0 {
+			return errors.New("频道信息不能为空！")
+		}
+	}
+	return nil
+}
+
+func (f folderReq) rules() folderRules {
+	return folderRules{
+		IncludeTypes:    f.IncludeTypes,
+		Channels:        f.Channels,
+		ExcludeChannels: f.ExcludeChannels,
+	}
+}
+
+type conversationFolderResp struct {
+	FolderNo  string      `json:"folder_no"`
+	Name      string      `json:"name"`
+	Rules     folderRules `json:"rules"`
+	Sort      int         `json:"sort"`
+	IsDeleted int         `json:"is_deleted"`
+	Version   int64       `json:"version"`
+}
+
+func newConversationFolderResp(m *conversationFolderModel) *conversationFolderResp {
+	var rules folderRules
+	if m.Rules != "" {
+		_ = util.ReadJsonByByte([]byte(m.Rules), &rules)
+	}
+	return &conversationFolderResp{
+		FolderNo:  m.FolderNo,
+		Name:      m.Name,
+		Rules:     rules,
+		Sort:      m.Sort,
+		IsDeleted: m.IsDeleted,
+		Version:   m.Version,
+	}
+}
@@ -0,0 +1,189 @@
+package message
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"go.uber.org/zap"
+)
+
+// flameSetting 阅后即焚设置
+type flameSetting struct {
+	Flame       int `json:"flame"`        // 是否开启阅后即焚
+	FlameSecond int `json:"flame_second"` // 阅后即焚秒数
+}
+
+// addFlameIfNeed 消息被阅读后 如果消息开启了阅后即焚则添加销毁任务（发送者自己阅读不算）
+func (m *Message) addFlameIfNeed(messages []*messageModel, fakeChannelID string, channelType uint8, loginUID string) {
+	now := time.Now().Unix()
+	for _, message := range messages {
+		if message.FromUID == loginUID || message.IsDeleted == 1 {
+			continue
+		}
+		setting := m.getFlameSetting(message, channelType, loginUID)
+		if setting == nil || setting.Flame != 1 {
+			continue
+		}
+		err := m.flameDB.insertIfNotExist(&flameModel{
+			MessageID:   message.MessageID,
+			MessageSeq:  message.MessageSeq,
+			FromUID:     message.FromUID,
+			UID:         loginUID,
+			ChannelID:   fakeChannelID,
+			ChannelType: channelType,
+			FlameSecond: setting.FlameSecond,
+			ExpireAt:    now + int64(setting.FlameSecond),
+			Status:      int(flameStatusWait),
+		})
+		if err != nil {
+			m.Error("添加阅后即焚销毁任务失败！", zap.Error(err), zap.Int64("messageID", message.MessageID))
+		}
+	}
+}
+
+// getFlameSetting 获取消息的阅后即焚设置 优先使用消息正文里的设置，没有则使用发送者对频道的设置
+func (m *Message) getFlameSetting(message *messageModel, channelType uint8, loginUID string) *flameSetting {
+	setting := config.SettingFromUint8(message.Setting)
+	if !setting.Signal {
+		var payloadSetting flameSetting
+		if err := util.ReadJsonByByte(message.Payload, &payloadSetting); err == nil && payloadSetting.Flame == 1 {
+			return &payloadSetting
+		}
+	}
+	if channelType == common.ChannelTypePerson.Uint8() {
+		settings, err := m.userService.GetUserSettings([]string{loginUID}, message.FromUID)
+		if err != nil {
+			m.Error("查询用户设置失败！", zap.Error(err))
+			return nil
+		}
+		if len(settings) > 0 {
+			return &flameSetting{Flame: settings[0].Flame, FlameSecond: settings[0].FlameSecond}
+		}
+		return nil
+	}
+	if channelType == common.ChannelTypeGroup.Uint8() {
+		settings, err := m.groupService.GetSettingsWithUIDs(message.ChannelID, []string{message.FromUID})
+		if err != nil {
+			m.Error("查询群设置失败！", zap.Error(err))
+			return nil
+		}
+		if len(settings) > 0 {
+			return &flameSetting{Flame: settings[0].Flame, FlameSecond: settings[0].FlameSecond}
+		}
+	}
+	return nil
+}
+
+// flameCheck 销毁到期的阅后即焚消息
+func (m *Message) flameCheck() {
+	models, err := m.flameDB.queryDue(time.Now().Unix(), 100)
+	if err != nil {
+		m.Error("查询待销毁的阅后即焚消息失败！", zap.Error(err))
+		return
+	}
+	for _, model := range models {
+		if model.ChannelType == common.ChannelTypePerson.Uint8() {
+			err = m.burnPersonMessage(model)
+		} else {
+			err = m.burnMemberMessage(model)
+		}
+		if err != nil {
+			m.Error("销毁阅后即焚消息失败！", zap.Error(err), zap.Int64("messageID", model.MessageID))
+		}
+	}
+}
+
+// burnPersonMessage 个人频道 对方阅读后双方的消息都销毁
+func (m *Message) burnPersonMessage(model *flameModel) error {
+	tx, _ := m.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err := m.db.updateDeletedTx(model.ChannelID, model.MessageID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = m.messageExtraDB.insertOrUpdateDeletedTx(&messageExtraModel{
+		MessageID:   strconv.FormatInt(model.MessageID, 10),
+		MessageSeq:  model.MessageSeq,
+		ChannelID:   model.ChannelID,
+		ChannelType: model.ChannelType,
+		IsDeleted:   1,
+		Version:     m.genMessageExtraSeq(model.ChannelID),
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = m.flameDB.updateStatusWithMessageIDTx(model.MessageID, flameStatusBurned, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   model.FromUID,
+		ChannelType: model.ChannelType,
+		FromUID:     model.UID,
+		CMD:         common.CMDSyncMessageExtra,
+	})
+}
+
+// burnMemberMessage 群频道 每个成员阅读后只销毁该成员的消息
+func (m *Message) burnMemberMessage(model *flameModel) error {
+	tx, _ := m.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err := m.messageUserExtraDB.insertOrUpdateDeletedTx(&messageUserExtraModel{
+		UID:              model.UID,
+		MessageID:        strconv.FormatInt(model.MessageID, 10),
+		MessageSeq:       model.MessageSeq,
+		ChannelID:        model.ChannelID,
+		ChannelType:      model.ChannelType,
+		MessageIsDeleted: 1,
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = m.flameDB.updateStatusTx(model.Id, flameStatusBurned, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   model.UID,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		CMD:         CMDMessageDeleted,
+		Param: map[string]interface{}{
+			"messages": []*deleteReq{
+				{
+					MessageID:   strconv.FormatInt(model.MessageID, 10),
+					MessageSeq:  model.MessageSeq,
+					ChannelID:   model.ChannelID,
+					ChannelType: model.ChannelType,
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,390 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/api/group"
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 可以转发的消息类型
+var forwardableContentTypes = map[common.ContentType]bool{
+	common.Text:            true,
+	common.Image:           true,
+	common.GIF:             true,
+	common.Voice:           true,
+	common.Video:           true,
+	common.File:            true,
+	common.Location:        true,
+	common.Card:            true,
+	common.MultipleForward: true,
+	common.VectorSticker:   true,
+	common.EmojiSticker:    true,
+}
+
+// 转发消息 将一个频道内的一条或多条消息转发到多个频道（逐条转发或合并转发）
+func (m *Message) forward(c *wkhttp.Context) {
+	var req forwardReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(m.ctx.GetConfig()); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	loginUID := c.GetLoginUID()
+
+	sourceGroup, err := m.checkForwardSource(req.ChannelID, req.ChannelType, loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	messages, err := m.getForwardMessages(req.ChannelID, req.ChannelType, req.MessageIDs, loginUID, sourceGroup)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	for _, target := range req.Targets {
+		if err = m.checkForwardTarget(target.ChannelID, target.ChannelType, loginUID); err != nil {
+			c.ResponseError(err)
+			return
+		}
+	}
+
+	payloads, err := m.buildForwardPayloads(messages, req.ChannelID, req.ChannelType, sourceGroup, req.Merge)
+	if err != nil {
+		m.Error("生成转发消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("生成转发消息失败！"))
+		return
+	}
+	// 目标频道已在发送前全部检查过 某个频道发送失败时继续发送其他频道 在结果里标记失败
+	results := make([]*forwardResultResp, 0, len(req.Targets)*len(payloads))
+	failedCount := 0
+	for _, target := range req.Targets {
+		for _, payload := range payloads {
+			sendResp, err := m.ctx.SendMessageWithResult(&config.MsgSendReq{
+				Header: config.MsgHeader{
+					RedDot: 1,
+				},
+				FromUID:     loginUID,
+				ChannelID:   target.ChannelID,
+				ChannelType: target.ChannelType,
+				Payload:     []byte(util.ToJson(payload)),
+			})
+			if err != nil {
+				m.Error("转发消息失败！", zap.Error(err), zap.String("channelID", target.ChannelID), zap.Uint8("channelType", target.ChannelType))
+				failedCount++
+				results = append(results, &forwardResultResp{
+					ChannelID:   target.ChannelID,
+					ChannelType: target.ChannelType,
+					Error:       "转发消息失败！",
+				})
+				break
+			}
+			results = append(results, &forwardResultResp{
+				ChannelID:    target.ChannelID,
+				ChannelType:  target.ChannelType,
+				MessageID:    sendResp.MessageID,
+				MessageIDStr: strconv.FormatInt(sendResp.MessageID, 10),
+				MessageSeq:   sendResp.MessageSeq,
+			})
+		}
+	}
+	if failedCount == len(req.Targets) {
+		c.ResponseError(errors.New("转发消息失败！"))
+		return
+	}
+	c.Response(results)
+}
+
+// checkForwardSource 检查用户是否可以从来源频道转发消息 群聊返回群信息
+func (m *Message) checkForwardSource(channelID string, channelType uint8, loginUID string) (*group.InfoResp, error) {
+	if channelType == common.ChannelTypePerson.Uint8() {
+		return nil, nil
+	}
+	if channelType != common.ChannelTypeGroup.Uint8() {
+		return nil, errors.New("不支持的频道类型！")
+	}
+	isMember, err := m.groupService.ExistMember(channelID, loginUID)
+	if err != nil {
+		m.Error("查询是否是群成员失败！", zap.Error(err))
+		return nil, errors.New("查询是否是群成员失败！")
+	}
+	if !isMember {
+		return nil, errors.New("不是群成员，不能转发该群的消息！")
+	}
+	groupResp, err := m.groupService.GetGroupWithGroupNo(channelID)
+	if err != nil {
+		m.Error("查询群信息失败！", zap.Error(err))
+		return nil, errors.New("查询群信息失败！")
+	}
+	if groupResp == nil {
+		return nil, errors.New("群不存在！")
+	}
+	if groupResp.ForbiddenForward == 1 {
+		return nil, errors.New("该群已开启禁止转发！")
+	}
+	return groupResp, nil
+}
+
+// getForwardMessages 获取要转发的消息 只能转发自己可见的消息（已删除、已撤回、清空前和入群前不可查看的历史消息都不能转发）
+func (m *Message) getForwardMessages(channelID string, channelType uint8, messageIDs []string, loginUID string, sourceGroup *group.InfoResp) ([]*messageModel, error) {
+	fakeChannelID := channelID
+	if channelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(loginUID, channelID)
+	}
+	messages, err := m.db.queryMessagesWithMessageIDs(fakeChannelID, channelType, messageIDs)
+	if err != nil {
+		m.Error("查询消息失败！", zap.Error(err))
+		return nil, errors.New("查询消息失败！")
+	}
+	if len(messages) != len(messageIDs) {
+		return nil, errors.New("消息不存在！")
+	}
+	channelOffsetM, err := m.channelOffsetDB.queryWithUIDAndChannel(loginUID, channelID, channelType)
+	if err != nil {
+		m.Error("查询频道偏移量失败！", zap.Error(err))
+		return nil, errors.New("查询频道偏移量失败！")
+	}
+	messageExtras, err := m.messageExtraDB.queryWithMessageIDs(messageIDs, loginUID)
+	if err != nil {
+		m.Error("查询消息扩展失败！", zap.Error(err))
+		return nil, errors.New("查询消息扩展失败！")
+	}
+	messageExtraMap := make(map[string]*messageExtraDetailModel, len(messageExtras))
+	for _, messageExtra := range messageExtras {
+		messageExtraMap[messageExtra.MessageID] = messageExtra
+	}
+	messageUserExtras, err := m.messageUserExtraDB.queryWithMessageIDsAndUID(messageIDs, loginUID)
+	if err != nil {
+		m.Error("查询用户消息扩展失败！", zap.Error(err))
+		return nil, errors.New("查询用户消息扩展失败！")
+	}
+	messageUserExtraMap := make(map[string]*messageUserExtraModel, len(messageUserExtras))
+	for _, messageUserExtra := range messageUserExtras {
+		messageUserExtraMap[messageUserExtra.MessageID] = messageUserExtra
+	}
+	var joinedAt int64
+	if sourceGroup != nil && sourceGroup.AllowViewHistoryMsg != int(common.GroupAllowViewHistoryMsgEnabled) {
+		joinedAt, err = m.groupService.GetMemberJoinedAt(channelID, loginUID)
+		if err != nil {
+			m.Error("查询入群时间失败！", zap.Error(err))
+			return nil, errors.New("查询入群时间失败！")
+		}
+	}
+
+	for _, message := range messages {
+		messageID := strconv.FormatInt(message.MessageID, 10)
+		if message.ChannelID != fakeChannelID || message.ChannelType != channelType { // 消息表按频道分表 同一张表里有其他频道的消息
+			return nil, errors.New("消息不存在！")
+		}
+		if message.IsDeleted == 1 || (channelOffsetM != nil && message.MessageSeq <= channelOffsetM.MessageSeq) {
+			return nil, errors.New("消息不存在！")
+		}
+		if !visibleAfterJoin(sourceGroup, joinedAt, message.Timestamp) {
+			return nil, errors.New("消息不存在！")
+		}
+		if messageUserExtra := messageUserExtraMap[messageID]; messageUserExtra != nil && messageUserExtra.MessageIsDeleted == 1 {
+			return nil, errors.New("消息不存在！")
+		}
+		if messageExtra := messageExtraMap[messageID]; messageExtra != nil && (messageExtra.Revoke == 1 || messageExtra.IsDeleted == 1) {
+			return nil, errors.New("消息已撤回或已删除，不能转发！")
+		}
+		if config.SettingFromUint8(message.Setting).Signal {
+			return nil, errors.New("加密消息不支持转发！")
+		}
+		payloadMap, err := util.JsonToMap(string(message.Payload))
+		if err != nil {
+			return nil, errors.New("消息内容格式有误！")
+		}
+		if !forwardableContentTypes[common.ContentType(m.contentType(payloadMap))] {
+			return nil, errors.New("该类型的消息不支持转发！")
+		}
+		if setting := m.getFlameSetting(message, channelType, loginUID); setting != nil && setting.Flame == 1 {
+			return nil, errors.New("阅后即焚消息不能转发！")
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].MessageSeq < messages[j].MessageSeq
+	})
+	return messages, nil
+}
+
+// checkForwardTarget 检查用户是否可以向目标频道发送消息
+func (m *Message) checkForwardTarget(channelID string, channelType uint8, loginUID string) error {
+	if err := m.messageService.CheckSendPermission(loginUID, channelID, channelType); err != nil {
+		return err
+	}
+	if channelType != common.ChannelTypeGroup.Uint8() {
+		return nil
+	}
+	checkResp, err := m.groupService.CheckSend(&group.CheckSendReq{
+		GroupNo:     channelID,
+		UID:         loginUID,
+		ContentType: common.MultipleForward,
+	})
+	if err != nil {
+		return err
+	}
+	if !checkResp.Allow {
+		return errors.New(checkResp.Reason)
+	}
+	return nil
+}
+
+// visibleAfterJoin 群不允许新成员查看历史消息时 入群前的消息不可见
+func visibleAfterJoin(sourceGroup *group.InfoResp, joinedAt int64, timestamp int64) bool {
+	if sourceGroup == nil || sourceGroup.AllowViewHistoryMsg == int(common.GroupAllowViewHistoryMsgEnabled) {
+		return true
+	}
+	return timestamp >= joinedAt
+}
+
+// buildForwardPayloads 生成转发消息的正文 正文里带上来源信息
+func (m *Message) buildForwardPayloads(messages []*messageModel, channelID string, channelType uint8, sourceGroup *group.InfoResp, merge bool) ([]map[string]interface{}, error) {
+	uids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		uids = append(uids, message.FromUID)
+	}
+	users, err := m.userService.GetUsers(util.RemoveRepeatedElement(uids))
+	if err != nil {
+		return nil, err
+	}
+	userNameMap := make(map[string]string, len(users))
+	for _, user := range users {
+		userNameMap[user.UID] = user.Name
+	}
+
+	if merge {
+		userList := make([]map[string]interface{}, 0, len(users))
+		for _, user := range users {
+			userList = append(userList, map[string]interface{}{
+				"uid":  user.UID,
+				"name": user.Name,
+			})
+		}
+		msgs := make([]map[string]interface{}, 0, len(messages))
+		for _, message := range messages {
+			payloadMap, err := util.JsonToMap(string(message.Payload))
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, map[string]interface{}{
+				"message_id":    message.MessageID,
+				"message_idstr": strconv.FormatInt(message.MessageID, 10),
+				"from_uid":      message.FromUID,
+				"timestamp":     message.Timestamp,
+				"payload":       cleanForwardPayload(payloadMap),
+			})
+		}
+		return []map[string]interface{}{
+			{
+				"type":         common.MultipleForward,
+				"channel_type": channelType,
+				"users":        userList,
+				"msgs":         msgs,
+				"forward":      newForwardProvenance(nil, channelID, channelType, sourceGroup, ""),
+			},
+		}, nil
+	}
+
+	payloads := make([]map[string]interface{}, 0, len(messages))
+	for _, message := range messages {
+		payloadMap, err := util.JsonToMap(string(message.Payload))
+		if err != nil {
+			return nil, err
+		}
+		payloadMap = cleanForwardPayload(payloadMap)
+		if payloadMap["forward"] == nil { // 已经是转发的消息则保留最初的来源
+			payloadMap["forward"] = newForwardProvenance(message, channelID, channelType, sourceGroup, userNameMap[message.FromUID])
+		}
+		payloads = append(payloads, payloadMap)
+	}
+	return payloads, nil
+}
+
+// newForwardProvenance 转发来源 单聊不暴露会话信息 只记录原发送者
+func newForwardProvenance(message *messageModel, channelID string, channelType uint8, sourceGroup *group.InfoResp, fromName string) map[string]interface{} {
+	provenance := map[string]interface{}{}
+	if message != nil {
+		provenance["from_uid"] = message.FromUID
+		provenance["from_name"] = fromName
+		provenance["message_id"] = strconv.FormatInt(message.MessageID, 10)
+		provenance["timestamp"] = message.Timestamp
+	}
+	if channelType == common.ChannelTypeGroup.Uint8() && sourceGroup != nil {
+		provenance["channel_id"] = channelID
+		provenance["channel_type"] = channelType
+		provenance["channel_name"] = sourceGroup.Name
+	}
+	return provenance
+}
+
+// cleanForwardPayload 去掉不应该带到新频道的字段（@、回复、阅后即焚等）
+func cleanForwardPayload(payloadMap map[string]interface{}) map[string]interface{} {
+	for _, key := range []string{"mention", "reply", "flame", "flame_second", "robot_id"} {
+		delete(payloadMap, key)
+	}
+	return payloadMap
+}
+
+type forwardTarget struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+}
+
+type forwardReq struct {
+	ChannelID   string           `json:"channel_id"`   // 消息所在频道
+	ChannelType uint8            `json:"channel_type"` // 消息所在频道类型
+	MessageIDs  []string         `json:"message_ids"`  // 要转发的消息
+	Targets     []*forwardTarget `json:"targets"`      // 转发到的频道
+	Merge       bool             `json:"merge"`        // 是否合并转发
+}
+
+func (f *forwardReq) check(cfg *config.Config) error {
+	if strings.TrimSpace(f.ChannelID) == "" || f.ChannelType == 0 {
+		return errors.New("频道信息不能为空！")
+	}
+	if len(f.MessageIDs) == 0 {
+		return errors.New("转发的消息不能为空！")
+	}
+	if len(f.MessageIDs) > cfg.ForwardMaxMessageCount {
+		return fmt.Errorf("每次最多转发%d条消息！", cfg.ForwardMaxMessageCount)
+	}
+	f.MessageIDs = util.RemoveRepeatedElement(f.MessageIDs)
+	for _, messageID := range f.MessageIDs {
+		if _, err := strconv.ParseInt(messageID, 10, 64); err != nil {
+			return errors.New("消息ID格式有误！")
+		}
+	}
+	if len(f.Targets) == 0 {
+		return errors.New("转发的目标频道不能为空！")
+	}
+	if len(f.Targets) > cfg.ForwardMaxTargetCount {
+		return fmt.Errorf("每次最多转发到%d个频道！", cfg.ForwardMaxTargetCount)
+	}
+	for _, target := range f.Targets {
+		if target == nil || strings.TrimSpace(target.ChannelID) == "" || target.ChannelType == 0 {
+			return errors.New("目标频道信息不能为空！")
+		}
+	}
+	return nil
+}
+
+type forwardResultResp struct {
+	ChannelID    string `json:"channel_id"`
+	ChannelType  uint8  `json:"channel_type"`
+	MessageID    int64  `json:"message_id"`
+	MessageIDStr string `json:"message_idstr"`
+	MessageSeq   uint32 `json:"message_seq"`
+	Error        string `json:"error,omitempty"` // 发送失败的原因
+}
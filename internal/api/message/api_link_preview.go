@@ -0,0 +1,194 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/api/file"
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+)
+
+// 获取链接预览（发送前预览）
+func (m *Message) linkPreview(c *wkhttp.Context) {
+	link := strings.TrimSpace(c.Query("url"))
+	if link == "" {
+		c.ResponseError(errors.New("链接不能为空！"))
+		return
+	}
+	if !m.ctx.GetConfig().LinkPreviewOn {
+		c.ResponseError(errors.New("链接预览未开启！"))
+		return
+	}
+	previewM, err := m.getLinkPreview(link)
+	if err != nil {
+		m.Warn("获取链接预览失败！", zap.Error(err), zap.String("url", link))
+		c.ResponseError(errors.New("无法获取链接预览！"))
+		return
+	}
+	c.Response(newLinkPreviewResp(previewM))
+}
+
+// handleLinkPreviews 为包含链接的文本消息生成预览 通过消息扩展同步给客户端
+func (m *Message) handleLinkPreviews(messages []*config.MessageResp) {
+	if !m.ctx.GetConfig().LinkPreviewOn {
+		return
+	}
+	for _, message := range messages {
+		if config.SettingFromUint8(message.Setting).Signal {
+			continue
+		}
+		payloadMap, err := message.GetPayloadMap()
+		if err != nil || payloadMap == nil || m.contentType(payloadMap) != common.Text.Int() {
+			continue
+		}
+		content, _ := payloadMap["content"].(string)
+		link := getFirstLinkURL(content)
+		if link == "" {
+			continue
+		}
+		message := message
+		m.linkPreviewQueue.submit(func() {
+			previewM, err := m.getLinkPreview(link)
+			if err != nil {
+				m.Debug("获取链接预览失败！", zap.Error(err), zap.String("url", link))
+				return
+			}
+			m.attachLinkPreview(message, previewM)
+		})
+	}
+}
+
+// attachLinkPreview 将预览写入消息扩展
+func (m *Message) attachLinkPreview(message *config.MessageResp, previewM *linkPreviewModel) {
+	fakeChannelID := message.ChannelID
+	if message.ChannelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(message.FromUID, message.ChannelID)
+	}
+	err := m.messageExtraDB.insertOrUpdateLinkPreview(&messageExtraModel{
+		MessageID:   strconv.FormatInt(message.MessageID, 10),
+		MessageSeq:  message.MessageSeq,
+		FromUID:     message.FromUID,
+		ChannelID:   fakeChannelID,
+		ChannelType: message.ChannelType,
+		LinkPreview: dbr.NewNullString(util.ToJson(newLinkPreviewResp(previewM))),
+		Version:     m.genMessageExtraSeq(fakeChannelID),
+	})
+	if err != nil {
+		m.Error("更新消息链接预览失败！", zap.Error(err))
+		return
+	}
+	err = m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   threadChannelIDFor(fakeChannelID, message.ChannelType, message.FromUID),
+		ChannelType: message.ChannelType,
+		FromUID:     message.FromUID,
+		CMD:         common.CMDSyncMessageExtra,
+	})
+	if err != nil {
+		m.Error("发送同步消息扩展cmd失败！", zap.Error(err))
+	}
+}
+
+// getLinkPreview 获取链接预览 优先使用缓存（抓取失败的结果也会缓存）
+func (m *Message) getLinkPreview(link string) (*linkPreviewModel, error) {
+	urlHash := util.MD5(link)
+	cacheM, err := m.linkPreviewDB.queryWithURLHash(urlHash)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if cacheM != nil && now.Sub(time.Unix(cacheM.FetchedAt, 0)) < m.ctx.GetConfig().LinkPreviewCacheExpire {
+		if cacheM.Status != 1 {
+			return nil, errors.New("链接无法预览！")
+		}
+		return cacheM, nil
+	}
+	// 同一链接同时只抓取一次 其他请求等待并共享结果
+	previewM, err, _ := m.linkPreviewCalls.Do(urlHash, func() (interface{}, error) {
+		return m.fetchLinkPreview(urlHash, link, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return previewM.(*linkPreviewModel), nil
+}
+
+// fetchLinkPreview 抓取链接预览并缓存
+func (m *Message) fetchLinkPreview(urlHash string, link string, now time.Time) (*linkPreviewModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.ctx.GetConfig().LinkPreviewTimeout*2)
+	defer cancel()
+
+	var err error
+	previewM := &linkPreviewModel{
+		URLHash:   urlHash,
+		URL:       link,
+		FetchedAt: now.Unix(),
+	}
+	meta, fetchErr := m.linkPreviewFetcher.fetch(ctx, link)
+	if fetchErr == nil {
+		previewM.Status = 1
+		previewM.Title = meta.Title
+		previewM.Description = meta.Description
+		previewM.SiteName = meta.SiteName
+		if meta.Image != "" {
+			previewM.Image, err = m.storeLinkPreviewImage(ctx, urlHash, meta.Image)
+			if err != nil {
+				m.Debug("转存链接预览图失败！", zap.Error(err), zap.String("image", meta.Image))
+			}
+		}
+	}
+	err = m.linkPreviewDB.insertOrUpdate(previewM)
+	if err != nil {
+		m.Warn("缓存链接预览失败！", zap.Error(err))
+	}
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return previewM, nil
+}
+
+// storeLinkPreviewImage 下载预览图并转存 客户端不直接访问第三方图片
+func (m *Message) storeLinkPreviewImage(ctx context.Context, urlHash string, imageURL string) (string, error) {
+	data, contentType, err := m.linkPreviewFetcher.fetchImage(ctx, imageURL)
+	if err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("/linkpreview/%s%s", urlHash, linkPreviewImageExt(contentType))
+	_, err = m.fileService.UploadFile(fmt.Sprintf("%s%s", file.TypeCommon, path), contentType, func(w io.Writer) error {
+		_, err := io.Copy(w, bytes.NewReader(data))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("file/preview/%s%s", file.TypeCommon, path), nil
+}
+
+type linkPreviewResp struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+func newLinkPreviewResp(m *linkPreviewModel) *linkPreviewResp {
+	return &linkPreviewResp{
+		URL:         m.URL,
+		Title:       m.Title,
+		Description: m.Description,
+		Image:       m.Image,
+		SiteName:    m.SiteName,
+	}
+}
@@ -21,19 +21,21 @@ import (
 type Manager struct {
 	ctx *config.Context
 	log.Log
-	userService  user.IService
-	groupService group.IService
-	managerDB    *managerDB
+	userService        user.IService
+	groupService       group.IService
+	managerDB          *managerDB
+	scheduledMessageDB *scheduledMessageDB
 }
 
 // NewManager NewManager
 func NewManager(ctx *config.Context) *Manager {
 	return &Manager{
-		ctx:          ctx,
-		Log:          log.NewTLog("MessageManager"),
-		userService:  user.NewService(ctx),
-		groupService: group.NewService(ctx),
-		managerDB:    newManagerDB(ctx),
+		ctx:                ctx,
+		Log:                log.NewTLog("MessageManager"),
+		userService:        user.NewService(ctx),
+		groupService:       group.NewService(ctx),
+		managerDB:          newManagerDB(ctx),
+		scheduledMessageDB: newScheduledMessageDB(ctx),
 	}
 }
 
@@ -51,6 +53,10 @@ func (m *Manager) Route(r *wkhttp.WKHttp) {
 		auth.GET("/message/prohibit_words", m.prohibitWords)          // 查询违禁词
 		auth.DELETE("/message/prohibit_words", m.deleteProhibitWords) // 删除违禁词
 		auth.DELETE("/message", m.delete)                             // 删除消息
+		auth.POST("/message/scheduled", m.addScheduledMsg)            // 添加定时消息
+		auth.GET("/message/scheduled", m.scheduledMsgList)            // 定时消息列表
+		auth.PUT("/message/scheduled/:id", m.updateScheduledMsg)      // 修改定时消息
+		auth.DELETE("/message/scheduled/:id", m.cancelScheduledMsg)   // 取消定时消息
 	}
 }
 func (m *Manager) sendMsgToFriends(c *wkhttp.Context) {
@@ -754,3 +760,190 @@ type prohibitWordsVO struct {
 	Version   int64  `json:"version"`    // 版本
 	CreatedAt string `json:"created_at"` // 时间
 }
+
+// 添加定时消息（支持cron表达式重复发送）
+func (m *Manager) addScheduledMsg(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req managerScheduledMsgReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	model, err := m.newScheduledMsgModel(&req, time.Now())
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model.UID = c.GetLoginUID()
+	model.CreatorType = int(scheduledCreatorManager)
+	model.Status = int(scheduledStatusWait)
+	id, err := m.scheduledMessageDB.insert(model)
+	if err != nil {
+		m.Error("添加定时消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加定时消息失败！"))
+		return
+	}
+	model.Id = id
+	c.Response(newScheduledMessageResp(model))
+}
+
+// 修改定时消息
+func (m *Manager) updateScheduledMsg(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	old, err := m.getPendingScheduledMsg(c.Param("id"))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req managerScheduledMsgReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	model, err := m.newScheduledMsgModel(&req, time.Now())
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model.Id = old.Id
+	ok, err := m.scheduledMessageDB.update(model)
+	if err != nil {
+		m.Error("修改定时消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改定时消息失败！"))
+		return
+	}
+	if !ok { // 查询后被发送或取消
+		c.ResponseError(errors.New("定时消息已发送或已取消！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 取消定时消息
+func (m *Manager) cancelScheduledMsg(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model, err := m.getPendingScheduledMsg(c.Param("id"))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	ok, err := m.scheduledMessageDB.cancel(model.Id, model.Version)
+	if err != nil {
+		m.Error("取消定时消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("取消定时消息失败！"))
+		return
+	}
+	if !ok { // 查询后被发送或取消
+		c.ResponseError(errors.New("定时消息已发送或已取消！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 定时消息列表
+func (m *Manager) scheduledMsgList(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pageIndex, pageSize := c.GetPage()
+	models, err := m.scheduledMessageDB.queryManagerWithPage(uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		m.Error("查询定时消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询定时消息失败！"))
+		return
+	}
+	count, err := m.scheduledMessageDB.queryManagerCount()
+	if err != nil {
+		m.Error("查询定时消息数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询定时消息数量失败！"))
+		return
+	}
+	list := make([]*scheduledMessageResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newScheduledMessageResp(model))
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  list,
+	})
+}
+
+func (m *Manager) getPendingScheduledMsg(idStr string) (*scheduledMessageModel, error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, errors.New("定时消息ID格式有误！")
+	}
+	model, err := m.scheduledMessageDB.queryWithID(id)
+	if err != nil {
+		m.Error("查询定时消息失败！", zap.Error(err))
+		return nil, errors.New("查询定时消息失败！")
+	}
+	if model == nil || model.CreatorType != int(scheduledCreatorManager) {
+		return nil, errors.New("定时消息不存在！")
+	}
+	if model.Status != int(scheduledStatusWait) {
+		return nil, errors.New("定时消息已发送或已取消！")
+	}
+	return model, nil
+}
+
+// newScheduledMsgModel 校验请求并生成定时消息 设置了cron且没有指定发送时间的 从cron计算首次发送时间
+func (m *Manager) newScheduledMsgModel(req *managerScheduledMsgReq, now time.Time) (*scheduledMessageModel, error) {
+	if err := req.check(); err != nil {
+		return nil, err
+	}
+	if req.Content == "" {
+		return nil, errors.New("发送内容不能为空")
+	}
+	if req.ReceivedChannelType == int(common.ChannelTypeNone) {
+		return nil, errors.New("接受者类型错误")
+	}
+	sendAt := req.SendAt
+	if req.Cron != "" {
+		next, err := nextScheduledSendAt(req.Cron, now)
+		if err != nil {
+			return nil, errors.New("cron表达式有误！")
+		}
+		if sendAt == 0 {
+			sendAt = next
+		}
+	}
+	if sendAt <= now.Unix() {
+		return nil, errors.New("发送时间必须晚于当前时间！")
+	}
+	return &scheduledMessageModel{
+		FromUID:     req.Sender,
+		ChannelID:   req.ReceivedChannelID,
+		ChannelType: uint8(req.ReceivedChannelType),
+		Payload: util.ToJson(map[string]interface{}{
+			"content":  req.Content,
+			"type":     1,
+			"from_uid": req.Sender,
+		}),
+		SendAt:  sendAt,
+		Cron:    strings.TrimSpace(req.Cron),
+		Version: m.ctx.GenSeq(fmt.Sprintf("%s:%s", scheduledMessageSeqKey, "manager")),
+	}, nil
+}
+
+type managerScheduledMsgReq struct {
+	managerSendMsgReq
+	SendAt int64  `json:"send_at"` // 首次发送时间 时间戳（秒）
+	Cron   string `json:"cron"`    // 重复发送的cron表达式（分 时 日 月 周） 为空则只发送一次
+}
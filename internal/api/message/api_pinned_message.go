@@ -0,0 +1,269 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/api/group"
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 置顶消息
+func (m *Message) pinMessage(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req pinnedMessageReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	messageM, fakeChannelID, err := m.checkPinnedMessage(&req, loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pinnedM, err := m.pinnedMessageDB.queryWithMessageID(messageM.MessageID)
+	if err != nil {
+		m.Error("查询置顶消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询置顶消息失败！"))
+		return
+	}
+	if pinnedM != nil && pinnedM.IsDeleted == 0 {
+		c.ResponseOK()
+		return
+	}
+	count, err := m.pinnedMessageDB.queryCount(fakeChannelID, req.ChannelType)
+	if err != nil {
+		m.Error("查询置顶消息数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询置顶消息数量失败！"))
+		return
+	}
+	maxCount := m.ctx.GetConfig().PinnedMessageMaxCount
+	if maxCount > 0 && count >= int64(maxCount) {
+		c.ResponseError(fmt.Errorf("最多只能置顶%d条消息！", maxCount))
+		return
+	}
+	err = m.pinnedMessageDB.insertOrUpdate(&pinnedMessageModel{
+		MessageID:   messageM.MessageID,
+		MessageSeq:  messageM.MessageSeq,
+		ChannelID:   fakeChannelID,
+		ChannelType: req.ChannelType,
+		PinnerUID:   loginUID,
+		Version:     m.genPinnedMessageSeq(fakeChannelID),
+	})
+	if err != nil {
+		m.Error("置顶消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("置顶消息失败！"))
+		return
+	}
+	m.sendPinnedMessageNotice(&req, messageM, loginUID, c.GetLoginName())
+	m.sendSyncPinnedMessageCMD(&req, loginUID)
+	c.ResponseOK()
+}
+
+// 取消置顶消息
+func (m *Message) unpinMessage(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req pinnedMessageReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	messageM, fakeChannelID, err := m.checkPinnedMessage(&req, loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pinnedM, err := m.pinnedMessageDB.queryWithMessageID(messageM.MessageID)
+	if err != nil {
+		m.Error("查询置顶消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询置顶消息失败！"))
+		return
+	}
+	if pinnedM == nil || pinnedM.IsDeleted == 1 {
+		c.ResponseOK()
+		return
+	}
+	err = m.pinnedMessageDB.updateDeleted(messageM.MessageID, m.genPinnedMessageSeq(fakeChannelID))
+	if err != nil {
+		m.Error("取消置顶消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("取消置顶消息失败！"))
+		return
+	}
+	m.sendSyncPinnedMessageCMD(&req, loginUID)
+	c.ResponseOK()
+}
+
+// 同步置顶消息
+func (m *Message) syncPinnedMessage(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		ChannelID   string `json:"channel_id"`
+		ChannelType uint8  `json:"channel_type"`
+		Version     int64  `json:"version"`
+		Limit       uint64 `json:"limit"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if strings.TrimSpace(req.ChannelID) == "" {
+		c.ResponseError(errors.New("频道ID不能为空！"))
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 100
+	}
+	fakeChannelID := req.ChannelID
+	if req.ChannelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(loginUID, req.ChannelID)
+	} else if req.ChannelType == common.ChannelTypeGroup.Uint8() {
+		isMember, err := m.groupService.ExistMember(req.ChannelID, loginUID)
+		if err != nil {
+			m.Error("查询是否是群成员失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询是否是群成员失败！"))
+			return
+		}
+		if !isMember {
+			c.Response([]*pinnedMessageResp{})
+			return
+		}
+	}
+	models, err := m.pinnedMessageDB.sync(fakeChannelID, req.ChannelType, req.Version, req.Limit)
+	if err != nil {
+		m.Error("同步置顶消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("同步置顶消息失败！"))
+		return
+	}
+	resps := make([]*pinnedMessageResp, 0, len(models))
+	for _, model := range models {
+		resps = append(resps, newPinnedMessageResp(model, req.ChannelID))
+	}
+	c.Response(resps)
+}
+
+// checkPinnedMessage 检查置顶权限及消息 群内只有群主或管理员可以置顶，个人频道双方都可以置顶
+func (m *Message) checkPinnedMessage(req *pinnedMessageReq, loginUID string) (*messageModel, string, error) {
+	if err := req.check(); err != nil {
+		return nil, "", err
+	}
+	fakeChannelID := req.ChannelID
+	if req.ChannelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(loginUID, req.ChannelID)
+	} else if req.ChannelType == common.ChannelTypeGroup.Uint8() {
+		isManager, err := m.groupService.HasManagerPermission(req.ChannelID, loginUID, group.ManagerPermissionPin)
+		if err != nil {
+			m.Error("查询是否是群管理者失败！", zap.Error(err))
+			return nil, "", errors.New("查询是否是群管理者失败！")
+		}
+		if !isManager {
+			return nil, "", errors.New("只有群主或有置顶权限的管理员才能置顶消息！")
+		}
+	} else {
+		return nil, "", errors.New("不支持的频道类型！")
+	}
+	messageM, err := m.db.queryMessageWithMessageID(fakeChannelID, req.ChannelType, req.MessageID)
+	if err != nil {
+		m.Error("查询消息失败！", zap.Error(err))
+		return nil, "", errors.New("查询消息失败！")
+	}
+	if messageM == nil || messageM.IsDeleted == 1 {
+		return nil, "", errors.New("消息不存在！")
+	}
+	return messageM, fakeChannelID, nil
+}
+
+// sendPinnedMessageNotice 发送置顶提示消息
+func (m *Message) sendPinnedMessageNotice(req *pinnedMessageReq, messageM *messageModel, loginUID string, loginName string) {
+	msgReq := &config.MsgSendReq{
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"content": "{0}置顶了一条消息",
+			"extra": []config.UserBaseVo{
+				{
+					UID:  loginUID,
+					Name: loginName,
+				},
+			},
+			"message_id":  strconv.FormatInt(messageM.MessageID, 10),
+			"message_seq": messageM.MessageSeq,
+			"type":        common.PinnedMessage,
+		})),
+	}
+	if req.ChannelType == common.ChannelTypePerson.Uint8() {
+		msgReq.FromUID = loginUID
+	}
+	err := m.ctx.SendMessage(msgReq)
+	if err != nil {
+		m.Error("发送置顶提示消息失败！", zap.Error(err))
+	}
+}
+
+func (m *Message) sendSyncPinnedMessageCMD(req *pinnedMessageReq, loginUID string) {
+	err := m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		FromUID:     loginUID,
+		CMD:         common.CMDSyncPinnedMessage,
+	})
+	if err != nil {
+		m.Error("发送同步置顶消息cmd失败！", zap.Error(err))
+	}
+}
+
+func (m *Message) genPinnedMessageSeq(channelID string) int64 {
+	return m.ctx.GenSeq(fmt.Sprintf("%s:%s", common.PinnedMessageSeqKey, channelID))
+}
+
+type pinnedMessageReq struct {
+	MessageID   string `json:"message_id"`
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+}
+
+func (p *pinnedMessageReq) check() error {
+	if strings.TrimSpace(p.MessageID) == "" {
+		return errors.New("消息ID不能为空！")
+	}
+	if strings.TrimSpace(p.ChannelID) == "" {
+		return errors.New("频道ID不能为空！")
+	}
+	if p.ChannelType == 0 {
+		return errors.New("频道类型不能为空！")
+	}
+	return nil
+}
+
+type pinnedMessageResp struct {
+	MessageID   string `json:"message_id"`
+	MessageSeq  uint32 `json:"message_seq"`
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+	PinnerUID   string `json:"pinner_uid"`
+	IsDeleted   int    `json:"is_deleted"`
+	Version     int64  `json:"version"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func newPinnedMessageResp(m *pinnedMessageModel, channelID string) *pinnedMessageResp {
+	return &pinnedMessageResp{
+		MessageID:   strconv.FormatInt(m.MessageID, 10),
+		MessageSeq:  m.MessageSeq,
+		ChannelID:   channelID,
+		ChannelType: m.ChannelType,
+		PinnerUID:   m.PinnerUID,
+		IsDeleted:   m.IsDeleted,
+		Version:     m.Version,
+		CreatedAt:   m.CreatedAt.String(),
+	}
+}
@@ -0,0 +1,687 @@
+package message
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	pollTitleMaxLen  = 100 // 投票标题最大长度
+	pollOptionMaxLen = 50  // 投票选项最大长度
+)
+
+// 发起投票
+func (m *Message) pollCreate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req pollCreateReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(m.ctx.GetConfig(), time.Now()); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	fakeChannelID := req.ChannelID
+	if req.ChannelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(loginUID, req.ChannelID)
+	}
+	// 投票消息由服务端代发 不经过IM的权限检查（禁言、黑名单等）
+	if err := m.messageService.CheckSend(loginUID, req.ChannelID, req.ChannelType, nil); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	options := make([]*pollOption, 0, len(req.Options))
+	for i, text := range req.Options {
+		options = append(options, &pollOption{
+			ID:   i + 1,
+			Text: strings.TrimSpace(text),
+		})
+	}
+	pollM := &pollModel{
+		PollNo:      util.GenerUUID(),
+		ChannelID:   fakeChannelID,
+		ChannelType: req.ChannelType,
+		CreatorUID:  loginUID,
+		Title:       strings.TrimSpace(req.Title),
+		Options:     util.ToJson(options),
+		Multiple:    req.Multiple,
+		Anonymous:   req.Anonymous,
+		Deadline:    req.Deadline,
+	}
+	err := m.pollDB.insert(pollM)
+	if err != nil {
+		m.Error("添加投票失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加投票失败！"))
+		return
+	}
+	resp, err := m.ctx.SendMessageWithResult(&config.MsgSendReq{
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+		FromUID:     loginUID,
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"type":      common.Poll,
+			"poll_no":   pollM.PollNo,
+			"title":     pollM.Title,
+			"options":   options,
+			"multiple":  pollM.Multiple,
+			"anonymous": pollM.Anonymous,
+			"deadline":  pollM.Deadline,
+		})),
+	})
+	if err != nil {
+		m.Error("发送投票消息失败！", zap.Error(err))
+		if err = m.pollDB.delete(pollM.PollNo); err != nil {
+			m.Error("删除投票失败！", zap.Error(err))
+		}
+		c.ResponseError(errors.New("发送投票消息失败！"))
+		return
+	}
+	err = m.pollDB.updateMessage(pollM.PollNo, loginUID, pollM.ChannelID, pollM.ChannelType, resp.MessageID, resp.MessageSeq)
+	if err != nil { // 消息已发出 由消息监听（handlePollMessages）补关联 不能返回失败
+		m.Warn("关联投票消息失败！", zap.Error(err), zap.String("pollNo", pollM.PollNo))
+	}
+	pollM.MessageID = resp.MessageID
+	pollM.MessageSeq = resp.MessageSeq
+	c.Response(newPollResp(pollM, options, nil, 0, nil, req.ChannelID))
+}
+
+// 投票（重复投票会覆盖之前的选择）
+func (m *Message) pollVote(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		OptionIDs []int `json:"option_ids"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	pollM, options, err := m.getVotablePoll(c.Param("poll_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if err = checkPollOptionIDs(req.OptionIDs, options, pollM.Multiple == 1); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, _ := m.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	if err = m.lockVotablePollTx(pollM.PollNo, tx); err != nil {
+		tx.Rollback()
+		c.ResponseError(err)
+		return
+	}
+	err = m.pollDB.deleteVotesTx(pollM.PollNo, loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("删除投票记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除投票记录失败！"))
+		return
+	}
+	for _, optionID := range req.OptionIDs {
+		err = m.pollDB.insertVoteTx(&pollVoteModel{
+			PollNo:   pollM.PollNo,
+			UID:      loginUID,
+			OptionID: optionID,
+		}, tx)
+		if err != nil {
+			tx.Rollback()
+			m.Error("添加投票记录失败！", zap.Error(err))
+			c.ResponseError(errors.New("添加投票记录失败！"))
+			return
+		}
+	}
+	err = m.updatePollTallyTx(pollM, options, tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("更新投票统计失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新投票统计失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		c.ResponseErrorf("提交事务失败！", err)
+		return
+	}
+	m.sendPollSyncCMD(pollM, loginUID)
+	c.ResponseOK()
+}
+
+// 撤回投票
+func (m *Message) pollRetract(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	pollM, options, err := m.getVotablePoll(c.Param("poll_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, _ := m.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	if err = m.lockVotablePollTx(pollM.PollNo, tx); err != nil {
+		tx.Rollback()
+		c.ResponseError(err)
+		return
+	}
+	err = m.pollDB.deleteVotesTx(pollM.PollNo, loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("删除投票记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除投票记录失败！"))
+		return
+	}
+	err = m.updatePollTallyTx(pollM, options, tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("更新投票统计失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新投票统计失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		c.ResponseErrorf("提交事务失败！", err)
+		return
+	}
+	m.sendPollSyncCMD(pollM, loginUID)
+	c.ResponseOK()
+}
+
+// 结束投票 发起人或群主/管理员可以结束
+func (m *Message) pollClose(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	pollM, err := m.getManagedPoll(c.Param("poll_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if pollM.IsClosed == 1 {
+		c.ResponseOK()
+		return
+	}
+	err = m.closePoll(pollM, loginUID)
+	if err != nil {
+		m.Error("结束投票失败！", zap.Error(err))
+		c.ResponseError(errors.New("结束投票失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 投票详情
+func (m *Message) pollDetail(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	pollM, err := m.pollDB.queryWithPollNo(c.Param("poll_no"))
+	if err != nil {
+		m.Error("查询投票失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询投票失败！"))
+		return
+	}
+	if pollM == nil || pollM.MessageID == 0 {
+		c.ResponseError(errors.New("投票不存在！"))
+		return
+	}
+	if err = m.checkChannelAccess(pollM.ChannelID, pollM.ChannelType, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	options := pollM.getOptions()
+	voteModels, err := m.pollDB.queryVoteDetails(pollM.PollNo)
+	if err != nil {
+		m.Error("查询投票记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询投票记录失败！"))
+		return
+	}
+	voterCount, myOptionIDs := countPollVotes(voteModels, loginUID)
+	c.Response(newPollResp(pollM, options, voteModels, voterCount, myOptionIDs, threadChannelIDFor(pollM.ChannelID, pollM.ChannelType, loginUID)))
+}
+
+// 导出投票结果（csv）
+func (m *Message) pollExport(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	pollM, err := m.getManagedPoll(c.Param("poll_no"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	voteModels, err := m.pollDB.queryVoteDetails(pollM.PollNo)
+	if err != nil {
+		m.Error("查询投票记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询投票记录失败！"))
+		return
+	}
+	data, err := exportPollCSV(pollM, pollM.getOptions(), voteModels)
+	if err != nil {
+		m.Error("导出投票结果失败！", zap.Error(err))
+		c.ResponseError(errors.New("导出投票结果失败！"))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=poll_%s.csv", pollM.PollNo))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
+
+// pollExpireCheck 结束已到截止时间的投票
+func (m *Message) pollExpireCheck() {
+	models, err := m.pollDB.queryExpired(time.Now().Unix(), 100)
+	if err != nil {
+		m.Error("查询到期的投票失败！", zap.Error(err))
+		return
+	}
+	for _, model := range models {
+		if err = m.closePoll(model, ""); err != nil {
+			m.Error("结束到期的投票失败！", zap.Error(err), zap.String("pollNo", model.PollNo))
+		}
+	}
+}
+
+func (m *Message) closePoll(pollM *pollModel, closerUID string) error {
+	tx, _ := m.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	closed, err := m.pollDB.closeTx(pollM.PollNo, closerUID, time.Now().Unix(), tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !closed {
+		tx.Rollback()
+		return nil
+	}
+	pollM.IsClosed = 1
+	err = m.updatePollTallyTx(pollM, pollM.getOptions(), tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	fromUID := closerUID
+	if fromUID == "" {
+		fromUID = pollM.CreatorUID
+	}
+	m.sendPollSyncCMD(pollM, fromUID)
+	return nil
+}
+
+// getVotablePoll 获取可投票的投票
+func (m *Message) getVotablePoll(pollNo string, loginUID string) (*pollModel, []*pollOption, error) {
+	pollM, err := m.pollDB.queryWithPollNo(pollNo)
+	if err != nil {
+		m.Error("查询投票失败！", zap.Error(err))
+		return nil, nil, errors.New("查询投票失败！")
+	}
+	if pollM == nil || pollM.MessageID == 0 {
+		return nil, nil, errors.New("投票不存在！")
+	}
+	if pollM.IsClosed == 1 || (pollM.Deadline > 0 && pollM.Deadline <= time.Now().Unix()) {
+		return nil, nil, errors.New("投票已结束！")
+	}
+	if err = m.checkChannelAccess(pollM.ChannelID, pollM.ChannelType, loginUID); err != nil {
+		return nil, nil, err
+	}
+	return pollM, pollM.getOptions(), nil
+}
+
+// lockVotablePollTx 锁定投票行 防止并发投票互相覆盖统计结果 锁定后再次确认投票未结束
+func (m *Message) lockVotablePollTx(pollNo string, tx *dbr.Tx) error {
+	pollM, err := m.pollDB.queryWithPollNoForUpdateTx(pollNo, tx)
+	if err != nil {
+		m.Error("锁定投票失败！", zap.Error(err))
+		return errors.New("锁定投票失败！")
+	}
+	if pollM == nil {
+		return errors.New("投票不存在！")
+	}
+	if pollM.IsClosed == 1 {
+		return errors.New("投票已结束！")
+	}
+	return nil
+}
+
+// getManagedPoll 获取有管理权限的投票 发起人或群主/管理员
+func (m *Message) getManagedPoll(pollNo string, loginUID string) (*pollModel, error) {
+	pollM, err := m.pollDB.queryWithPollNo(pollNo)
+	if err != nil {
+		m.Error("查询投票失败！", zap.Error(err))
+		return nil, errors.New("查询投票失败！")
+	}
+	if pollM == nil || pollM.MessageID == 0 {
+		return nil, errors.New("投票不存在！")
+	}
+	if pollM.CreatorUID == loginUID {
+		return pollM, nil
+	}
+	if pollM.ChannelType == common.ChannelTypeGroup.Uint8() {
+		isManager, err := m.groupService.IsCreatorOrManager(pollM.ChannelID, loginUID)
+		if err != nil {
+			m.Error("查询是否是群管理者失败！", zap.Error(err))
+			return nil, errors.New("查询是否是群管理者失败！")
+		}
+		if isManager {
+			return pollM, nil
+		}
+	}
+	return nil, errors.New("只有发起人或群管理员才能操作！")
+}
+
+// updatePollTallyTx 重新统计票数并写入消息扩展 调用前需在同一事务里锁定投票行（lockVotablePollTx或closeTx）
+func (m *Message) updatePollTallyTx(pollM *pollModel, options []*pollOption, tx *dbr.Tx) error {
+	countModels, err := m.pollDB.queryOptionCountsTx(pollM.PollNo, tx)
+	if err != nil {
+		return err
+	}
+	voterCount, err := m.pollDB.queryVoterCountTx(pollM.PollNo, tx)
+	if err != nil {
+		return err
+	}
+	return m.messageExtraDB.insertOrUpdatePollTx(&messageExtraModel{
+		MessageID:   strconv.FormatInt(pollM.MessageID, 10),
+		MessageSeq:  pollM.MessageSeq,
+		FromUID:     pollM.CreatorUID,
+		ChannelID:   pollM.ChannelID,
+		ChannelType: pollM.ChannelType,
+		Poll:        dbr.NewNullString(util.ToJson(newPollTally(pollM, options, countModels, voterCount))),
+		Version:     m.genMessageExtraSeq(pollM.ChannelID),
+	}, tx)
+}
+
+// handlePollMessages 投票消息发出后关联投票 发起投票时关联失败的投票通过这里补上
+func (m *Message) handlePollMessages(messages []*config.MessageResp) {
+	for _, message := range messages {
+		payloadMap, err := message.GetPayloadMap()
+		if err != nil || payloadMap == nil || m.contentType(payloadMap) != common.Poll.Int() {
+			continue
+		}
+		pollNo, _ := payloadMap["poll_no"].(string)
+		if pollNo == "" {
+			continue
+		}
+		fakeChannelID := message.ChannelID
+		if message.ChannelType == common.ChannelTypePerson.Uint8() {
+			fakeChannelID = common.GetFakeChannelIDWith(message.FromUID, message.ChannelID)
+		}
+		// 只关联发到投票所属频道的消息 防止把投票关联到其他频道的消息上
+		err = m.pollDB.updateMessage(pollNo, message.FromUID, fakeChannelID, message.ChannelType, message.MessageID, message.MessageSeq)
+		if err != nil {
+			m.Error("关联投票消息失败！", zap.Error(err), zap.String("pollNo", pollNo))
+		}
+	}
+}
+
+func (m *Message) sendPollSyncCMD(pollM *pollModel, fromUID string) {
+	err := m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   threadChannelIDFor(pollM.ChannelID, pollM.ChannelType, fromUID),
+		ChannelType: pollM.ChannelType,
+		FromUID:     fromUID,
+		CMD:         common.CMDSyncMessageExtra,
+	})
+	if err != nil {
+		m.Error("发送同步消息扩展cmd失败！", zap.Error(err))
+	}
+}
+
+func (p *pollModel) getOptions() []*pollOption {
+	var options []*pollOption
+	if p.Options != "" {
+		if err := util.ReadJsonByByte([]byte(p.Options), &options); err != nil {
+			return nil
+		}
+	}
+	return options
+}
+
+// checkPollOptionIDs 检查投票选项
+func checkPollOptionIDs(optionIDs []int, options []*pollOption, multiple bool) error {
+	if len(optionIDs) == 0 {
+		return errors.New("请选择投票选项！")
+	}
+	if !multiple && len(optionIDs) > 1 {
+		return errors.New("此投票为单选！")
+	}
+	selected := make(map[int]bool, len(optionIDs))
+	for _, optionID := range optionIDs {
+		if selected[optionID] {
+			return errors.New("投票选项重复！")
+		}
+		exist := false
+		for _, option := range options {
+			if option.ID == optionID {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			return errors.New("投票选项不存在！")
+		}
+		selected[optionID] = true
+	}
+	return nil
+}
+
+// countPollVotes 统计投票人数及我投的选项
+func countPollVotes(voteModels []*pollVoteDetailModel, loginUID string) (int64, []int) {
+	voters := make(map[string]bool)
+	myOptionIDs := make([]int, 0)
+	for _, voteM := range voteModels {
+		voters[voteM.UID] = true
+		if voteM.UID == loginUID {
+			myOptionIDs = append(myOptionIDs, voteM.OptionID)
+		}
+	}
+	return int64(len(voters)), myOptionIDs
+}
+
+func exportPollCSV(pollM *pollModel, options []*pollOption, voteModels []*pollVoteDetailModel) ([]byte, error) {
+	counts := make(map[int]int64)
+	voters := make(map[int][]string)
+	for _, voteM := range voteModels {
+		counts[voteM.OptionID]++
+		if pollM.Anonymous == 0 {
+			name := voteM.Name
+			if name == "" {
+				name = voteM.UID
+			}
+			voters[voteM.OptionID] = append(voters[voteM.OptionID], name)
+		}
+	}
+	buff := bytes.NewBuffer([]byte("\xEF\xBB\xBF")) // utf8 bom 兼容excel
+	writer := csv.NewWriter(buff)
+	records := [][]string{
+		{"投票", pollM.Title},
+		{"选项", "票数", "投票人"},
+	}
+	for _, option := range options {
+		records = append(records, []string{option.Text, strconv.FormatInt(counts[option.ID], 10), strings.Join(voters[option.ID], "、")})
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+type pollOption struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+}
+
+type pollCreateReq struct {
+	ChannelID   string   `json:"channel_id"`
+	ChannelType uint8    `json:"channel_type"`
+	Title       string   `json:"title"`     // 投票标题
+	Options     []string `json:"options"`   // 选项
+	Multiple    int      `json:"multiple"`  // 是否多选
+	Anonymous   int      `json:"anonymous"` // 是否匿名
+	Deadline    int64    `json:"deadline"`  // 截止时间 时间戳（秒） 0为不限
+}
+
+func (p pollCreateReq) check(cfg *config.Config, now time.Time) error {
+	if strings.TrimSpace(p.ChannelID) == "" {
+		return errors.New("频道ID不能为空！")
+	}
+	if p.ChannelType != common.ChannelTypePerson.Uint8() && p.ChannelType != common.ChannelTypeGroup.Uint8() {
+		return errors.New("不支持的频道类型！")
+	}
+	title := strings.TrimSpace(p.Title)
+	if title == "" {
+		return errors.New("投票标题不能为空！")
+	}
+	if utf8.RuneCountInString(title) > pollTitleMaxLen {
+		return fmt.Errorf("投票标题不能超过%d个字！", pollTitleMaxLen)
+	}
+	if len(p.Options) < 2 {
+		return errors.New("投票至少需要两个选项！")
+	}
+	if cfg.PollOptionMaxCount > 0 && len(p.Options) > cfg.PollOptionMaxCount {
+		return fmt.Errorf("投票最多只能有%d个选项！", cfg.PollOptionMaxCount)
+	}
+	for _, option := range p.Options {
+		text := strings.TrimSpace(option)
+		if text == "" {
+			return errors.New("投票选项不能为空！")
+		}
+		if utf8.RuneCountInString(text) > pollOptionMaxLen {
+			return fmt.Errorf("投票选项不能超过%d个字！", pollOptionMaxLen)
+		}
+	}
+	if p.Deadline < 0 || (p.Deadline > 0 && p.Deadline <= now.Unix()) {
+		return errors.New("截止时间必须晚于当前时间！")
+	}
+	return nil
+}
+
+// pollTally 投票统计（存于消息扩展）
+type pollTally struct {
+	PollNo     string             `json:"poll_no"`
+	VoterCount int64              `json:"voter_count"`
+	IsClosed   int                `json:"is_closed"`
+	Options    []*pollOptionTally `json:"options"`
+}
+
+type pollOptionTally struct {
+	ID    int   `json:"id"`
+	Count int64 `json:"count"`
+}
+
+func newPollTally(pollM *pollModel, options []*pollOption, countModels []*pollOptionCountModel, voterCount int64) *pollTally {
+	countMap := make(map[int]int64, len(countModels))
+	for _, countM := range countModels {
+		countMap[countM.OptionID] = countM.Count
+	}
+	optionTallies := make([]*pollOptionTally, 0, len(options))
+	for _, option := range options {
+		optionTallies = append(optionTallies, &pollOptionTally{
+			ID:    option.ID,
+			Count: countMap[option.ID],
+		})
+	}
+	return &pollTally{
+		PollNo:     pollM.PollNo,
+		VoterCount: voterCount,
+		IsClosed:   pollM.IsClosed,
+		Options:    optionTallies,
+	}
+}
+
+type pollResp struct {
+	PollNo      string            `json:"poll_no"`
+	MessageID   string            `json:"message_id"`
+	MessageSeq  uint32            `json:"message_seq"`
+	ChannelID   string            `json:"channel_id"`
+	ChannelType uint8             `json:"channel_type"`
+	CreatorUID  string            `json:"creator_uid"`
+	Title       string            `json:"title"`
+	Multiple    int               `json:"multiple"`
+	Anonymous   int               `json:"anonymous"`
+	Deadline    int64             `json:"deadline"`
+	IsClosed    int               `json:"is_closed"`
+	ClosedAt    int64             `json:"closed_at,omitempty"`
+	VoterCount  int64             `json:"voter_count"`
+	MyOptionIDs []int             `json:"my_option_ids"` // 我投的选项
+	Options     []*pollOptionResp `json:"options"`
+}
+
+type pollOptionResp struct {
+	ID     int                 `json:"id"`
+	Text   string              `json:"text"`
+	Count  int64               `json:"count"`
+	Voters []config.UserBaseVo `json:"voters,omitempty"` // 投票人（匿名投票不返回）
+}
+
+func newPollResp(pollM *pollModel, options []*pollOption, voteModels []*pollVoteDetailModel, voterCount int64, myOptionIDs []int, channelID string) *pollResp {
+	optionResps := make([]*pollOptionResp, 0, len(options))
+	optionRespMap := make(map[int]*pollOptionResp, len(options))
+	for _, option := range options {
+		optionResp := &pollOptionResp{
+			ID:   option.ID,
+			Text: option.Text,
+		}
+		optionResps = append(optionResps, optionResp)
+		optionRespMap[option.ID] = optionResp
+	}
+	for _, voteM := range voteModels {
+		optionResp := optionRespMap[voteM.OptionID]
+		if optionResp == nil {
+			continue
+		}
+		optionResp.Count++
+		if pollM.Anonymous == 0 {
+			optionResp.Voters = append(optionResp.Voters, config.UserBaseVo{
+				UID:  voteM.UID,
+				Name: voteM.Name,
+			})
+		}
+	}
+	if myOptionIDs == nil {
+		myOptionIDs = make([]int, 0)
+	}
+	return &pollResp{
+		PollNo:      pollM.PollNo,
+		MessageID:   strconv.FormatInt(pollM.MessageID, 10),
+		MessageSeq:  pollM.MessageSeq,
+		ChannelID:   channelID,
+		ChannelType: pollM.ChannelType,
+		CreatorUID:  pollM.CreatorUID,
+		Title:       pollM.Title,
+		Multiple:    pollM.Multiple,
+		Anonymous:   pollM.Anonymous,
+		Deadline:    pollM.Deadline,
+		IsClosed:    pollM.IsClosed,
+		ClosedAt:    pollM.ClosedAt,
+		VoterCount:  voterCount,
+		MyOptionIDs: myOptionIDs,
+		Options:     optionResps,
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
 	"github.com/WuKongIM/WuKongChatServer/pkg/util"
 	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"github.com/gocraft/dbr/v2"
 	"go.uber.org/zap"
 )
 
@@ -32,13 +33,28 @@ func (m *Message) reminderDone(c *wkhttp.Context) {
 			panic(err)
 		}
 	}()
-	err := m.remindersDB.insertDonesTx(ids, loginUID, tx)
+	undoneReminders, err := m.remindersDB.queryUndoneWithIDsTx(ids, loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("查询未完成的提醒项失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询未完成的提醒项失败！"))
+		return
+	}
+	doneIDs, err := m.remindersDB.insertDonesTx(ids, loginUID, tx)
 	if err != nil {
 		tx.Rollback()
 		m.Error("添加done失败！", zap.Error(err))
 		c.ResponseError(errors.New("添加done失败！"))
 		return
 	}
+	// 只减去本次真正完成的提醒项（并发完成时done记录已存在的不再重复减）
+	err = decreaseConversationCountersTx(m.conversationCounterDB, loginUID, filterRemindersWithIDs(undoneReminders, doneIDs), tx)
+	if err != nil {
+		tx.Rollback()
+		m.Error("减少会话计数失败！", zap.Error(err))
+		c.ResponseError(errors.New("减少会话计数失败！"))
+		return
+	}
 	for _, id := range ids {
 		version := m.ctx.GenSeq(common.RemindersKey)
 		err = m.remindersDB.updateVersionTx(version, id, tx)
@@ -100,8 +116,12 @@ func (m *Message) listenerMessages(messages []*config.MessageResp) {
 	reminders := m.getReminders(messages) // 提醒
 	if len(reminders) > 0 {
 		m.handleReminders(reminders)
+		m.unarchiveMentioned(reminders) // 有人@我时取消会话归档
 	}
-
+	m.handleThreadReplies(messages)       // 话题回复
+	m.handleLinkPreviews(messages)        // 链接预览
+	m.handleVoiceTranscriptions(messages) // 语音转文字
+	m.handlePollMessages(messages)        // 关联投票消息
 }
 
 func (m *Message) getReminders(messages []*config.MessageResp) []*remindersModel {
@@ -152,6 +172,24 @@ func (m *Message) getReminders(messages []*config.MessageResp) []*remindersModel
 				}
 			}
 		}
+		// 回复我
+		replyUID := getReplyFromUID(payloadMap)
+		if replyUID != "" && replyUID != message.FromUID {
+			version := m.ctx.GenSeq(common.RemindersKey)
+			reminders = append(reminders, &remindersModel{
+				ChannelID:    message.ChannelID,
+				ChannelType:  message.ChannelType,
+				ClientMsgNo:  message.ClientMsgNo,
+				Publisher:    message.FromUID,
+				MessageID:    fmt.Sprintf("%d", message.MessageID),
+				MessageSeq:   message.MessageSeq,
+				ReminderType: ReminderTypeReplyMe,
+				UID:          replyUID,
+				IsLocate:     1,
+				Version:      version,
+				Text:         "[有人回复我]",
+			})
+		}
 		// 申请入群
 		contentType := m.contentType(payloadMap)
 		if contentType == common.GroupMemberInvite.Int() {
@@ -183,6 +221,7 @@ func (m *Message) handleReminders(reminders []*remindersModel) {
 		if err != nil {
 			m.Error("插入提醒项失败！", zap.Error(err))
 		}
+		m.increaseConversationCounters(reminders)
 		channels := make([]*config.ChannelReq, 0)
 		uids := make([]string, 0)
 		for _, reminder := range reminders {
@@ -221,6 +260,113 @@ func (m *Message) handleReminders(reminders []*remindersModel) {
 	}
 }
 
+// increaseConversationCounters 根据提醒项增加会话的@我和回复我数量
+func (m *Message) increaseConversationCounters(reminders []*remindersModel) {
+	for _, reminder := range reminders {
+		field, ok := reminderCounterField(reminder.ReminderType)
+		if !ok {
+			continue
+		}
+		var uids []string
+		if reminder.UID != "" {
+			uids = []string{reminder.UID}
+		} else if reminder.ChannelType == common.ChannelTypeGroup.Uint8() { // @所有人
+			members, err := m.groupService.GetMembers(reminder.ChannelID)
+			if err != nil {
+				m.Error("查询群成员失败！", zap.Error(err), zap.String("groupNo", reminder.ChannelID))
+				continue
+			}
+			uids = make([]string, 0, len(members))
+			for _, member := range members {
+				if member.UID == reminder.Publisher {
+					continue
+				}
+				uids = append(uids, member.UID)
+			}
+		}
+		if len(uids) == 0 {
+			continue
+		}
+		err := m.conversationCounterDB.increase(field, reminderChannelID(reminder), reminder.ChannelType, uids)
+		if err != nil {
+			m.Error("增加会话计数失败！", zap.Error(err), zap.String("field", string(field)))
+		}
+	}
+}
+
+// decreaseConversationCountersTx 提醒项完成后减少对应的会话计数
+func decreaseConversationCountersTx(counterDB *conversationCounterDB, uid string, reminders []*remindersModel, tx *dbr.Tx) error {
+	type counterKey struct {
+		field       counterField
+		channelID   string
+		channelType uint8
+	}
+	counts := map[counterKey]int{}
+	keys := make([]counterKey, 0)
+	for _, reminder := range reminders {
+		field, ok := reminderCounterField(reminder.ReminderType)
+		if !ok {
+			continue
+		}
+		key := counterKey{field: field, channelID: reminderChannelID(reminder), channelType: reminder.ChannelType}
+		if _, exist := counts[key]; !exist {
+			keys = append(keys, key)
+		}
+		counts[key]++
+	}
+	for _, key := range keys {
+		err := counterDB.decreaseTx(key.field, uid, key.channelID, key.channelType, counts[key], tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filterRemindersWithIDs 过滤出指定id的提醒项
+func filterRemindersWithIDs(reminders []*remindersModel, ids []int64) []*remindersModel {
+	idMap := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		idMap[id] = struct{}{}
+	}
+	results := make([]*remindersModel, 0, len(reminders))
+	for _, reminder := range reminders {
+		if _, ok := idMap[reminder.Id]; ok {
+			results = append(results, reminder)
+		}
+	}
+	return results
+}
+
+// reminderCounterField 提醒类型对应的会话计数字段
+func reminderCounterField(reminderType int) (counterField, bool) {
+	switch reminderType {
+	case ReminderTypeMentionMe:
+		return counterFieldMention, true
+	case ReminderTypeThreadReply, ReminderTypeReplyMe:
+		return counterFieldReply, true
+	}
+	return "", false
+}
+
+// reminderChannelID 提醒项在被提醒人视角下的频道ID（个人频道为发送者）
+func reminderChannelID(reminder *remindersModel) string {
+	if reminder.ChannelType == common.ChannelTypePerson.Uint8() {
+		return reminder.Publisher
+	}
+	return reminder.ChannelID
+}
+
+// getReplyFromUID 获取被回复消息的发送者
+func getReplyFromUID(payloadMap map[string]interface{}) string {
+	replyMap, ok := payloadMap["reply"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	fromUID, _ := replyMap["from_uid"].(string)
+	return fromUID
+}
+
 func (m *Message) hasMention(payloadMap map[string]interface{}) bool {
 	return payloadMap["mention"] != nil
 }
@@ -0,0 +1,345 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"github.com/robfig/cron"
+	"go.uber.org/zap"
+)
+
+// 添加定时消息
+func (m *Message) scheduledMessageAdd(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req scheduledMessageReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(m.ctx.GetConfig(), time.Now()); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if err := m.checkScheduledChannel(req.ChannelID, req.ChannelType, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	count, err := m.scheduledMessageDB.queryPendingCount(loginUID)
+	if err != nil {
+		m.Error("查询待发送的定时消息数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询待发送的定时消息数量失败！"))
+		return
+	}
+	if count >= int64(m.ctx.GetConfig().ScheduledMessageMaxPending) {
+		c.ResponseError(fmt.Errorf("最多只能有%d条待发送的定时消息！", m.ctx.GetConfig().ScheduledMessageMaxPending))
+		return
+	}
+	model := &scheduledMessageModel{
+		UID:         loginUID,
+		CreatorType: int(scheduledCreatorUser),
+		FromUID:     loginUID,
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		Payload:     util.ToJson(req.Payload),
+		SendAt:      req.SendAt,
+		Status:      int(scheduledStatusWait),
+		Version:     m.genScheduledMessageSeq(loginUID),
+	}
+	id, err := m.scheduledMessageDB.insert(model)
+	if err != nil {
+		m.Error("添加定时消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加定时消息失败！"))
+		return
+	}
+	model.Id = id
+	c.Response(newScheduledMessageResp(model))
+}
+
+// 修改定时消息
+func (m *Message) scheduledMessageUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	model, err := m.getPendingScheduledMessage(c.Param("id"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req scheduledMessageReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(m.ctx.GetConfig(), time.Now()); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if err := m.checkScheduledChannel(req.ChannelID, req.ChannelType, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	model.ChannelID = req.ChannelID
+	model.ChannelType = req.ChannelType
+	model.Payload = util.ToJson(req.Payload)
+	model.SendAt = req.SendAt
+	model.Version = m.genScheduledMessageSeq(loginUID)
+	ok, err := m.scheduledMessageDB.update(model)
+	if err != nil {
+		m.Error("修改定时消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改定时消息失败！"))
+		return
+	}
+	if !ok { // 查询后被发送或取消
+		c.ResponseError(errors.New("定时消息已发送或已取消！"))
+		return
+	}
+	c.Response(newScheduledMessageResp(model))
+}
+
+// 取消定时消息
+func (m *Message) scheduledMessageCancel(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	model, err := m.getPendingScheduledMessage(c.Param("id"), loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	ok, err := m.scheduledMessageDB.cancel(model.Id, m.genScheduledMessageSeq(loginUID))
+	if err != nil {
+		m.Error("取消定时消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("取消定时消息失败！"))
+		return
+	}
+	if !ok { // 查询后被发送或取消
+		c.ResponseError(errors.New("定时消息已发送或已取消！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 同步定时消息
+func (m *Message) scheduledMessageSync(c *wkhttp.Context) {
+	var req struct {
+		Version int64  `json:"version"`
+		Limit   uint64 `json:"limit"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 200 {
+		req.Limit = 200
+	}
+	models, err := m.scheduledMessageDB.sync(c.GetLoginUID(), req.Version, req.Limit)
+	if err != nil {
+		m.Error("同步定时消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("同步定时消息失败！"))
+		return
+	}
+	list := make([]*scheduledMessageResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newScheduledMessageResp(model))
+	}
+	c.Response(list)
+}
+
+// getPendingScheduledMessage 获取用户自己待发送的定时消息
+func (m *Message) getPendingScheduledMessage(idStr string, loginUID string) (*scheduledMessageModel, error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, errors.New("定时消息ID格式有误！")
+	}
+	model, err := m.scheduledMessageDB.queryWithID(id)
+	if err != nil {
+		m.Error("查询定时消息失败！", zap.Error(err))
+		return nil, errors.New("查询定时消息失败！")
+	}
+	if model == nil || model.UID != loginUID || model.CreatorType != int(scheduledCreatorUser) {
+		return nil, errors.New("定时消息不存在！")
+	}
+	if model.Status != int(scheduledStatusWait) {
+		return nil, errors.New("定时消息已发送或已取消！")
+	}
+	return model, nil
+}
+
+// checkScheduledChannel 检查用户是否可以向频道发送定时消息
+func (m *Message) checkScheduledChannel(channelID string, channelType uint8, loginUID string) error {
+	if channelType == common.ChannelTypePerson.Uint8() {
+		if channelID == loginUID {
+			return errors.New("不能给自己发送定时消息！")
+		}
+		return nil
+	}
+	if channelType == common.ChannelTypeGroup.Uint8() {
+		isMember, err := m.groupService.ExistMember(channelID, loginUID)
+		if err != nil {
+			m.Error("查询是否是群成员失败！", zap.Error(err))
+			return errors.New("查询是否是群成员失败！")
+		}
+		if !isMember {
+			return errors.New("不是群成员，不能发送定时消息！")
+		}
+		return nil
+	}
+	return errors.New("不支持的频道类型！")
+}
+
+// scheduledMessageCheck 发送到期的定时消息
+func (m *Message) scheduledMessageCheck() {
+	now := time.Now()
+	models, err := m.scheduledMessageDB.queryDue(now.Unix(), 100)
+	if err != nil {
+		m.Error("查询到期的定时消息失败！", zap.Error(err))
+		return
+	}
+	for _, model := range models {
+		m.sendScheduledMessage(model, now)
+	}
+}
+
+func (m *Message) sendScheduledMessage(model *scheduledMessageModel, now time.Time) {
+	status := scheduledStatusSent
+	nextSendAt := model.SendAt
+	if model.Cron != "" {
+		next, err := nextScheduledSendAt(model.Cron, now)
+		if err != nil {
+			m.Warn("定时消息的cron表达式有误！", zap.Error(err), zap.Int64("id", model.Id))
+		} else {
+			status = scheduledStatusWait
+			nextSendAt = next
+		}
+	}
+	ok, err := m.scheduledMessageDB.claim(model, status, nextSendAt, now.Unix(), m.genScheduledMessageSeq(model.UID))
+	if err != nil {
+		m.Error("更新定时消息状态失败！", zap.Error(err), zap.Int64("id", model.Id))
+		return
+	}
+	if !ok { // 已被其他实例处理或已被修改
+		return
+	}
+	if model.CreatorType == int(scheduledCreatorUser) {
+		// 创建后到发送前用户的权限可能已经变化（退群、被禁言、被拉黑等） 发送时需要重新检查
+		err = m.messageService.CheckSend(model.FromUID, model.ChannelID, model.ChannelType, []byte(model.Payload))
+	}
+	if err == nil {
+		err = m.ctx.SendMessage(&config.MsgSendReq{
+			Header: config.MsgHeader{
+				RedDot: 1,
+			},
+			FromUID:     model.FromUID,
+			ChannelID:   model.ChannelID,
+			ChannelType: model.ChannelType,
+			Payload:     []byte(model.Payload),
+		})
+	}
+	if err != nil {
+		m.Warn("发送定时消息失败！", zap.Error(err), zap.Int64("id", model.Id))
+		failStatus := scheduledStatusFailed
+		if status == scheduledStatusWait { // 周期消息失败后继续等待下次发送
+			failStatus = scheduledStatusWait
+		}
+		err = m.scheduledMessageDB.sendFailed(model.Id, status, failStatus, util.Substr(err.Error(), 0, 255), m.genScheduledMessageSeq(model.UID))
+		if err != nil {
+			m.Error("更新定时消息状态失败！", zap.Error(err), zap.Int64("id", model.Id))
+		}
+	}
+	if model.CreatorType != int(scheduledCreatorUser) {
+		return
+	}
+	err = m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   model.UID,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		CMD:         CMDSyncScheduledMessage,
+	})
+	if err != nil {
+		m.Error("发送同步定时消息cmd失败！", zap.Error(err))
+	}
+}
+
+func (m *Message) genScheduledMessageSeq(uid string) int64 {
+	return m.ctx.GenSeq(fmt.Sprintf("%s:%s", scheduledMessageSeqKey, uid))
+}
+
+// nextScheduledSendAt 通过cron表达式（分 时 日 月 周）计算下次发送时间
+func nextScheduledSendAt(spec string, after time.Time) (int64, error) {
+	schedule, err := cron.ParseStandard(strings.TrimSpace(spec))
+	if err != nil {
+		return 0, err
+	}
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return 0, errors.New("cron表达式没有下次执行时间！")
+	}
+	return next.Unix(), nil
+}
+
+type scheduledMessageReq struct {
+	ChannelID   string                 `json:"channel_id"`
+	ChannelType uint8                  `json:"channel_type"`
+	Payload     map[string]interface{} `json:"payload"`
+	SendAt      int64                  `json:"send_at"` // 发送时间 时间戳（秒）
+}
+
+func (s scheduledMessageReq) check(cfg *config.Config, now time.Time) error {
+	if strings.TrimSpace(s.ChannelID) == "" {
+		return errors.New("频道ID不能为空！")
+	}
+	if s.ChannelType == 0 {
+		return errors.New("频道类型不能为空！")
+	}
+	if len(s.Payload) == 0 {
+		return errors.New("消息内容不能为空！")
+	}
+	if _, ok := s.Payload["type"]; !ok {
+		return errors.New("消息类型不能为空！")
+	}
+	if s.SendAt <= now.Unix() {
+		return errors.New("发送时间必须晚于当前时间！")
+	}
+	if cfg.ScheduledMessageMaxAhead > 0 && s.SendAt > now.Add(cfg.ScheduledMessageMaxAhead).Unix() {
+		return errors.New("发送时间超出可设置范围！")
+	}
+	return nil
+}
+
+type scheduledMessageResp struct {
+	ID          int64                  `json:"id"`
+	FromUID     string                 `json:"from_uid"`
+	ChannelID   string                 `json:"channel_id"`
+	ChannelType uint8                  `json:"channel_type"`
+	Payload     map[string]interface{} `json:"payload"`
+	SendAt      int64                  `json:"send_at"`
+	Cron        string                 `json:"cron,omitempty"`
+	Status      int                    `json:"status"` // 0.待发送 1.已发送 2.已取消 3.发送失败
+	SentCount   int                    `json:"sent_count"`
+	LastSentAt  int64                  `json:"last_sent_at"`
+	FailReason  string                 `json:"fail_reason,omitempty"`
+	Version     int64                  `json:"version"`
+	CreatedAt   string                 `json:"created_at"`
+}
+
+func newScheduledMessageResp(m *scheduledMessageModel) *scheduledMessageResp {
+	payload, _ := util.JsonToMap(m.Payload)
+	return &scheduledMessageResp{
+		ID:          m.Id,
+		FromUID:     m.FromUID,
+		ChannelID:   m.ChannelID,
+		ChannelType: m.ChannelType,
+		Payload:     payload,
+		SendAt:      m.SendAt,
+		Cron:        m.Cron,
+		Status:      m.Status,
+		SentCount:   m.SentCount,
+		LastSentAt:  m.LastSentAt,
+		FailReason:  m.FailReason,
+		Version:     m.Version,
+		CreatedAt:   m.CreatedAt.String(),
+	}
+}
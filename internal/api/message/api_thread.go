@@ -0,0 +1,572 @@
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// 添加话题回复
+func (m *Message) addReply(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req threadReplyReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	rootMessageID, _ := strconv.ParseInt(req.MessageID, 10, 64)
+	// 服务端代发不经过IM的权限检查（禁言、黑名单等） 需要自己检查
+	if err := m.messageService.CheckSend(loginUID, req.ChannelID, req.ChannelType, []byte(util.ToJson(req.Payload))); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	fakeChannelID := req.ChannelID
+	if req.ChannelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(loginUID, req.ChannelID)
+	}
+	rootM, err := m.db.queryMessageWithMessageID(fakeChannelID, req.ChannelType, req.MessageID)
+	if err != nil {
+		m.Error("查询消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询消息失败！"))
+		return
+	}
+	if rootM == nil || rootM.IsDeleted == 1 || rootM.ChannelID != fakeChannelID || rootM.ChannelType != req.ChannelType {
+		c.ResponseError(errors.New("消息不存在！"))
+		return
+	}
+	if rootM.RootMessageID != "" {
+		c.ResponseError(errors.New("不能回复话题内的回复消息！"))
+		return
+	}
+	req.Payload["root_message_id"] = strconv.FormatInt(rootMessageID, 10)
+	resp, err := m.ctx.SendMessageWithResult(&config.MsgSendReq{
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+		FromUID:     loginUID,
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		Payload:     []byte(util.ToJson(req.Payload)),
+	})
+	if err != nil {
+		m.Error("发送话题回复失败！", zap.Error(err))
+		c.ResponseError(errors.New("发送话题回复失败！"))
+		return
+	}
+	c.Response(gin.H{
+		"message_id":    strconv.FormatInt(resp.MessageID, 10),
+		"message_seq":   resp.MessageSeq,
+		"client_msg_no": resp.ClientMsgNo,
+	})
+}
+
+// 获取话题回复详情
+func (m *Message) syncMessageReplies(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	rootMessageID, err := strconv.ParseInt(c.Param("message_id"), 10, 64)
+	if err != nil {
+		c.ResponseError(errors.New("消息ID格式有误！"))
+		return
+	}
+	seq, _ := strconv.ParseUint(c.Query("seq"), 10, 64)
+	limit, _ := strconv.ParseUint(c.Query("limit"), 10, 64)
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	threadM, err := m.threadDB.queryWithRootMessageID(rootMessageID)
+	if err != nil {
+		m.Error("查询话题失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询话题失败！"))
+		return
+	}
+	if threadM == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"root":     nil,
+			"messages": []*MsgSyncResp{},
+		})
+		return
+	}
+	if err = m.checkThreadAccess(threadM, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	rootM, err := m.db.queryMessageWithMessageID(threadM.ChannelID, threadM.ChannelType, strconv.FormatInt(rootMessageID, 10))
+	if err != nil {
+		m.Error("查询话题根消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询话题根消息失败！"))
+		return
+	}
+	replyModels, err := m.db.queryThreadReplies(threadM.ChannelID, rootMessageID, uint32(seq), limit)
+	if err != nil {
+		m.Error("查询话题回复失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询话题回复失败！"))
+		return
+	}
+	var rootmsgResp *MsgSyncResp
+	if rootM != nil {
+		rootmsgResp = &MsgSyncResp{}
+		rootmsgResp.from(newThreadMessageResp(rootM, loginUID), loginUID, nil, nil, nil)
+	}
+	messages := make([]*MsgSyncResp, 0, len(replyModels))
+	for _, replyM := range replyModels {
+		msgResp := &MsgSyncResp{}
+		msgResp.from(newThreadMessageResp(replyM, loginUID), loginUID, nil, nil, nil)
+		messages = append(messages, msgResp)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"root":     rootmsgResp,
+		"messages": messages,
+	})
+}
+
+// 同步回复统计数据
+func (m *Message) syncReplyTotal(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		MessageID string `json:"message_id"` // 消息唯一ID
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	rootMessageID, err := strconv.ParseInt(req.MessageID, 10, 64)
+	if err != nil {
+		c.ResponseError(errors.New("消息ID格式有误！"))
+		return
+	}
+	threadM, err := m.threadDB.queryWithRootMessageID(rootMessageID)
+	if err != nil {
+		m.Error("查询话题失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询话题失败！"))
+		return
+	}
+	if threadM == nil {
+		c.JSON(http.StatusOK, &syncTotalResp{
+			MessageID: req.MessageID,
+		})
+		return
+	}
+	if err = m.checkThreadAccess(threadM, loginUID); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.JSON(http.StatusOK, &syncTotalResp{
+		MessageID:   req.MessageID,
+		Seq:         fmt.Sprintf("%d", threadM.LastReplyMessageSeq),
+		ChannelID:   threadChannelIDFor(threadM.ChannelID, threadM.ChannelType, loginUID),
+		ChannelType: threadM.ChannelType,
+		Count:       int(threadM.ReplyCount),
+	})
+}
+
+// 同步我参与的话题
+func (m *Message) syncThread(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		Version int64  `json:"version"`
+		Limit   uint64 `json:"limit"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 100
+	}
+	memberModels, err := m.threadDB.syncMembers(loginUID, req.Version, req.Limit)
+	if err != nil {
+		m.Error("同步话题失败！", zap.Error(err))
+		c.ResponseError(errors.New("同步话题失败！"))
+		return
+	}
+	resps := make([]*threadResp, 0, len(memberModels))
+	if len(memberModels) == 0 {
+		c.Response(resps)
+		return
+	}
+	rootMessageIDs := make([]int64, 0, len(memberModels))
+	for _, memberM := range memberModels {
+		rootMessageIDs = append(rootMessageIDs, memberM.RootMessageID)
+	}
+	threadModels, err := m.threadDB.queryWithRootMessageIDs(rootMessageIDs)
+	if err != nil {
+		m.Error("查询话题失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询话题失败！"))
+		return
+	}
+	threadMap := make(map[int64]*threadModel, len(threadModels))
+	channelAccessMap := map[string]bool{} // 已退群等不能再查看的频道的话题不再同步
+	for _, threadM := range threadModels {
+		channelKey := fmt.Sprintf("%s-%d", threadM.ChannelID, threadM.ChannelType)
+		canAccess, ok := channelAccessMap[channelKey]
+		if !ok {
+			canAccess = m.checkThreadAccess(threadM, loginUID) == nil
+			channelAccessMap[channelKey] = canAccess
+		}
+		if !canAccess {
+			continue
+		}
+		threadMap[threadM.RootMessageID] = threadM
+	}
+	for _, memberM := range memberModels {
+		threadM := threadMap[memberM.RootMessageID]
+		if threadM == nil {
+			continue
+		}
+		resps = append(resps, newThreadResp(threadM, memberM, loginUID))
+	}
+	c.Response(resps)
+}
+
+// 话题已读
+func (m *Message) threadRead(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		RootMessageID string `json:"root_message_id"` // 话题根消息ID
+		MessageSeq    uint32 `json:"message_seq"`     // 已读到的回复序号 为0表示全部已读
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	rootMessageID, err := strconv.ParseInt(req.RootMessageID, 10, 64)
+	if err != nil {
+		c.ResponseError(errors.New("话题ID格式有误！"))
+		return
+	}
+	memberM, err := m.threadDB.queryMember(rootMessageID, loginUID)
+	if err != nil {
+		m.Error("查询话题参与者失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询话题参与者失败！"))
+		return
+	}
+	if memberM == nil {
+		c.ResponseOK()
+		return
+	}
+	threadM, err := m.threadDB.queryWithRootMessageID(rootMessageID)
+	if err != nil {
+		m.Error("查询话题失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询话题失败！"))
+		return
+	}
+	if threadM == nil {
+		c.ResponseOK()
+		return
+	}
+	readMessageSeq := req.MessageSeq
+	if readMessageSeq == 0 || readMessageSeq > threadM.LastReplyMessageSeq {
+		readMessageSeq = threadM.LastReplyMessageSeq
+	}
+	if readMessageSeq <= memberM.ReadMessageSeq && memberM.UnreadCount == 0 {
+		c.ResponseOK()
+		return
+	}
+	if readMessageSeq < memberM.ReadMessageSeq {
+		readMessageSeq = memberM.ReadMessageSeq
+	}
+	unreadCount, err := m.db.queryThreadUnreadCount(threadM.ChannelID, rootMessageID, loginUID, readMessageSeq)
+	if err != nil {
+		m.Error("查询话题未读数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询话题未读数量失败！"))
+		return
+	}
+	err = m.threadDB.updateRead(rootMessageID, loginUID, readMessageSeq, unreadCount, m.ctx.GenSeq(common.ThreadSeqKey))
+	if err != nil {
+		m.Error("更新话题已读位置失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新话题已读位置失败！"))
+		return
+	}
+	m.sendSyncThreadCMD([]string{loginUID}, rootMessageID)
+	c.ResponseOK()
+}
+
+// handleThreadReplies 处理话题回复消息 更新话题统计、参与者未读数并提醒参与者
+func (m *Message) handleThreadReplies(messages []*config.MessageResp) {
+	for _, message := range messages {
+		payloadMap, err := message.GetPayloadMap()
+		if err != nil || payloadMap == nil {
+			continue
+		}
+		rootMessageID := getThreadRootMessageID(payloadMap)
+		if rootMessageID == 0 {
+			continue
+		}
+		fakeChannelID := message.ChannelID
+		if message.ChannelType == common.ChannelTypePerson.Uint8() {
+			fakeChannelID = common.GetFakeChannelIDWith(message.FromUID, message.ChannelID)
+		}
+		rootM, err := m.db.queryMessageWithMessageID(fakeChannelID, message.ChannelType, strconv.FormatInt(rootMessageID, 10))
+		if err != nil {
+			m.Error("查询话题根消息失败！", zap.Error(err))
+			continue
+		}
+		if rootM == nil || rootM.ChannelID != fakeChannelID || rootM.ChannelType != message.ChannelType {
+			m.Warn("话题根消息不存在，跳过", zap.Int64("rootMessageID", rootMessageID), zap.Int64("messageID", message.MessageID))
+			continue
+		}
+		replyCount, err := m.db.queryThreadReplyCount(fakeChannelID, rootMessageID)
+		if err != nil {
+			m.Error("查询话题回复数量失败！", zap.Error(err))
+			continue
+		}
+		version := m.ctx.GenSeq(common.ThreadSeqKey)
+		err = m.threadDB.insertOrUpdate(&threadModel{
+			RootMessageID:       rootMessageID,
+			RootMessageSeq:      rootM.MessageSeq,
+			ChannelID:           fakeChannelID,
+			ChannelType:         message.ChannelType,
+			CreatorUID:          rootM.FromUID,
+			ReplyCount:          replyCount,
+			LastReplyMessageID:  message.MessageID,
+			LastReplyMessageSeq: message.MessageSeq,
+			LastReplyUID:        message.FromUID,
+			LastReplyAt:         int64(message.Timestamp),
+			Version:             version,
+		})
+		if err != nil {
+			m.Error("更新话题失败！", zap.Error(err))
+			continue
+		}
+		participants := make([]*threadMemberModel, 0, 2)
+		if rootM.FromUID != "" && rootM.FromUID != message.FromUID {
+			participants = append(participants, &threadMemberModel{
+				RootMessageID: rootMessageID,
+				UID:           rootM.FromUID,
+				Version:       version,
+			})
+		}
+		participants = append(participants, &threadMemberModel{
+			RootMessageID:  rootMessageID,
+			UID:            message.FromUID,
+			ReadMessageSeq: message.MessageSeq,
+			Version:        version,
+		})
+		if message.ChannelType == common.ChannelTypeGroup.Uint8() && m.hasMention(payloadMap) {
+			_, mentionUIDs := m.getMention(payloadMap)
+			for _, mentionUID := range mentionUIDs {
+				if mentionUID == message.FromUID || mentionUID == rootM.FromUID {
+					continue
+				}
+				participants = append(participants, &threadMemberModel{
+					RootMessageID: rootMessageID,
+					UID:           mentionUID,
+					Version:       version,
+				})
+			}
+		}
+		for _, participant := range participants {
+			err = m.threadDB.insertOrUpdateMember(participant)
+			if err != nil {
+				m.Error("添加话题参与者失败！", zap.Error(err), zap.String("uid", participant.UID))
+			}
+		}
+		err = m.threadDB.increaseUnreadCount(rootMessageID, message.MessageID, message.FromUID, version)
+		if err != nil {
+			m.Error("更新话题未读数量失败！", zap.Error(err))
+		}
+		uids, err := m.threadDB.queryMemberUIDs(rootMessageID)
+		if err != nil {
+			m.Error("查询话题参与者失败！", zap.Error(err))
+			continue
+		}
+		replyUID := getReplyFromUID(payloadMap) // 被回复的人已经有“回复我”的提醒 不再重复提醒
+		reminders := make([]*remindersModel, 0, len(uids))
+		for _, uid := range uids {
+			if uid == message.FromUID || uid == replyUID {
+				continue
+			}
+			reminders = append(reminders, &remindersModel{
+				ChannelID:    message.ChannelID,
+				ChannelType:  message.ChannelType,
+				ClientMsgNo:  message.ClientMsgNo,
+				Publisher:    message.FromUID,
+				MessageID:    fmt.Sprintf("%d", message.MessageID),
+				MessageSeq:   message.MessageSeq,
+				ReminderType: ReminderTypeThreadReply,
+				UID:          uid,
+				IsLocate:     1,
+				Version:      m.ctx.GenSeq(common.RemindersKey),
+				Text:         "[话题有新回复]",
+				Data: util.ToJson(map[string]interface{}{
+					"root_message_id": strconv.FormatInt(rootMessageID, 10),
+				}),
+			})
+		}
+		m.handleReminders(reminders)
+		m.sendSyncThreadCMD(uids, rootMessageID)
+	}
+}
+
+// checkThreadAccess 检查用户是否能查看话题
+func (m *Message) checkThreadAccess(threadM *threadModel, loginUID string) error {
+	return m.checkChannelAccess(threadM.ChannelID, threadM.ChannelType, loginUID)
+}
+
+// checkChannelAccess 检查用户是否属于频道 个人频道为fake channel id
+func (m *Message) checkChannelAccess(fakeChannelID string, channelType uint8, loginUID string) error {
+	if channelType == common.ChannelTypePerson.Uint8() {
+		for _, uid := range strings.Split(fakeChannelID, "@") {
+			if uid == loginUID {
+				return nil
+			}
+		}
+		return errors.New("无权查看此频道内容！")
+	}
+	if channelType == common.ChannelTypeGroup.Uint8() {
+		isMember, err := m.groupService.ExistMember(fakeChannelID, loginUID)
+		if err != nil {
+			m.Error("查询是否是群成员失败！", zap.Error(err))
+			return errors.New("查询是否是群成员失败！")
+		}
+		if !isMember {
+			return errors.New("不是群成员，无权查看！")
+		}
+		return nil
+	}
+	return errors.New("不支持的频道类型！")
+}
+
+func (m *Message) sendSyncThreadCMD(uids []string, rootMessageID int64) {
+	if len(uids) == 0 {
+		return
+	}
+	err := m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		Subscribers: uids,
+		CMD:         common.CMDSyncThread,
+		Param: map[string]interface{}{
+			"root_message_id": strconv.FormatInt(rootMessageID, 10),
+		},
+	})
+	if err != nil {
+		m.Error("发送同步话题cmd失败！", zap.Error(err))
+	}
+}
+
+// getThreadRootMessageID 从消息正文中获取话题根消息ID 不是话题回复返回0
+func getThreadRootMessageID(payloadMap map[string]interface{}) int64 {
+	if payloadMap == nil || payloadMap["root_message_id"] == nil {
+		return 0
+	}
+	var rootMessageID int64
+	switch v := payloadMap["root_message_id"].(type) {
+	case json.Number:
+		rootMessageID, _ = v.Int64()
+	case string:
+		rootMessageID, _ = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	}
+	if rootMessageID < 0 {
+		return 0
+	}
+	return rootMessageID
+}
+
+// threadChannelIDFor 获取用户视角下的频道ID（个人频道为对方uid）
+func threadChannelIDFor(fakeChannelID string, channelType uint8, loginUID string) string {
+	if channelType != common.ChannelTypePerson.Uint8() {
+		return fakeChannelID
+	}
+	uids := strings.Split(fakeChannelID, "@")
+	if len(uids) != 2 {
+		return fakeChannelID
+	}
+	if uids[0] == loginUID {
+		return uids[1]
+	}
+	return uids[0]
+}
+
+func newThreadMessageResp(model *messageModel, loginUID string) *config.MessageResp {
+	var header config.MsgHeader
+	if model.Header != "" {
+		_ = util.ReadJsonByByte([]byte(model.Header), &header)
+	}
+	return &config.MessageResp{
+		Header:      header,
+		Setting:     model.Setting,
+		MessageID:   model.MessageID,
+		MessageSeq:  model.MessageSeq,
+		ClientMsgNo: model.ClientMsgNo,
+		FromUID:     model.FromUID,
+		ChannelID:   threadChannelIDFor(model.ChannelID, model.ChannelType, loginUID),
+		ChannelType: model.ChannelType,
+		Timestamp:   int32(model.Timestamp),
+		Payload:     model.Payload,
+		IsDeleted:   model.IsDeleted,
+	}
+}
+
+type threadReplyReq struct {
+	MessageID   string                 `json:"message_id"`   // 话题根消息ID
+	ChannelID   string                 `json:"channel_id"`   // 频道唯一ID
+	ChannelType uint8                  `json:"channel_type"` // 频道类型
+	Payload     map[string]interface{} `json:"payload"`      // 回复消息内容
+}
+
+func (t threadReplyReq) check() error {
+	if strings.TrimSpace(t.MessageID) == "" {
+		return errors.New("消息ID不能为空！")
+	}
+	if _, err := strconv.ParseInt(t.MessageID, 10, 64); err != nil {
+		return errors.New("消息ID格式有误！")
+	}
+	if strings.TrimSpace(t.ChannelID) == "" {
+		return errors.New("频道ID不能为空！")
+	}
+	if t.ChannelType == 0 {
+		return errors.New("频道类型不能为空！")
+	}
+	if len(t.Payload) == 0 || t.Payload["type"] == nil {
+		return errors.New("回复内容不能为空！")
+	}
+	return nil
+}
+
+type threadResp struct {
+	RootMessageID       string `json:"root_message_id"`
+	RootMessageSeq      uint32 `json:"root_message_seq"`
+	ChannelID           string `json:"channel_id"`
+	ChannelType         uint8  `json:"channel_type"`
+	CreatorUID          string `json:"creator_uid"`
+	ReplyCount          int64  `json:"reply_count"`
+	LastReplyMessageID  string `json:"last_reply_message_id"`
+	LastReplyMessageSeq uint32 `json:"last_reply_message_seq"`
+	LastReplyUID        string `json:"last_reply_uid"`
+	LastReplyAt         int64  `json:"last_reply_at"`
+	ReadMessageSeq      uint32 `json:"read_message_seq"` // 我已读到的回复序号
+	UnreadCount         int64  `json:"unread_count"`     // 我的未读回复数量
+	Version             int64  `json:"version"`
+}
+
+func newThreadResp(t *threadModel, member *threadMemberModel, loginUID string) *threadResp {
+	return &threadResp{
+		RootMessageID:       strconv.FormatInt(t.RootMessageID, 10),
+		RootMessageSeq:      t.RootMessageSeq,
+		ChannelID:           threadChannelIDFor(t.ChannelID, t.ChannelType, loginUID),
+		ChannelType:         t.ChannelType,
+		CreatorUID:          t.CreatorUID,
+		ReplyCount:          t.ReplyCount,
+		LastReplyMessageID:  strconv.FormatInt(t.LastReplyMessageID, 10),
+		LastReplyMessageSeq: t.LastReplyMessageSeq,
+		LastReplyUID:        t.LastReplyUID,
+		LastReplyAt:         t.LastReplyAt,
+		ReadMessageSeq:      member.ReadMessageSeq,
+		UnreadCount:         member.UnreadCount,
+		Version:             member.Version,
+	}
+}
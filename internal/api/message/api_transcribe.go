@@ -0,0 +1,408 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/api/group"
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+)
+
+const transcriptSearchLimit = 20 // 语音转写文本每次最多搜索的数量
+
+const (
+	transcriptStatusNone       = 0 // 未转写
+	transcriptStatusSuccess    = 1 // 转写成功
+	transcriptStatusFail       = 2 // 转写失败
+	transcriptStatusProcessing = 3 // 转写中
+)
+
+// transcribeTask 语音转写任务
+type transcribeTask struct {
+	MessageID     int64
+	MessageSeq    uint32
+	FromUID       string
+	FakeChannelID string
+	ChannelType   uint8
+	VoiceURL      string
+	ClaimedAt     int64 // 标记为转写中的时间
+}
+
+// handleVoiceTranscriptions 异步将语音消息转为文字 通过消息扩展同步给客户端
+func (m *Message) handleVoiceTranscriptions(messages []*config.MessageResp) {
+	if m.ctx.GetConfig().TranscribeProvider == "" {
+		return
+	}
+	for _, message := range messages {
+		if config.SettingFromUint8(message.Setting).Signal {
+			continue
+		}
+		payloadMap, err := message.GetPayloadMap()
+		if err != nil {
+			continue
+		}
+		fakeChannelID := message.ChannelID
+		if message.ChannelType == common.ChannelTypePerson.Uint8() {
+			fakeChannelID = common.GetFakeChannelIDWith(message.FromUID, message.ChannelID)
+		}
+		task := m.newTranscribeTask(message.MessageID, message.MessageSeq, message.FromUID, fakeChannelID, message.ChannelType, payloadMap)
+		if task == nil {
+			continue
+		}
+		m.submitTranscribeTask(task)
+	}
+}
+
+// newTranscribeTask 创建语音转写任务 不需要转写的消息返回nil
+func (m *Message) newTranscribeTask(messageID int64, messageSeq uint32, fromUID string, fakeChannelID string, channelType uint8, payloadMap map[string]interface{}) *transcribeTask {
+	if payloadMap == nil || m.contentType(payloadMap) != common.Voice.Int() {
+		return nil
+	}
+	voiceURL, _ := payloadMap["url"].(string)
+	if voiceURL == "" {
+		return nil
+	}
+	if duration := getVoiceDuration(payloadMap); duration > m.ctx.GetConfig().TranscribeMaxDuration {
+		m.Debug("语音太长，不转写！", zap.Int64("messageID", messageID), zap.Int("duration", duration))
+		return nil
+	}
+	return &transcribeTask{
+		MessageID:     messageID,
+		MessageSeq:    messageSeq,
+		FromUID:       fromUID,
+		FakeChannelID: fakeChannelID,
+		ChannelType:   channelType,
+		VoiceURL:      voiceURL,
+	}
+}
+
+// submitTranscribeTask 标记为转写中后放入转写队列 已被标记（webhook重复通知）的不再转写
+// 队列已满或服务重启丢失的任务由transcribeRecoverCheck重新放入队列
+func (m *Message) submitTranscribeTask(task *transcribeTask) {
+	task.ClaimedAt = time.Now().Unix()
+	claimed, err := m.messageExtraDB.claimTranscript(&messageExtraModel{
+		MessageID:   strconv.FormatInt(task.MessageID, 10),
+		MessageSeq:  task.MessageSeq,
+		FromUID:     task.FromUID,
+		ChannelID:   task.FakeChannelID,
+		ChannelType: task.ChannelType,
+	}, task.ClaimedAt, m.transcribeStaleBefore())
+	if err != nil {
+		m.Error("标记语音转写中失败！", zap.Error(err), zap.Int64("messageID", task.MessageID))
+		return
+	}
+	if !claimed {
+		return
+	}
+	m.transcribeQueue.submit(func() {
+		m.transcribeVoice(task)
+	})
+}
+
+// transcribeStaleBefore 转写开始时间早于此时间的任务视为已中断
+func (m *Message) transcribeStaleBefore() int64 {
+	return time.Now().Add(-m.ctx.GetConfig().TranscribeTimeout * 2).Unix()
+}
+
+// transcribeRecoverCheck 重新转写中断的任务（服务重启、队列已满）
+func (m *Message) transcribeRecoverCheck() {
+	if m.ctx.GetConfig().TranscribeProvider == "" {
+		return
+	}
+	if m.transcribeQueue.pending() > 0 { // 还有排队中的任务 排队等待的时间不算中断 等队列空闲后再恢复
+		return
+	}
+	extraModels, err := m.messageExtraDB.queryStaleTranscripts(m.transcribeStaleBefore(), 100)
+	if err != nil {
+		m.Error("查询中断的语音转写失败！", zap.Error(err))
+		return
+	}
+	for _, extraM := range extraModels {
+		messageModels, err := m.db.queryMessagesWithMessageIDs(extraM.ChannelID, extraM.ChannelType, []string{extraM.MessageID})
+		if err != nil {
+			m.Error("查询语音消息失败！", zap.Error(err), zap.String("messageID", extraM.MessageID))
+			continue
+		}
+		var task *transcribeTask
+		for _, messageM := range messageModels {
+			if messageM.ChannelID != extraM.ChannelID || messageM.IsDeleted == 1 {
+				continue
+			}
+			payloadMap, err := util.JsonToMap(string(messageM.Payload))
+			if err != nil {
+				continue
+			}
+			task = m.newTranscribeTask(messageM.MessageID, messageM.MessageSeq, messageM.FromUID, messageM.ChannelID, messageM.ChannelType, payloadMap)
+		}
+		if task == nil {
+			m.saveTranscript(&transcribeTask{ // 消息已不存在 不再转写
+				MessageSeq:    extraM.MessageSeq,
+				FromUID:       extraM.FromUID,
+				FakeChannelID: extraM.ChannelID,
+				ChannelType:   extraM.ChannelType,
+			}, extraM.MessageID, "", transcriptStatusFail)
+			continue
+		}
+		m.submitTranscribeTask(task)
+	}
+}
+
+// transcribeVoice 转写语音并写入消息扩展 失败也会记录状态 客户端据此停止等待
+func (m *Message) transcribeVoice(task *transcribeTask) {
+	started, err := m.messageExtraDB.startTranscript(strconv.FormatInt(task.MessageID, 10), task.ClaimedAt, time.Now().Unix())
+	if err != nil {
+		m.Error("更新语音转写开始时间失败！", zap.Error(err), zap.Int64("messageID", task.MessageID))
+		return
+	}
+	if !started { // 排队太久已被重新标记 由新的任务转写
+		return
+	}
+	provider, err := newTranscribeProvider(m.ctx)
+	if err != nil {
+		m.Warn("创建语音转文字提供商失败！", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.ctx.GetConfig().TranscribeTimeout)
+	defer cancel()
+
+	status := transcriptStatusSuccess
+	transcript, err := m.transcribeVoiceURL(ctx, provider, task.FromUID, task.VoiceURL)
+	if err != nil {
+		m.Warn("语音转文字失败！", zap.Error(err), zap.Int64("messageID", task.MessageID), zap.String("provider", provider.Name()))
+		status = transcriptStatusFail
+	} else if transcript == "" {
+		status = transcriptStatusFail
+	}
+	m.saveTranscript(task, strconv.FormatInt(task.MessageID, 10), transcript, status)
+}
+
+// saveTranscript 保存转写结果并通知客户端同步消息扩展
+func (m *Message) saveTranscript(task *transcribeTask, messageID string, transcript string, status int) {
+	err := m.messageExtraDB.insertOrUpdateTranscript(&messageExtraModel{
+		MessageID:        messageID,
+		MessageSeq:       task.MessageSeq,
+		FromUID:          task.FromUID,
+		ChannelID:        task.FakeChannelID,
+		ChannelType:      task.ChannelType,
+		Transcript:       dbr.NewNullString(transcript),
+		TranscriptStatus: status,
+		Version:          m.genMessageExtraSeq(task.FakeChannelID),
+	})
+	if err != nil {
+		m.Error("更新语音转写结果失败！", zap.Error(err))
+		return
+	}
+	err = m.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   threadChannelIDFor(task.FakeChannelID, task.ChannelType, task.FromUID),
+		ChannelType: task.ChannelType,
+		FromUID:     task.FromUID,
+		CMD:         common.CMDSyncMessageExtra,
+	})
+	if err != nil {
+		m.Error("发送同步消息扩展cmd失败！", zap.Error(err))
+	}
+}
+
+// transcribeVoiceURL 下载语音到临时文件后转写 语言提示使用发送者的偏好语言
+func (m *Message) transcribeVoiceURL(ctx context.Context, provider ITranscribeProvider, fromUID string, voiceURL string) (string, error) {
+	audioPath, err := m.downloadVoice(ctx, voiceURL)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(audioPath)
+
+	lang, err := m.getUserLanguage(fromUID)
+	if err != nil {
+		m.Warn("获取发送者语言失败！", zap.Error(err), zap.String("uid", fromUID))
+	}
+	transcript, err := provider.Transcribe(ctx, audioPath, lang)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(transcript), nil
+}
+
+// downloadVoice 下载语音文件 只下载本服务存储的文件
+func (m *Message) downloadVoice(ctx context.Context, voiceURL string) (string, error) {
+	filePath, err := getVoiceFilePath(voiceURL)
+	if err != nil {
+		return "", err
+	}
+	downloadURL, err := m.fileService.DownloadURL(filePath, filepath.Base(filePath))
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("下载语音返回状态[%d]！", resp.StatusCode)
+	}
+	maxSize := m.ctx.GetConfig().TranscribeMaxAudioSize
+	if resp.ContentLength > maxSize {
+		return "", errors.New("语音文件太大！")
+	}
+	tmpFile, err := os.CreateTemp("", fmt.Sprintf("voice_*%s", filepath.Ext(filePath)))
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+	n, err := io.Copy(tmpFile, io.LimitReader(resp.Body, maxSize+1))
+	if err == nil && n > maxSize {
+		err = errors.New("语音文件太大！")
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
+
+// searchTranscripts 搜索语音转写的文本 channelID为空时搜索用户的所有单聊和群聊
+func (m *Message) searchTranscripts(loginUID string, channelID string, channelType uint8, keyword string) ([]map[string]interface{}, error) {
+	var (
+		extraModels []*messageExtraModel
+		err         error
+	)
+	if channelID != "" {
+		fakeChannelID := channelID
+		if channelType == common.ChannelTypePerson.Uint8() {
+			fakeChannelID = common.GetFakeChannelIDWith(loginUID, channelID)
+		} else {
+			exist, err := m.groupService.ExistMember(channelID, loginUID)
+			if err != nil {
+				return nil, err
+			}
+			if !exist {
+				return nil, nil
+			}
+		}
+		extraModels, err = m.messageExtraDB.searchTranscriptInChannel(fakeChannelID, channelType, keyword, transcriptSearchLimit)
+	} else {
+		var groups []*group.InfoResp
+		groups, err = m.groupService.GetGroupsWithMemberUID(loginUID)
+		if err != nil {
+			return nil, err
+		}
+		groupNos := make([]string, 0, len(groups))
+		for _, groupResp := range groups {
+			groupNos = append(groupNos, groupResp.GroupNo)
+		}
+		extraModels, err = m.messageExtraDB.searchTranscriptWithUID(loginUID, groupNos, keyword, transcriptSearchLimit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	results := make([]map[string]interface{}, 0, len(extraModels))
+	for _, extraM := range extraModels {
+		msgChannelID := extraM.ChannelID
+		if extraM.ChannelType == common.ChannelTypePerson.Uint8() {
+			msgChannelID = getPersonChannelIDFromFake(extraM.ChannelID, loginUID)
+		}
+		messageResp, err := m.messageService.GetMessage(loginUID, msgChannelID, extraM.ChannelType, extraM.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		if messageResp == nil {
+			continue
+		}
+		var payloadMap map[string]interface{}
+		if err = util.ReadJsonByByte(messageResp.Payload, &payloadMap); err != nil {
+			m.Warn("消息payload格式有误！", zap.Error(err), zap.String("messageID", extraM.MessageID))
+			continue
+		}
+		results = append(results, map[string]interface{}{
+			"message_id":    messageResp.MessageID,
+			"message_idstr": extraM.MessageID,
+			"message_seq":   messageResp.MessageSeq,
+			"from_uid":      messageResp.FromUID,
+			"channel_id":    messageResp.ChannelID,
+			"channel_type":  messageResp.ChannelType,
+			"timestamp":     messageResp.Timestamp,
+			"payload":       payloadMap,
+			"transcript":    extraM.Transcript.String,
+		})
+	}
+	return results, nil
+}
+
+// mergeSearchResults 将语音转写的搜索结果合并到消息搜索结果里（去重）
+func mergeSearchResults(results []map[string]interface{}, transcriptResults []map[string]interface{}) []map[string]interface{} {
+	if len(transcriptResults) == 0 {
+		return results
+	}
+	existMessageIDs := make(map[string]bool, len(results))
+	for _, result := range results {
+		if messageIDStr, ok := result["message_idstr"].(string); ok {
+			existMessageIDs[messageIDStr] = true
+		}
+		if messageID, ok := result["message_id"].(json.Number); ok {
+			existMessageIDs[messageID.String()] = true
+		}
+	}
+	for _, transcriptResult := range transcriptResults {
+		if existMessageIDs[transcriptResult["message_idstr"].(string)] {
+			continue
+		}
+		results = append(results, transcriptResult)
+	}
+	return results
+}
+
+// getPersonChannelIDFromFake 从单聊的fake channel id中获取对方的uid
+func getPersonChannelIDFromFake(fakeChannelID string, loginUID string) string {
+	uids := strings.SplitN(fakeChannelID, "@", 2)
+	if len(uids) != 2 {
+		return fakeChannelID
+	}
+	if uids[0] == loginUID {
+		return uids[1]
+	}
+	return uids[0]
+}
+
+// getVoiceFilePath 从语音地址中获取文件存储路径 例如 file/preview/chat/xx.aac -> /chat/xx.aac
+func getVoiceFilePath(voiceURL string) (string, error) {
+	const previewPrefix = "file/preview/"
+	index := strings.Index(voiceURL, previewPrefix)
+	if index == -1 {
+		return "", errors.New("不支持的语音地址！")
+	}
+	filePath := voiceURL[index+len(previewPrefix)-1:]
+	if i := strings.IndexAny(filePath, "?#"); i != -1 {
+		filePath = filePath[:i]
+	}
+	if filePath == "/" || strings.Contains(filePath, "..") {
+		return "", errors.New("不支持的语音地址！")
+	}
+	return filePath, nil
+}
+
+// getVoiceDuration 语音时长（秒）
+func getVoiceDuration(payloadMap map[string]interface{}) int {
+	if timeTrad, ok := payloadMap["timeTrad"].(json.Number); ok {
+		duration, _ := timeTrad.Int64()
+		return int(duration)
+	}
+	return 0
+}
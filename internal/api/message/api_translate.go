@@ -0,0 +1,352 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 翻译消息
+func (m *Message) translate(c *wkhttp.Context) {
+	var req translateReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	loginUID := c.GetLoginUID()
+	provider, err := newTranslateProvider(m.ctx)
+	if err != nil {
+		c.ResponseError(errors.New("翻译服务未开启！"))
+		return
+	}
+	targetLang := req.TargetLang
+	if targetLang == "" {
+		targetLang, err = m.getUserLanguage(loginUID)
+		if err != nil {
+			m.Error("查询用户偏好语言失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询用户偏好语言失败！"))
+			return
+		}
+		if targetLang == "" {
+			c.ResponseError(errors.New("请先设置偏好语言！"))
+			return
+		}
+	}
+	fakeChannelID := req.ChannelID
+	if req.ChannelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(req.ChannelID, loginUID)
+	}
+	err = m.checkChannelAccess(fakeChannelID, req.ChannelType, loginUID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	messageModels, err := m.db.queryMessagesWithMessageIDs(fakeChannelID, req.ChannelType, req.MessageIDs)
+	if err != nil {
+		m.Error("查询消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询消息失败！"))
+		return
+	}
+	// 编辑后的正文只存在消息扩展里 编辑过的消息翻译编辑后的正文
+	messageExtras, err := m.messageExtraDB.queryWithMessageIDs(req.MessageIDs, loginUID)
+	if err != nil {
+		m.Error("查询消息扩展失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询消息扩展失败！"))
+		return
+	}
+	contentEditMap := make(map[string]map[string]interface{}, len(messageExtras))
+	for _, messageExtra := range messageExtras {
+		if messageExtra.ContentEdit.String == "" {
+			continue
+		}
+		contentEdit, err := util.JsonToMap(messageExtra.ContentEdit.String)
+		if err != nil {
+			continue
+		}
+		contentEditMap[messageExtra.MessageID] = contentEdit
+	}
+	messages := make([]*translateMessage, 0, len(messageModels))
+	for _, messageM := range messageModels {
+		if messageM.ChannelID != fakeChannelID || messageM.IsDeleted == 1 || messageM.Signal == 1 {
+			continue
+		}
+		payloadMap, err := util.JsonToMap(string(messageM.Payload))
+		if err != nil {
+			continue
+		}
+		text := m.getTranslatableText(payloadMap, contentEditMap[strconv.FormatInt(messageM.MessageID, 10)])
+		if text == "" {
+			continue
+		}
+		messages = append(messages, &translateMessage{
+			MessageID: strconv.FormatInt(messageM.MessageID, 10),
+			Text:      text,
+		})
+	}
+	if len(messages) == 0 {
+		c.ResponseError(errors.New("没有可翻译的文本消息！"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.ctx.GetConfig().TranslateTimeout)
+	defer cancel()
+	resps, err := m.translateMessages(ctx, provider, messages, targetLang)
+	if err != nil {
+		m.Error("翻译消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("翻译消息失败！"))
+		return
+	}
+	c.Response(resps)
+}
+
+// 设置会话自动翻译
+func (co *Conversation) conversationAutoTranslate(c *wkhttp.Context) {
+	var req struct {
+		AutoTranslate int `json:"auto_translate"` // 是否自动翻译 0.否 1.是
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseErrorf("数据格式有误！", err)
+		return
+	}
+	loginUID := c.GetLoginUID()
+	channelID := c.Param("channel_id")
+	channelType, _ := strconv.ParseInt(c.Param("channel_type"), 10, 64)
+	if strings.TrimSpace(channelID) == "" || channelType == 0 {
+		c.ResponseError(errors.New("频道信息不能为空！"))
+		return
+	}
+	autoTranslate := 0
+	if req.AutoTranslate == 1 {
+		autoTranslate = 1
+	}
+	version := co.ctx.GenSeq(common.SyncConversationExtraKey)
+	err := co.conversationExtraDB.insertOrUpdateAutoTranslate(&conversationExtraModel{
+		UID:           loginUID,
+		ChannelID:     channelID,
+		ChannelType:   uint8(channelType),
+		AutoTranslate: autoTranslate,
+		Version:       version,
+	})
+	if err != nil {
+		co.Error("修改会话自动翻译失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改会话自动翻译失败！"))
+		return
+	}
+	co.sendSyncConversationExtraCMD(loginUID)
+	c.Response(map[string]interface{}{
+		"version": version,
+	})
+}
+
+// attachAutoTranslations 开启了自动翻译的会话 同步消息时附带已缓存的译文 未翻译的消息异步翻译 下次同步时附带
+func (m *Message) attachAutoTranslations(loginUID string, channelID string, channelType uint8, messages []*MsgSyncResp) {
+	if m.ctx.GetConfig().TranslateProvider == "" || len(messages) == 0 {
+		return
+	}
+	extra, err := m.conversationExtradb.queryWithChannel(loginUID, channelID, channelType)
+	if err != nil {
+		m.Error("查询最近会话扩展失败！", zap.Error(err))
+		return
+	}
+	if extra == nil || extra.AutoTranslate != 1 {
+		return
+	}
+	targetLang, err := m.getUserLanguage(loginUID)
+	if err != nil {
+		m.Error("查询用户偏好语言失败！", zap.Error(err))
+		return
+	}
+	if targetLang == "" {
+		return
+	}
+	provider, err := newTranslateProvider(m.ctx)
+	if err != nil {
+		m.Warn("翻译服务不可用！", zap.Error(err))
+		return
+	}
+	maxCount := m.ctx.GetConfig().TranslateAutoMaxCount
+	translateMessages := make([]*translateMessage, 0)
+	for _, message := range messages {
+		if len(translateMessages) >= maxCount {
+			break
+		}
+		if message.FromUID == loginUID || message.IsDeleted == 1 || message.SignalPayload != "" {
+			continue
+		}
+		var contentEdit map[string]interface{}
+		if message.MessageExtra != nil {
+			contentEdit = message.MessageExtra.ContentEdit
+		}
+		text := m.getTranslatableText(message.Payload, contentEdit)
+		if text == "" {
+			continue
+		}
+		translateMessages = append(translateMessages, &translateMessage{
+			MessageID: message.MessageIDStr,
+			Text:      text,
+		})
+	}
+	if len(translateMessages) == 0 {
+		return
+	}
+	translationMap, err := m.queryCachedTranslations(translateMessages, targetLang)
+	if err != nil {
+		m.Error("查询消息译文缓存失败！", zap.Error(err))
+		return
+	}
+	untranslatedMessages := make([]*translateMessage, 0, len(translateMessages))
+	for _, translateM := range translateMessages {
+		if translationMap[translateM.MessageID] == nil {
+			untranslatedMessages = append(untranslatedMessages, translateM)
+		}
+	}
+	for _, message := range messages {
+		if translationM := translationMap[message.MessageIDStr]; translationM != nil {
+			message.Translation = newTranslationResp(translationM)
+		}
+	}
+	if len(untranslatedMessages) > 0 {
+		m.translateQueue.submit(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), m.ctx.GetConfig().TranslateTimeout)
+			defer cancel()
+			_, err := m.translateMessages(ctx, provider, untranslatedMessages, targetLang)
+			if err != nil {
+				m.Warn("自动翻译消息失败！", zap.Error(err))
+			}
+		})
+	}
+}
+
+// queryCachedTranslations 查询原文未变化的译文缓存
+func (m *Message) queryCachedTranslations(messages []*translateMessage, targetLang string) (map[string]*messageTranslationModel, error) {
+	messageIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		messageIDs = append(messageIDs, message.MessageID)
+	}
+	translationModels, err := m.messageTranslationDB.queryWithMessageIDs(messageIDs, targetLang)
+	if err != nil {
+		return nil, err
+	}
+	contentHashMap := make(map[string]string, len(messages))
+	for _, message := range messages {
+		contentHashMap[message.MessageID] = util.MD5(message.Text)
+	}
+	translationMap := make(map[string]*messageTranslationModel, len(translationModels))
+	for _, translationM := range translationModels {
+		if translationM.ContentHash != contentHashMap[translationM.MessageID] { // 消息编辑过
+			continue
+		}
+		translationMap[translationM.MessageID] = translationM
+	}
+	return translationMap, nil
+}
+
+// translateMessages 翻译消息 优先使用已缓存的译文 出错时返回已翻译的部分
+func (m *Message) translateMessages(ctx context.Context, provider ITranslateProvider, messages []*translateMessage, targetLang string) ([]*translationResp, error) {
+	translationMap, err := m.queryCachedTranslations(messages, targetLang)
+	if err != nil {
+		return nil, err
+	}
+	resps := make([]*translationResp, 0, len(messages))
+	for _, message := range messages {
+		translationM := translationMap[message.MessageID]
+		if translationM == nil {
+			result, err := provider.Translate(ctx, message.Text, targetLang)
+			if err != nil {
+				return resps, err
+			}
+			translationM = &messageTranslationModel{
+				MessageID:   message.MessageID,
+				TargetLang:  targetLang,
+				SourceLang:  result.SourceLang,
+				Text:        result.Text,
+				Provider:    provider.Name(),
+				ContentHash: util.MD5(message.Text),
+			}
+			err = m.messageTranslationDB.insertOrUpdate(translationM)
+			if err != nil {
+				m.Warn("缓存译文失败！", zap.Error(err), zap.String("messageID", message.MessageID))
+			}
+		}
+		resps = append(resps, newTranslationResp(translationM))
+	}
+	return resps, nil
+}
+
+// getTranslatableText 获取可翻译的文本 只翻译文本消息 消息编辑过时取编辑后的正文
+func (m *Message) getTranslatableText(payloadMap map[string]interface{}, contentEdit map[string]interface{}) string {
+	if payloadMap == nil || m.contentType(payloadMap) != common.Text.Int() {
+		return ""
+	}
+	content, _ := payloadMap["content"].(string)
+	if editContent, ok := contentEdit["content"].(string); ok {
+		content = editContent
+	}
+	content = strings.TrimSpace(content)
+	if content == "" || utf8.RuneCountInString(content) > m.ctx.GetConfig().TranslateTextMaxLength {
+		return ""
+	}
+	return content
+}
+
+func (m *Message) getUserLanguage(uid string) (string, error) {
+	userResp, err := m.userService.GetUser(uid)
+	if err != nil {
+		return "", err
+	}
+	return userResp.Language, nil
+}
+
+type translateReq struct {
+	ChannelID   string   `json:"channel_id"`
+	ChannelType uint8    `json:"channel_type"`
+	MessageIDs  []string `json:"message_ids"`
+	TargetLang  string   `json:"target_lang"` // 目标语言 为空则使用用户的偏好语言
+}
+
+func (t translateReq) check() error {
+	if strings.TrimSpace(t.ChannelID) == "" || t.ChannelType == 0 {
+		return errors.New("频道信息不能为空！")
+	}
+	if len(t.MessageIDs) == 0 {
+		return errors.New("消息ID不能为空！")
+	}
+	if len(t.MessageIDs) > 100 {
+		return errors.New("一次最多翻译100条消息！")
+	}
+	if t.TargetLang != "" && !common.IsSupportedLanguage(t.TargetLang) {
+		return errors.New("不支持的目标语言！")
+	}
+	return nil
+}
+
+type translateMessage struct {
+	MessageID string
+	Text      string
+}
+
+type translationResp struct {
+	MessageID  string `json:"message_id"`
+	TargetLang string `json:"target_lang"`
+	SourceLang string `json:"source_lang"`
+	Text       string `json:"text"`
+}
+
+func newTranslationResp(m *messageTranslationModel) *translationResp {
+	return &translationResp{
+		MessageID:  m.MessageID,
+		TargetLang: m.TargetLang,
+		SourceLang: m.SourceLang,
+		Text:       m.Text,
+	}
+}
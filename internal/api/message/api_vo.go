@@ -2,6 +2,7 @@ package message
 
 import (
 	"errors"
+	"strconv"
 	"strings"
 )
 
@@ -31,3 +32,22 @@ func (d *deleteReq) check() error {
 type voiceReadedReq struct {
 	deleteReq
 }
+
+// messageEditHistoryResp 消息编辑历史
+type messageEditHistoryResp struct {
+	MessageID   string `json:"message_id"`
+	MessageSeq  uint32 `json:"message_seq"`
+	EditorUID   string `json:"editor_uid"`
+	ContentEdit string `json:"content_edit"`
+	EditedAt    int    `json:"edited_at"`
+}
+
+func newMessageEditHistoryResp(m *messageEditHistoryModel) *messageEditHistoryResp {
+	return &messageEditHistoryResp{
+		MessageID:   strconv.FormatInt(m.MessageID, 10),
+		MessageSeq:  m.MessageSeq,
+		EditorUID:   m.EditorUID,
+		ContentEdit: m.ContentEdit.String,
+		EditedAt:    m.EditedAt,
+	}
+}
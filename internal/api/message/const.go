@@ -4,8 +4,12 @@ const (
 	// 消息已删除
 	CMDMessageDeleted = "messageDeleted"
 	// CMDMessageErase 消息擦除
-	CMDMessageErase       = "messageEerase"
-	sensitiveWordsVersion = 1
+	CMDMessageErase = "messageEerase"
+	// CMDSyncScheduledMessage 同步定时消息
+	CMDSyncScheduledMessage = "syncScheduledMessage"
+	// 定时消息版本号key
+	scheduledMessageSeqKey = "scheduledMessageSeq"
+	sensitiveWordsVersion  = 1
 )
 
 type ReminderType int
@@ -13,6 +17,8 @@ type ReminderType int
 const (
 	ReminderTypeMentionMe      = 1 // 有人@我
 	ReminderTypeApplyJoinGroup = 2 // 申请加群
+	ReminderTypeThreadReply    = 3 // 话题有新回复
+	ReminderTypeReplyMe        = 4 // 有人回复我
 )
 
 var sensitive_words = []string{
@@ -3,6 +3,7 @@ package message
 import (
 	"fmt"
 	"hash/crc32"
+	"strconv"
 
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
 	"github.com/WuKongIM/WuKongChatServer/pkg/db"
@@ -55,12 +56,47 @@ func (d *DB) queryMessagesWithChannelClientMsgNo(channelID string, channelType u
 	_, err := d.session.Select("*").From(d.getTable(channelID)).Where("channel_id=? and channel_type=? and client_msg_no=?", channelID, channelType, clientMsgNo).Load(&models)
 	return models, err
 }
+
+// queryThreadReplies 查询话题的回复消息
+func (d *DB) queryThreadReplies(channelID string, rootMessageID int64, startMessageSeq uint32, limit uint64) ([]*messageModel, error) {
+	var models []*messageModel
+	_, err := d.session.Select("*").From(d.getTable(channelID)).Where("root_message_id=? and message_seq>? and is_deleted=0", strconv.FormatInt(rootMessageID, 10), startMessageSeq).OrderAsc("message_seq").Limit(limit).Load(&models)
+	return models, err
+}
+
+// queryThreadReplyCount 查询话题的回复数量
+func (d *DB) queryThreadReplyCount(channelID string, rootMessageID int64) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From(d.getTable(channelID)).Where("root_message_id=? and is_deleted=0", strconv.FormatInt(rootMessageID, 10)).Load(&count)
+	return count, err
+}
+
+// queryThreadUnreadCount 查询话题内某序号之后不是自己发送的回复数量
+func (d *DB) queryThreadUnreadCount(channelID string, rootMessageID int64, uid string, readMessageSeq uint32) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From(d.getTable(channelID)).Where("root_message_id=? and message_seq>? and from_uid<>? and is_deleted=0", strconv.FormatInt(rootMessageID, 10), readMessageSeq, uid).Load(&count)
+	return count, err
+}
+
+// updateDeletedTx 标记消息已删除
+func (d *DB) updateDeletedTx(channelID string, messageID int64, tx *dbr.Tx) error {
+	_, err := tx.Update(d.getTable(channelID)).Set("is_deleted", 1).Where("message_id=?", messageID).Exec()
+	return err
+}
+
 func (d *DB) queryProhibitWordsWithVersion(version int64) ([]*ProhibitWordModel, error) {
 	var list []*ProhibitWordModel
 	_, err := d.session.Select("*").From("prohibit_words").Where("`version` > ?", version).Load(&list)
 	return list, err
 }
 
+// queryValidProhibitWords 查询所有有效的违禁词
+func (d *DB) queryValidProhibitWords() ([]*ProhibitWordModel, error) {
+	var list []*ProhibitWordModel
+	_, err := d.session.Select("*").From("prohibit_words").Where("is_deleted=0").Load(&list)
+	return list, err
+}
+
 // 通过频道ID获取表
 func (d *DB) getTable(channelID string) string {
 	tableIndex := crc32.ChecksumIEEE([]byte(channelID)) % uint32(d.ctx.GetConfig().TablePartitionConfig.MessageTableCount)
@@ -80,18 +116,19 @@ type ProhibitWordModel struct {
 
 // Model 消息model
 type messageModel struct {
-	MessageID   int64
-	MessageSeq  uint32
-	ClientMsgNo string
-	Header      string
-	Setting     uint8
-	FromUID     string
-	ChannelID   string
-	ChannelType uint8
-	Timestamp   int64
-	Type        int
-	Payload     []byte
-	IsDeleted   int
-	Signal      int
+	MessageID     int64
+	MessageSeq    uint32
+	ClientMsgNo   string
+	Header        string
+	Setting       uint8
+	FromUID       string
+	ChannelID     string
+	ChannelType   uint8
+	Timestamp     int64
+	Type          int
+	Payload       []byte
+	IsDeleted     int
+	Signal        int
+	RootMessageID string // 话题根消息ID
 	db.BaseModel
 }
@@ -0,0 +1,96 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+// counterField 会话计数字段
+type counterField string
+
+const (
+	counterFieldMention  counterField = "mention_count"  // 未读的@我数量
+	counterFieldReply    counterField = "reply_count"    // 未读的回复我数量
+	counterFieldReaction counterField = "reaction_count" // 未读的回应我数量
+)
+
+type conversationCounterDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newConversationCounterDB(ctx *config.Context) *conversationCounterDB {
+	return &conversationCounterDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+const counterIncreaseBatchSize = 500 // 每条sql最多增加计数的用户数
+
+// increase 指定用户的会话计数加1 （@所有人时用户很多 分批多行插入）
+func (c *conversationCounterDB) increase(field counterField, channelID string, channelType uint8, uids []string) error {
+	for start := 0; start < len(uids); start += counterIncreaseBatchSize {
+		end := start + counterIncreaseBatchSize
+		if end > len(uids) {
+			end = len(uids)
+		}
+		batchUIDs := uids[start:end]
+		values := make([]string, 0, len(batchUIDs))
+		args := make([]interface{}, 0, len(batchUIDs)*3)
+		for _, uid := range batchUIDs {
+			values = append(values, "(?,?,?,1)")
+			args = append(args, uid, channelID, channelType)
+		}
+		_, err := c.session.InsertBySql(fmt.Sprintf("insert into conversation_counter(uid,channel_id,channel_type,%s) values %s ON DUPLICATE KEY UPDATE %s=%s+1", field, strings.Join(values, ","), field, field), args...).Exec()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decrease 会话计数减去n（最小为0）
+func (c *conversationCounterDB) decrease(field counterField, uid string, channelID string, channelType uint8, n int) error {
+	_, err := c.session.Update("conversation_counter").Set(string(field), dbr.Expr(fmt.Sprintf("GREATEST(%s-?,0)", field), n)).Where("uid=? and channel_id=? and channel_type=?", uid, channelID, channelType).Exec()
+	return err
+}
+
+// decreaseTx 会话计数减去n（最小为0）
+func (c *conversationCounterDB) decreaseTx(field counterField, uid string, channelID string, channelType uint8, n int, tx *dbr.Tx) error {
+	_, err := tx.Update("conversation_counter").Set(string(field), dbr.Expr(fmt.Sprintf("GREATEST(%s-?,0)", field), n)).Where("uid=? and channel_id=? and channel_type=?", uid, channelID, channelType).Exec()
+	return err
+}
+
+// clearTx 清空会话计数
+func (c *conversationCounterDB) clearTx(uid string, channelID string, channelType uint8, tx *dbr.Tx) error {
+	_, err := tx.Update("conversation_counter").SetMap(map[string]interface{}{
+		string(counterFieldMention):  0,
+		string(counterFieldReply):    0,
+		string(counterFieldReaction): 0,
+	}).Where("uid=? and channel_id=? and channel_type=?", uid, channelID, channelType).Exec()
+	return err
+}
+
+func (c *conversationCounterDB) queryWithChannelIDs(uid string, channelIDs []string) ([]*conversationCounterModel, error) {
+	if len(channelIDs) == 0 {
+		return nil, nil
+	}
+	var models []*conversationCounterModel
+	_, err := c.session.Select("*").From("conversation_counter").Where("uid=? and channel_id in ?", uid, channelIDs).Load(&models)
+	return models, err
+}
+
+type conversationCounterModel struct {
+	UID           string
+	ChannelID     string
+	ChannelType   uint8
+	MentionCount  int
+	ReplyCount    int
+	ReactionCount int
+	db.BaseModel
+}
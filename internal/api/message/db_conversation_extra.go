@@ -24,6 +24,44 @@ func (c *conversationExtraDB) insertOrUpdate(model *conversationExtraModel) erro
 	return err
 }
 
+// insertOrUpdateArchived 归档或取消归档 只更新归档状态
+func (c *conversationExtraDB) insertOrUpdateArchived(model *conversationExtraModel) error {
+	_, err := c.session.InsertBySql("INSERT INTO conversation_extra (uid,channel_id,channel_type,archived,version) VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE archived=VALUES(archived),version=VALUES(version)", model.UID, model.ChannelID, model.ChannelType, model.Archived, model.Version).Exec()
+	return err
+}
+
+// insertOrUpdateAutoTranslate 开启或关闭自动翻译 只更新自动翻译状态
+func (c *conversationExtraDB) insertOrUpdateAutoTranslate(model *conversationExtraModel) error {
+	_, err := c.session.InsertBySql("INSERT INTO conversation_extra (uid,channel_id,channel_type,auto_translate,version) VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE auto_translate=VALUES(auto_translate),version=VALUES(version)", model.UID, model.ChannelID, model.ChannelType, model.AutoTranslate, model.Version).Exec()
+	return err
+}
+
+func (c *conversationExtraDB) queryWithChannel(uid string, channelID string, channelType uint8) (*conversationExtraModel, error) {
+	var model *conversationExtraModel
+	_, err := c.session.Select("*").From("conversation_extra").Where("uid=? and channel_id=? and channel_type=?", uid, channelID, channelType).Load(&model)
+	return model, err
+}
+
+// queryArchivedUIDs 查询频道内已归档此会话的用户
+func (c *conversationExtraDB) queryArchivedUIDs(channelID string, channelType uint8, uids []string) ([]string, error) {
+	var archivedUIDs []string
+	builder := c.session.Select("uid").From("conversation_extra").Where("channel_id=? and channel_type=? and archived=1", channelID, channelType)
+	if len(uids) > 0 {
+		builder = builder.Where("uid in ?", uids)
+	}
+	_, err := builder.Load(&archivedUIDs)
+	return archivedUIDs, err
+}
+
+// updateUnarchived 取消归档
+func (c *conversationExtraDB) updateUnarchived(uid string, channelID string, channelType uint8, version int64) error {
+	_, err := c.session.Update("conversation_extra").SetMap(map[string]interface{}{
+		"archived": 0,
+		"version":  version,
+	}).Where("uid=? and channel_id=? and channel_type=? and archived=1", uid, channelID, channelType).Exec()
+	return err
+}
+
 func (c *conversationExtraDB) sync(uid string, version int64) ([]*conversationExtraModel, error) {
 	var models []*conversationExtraModel
 	_, err := c.session.Select("*").From("conversation_extra").Where("uid=? and version>?", uid, version).Load(&models)
@@ -47,6 +85,8 @@ type conversationExtraModel struct {
 	KeepMessageSeq uint32
 	KeepOffsetY    int
 	Draft          string // 草稿
+	Archived       int    // 是否已归档
+	AutoTranslate  int    // 是否自动翻译
 	Version        int64
 	db.BaseModel
 }
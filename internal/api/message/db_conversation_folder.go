@@ -0,0 +1,86 @@
+package message
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type conversationFolderDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newConversationFolderDB(ctx *config.Context) *conversationFolderDB {
+	return &conversationFolderDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+func (c *conversationFolderDB) insert(m *conversationFolderModel) error {
+	_, err := c.session.InsertInto("conversation_folder").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+func (c *conversationFolderDB) update(m *conversationFolderModel) error {
+	_, err := c.session.Update("conversation_folder").SetMap(map[string]interface{}{
+		"name":    m.Name,
+		"rules":   m.Rules,
+		"version": m.Version,
+	}).Where("folder_no=? and uid=?", m.FolderNo, m.UID).Exec()
+	return err
+}
+
+func (c *conversationFolderDB) updateSortTx(uid string, folderNo string, sort int, version int64, tx *dbr.Tx) error {
+	_, err := tx.Update("conversation_folder").SetMap(map[string]interface{}{
+		"sort":    sort,
+		"version": version,
+	}).Where("folder_no=? and uid=? and is_deleted=0", folderNo, uid).Exec()
+	return err
+}
+
+func (c *conversationFolderDB) updateDeleted(uid string, folderNo string, version int64) error {
+	_, err := c.session.Update("conversation_folder").SetMap(map[string]interface{}{
+		"is_deleted": 1,
+		"version":    version,
+	}).Where("folder_no=? and uid=?", folderNo, uid).Exec()
+	return err
+}
+
+func (c *conversationFolderDB) queryWithFolderNo(uid string, folderNo string) (*conversationFolderModel, error) {
+	var model *conversationFolderModel
+	_, err := c.session.Select("*").From("conversation_folder").Where("folder_no=? and uid=? and is_deleted=0", folderNo, uid).Load(&model)
+	return model, err
+}
+
+func (c *conversationFolderDB) queryWithUID(uid string) ([]*conversationFolderModel, error) {
+	var models []*conversationFolderModel
+	_, err := c.session.Select("*").From("conversation_folder").Where("uid=? and is_deleted=0", uid).OrderAsc("sort").OrderAsc("id").Load(&models)
+	return models, err
+}
+
+func (c *conversationFolderDB) queryCount(uid string) (int64, error) {
+	var count int64
+	_, err := c.session.Select("count(*)").From("conversation_folder").Where("uid=? and is_deleted=0", uid).Load(&count)
+	return count, err
+}
+
+// sync 同步分组（包含已删除的，客户端据此移除）
+func (c *conversationFolderDB) sync(uid string, version int64) ([]*conversationFolderModel, error) {
+	var models []*conversationFolderModel
+	_, err := c.session.Select("*").From("conversation_folder").Where("uid=? and version>?", uid, version).OrderAsc("version").Load(&models)
+	return models, err
+}
+
+type conversationFolderModel struct {
+	UID       string
+	FolderNo  string
+	Name      string
+	Rules     string // 包含规则 json
+	Sort      int
+	IsDeleted int
+	Version   int64
+	db.BaseModel
+}
@@ -0,0 +1,64 @@
+package message
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+type flameDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newFlameDB(ctx *config.Context) *flameDB {
+	return &flameDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+// insertIfNotExist 添加销毁任务 同一个消息同一个阅读者只记录第一次阅读
+func (f *flameDB) insertIfNotExist(m *flameModel) error {
+	_, err := f.session.InsertBySql("INSERT IGNORE INTO message_flame (message_id,message_seq,from_uid,uid,channel_id,channel_type,flame_second,expire_at,status) VALUES (?,?,?,?,?,?,?,?,?)", m.MessageID, m.MessageSeq, m.FromUID, m.UID, m.ChannelID, m.ChannelType, m.FlameSecond, m.ExpireAt, m.Status).Exec()
+	return err
+}
+
+// queryDue 查询到期待销毁的任务
+func (f *flameDB) queryDue(now int64, limit uint64) ([]*flameModel, error) {
+	var models []*flameModel
+	_, err := f.session.Select("*").From("message_flame").Where("status=? and expire_at<=?", flameStatusWait, now).OrderAsc("expire_at").Limit(limit).Load(&models)
+	return models, err
+}
+
+// updateStatusTx 更新销毁任务状态
+func (f *flameDB) updateStatusTx(id int64, status flameStatus, tx *dbr.Tx) error {
+	_, err := tx.Update("message_flame").Set("status", status).Where("id=?", id).Exec()
+	return err
+}
+
+// updateStatusWithMessageIDTx 更新某条消息所有的销毁任务状态
+func (f *flameDB) updateStatusWithMessageIDTx(messageID int64, status flameStatus, tx *dbr.Tx) error {
+	_, err := tx.Update("message_flame").Set("status", status).Where("message_id=?", messageID).Exec()
+	return err
+}
+
+type flameStatus int
+
+const (
+	flameStatusWait   flameStatus = iota // 待销毁
+	flameStatusBurned                    // 已销毁
+)
+
+type flameModel struct {
+	MessageID   int64
+	MessageSeq  uint32
+	FromUID     string
+	UID         string
+	ChannelID   string
+	ChannelType uint8
+	FlameSecond int
+	ExpireAt    int64
+	Status      int
+	db.BaseModel
+}
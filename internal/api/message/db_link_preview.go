@@ -0,0 +1,42 @@
+package message
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+type linkPreviewDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newLinkPreviewDB(ctx *config.Context) *linkPreviewDB {
+	return &linkPreviewDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+func (l *linkPreviewDB) insertOrUpdate(m *linkPreviewModel) error {
+	_, err := l.session.InsertBySql("INSERT INTO link_preview (url_hash,url,title,description,image,site_name,status,fetched_at) VALUES (?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE url=VALUES(url),title=VALUES(title),description=VALUES(description),image=VALUES(image),site_name=VALUES(site_name),status=VALUES(status),fetched_at=VALUES(fetched_at)", m.URLHash, m.URL, m.Title, m.Description, m.Image, m.SiteName, m.Status, m.FetchedAt).Exec()
+	return err
+}
+
+func (l *linkPreviewDB) queryWithURLHash(urlHash string) (*linkPreviewModel, error) {
+	var model *linkPreviewModel
+	_, err := l.session.Select("*").From("link_preview").Where("url_hash=?", urlHash).Load(&model)
+	return model, err
+}
+
+type linkPreviewModel struct {
+	URLHash     string
+	URL         string
+	Title       string
+	Description string
+	Image       string // 转存后的预览图路径
+	SiteName    string
+	Status      int // 抓取状态 0.失败 1.成功
+	FetchedAt   int64
+	db.BaseModel
+}
@@ -0,0 +1,44 @@
+package message
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type messageEditHistoryDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newMessageEditHistoryDB(ctx *config.Context) *messageEditHistoryDB {
+	return &messageEditHistoryDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+func (m *messageEditHistoryDB) insertTx(md *messageEditHistoryModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("message_edit_history").Columns(util.AttrToUnderscore(md)...).Record(md).Exec()
+	return err
+}
+
+// queryWithMessageID 查询某条消息的编辑历史（按编辑时间正序）
+func (m *messageEditHistoryDB) queryWithMessageID(messageID int64) ([]*messageEditHistoryModel, error) {
+	var models []*messageEditHistoryModel
+	_, err := m.session.Select("*").From("message_edit_history").Where("message_id=?", messageID).OrderAsc("id").Load(&models)
+	return models, err
+}
+
+type messageEditHistoryModel struct {
+	MessageID       int64
+	MessageSeq      uint32
+	ChannelID       string
+	ChannelType     uint8
+	EditorUID       string
+	ContentEdit     dbr.NullString
+	ContentEditHash string
+	EditedAt        int
+	db.BaseModel
+}
@@ -3,8 +3,10 @@ package message
 import (
 	"sort"
 
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
 	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
 	"github.com/gocraft/dbr/v2"
 )
 
@@ -30,6 +32,12 @@ func (m *messageExtraDB) insertOrUpdateRevokeTx(md *messageExtraModel, tx *dbr.T
 	return err
 }
 
+// 标记消息双向删除
+func (m *messageExtraDB) insertOrUpdateDeletedTx(md *messageExtraModel, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("INSERT INTO message_extra (message_id,message_seq,channel_id,channel_type,is_deleted,version) VALUES (?,?,?,?,?,?) ON DUPLICATE KEY UPDATE is_deleted=VALUES(is_deleted),version=VALUES(version)", md.MessageID, md.MessageSeq, md.ChannelID, md.ChannelType, md.IsDeleted, md.Version).Exec()
+	return err
+}
+
 // 更新已读数量
 func (m *messageExtraDB) insertOrUpdateReadedCount(md *messageExtraModel) error {
 	_, err := m.session.InsertBySql("INSERT INTO message_extra (clone_no,message_id,message_seq,from_uid,channel_id,channel_type,readed_count,version) VALUES (?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE clone_no=IF(clone_no='',VALUES(clone_no),clone_no),readed_count=VALUES(readed_count),version=VALUES(version)", md.CloneNo, md.MessageID, md.MessageSeq, md.FromUID, md.ChannelID, md.ChannelType, md.ReadedCount, md.Version).Exec()
@@ -42,11 +50,88 @@ func (m *messageExtraDB) insertOrUpdateReadedCountTx(md *messageExtraModel, tx *
 	return err
 }
 
-func (m *messageExtraDB) insertOrUpdateContentEdit(md *messageExtraModel) error {
-	_, err := m.session.InsertBySql("INSERT INTO message_extra (message_id,message_seq,channel_id,channel_type,content_edit,content_edit_hash,edited_at,version) VALUES (?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE content_edit=VALUES(content_edit),content_edit_hash=VALUES(content_edit_hash),edited_at=VALUES(edited_at),version=VALUES(version)", md.MessageID, md.MessageSeq, md.ChannelID, md.ChannelType, md.ContentEdit, md.ContentEditHash, md.EditedAt, md.Version).Exec()
+func (m *messageExtraDB) insertOrUpdateContentEditTx(md *messageExtraModel, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("INSERT INTO message_extra (message_id,message_seq,channel_id,channel_type,content_edit,content_edit_hash,edited_at,version) VALUES (?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE content_edit=VALUES(content_edit),content_edit_hash=VALUES(content_edit_hash),edited_at=VALUES(edited_at),version=VALUES(version)", md.MessageID, md.MessageSeq, md.ChannelID, md.ChannelType, md.ContentEdit, md.ContentEditHash, md.EditedAt, md.Version).Exec()
+	return err
+}
+
+// 更新投票统计
+func (m *messageExtraDB) insertOrUpdatePollTx(md *messageExtraModel, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("INSERT INTO message_extra (message_id,message_seq,from_uid,channel_id,channel_type,poll,version) VALUES (?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE poll=VALUES(poll),version=VALUES(version)", md.MessageID, md.MessageSeq, md.FromUID, md.ChannelID, md.ChannelType, md.Poll, md.Version).Exec()
+	return err
+}
+
+// 更新链接预览
+func (m *messageExtraDB) insertOrUpdateLinkPreview(md *messageExtraModel) error {
+	_, err := m.session.InsertBySql("INSERT INTO message_extra (message_id,message_seq,from_uid,channel_id,channel_type,link_preview,version) VALUES (?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE link_preview=VALUES(link_preview),version=VALUES(version)", md.MessageID, md.MessageSeq, md.FromUID, md.ChannelID, md.ChannelType, md.LinkPreview, md.Version).Exec()
+	return err
+}
+
+// 更新语音转写结果
+func (m *messageExtraDB) insertOrUpdateTranscript(md *messageExtraModel) error {
+	_, err := m.session.InsertBySql("INSERT INTO message_extra (message_id,message_seq,from_uid,channel_id,channel_type,transcript,transcript_status,version) VALUES (?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE transcript=VALUES(transcript),transcript_status=VALUES(transcript_status),version=VALUES(version)", md.MessageID, md.MessageSeq, md.FromUID, md.ChannelID, md.ChannelType, md.Transcript, md.TranscriptStatus, md.Version).Exec()
 	return err
 }
 
+// claimTranscript 将语音消息标记为转写中 未转写或转写已中断的才能标记成功
+func (m *messageExtraDB) claimTranscript(md *messageExtraModel, now int64, staleBefore int64) (bool, error) {
+	_, err := m.session.InsertBySql("INSERT INTO message_extra (message_id,message_seq,from_uid,channel_id,channel_type) VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE message_id=message_id", md.MessageID, md.MessageSeq, md.FromUID, md.ChannelID, md.ChannelType).Exec()
+	if err != nil {
+		return false, err
+	}
+	result, err := m.session.Update("message_extra").SetMap(map[string]interface{}{
+		"transcript_status": transcriptStatusProcessing,
+		"transcript_at":     now,
+	}).Where("message_id=? and (transcript_status=? or (transcript_status=? and transcript_at<?))", md.MessageID, transcriptStatusNone, transcriptStatusProcessing, staleBefore).Exec()
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// startTranscript worker开始转写时刷新开始时间 claimedAt与标记时不一致说明任务已被重新标记 返回false
+func (m *messageExtraDB) startTranscript(messageID string, claimedAt int64, now int64) (bool, error) {
+	result, err := m.session.Update("message_extra").Set("transcript_at", now).Where("message_id=? and transcript_status=? and transcript_at=?", messageID, transcriptStatusProcessing, claimedAt).Exec()
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// queryStaleTranscripts 查询已中断的转写任务
+func (m *messageExtraDB) queryStaleTranscripts(staleBefore int64, limit uint64) ([]*messageExtraModel, error) {
+	var models []*messageExtraModel
+	_, err := m.session.Select("*").From("message_extra").Where("transcript_status=? and transcript_at<?", transcriptStatusProcessing, staleBefore).Limit(limit).Load(&models)
+	return models, err
+}
+
+// 在某个频道内搜索语音转写的文本
+func (m *messageExtraDB) searchTranscriptInChannel(channelID string, channelType uint8, keyword string, limit uint64) ([]*messageExtraModel, error) {
+	var models []*messageExtraModel
+	_, err := m.session.Select("*").From("message_extra").Where("channel_id=? and channel_type=? and transcript_status=1 and `revoke`=0 and is_deleted=0 and transcript like ?", channelID, channelType, "%"+util.EscapeLike(keyword)+"%").OrderDesc("message_seq").Limit(limit).Load(&models)
+	return models, err
+}
+
+// 在用户的单聊和所在群内搜索语音转写的文本
+func (m *messageExtraDB) searchTranscriptWithUID(uid string, groupNos []string, keyword string, limit uint64) ([]*messageExtraModel, error) {
+	var models []*messageExtraModel
+	personCond := dbr.And(dbr.Eq("channel_type", common.ChannelTypePerson.Uint8()), dbr.Or(dbr.Expr("channel_id like ?", util.EscapeLike(uid)+"@%"), dbr.Expr("channel_id like ?", "%@"+util.EscapeLike(uid))))
+	channelCond := personCond
+	if len(groupNos) > 0 {
+		channelCond = dbr.Or(personCond, dbr.And(dbr.Eq("channel_type", common.ChannelTypeGroup.Uint8()), dbr.Eq("channel_id", groupNos)))
+	}
+	_, err := m.session.Select("*").From("message_extra").Where("transcript_status=1 and `revoke`=0 and is_deleted=0 and transcript like ?", "%"+util.EscapeLike(keyword)+"%").Where(channelCond).OrderDesc("created_at").Limit(limit).Load(&models)
+	return models, err
+}
+
 // 是否存在相同编辑内容
 func (m *messageExtraDB) existContentEdit(messageID string, contentEditHash string) (bool, error) {
 	var count int
@@ -104,19 +189,24 @@ type messageExtraDetailModel struct {
 }
 
 type messageExtraModel struct {
-	MessageID       string
-	MessageSeq      uint32
-	FromUID         string
-	ChannelID       string
-	ChannelType     uint8
-	Revoke          int
-	Revoker         string // 消息撤回者的uid
-	CloneNo         string
-	ReadedCount     int            // 已读数量
-	ContentEdit     dbr.NullString // 编辑后的正文
-	ContentEditHash string
-	EditedAt        int // 编辑时间 时间戳（秒）
-	IsDeleted       int
-	Version         int64 // 数据版本
+	MessageID        string
+	MessageSeq       uint32
+	FromUID          string
+	ChannelID        string
+	ChannelType      uint8
+	Revoke           int
+	Revoker          string // 消息撤回者的uid
+	CloneNo          string
+	ReadedCount      int            // 已读数量
+	ContentEdit      dbr.NullString // 编辑后的正文
+	ContentEditHash  string
+	EditedAt         int // 编辑时间 时间戳（秒）
+	IsDeleted        int
+	Poll             dbr.NullString // 投票统计
+	LinkPreview      dbr.NullString // 链接预览
+	Transcript       dbr.NullString // 语音转写的文本
+	TranscriptStatus int            // 语音转写状态 0.未转写 1.转写成功 2.转写失败 3.转写中
+	TranscriptAt     int64          // 开始转写的时间
+	Version          int64          // 数据版本
 	db.BaseModel
 }
@@ -0,0 +1,68 @@
+package message
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+type messageTranslationDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newMessageTranslationDB(ctx *config.Context) *messageTranslationDB {
+	return &messageTranslationDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+func (m *messageTranslationDB) insertOrUpdate(md *messageTranslationModel) error {
+	sq := fmt.Sprintf("INSERT INTO %s (message_id,target_lang,source_lang,text,provider,content_hash) VALUES (?,?,?,?,?,?) ON DUPLICATE KEY UPDATE source_lang=VALUES(source_lang),text=VALUES(text),provider=VALUES(provider),content_hash=VALUES(content_hash)", m.getTable(md.MessageID))
+	_, err := m.session.InsertBySql(sq, md.MessageID, md.TargetLang, md.SourceLang, md.Text, md.Provider, md.ContentHash).Exec()
+	return err
+}
+
+// queryWithMessageIDs 查询消息的译文
+func (m *messageTranslationDB) queryWithMessageIDs(messageIDs []string, targetLang string) ([]*messageTranslationModel, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+	tableMessageIDs := map[string][]string{}
+	for _, messageID := range messageIDs {
+		table := m.getTable(messageID)
+		tableMessageIDs[table] = append(tableMessageIDs[table], messageID)
+	}
+	models := make([]*messageTranslationModel, 0, len(messageIDs))
+	for table, ids := range tableMessageIDs {
+		var tableModels []*messageTranslationModel
+		_, err := m.session.Select("*").From(table).Where("message_id in ? and target_lang=?", ids, targetLang).Load(&tableModels)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, tableModels...)
+	}
+	return models, nil
+}
+
+func (m *messageTranslationDB) getTable(messageID string) string {
+	tableIndex := crc32.ChecksumIEEE([]byte(messageID)) % uint32(m.ctx.GetConfig().TablePartitionConfig.MessageTranslationTableCount)
+	if tableIndex == 0 {
+		return "message_translation"
+	}
+	return fmt.Sprintf("message_translation%d", tableIndex)
+}
+
+type messageTranslationModel struct {
+	MessageID   string
+	TargetLang  string
+	SourceLang  string
+	Text        string
+	Provider    string
+	ContentHash string // 原文的md5 原文变化（消息编辑）后译文失效
+	db.BaseModel
+}
@@ -0,0 +1,69 @@
+package message
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+type pinnedMessageDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newPinnedMessageDB(ctx *config.Context) *pinnedMessageDB {
+	return &pinnedMessageDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+// insertOrUpdate 置顶消息 已取消置顶的重新置顶
+func (p *pinnedMessageDB) insertOrUpdate(m *pinnedMessageModel) error {
+	_, err := p.session.InsertBySql("INSERT INTO pinned_message (message_id,message_seq,channel_id,channel_type,pinner_uid,is_deleted,version) VALUES (?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE pinner_uid=VALUES(pinner_uid),is_deleted=VALUES(is_deleted),version=VALUES(version)", m.MessageID, m.MessageSeq, m.ChannelID, m.ChannelType, m.PinnerUID, m.IsDeleted, m.Version).Exec()
+	return err
+}
+
+// updateDeleted 取消置顶
+func (p *pinnedMessageDB) updateDeleted(messageID int64, version int64) error {
+	_, err := p.session.Update("pinned_message").SetMap(map[string]interface{}{
+		"is_deleted": 1,
+		"version":    version,
+	}).Where("message_id=?", messageID).Exec()
+	return err
+}
+
+func (p *pinnedMessageDB) queryWithMessageID(messageID int64) (*pinnedMessageModel, error) {
+	var model *pinnedMessageModel
+	_, err := p.session.Select("*").From("pinned_message").Where("message_id=?", messageID).Load(&model)
+	return model, err
+}
+
+// queryCount 查询频道内置顶的消息数量
+func (p *pinnedMessageDB) queryCount(channelID string, channelType uint8) (int64, error) {
+	var count int64
+	_, err := p.session.Select("count(*)").From("pinned_message").Where("channel_id=? and channel_type=? and is_deleted=0", channelID, channelType).Load(&count)
+	return count, err
+}
+
+// sync 同步频道内的置顶消息（增量同步包含已取消的，客户端据此移除；首次同步只返回未取消的）
+func (p *pinnedMessageDB) sync(channelID string, channelType uint8, version int64, limit uint64) ([]*pinnedMessageModel, error) {
+	var models []*pinnedMessageModel
+	builder := p.session.Select("*").From("pinned_message").Where("channel_id=? and channel_type=? and version>?", channelID, channelType, version)
+	if version == 0 {
+		builder = builder.Where("is_deleted=0")
+	}
+	_, err := builder.OrderAsc("version").Limit(limit).Load(&models)
+	return models, err
+}
+
+type pinnedMessageModel struct {
+	MessageID   int64
+	MessageSeq  uint32
+	ChannelID   string
+	ChannelType uint8
+	PinnerUID   string
+	IsDeleted   int
+	Version     int64
+	db.BaseModel
+}
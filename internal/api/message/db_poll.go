@@ -0,0 +1,146 @@
+package message
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type pollDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newPollDB(ctx *config.Context) *pollDB {
+	return &pollDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+func (p *pollDB) insert(m *pollModel) error {
+	_, err := p.session.InsertInto("message_poll").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+// updateMessage 投票消息发送成功后关联消息 只关联发起人自己且还未关联消息的投票
+func (p *pollDB) updateMessage(pollNo string, creatorUID string, channelID string, channelType uint8, messageID int64, messageSeq uint32) error {
+	_, err := p.session.Update("message_poll").SetMap(map[string]interface{}{
+		"message_id":  messageID,
+		"message_seq": messageSeq,
+	}).Where("poll_no=? and creator_uid=? and channel_id=? and channel_type=? and message_id=0", pollNo, creatorUID, channelID, channelType).Exec()
+	return err
+}
+
+func (p *pollDB) delete(pollNo string) error {
+	_, err := p.session.DeleteFrom("message_poll").Where("poll_no=?", pollNo).Exec()
+	return err
+}
+
+func (p *pollDB) queryWithPollNo(pollNo string) (*pollModel, error) {
+	var model *pollModel
+	_, err := p.session.Select("*").From("message_poll").Where("poll_no=?", pollNo).Load(&model)
+	return model, err
+}
+
+// queryWithPollNoForUpdateTx 查询并锁定投票 同一个投票的计票串行执行
+func (p *pollDB) queryWithPollNoForUpdateTx(pollNo string, tx *dbr.Tx) (*pollModel, error) {
+	var model *pollModel
+	_, err := tx.Select("*").From("message_poll").Where("poll_no=?", pollNo).Suffix("FOR UPDATE").Load(&model)
+	return model, err
+}
+
+// queryExpired 查询已到截止时间但未结束的投票
+func (p *pollDB) queryExpired(now int64, limit uint64) ([]*pollModel, error) {
+	var models []*pollModel
+	_, err := p.session.Select("*").From("message_poll").Where("is_closed=0 and deadline>0 and deadline<=? and message_id<>0", now).Limit(limit).Load(&models)
+	return models, err
+}
+
+// closeTx 结束投票 返回是否是本次结束的
+func (p *pollDB) closeTx(pollNo string, closerUID string, closedAt int64, tx *dbr.Tx) (bool, error) {
+	result, err := tx.Update("message_poll").SetMap(map[string]interface{}{
+		"is_closed":  1,
+		"closer_uid": closerUID,
+		"closed_at":  closedAt,
+	}).Where("poll_no=? and is_closed=0", pollNo).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// queryOptionIDsWithUID 查询用户投的选项
+func (p *pollDB) queryOptionIDsWithUID(pollNo string, uid string) ([]int, error) {
+	var optionIDs []int
+	_, err := p.session.Select("option_id").From("message_poll_vote").Where("poll_no=? and uid=?", pollNo, uid).OrderAsc("option_id").Load(&optionIDs)
+	return optionIDs, err
+}
+
+func (p *pollDB) deleteVotesTx(pollNo string, uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("message_poll_vote").Where("poll_no=? and uid=?", pollNo, uid).Exec()
+	return err
+}
+
+func (p *pollDB) insertVoteTx(m *pollVoteModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("message_poll_vote").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+// queryOptionCountsTx 统计每个选项的票数
+func (p *pollDB) queryOptionCountsTx(pollNo string, tx *dbr.Tx) ([]*pollOptionCountModel, error) {
+	var models []*pollOptionCountModel
+	_, err := tx.Select("option_id,count(*) count").From("message_poll_vote").Where("poll_no=?", pollNo).GroupBy("option_id").Load(&models)
+	return models, err
+}
+
+// queryVoterCountTx 统计投票人数
+func (p *pollDB) queryVoterCountTx(pollNo string, tx *dbr.Tx) (int64, error) {
+	var count int64
+	_, err := tx.Select("count(distinct uid)").From("message_poll_vote").Where("poll_no=?", pollNo).Load(&count)
+	return count, err
+}
+
+// queryVoteDetails 查询投票记录（带投票人名称）
+func (p *pollDB) queryVoteDetails(pollNo string) ([]*pollVoteDetailModel, error) {
+	var models []*pollVoteDetailModel
+	_, err := p.session.Select("message_poll_vote.*,IFNULL(user.name,'') name").From("message_poll_vote").LeftJoin("user", "message_poll_vote.uid=user.uid").Where("message_poll_vote.poll_no=?", pollNo).OrderAsc("message_poll_vote.id").Load(&models)
+	return models, err
+}
+
+type pollModel struct {
+	PollNo      string
+	MessageID   int64
+	MessageSeq  uint32
+	ChannelID   string
+	ChannelType uint8
+	CreatorUID  string
+	Title       string
+	Options     string // 选项 json数组
+	Multiple    int
+	Anonymous   int
+	Deadline    int64
+	IsClosed    int
+	CloserUID   string
+	ClosedAt    int64
+	db.BaseModel
+}
+
+type pollVoteModel struct {
+	PollNo   string
+	UID      string
+	OptionID int
+	db.BaseModel
+}
+
+type pollVoteDetailModel struct {
+	pollVoteModel
+	Name string
+}
+
+type pollOptionCountModel struct {
+	OptionID int
+	Count    int64
+}
@@ -3,6 +3,7 @@ package message
 import (
 	"fmt"
 
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
 	"github.com/WuKongIM/WuKongChatServer/pkg/db"
 	"github.com/WuKongIM/WuKongChatServer/pkg/util"
@@ -81,14 +82,43 @@ func (r *remindersDB) sync(uid string, version int64, limit uint64, channelIDs [
 	return models, err
 }
 
-func (r *remindersDB) insertDonesTx(ids []int64, uid string, tx *dbr.Tx) error {
+// insertDonesTx 添加提醒项完成记录 返回本次新完成的提醒项id（已完成过的不返回）
+func (r *remindersDB) insertDonesTx(ids []int64, uid string, tx *dbr.Tx) ([]int64, error) {
+	doneIDs := make([]int64, 0, len(ids))
 	for _, id := range ids {
-		_, err := tx.InsertBySql("insert ignore  into reminder_done(reminder_id,uid) values(?,?)", id, uid).Exec()
+		result, err := tx.InsertBySql("insert ignore  into reminder_done(reminder_id,uid) values(?,?)", id, uid).Exec()
 		if err != nil {
-			return err
+			return nil, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
 		}
+		if affected > 0 {
+			doneIDs = append(doneIDs, id)
+		}
+	}
+	return doneIDs, nil
+}
+
+// queryUndoneWithIDsTx 查询用户还未完成的提醒项
+func (r *remindersDB) queryUndoneWithIDsTx(ids []int64, uid string, tx *dbr.Tx) ([]*remindersModel, error) {
+	var models []*remindersModel
+	_, err := tx.Select("reminders.*").From("reminders").LeftJoin("reminder_done", dbr.And(dbr.Expr("reminders.id=reminder_done.reminder_id"), dbr.Eq("reminder_done.uid", uid))).Where("reminders.id in ? and reminders.is_deleted=0 and reminder_done.id is null", ids).Load(&models)
+	return models, err
+}
+
+// queryUndoneWithChannelTx 查询用户在某个会话内还未完成的指定类型提醒项（个人会话channelID为对方uid）
+func (r *remindersDB) queryUndoneWithChannelTx(uid string, channelID string, channelType uint8, reminderTypes []int, tx *dbr.Tx) ([]*remindersModel, error) {
+	var models []*remindersModel
+	builder := tx.Select("reminders.*").From("reminders").LeftJoin("reminder_done", dbr.And(dbr.Expr("reminders.id=reminder_done.reminder_id"), dbr.Eq("reminder_done.uid", uid)))
+	if channelType == common.ChannelTypePerson.Uint8() {
+		builder = builder.Where("reminders.channel_type=? and reminders.publisher=? and reminders.uid=?", channelType, channelID, uid)
+	} else {
+		builder = builder.Where("reminders.channel_id=? and reminders.channel_type=? and (reminders.uid=? or reminders.uid='') and reminders.publisher<>?", channelID, channelType, uid, uid)
 	}
-	return nil
+	_, err := builder.Where("reminders.reminder_type in ? and reminders.is_deleted=0 and reminder_done.id is null", reminderTypes).Load(&models)
+	return models, err
 }
 
 func (r *remindersDB) updateVersionTx(version int64, id int64, tx *dbr.Tx) error {
@@ -0,0 +1,159 @@
+package message
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type scheduledMessageDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newScheduledMessageDB(ctx *config.Context) *scheduledMessageDB {
+	return &scheduledMessageDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+func (s *scheduledMessageDB) insert(m *scheduledMessageModel) (int64, error) {
+	result, err := s.session.InsertInto("message_scheduled").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s *scheduledMessageDB) queryWithID(id int64) (*scheduledMessageModel, error) {
+	var model *scheduledMessageModel
+	_, err := s.session.Select("*").From("message_scheduled").Where("id=?", id).Load(&model)
+	return model, err
+}
+
+// update 修改待发送的定时消息 已发送或已取消的不会修改 返回false
+func (s *scheduledMessageDB) update(m *scheduledMessageModel) (bool, error) {
+	result, err := s.session.Update("message_scheduled").SetMap(map[string]interface{}{
+		"from_uid":     m.FromUID,
+		"channel_id":   m.ChannelID,
+		"channel_type": m.ChannelType,
+		"payload":      m.Payload,
+		"send_at":      m.SendAt,
+		"cron":         m.Cron,
+		"version":      m.Version,
+	}).Where("id=? and status=?", m.Id, scheduledStatusWait).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// cancel 取消待发送的定时消息 已发送或已取消的不会修改 返回false
+func (s *scheduledMessageDB) cancel(id int64, version int64) (bool, error) {
+	result, err := s.session.Update("message_scheduled").SetMap(map[string]interface{}{
+		"status":      scheduledStatusCanceled,
+		"fail_reason": "",
+		"version":     version,
+	}).Where("id=? and status=?", id, scheduledStatusWait).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// claim 抢占一次发送 只有状态和发送时间都未被改动时才会成功 防止多个实例重复发送
+func (s *scheduledMessageDB) claim(m *scheduledMessageModel, status scheduledStatus, nextSendAt int64, sentAt int64, version int64) (bool, error) {
+	result, err := s.session.Update("message_scheduled").SetMap(map[string]interface{}{
+		"status":       status,
+		"send_at":      nextSendAt,
+		"sent_count":   dbr.Expr("sent_count+1"),
+		"last_sent_at": sentAt,
+		"version":      version,
+	}).Where("id=? and status=? and send_at=?", m.Id, scheduledStatusWait, m.SendAt).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// sendFailed 发送失败 回退本次发送计数并记录失败原因 只有状态仍是抢占时设置的状态才会更新（防止覆盖用户的取消操作）
+func (s *scheduledMessageDB) sendFailed(id int64, claimedStatus scheduledStatus, status scheduledStatus, failReason string, version int64) error {
+	_, err := s.session.Update("message_scheduled").SetMap(map[string]interface{}{
+		"status":      status,
+		"sent_count":  dbr.Expr("sent_count-1"),
+		"fail_reason": failReason,
+		"version":     version,
+	}).Where("id=? and status=?", id, claimedStatus).Exec()
+	return err
+}
+
+// queryDue 查询到期待发送的定时消息
+func (s *scheduledMessageDB) queryDue(now int64, limit uint64) ([]*scheduledMessageModel, error) {
+	var models []*scheduledMessageModel
+	_, err := s.session.Select("*").From("message_scheduled").Where("status=? and send_at<=?", scheduledStatusWait, now).OrderAsc("send_at").Limit(limit).Load(&models)
+	return models, err
+}
+
+// queryPendingCount 查询用户待发送的定时消息数量
+func (s *scheduledMessageDB) queryPendingCount(uid string) (int64, error) {
+	var count int64
+	_, err := s.session.Select("count(*)").From("message_scheduled").Where("uid=? and creator_type=? and status=?", uid, scheduledCreatorUser, scheduledStatusWait).Load(&count)
+	return count, err
+}
+
+// sync 同步用户的定时消息
+func (s *scheduledMessageDB) sync(uid string, version int64, limit uint64) ([]*scheduledMessageModel, error) {
+	var models []*scheduledMessageModel
+	_, err := s.session.Select("*").From("message_scheduled").Where("uid=? and creator_type=? and version>?", uid, scheduledCreatorUser, version).OrderAsc("version").Limit(limit).Load(&models)
+	return models, err
+}
+
+func (s *scheduledMessageDB) queryManagerWithPage(pageSize, page uint64) ([]*scheduledMessageModel, error) {
+	var models []*scheduledMessageModel
+	_, err := s.session.Select("*").From("message_scheduled").Where("creator_type=?", scheduledCreatorManager).Offset((page-1)*pageSize).Limit(pageSize).OrderDir("id", false).Load(&models)
+	return models, err
+}
+
+func (s *scheduledMessageDB) queryManagerCount() (int64, error) {
+	var count int64
+	_, err := s.session.Select("count(*)").From("message_scheduled").Where("creator_type=?", scheduledCreatorManager).Load(&count)
+	return count, err
+}
+
+type scheduledStatus int
+
+const (
+	scheduledStatusWait     scheduledStatus = iota // 待发送
+	scheduledStatusSent                            // 已发送
+	scheduledStatusCanceled                        // 已取消
+	scheduledStatusFailed                          // 发送失败
+)
+
+type scheduledCreator int
+
+const (
+	scheduledCreatorUser    scheduledCreator = iota // 用户
+	scheduledCreatorManager                         // 后台
+)
+
+type scheduledMessageModel struct {
+	UID         string
+	CreatorType int
+	FromUID     string
+	ChannelID   string
+	ChannelType uint8
+	Payload     string
+	SendAt      int64
+	Cron        string
+	Status      int
+	SentCount   int
+	LastSentAt  int64
+	FailReason  string
+	Version     int64
+	db.BaseModel
+}
@@ -0,0 +1,106 @@
+package message
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/gocraft/dbr/v2"
+)
+
+type threadDB struct {
+	ctx     *config.Context
+	session *dbr.Session
+}
+
+func newThreadDB(ctx *config.Context) *threadDB {
+	return &threadDB{
+		ctx:     ctx,
+		session: ctx.DB(),
+	}
+}
+
+// insertOrUpdate 创建话题 已存在则更新回复统计
+func (t *threadDB) insertOrUpdate(m *threadModel) error {
+	_, err := t.session.InsertBySql("INSERT INTO message_thread (root_message_id,root_message_seq,channel_id,channel_type,creator_uid,reply_count,last_reply_message_id,last_reply_message_seq,last_reply_uid,last_reply_at,version) VALUES (?,?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE reply_count=VALUES(reply_count),last_reply_message_id=IF(VALUES(last_reply_message_seq)>last_reply_message_seq,VALUES(last_reply_message_id),last_reply_message_id),last_reply_uid=IF(VALUES(last_reply_message_seq)>last_reply_message_seq,VALUES(last_reply_uid),last_reply_uid),last_reply_at=IF(VALUES(last_reply_message_seq)>last_reply_message_seq,VALUES(last_reply_at),last_reply_at),last_reply_message_seq=GREATEST(last_reply_message_seq,VALUES(last_reply_message_seq)),version=VALUES(version)", m.RootMessageID, m.RootMessageSeq, m.ChannelID, m.ChannelType, m.CreatorUID, m.ReplyCount, m.LastReplyMessageID, m.LastReplyMessageSeq, m.LastReplyUID, m.LastReplyAt, m.Version).Exec()
+	return err
+}
+
+func (t *threadDB) queryWithRootMessageID(rootMessageID int64) (*threadModel, error) {
+	var model *threadModel
+	_, err := t.session.Select("*").From("message_thread").Where("root_message_id=?", rootMessageID).Load(&model)
+	return model, err
+}
+
+func (t *threadDB) queryWithRootMessageIDs(rootMessageIDs []int64) ([]*threadModel, error) {
+	if len(rootMessageIDs) <= 0 {
+		return nil, nil
+	}
+	var models []*threadModel
+	_, err := t.session.Select("*").From("message_thread").Where("root_message_id in ?", rootMessageIDs).Load(&models)
+	return models, err
+}
+
+// insertOrUpdateMember 添加话题参与者 已存在则只更新版本号
+func (t *threadDB) insertOrUpdateMember(m *threadMemberModel) error {
+	_, err := t.session.InsertBySql("INSERT INTO message_thread_member (root_message_id,uid,read_message_seq,unread_count,version) VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE read_message_seq=GREATEST(read_message_seq,VALUES(read_message_seq)),version=VALUES(version)", m.RootMessageID, m.UID, m.ReadMessageSeq, m.UnreadCount, m.Version).Exec()
+	return err
+}
+
+// increaseUnreadCount 除回复者外的参与者未读数加1 同一条回复只计数一次
+func (t *threadDB) increaseUnreadCount(rootMessageID int64, replyMessageID int64, excludeUID string, version int64) error {
+	_, err := t.session.UpdateBySql("UPDATE message_thread_member SET unread_count=unread_count+1,counted_message_id=?,version=? WHERE root_message_id=? and uid<>? and counted_message_id<?", replyMessageID, version, rootMessageID, excludeUID, replyMessageID).Exec()
+	return err
+}
+
+// updateRead 更新参与者的已读位置
+func (t *threadDB) updateRead(rootMessageID int64, uid string, readMessageSeq uint32, unreadCount int64, version int64) error {
+	_, err := t.session.Update("message_thread_member").SetMap(map[string]interface{}{
+		"read_message_seq": readMessageSeq,
+		"unread_count":     unreadCount,
+		"version":          version,
+	}).Where("root_message_id=? and uid=?", rootMessageID, uid).Exec()
+	return err
+}
+
+func (t *threadDB) queryMember(rootMessageID int64, uid string) (*threadMemberModel, error) {
+	var model *threadMemberModel
+	_, err := t.session.Select("*").From("message_thread_member").Where("root_message_id=? and uid=?", rootMessageID, uid).Load(&model)
+	return model, err
+}
+
+func (t *threadDB) queryMemberUIDs(rootMessageID int64) ([]string, error) {
+	var uids []string
+	_, err := t.session.Select("uid").From("message_thread_member").Where("root_message_id=?", rootMessageID).Load(&uids)
+	return uids, err
+}
+
+// syncMembers 同步用户参与的话题
+func (t *threadDB) syncMembers(uid string, version int64, limit uint64) ([]*threadMemberModel, error) {
+	var models []*threadMemberModel
+	_, err := t.session.Select("*").From("message_thread_member").Where("uid=? and version>?", uid, version).OrderAsc("version").Limit(limit).Load(&models)
+	return models, err
+}
+
+type threadModel struct {
+	RootMessageID       int64
+	RootMessageSeq      uint32
+	ChannelID           string
+	ChannelType         uint8
+	CreatorUID          string
+	ReplyCount          int64
+	LastReplyMessageID  int64
+	LastReplyMessageSeq uint32
+	LastReplyUID        string
+	LastReplyAt         int64
+	Version             int64
+	db.BaseModel
+}
+
+type threadMemberModel struct {
+	RootMessageID    int64
+	UID              string
+	ReadMessageSeq   uint32
+	UnreadCount      int64
+	CountedMessageID int64 // 最后计入未读数的回复消息ID
+	Version          int64
+	db.BaseModel
+}
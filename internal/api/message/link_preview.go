@@ -0,0 +1,311 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+var linkURLRegexp = regexp.MustCompile(`https?://[^\s<>"'\x{3000}-\x{303F}\x{FF00}-\x{FFEF}]+`)
+
+// 不允许访问的网段（除了内网、回环等net包能直接判断的之外）
+var blockedIPNets = mustParseCIDRs(
+	"0.0.0.0/8",       // 本网络
+	"100.64.0.0/10",   // 运营商级NAT
+	"192.0.0.0/24",    // IETF协议分配
+	"192.0.2.0/24",    // 文档示例
+	"198.18.0.0/15",   // 基准测试
+	"198.51.100.0/24", // 文档示例
+	"203.0.113.0/24",  // 文档示例
+	"240.0.0.0/4",     // 保留
+	"64:ff9b::/96",    // NAT64 可能映射到内网
+	"2001:db8::/32",   // 文档示例
+)
+
+// linkPreviewMeta 网页的预览信息
+type linkPreviewMeta struct {
+	Title       string
+	Description string
+	Image       string
+	SiteName    string
+}
+
+// linkPreviewFetcher 抓取链接预览 只允许访问公网地址
+type linkPreviewFetcher struct {
+	client       *http.Client
+	maxHTMLSize  int64
+	maxImageSize int64
+}
+
+func newLinkPreviewFetcher(timeout time.Duration, maxHTMLSize int64, maxImageSize int64) *linkPreviewFetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error { // 连接时检查真实的ip 防止dns重绑定
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isBlockedIP(ip) {
+				return fmt.Errorf("不允许访问的地址[%s]！", host)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                  nil, // 不走代理 否则无法检查真实地址
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    timeout,
+		ResponseHeaderTimeout:  timeout,
+		MaxResponseHeaderBytes: 64 * 1024,
+		DisableKeepAlives:      true,
+	}
+	return &linkPreviewFetcher{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 3 {
+					return errors.New("重定向次数过多！")
+				}
+				return checkLinkURL(req.URL)
+			},
+		},
+		maxHTMLSize:  maxHTMLSize,
+		maxImageSize: maxImageSize,
+	}
+}
+
+// fetch 抓取网页的Open Graph/Twitter card信息
+func (l *linkPreviewFetcher) fetch(ctx context.Context, rawURL string) (*linkPreviewMeta, error) {
+	resp, err := l.get(ctx, rawURL, "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	if !strings.Contains(contentType, "text/html") && !strings.Contains(contentType, "application/xhtml+xml") {
+		return nil, fmt.Errorf("不支持的网页类型[%s]！", contentType)
+	}
+	meta := parseLinkPreviewMeta(io.LimitReader(resp.Body, l.maxHTMLSize), resp.Request.URL)
+	if meta.Title == "" && meta.Description == "" {
+		return nil, errors.New("网页没有可预览的信息！")
+	}
+	return meta, nil
+}
+
+// fetchImage 下载预览图
+func (l *linkPreviewFetcher) fetchImage(ctx context.Context, imageURL string) ([]byte, string, error) {
+	resp, err := l.get(ctx, imageURL, "image/*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]))
+	if linkPreviewImageExt(contentType) == "" {
+		return nil, "", fmt.Errorf("不支持的图片类型[%s]！", contentType)
+	}
+	if resp.ContentLength > l.maxImageSize {
+		return nil, "", errors.New("图片太大！")
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, l.maxImageSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > l.maxImageSize {
+		return nil, "", errors.New("图片太大！")
+	}
+	return data, contentType, nil
+}
+
+func (l *linkPreviewFetcher) get(ctx context.Context, rawURL string, accept string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkLinkURL(u); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "WuKongChatBot/1.0 (link preview)")
+	req.Header.Set("Accept", accept)
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("链接返回状态[%d]！", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// checkLinkURL 只允许http/https的默认端口 ip地址需要是公网地址
+func checkLinkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("只支持http和https链接！")
+	}
+	if u.User != nil {
+		return errors.New("链接不能包含用户信息！")
+	}
+	host := u.Hostname()
+	if host == "" {
+		return errors.New("链接没有域名！")
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return errors.New("不支持的端口！")
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return errors.New("不允许访问的地址！")
+	}
+	if ip := net.ParseIP(host); ip != nil && isBlockedIP(ip) {
+		return errors.New("不允许访问的地址！")
+	}
+	return nil
+}
+
+// isBlockedIP 是否是内网、回环、链路本地、组播等不允许访问的地址
+func isBlockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	if ip4 := ip.To4(); ip4 != nil && ip4.Equal(net.IPv4bcast) {
+		return true
+	}
+	for _, ipNet := range blockedIPNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLinkPreviewMeta 解析网页head里的预览信息
+func parseLinkPreviewMeta(r io.Reader, pageURL *url.URL) *linkPreviewMeta {
+	metas := map[string]string{}
+	var title string
+	inTitle := false
+	tokenizer := html.NewTokenizer(r)
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		if tokenType == html.EndTagToken && token.Data == "head" {
+			break
+		}
+		if tokenType == html.StartTagToken && token.Data == "body" {
+			break
+		}
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if token.Data == "title" {
+				inTitle = true
+			} else if token.Data == "meta" {
+				var key, content string
+				for _, attr := range token.Attr {
+					switch strings.ToLower(attr.Key) {
+					case "property", "name":
+						key = strings.ToLower(strings.TrimSpace(attr.Val))
+					case "content":
+						content = strings.TrimSpace(attr.Val)
+					}
+				}
+				if key != "" && content != "" && metas[key] == "" {
+					metas[key] = content
+				}
+			}
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = strings.TrimSpace(token.Data)
+			}
+		case html.EndTagToken:
+			if token.Data == "title" {
+				inTitle = false
+			}
+		}
+	}
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if metas[key] != "" {
+				return metas[key]
+			}
+		}
+		return ""
+	}
+	meta := &linkPreviewMeta{
+		Title:       first("og:title", "twitter:title"),
+		Description: first("og:description", "twitter:description", "description"),
+		SiteName:    first("og:site_name"),
+	}
+	if meta.Title == "" {
+		meta.Title = title
+	}
+	if meta.SiteName == "" {
+		meta.SiteName = pageURL.Hostname()
+	}
+	if image := first("og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"); image != "" {
+		if imageURL, err := pageURL.Parse(image); err == nil {
+			meta.Image = imageURL.String()
+		}
+	}
+	meta.Title = truncateRunes(meta.Title, 200)
+	meta.Description = truncateRunes(meta.Description, 500)
+	meta.SiteName = truncateRunes(meta.SiteName, 100)
+	return meta
+}
+
+// getFirstLinkURL 获取文本中的第一个链接
+func getFirstLinkURL(text string) string {
+	link := linkURLRegexp.FindString(text)
+	return strings.TrimRight(link, ".,;:!?)]}")
+}
+
+func linkPreviewImageExt(contentType string) string {
+	switch contentType {
+	case "image/jpeg", "image/jpg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	return ""
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	ipNets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets
+}
@@ -1,25 +1,57 @@
 package message
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	commonapi "github.com/WuKongIM/WuKongChatServer/internal/api/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/api/group"
+	"github.com/WuKongIM/WuKongChatServer/internal/api/user"
 	"github.com/WuKongIM/WuKongChatServer/internal/common"
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
 	"github.com/WuKongIM/WuKongChatServer/pkg/log"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
 )
 
 type IService interface {
 	DeleteConversation(uid string, channelID string, channelType uint8) error
+	// 编辑消息
+	EditMessage(req *EditMessageReq) error
+	// 获取用户可见的某条消息
+	GetMessage(loginUID string, channelID string, channelType uint8, messageID string) (*MessageResp, error)
+	// 检查用户是否可以向频道发送消息（禁言、黑名单、好友关系等）
+	CheckSendPermission(fromUID string, channelID string, channelType uint8) error
+	// CheckSend 检查服务端代发的消息是否可以发送（发送权限、群慢速模式、新成员观察期）
+	CheckSend(fromUID string, channelID string, channelType uint8, payload []byte) error
 }
 
 type Service struct {
 	ctx *config.Context
 	log.Log
+	db                   *DB
+	messageExtraDB       *messageExtraDB
+	messageEditHistoryDB *messageEditHistoryDB
+	commonService        commonapi.IService
+	userService          user.IService
+	groupService         group.IService
 }
 
 func NewService(ctx *config.Context) *Service {
 
 	return &Service{
-		ctx: ctx,
-		Log: log.NewTLog("message.Service"),
+		ctx:                  ctx,
+		Log:                  log.NewTLog("message.Service"),
+		db:                   NewDB(ctx),
+		messageExtraDB:       newMessageExtraDB(ctx),
+		messageEditHistoryDB: newMessageEditHistoryDB(ctx),
+		commonService:        commonapi.NewService(ctx),
+		userService:          user.NewService(ctx),
+		groupService:         group.NewService(ctx),
 	}
 }
 
@@ -47,3 +79,276 @@ func (s *Service) DeleteConversation(uid string, channelID string, channelType u
 
 	return nil
 }
+
+// EditMessage 编辑消息 只有发送者本人能编辑，且需在可编辑时长内
+func (s *Service) EditMessage(req *EditMessageReq) error {
+	if err := req.check(); err != nil {
+		return err
+	}
+	fakeChannelID := req.ChannelID
+	if req.ChannelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(req.EditorUID, req.ChannelID)
+	}
+	messageM, err := s.db.queryMessageWithMessageID(fakeChannelID, req.ChannelType, req.MessageID)
+	if err != nil {
+		s.Error("查询消息失败！", zap.Error(err))
+		return errors.New("查询消息失败！")
+	}
+	if messageM == nil || messageM.IsDeleted == 1 {
+		return errors.New("消息不存在！")
+	}
+	if messageM.FromUID != req.EditorUID {
+		return errors.New("只能编辑自己发送的消息！")
+	}
+	appConfig, err := s.commonService.GetAppConfig()
+	if err != nil {
+		s.Error("查询应用配置失败！", zap.Error(err))
+		return errors.New("查询应用配置失败！")
+	}
+	now := time.Now()
+	if appConfig != nil && appConfig.EditSecond > 0 {
+		sendAt := messageM.Timestamp
+		if sendAt == 0 {
+			sendAt = time.Time(messageM.CreatedAt).Unix()
+		}
+		if now.Unix()-sendAt > int64(appConfig.EditSecond) {
+			return errors.New("消息已超过可编辑时长！")
+		}
+	}
+	words, err := s.db.queryValidProhibitWords()
+	if err != nil {
+		s.Error("查询违禁词失败！", zap.Error(err))
+		return errors.New("查询违禁词失败！")
+	}
+	if containsProhibitWord(req.ContentEdit, words) {
+		return errors.New("编辑内容包含违禁词！")
+	}
+
+	contentEdit := dbr.NewNullString(req.ContentEdit)
+	contentMD5 := util.MD5(contentEdit.String)
+	exist, err := s.messageExtraDB.existContentEdit(req.MessageID, contentMD5)
+	if err != nil {
+		s.Error("查询是否存在相同正文失败！", zap.Error(err))
+		return errors.New("查询是否存在相同正文失败！")
+	}
+	if exist {
+		s.Warn("存在相同编辑正文，不再处理！")
+		return nil
+	}
+
+	editedAt := int(now.Unix())
+	tx, _ := s.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = s.messageExtraDB.insertOrUpdateContentEditTx(&messageExtraModel{
+		MessageID:       req.MessageID,
+		MessageSeq:      req.MessageSeq,
+		ChannelID:       fakeChannelID,
+		ChannelType:     req.ChannelType,
+		ContentEdit:     contentEdit,
+		ContentEditHash: contentMD5,
+		EditedAt:        editedAt,
+		Version:         s.ctx.GenSeq(fmt.Sprintf("%s:%s", common.MessageExtraSeqKey, fakeChannelID)),
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		s.Error("添加或修改编辑内容失败！", zap.Error(err))
+		return errors.New("添加或修改编辑内容失败！")
+	}
+	err = s.messageEditHistoryDB.insertTx(&messageEditHistoryModel{
+		MessageID:       messageM.MessageID,
+		MessageSeq:      req.MessageSeq,
+		ChannelID:       fakeChannelID,
+		ChannelType:     req.ChannelType,
+		EditorUID:       req.EditorUID,
+		ContentEdit:     contentEdit,
+		ContentEditHash: contentMD5,
+		EditedAt:        editedAt,
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		s.Error("添加编辑历史失败！", zap.Error(err))
+		return errors.New("添加编辑历史失败！")
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		s.Error("提交事务失败！", zap.Error(err))
+		return errors.New("提交事务失败！")
+	}
+
+	err = s.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		FromUID:     req.EditorUID,
+		CMD:         common.CMDSyncMessageExtra,
+	})
+	if err != nil {
+		s.Error("发送cmd失败！", zap.Error(err))
+		return errors.New("发送cmd失败！")
+	}
+	return nil
+}
+
+// GetMessage 获取用户可见的某条消息 个人频道通过fake channel id保证只能查到自己的消息 不存在或已删除返回nil
+func (s *Service) GetMessage(loginUID string, channelID string, channelType uint8, messageID string) (*MessageResp, error) {
+	fakeChannelID := channelID
+	if channelType == common.ChannelTypePerson.Uint8() {
+		fakeChannelID = common.GetFakeChannelIDWith(loginUID, channelID)
+	}
+	messageM, err := s.db.queryMessageWithMessageID(fakeChannelID, channelType, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if messageM == nil || messageM.IsDeleted == 1 {
+		return nil, nil
+	}
+	return &MessageResp{
+		MessageID:   messageM.MessageID,
+		MessageSeq:  messageM.MessageSeq,
+		FromUID:     messageM.FromUID,
+		ChannelID:   channelID,
+		ChannelType: channelType,
+		Setting:     messageM.Setting,
+		Timestamp:   messageM.Timestamp,
+		Payload:     messageM.Payload,
+	}, nil
+}
+
+// containsProhibitWord 内容是否包含违禁词
+func containsProhibitWord(content string, words []*ProhibitWordModel) bool {
+	if content == "" {
+		return false
+	}
+	for _, word := range words {
+		if word.IsDeleted == 1 || strings.TrimSpace(word.Content) == "" {
+			continue
+		}
+		if strings.Contains(content, word.Content) {
+			return true
+		}
+	}
+	return false
+}
+
+// MessageResp 消息
+type MessageResp struct {
+	MessageID   int64
+	MessageSeq  uint32
+	FromUID     string
+	ChannelID   string
+	ChannelType uint8
+	Setting     uint8
+	Timestamp   int64
+	Payload     []byte
+}
+
+// EditMessageReq 编辑消息请求
+type EditMessageReq struct {
+	EditorUID   string `json:"-"` // 编辑者uid
+	MessageID   string `json:"message_id"`
+	MessageSeq  uint32 `json:"message_seq"`
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+	ContentEdit string `json:"content_edit"`
+}
+
+func (e *EditMessageReq) check() error {
+	if e.EditorUID == "" {
+		return errors.New("编辑者不能为空！")
+	}
+	if e.MessageID == "" {
+		return errors.New("消息ID不能为空！")
+	}
+	if _, err := strconv.ParseInt(e.MessageID, 10, 64); err != nil {
+		return errors.New("消息ID格式有误！")
+	}
+	if e.MessageSeq == 0 {
+		return errors.New("消息序号不能为空！")
+	}
+	if e.ChannelID == "" {
+		return errors.New("频道ID不能为空！")
+	}
+	return nil
+}
+
+// CheckSendPermission 检查用户是否可以向频道发送消息 服务端代发的消息不经过IM的权限检查 发送前需调用
+func (s *Service) CheckSendPermission(fromUID string, channelID string, channelType uint8) error {
+	if channelType == common.ChannelTypePerson.Uint8() {
+		if channelID == s.ctx.GetConfig().SystemUID || channelID == s.ctx.GetConfig().SystemFileUID {
+			return nil
+		}
+		isFriend, err := s.userService.IsFriend(fromUID, channelID)
+		if err != nil {
+			return err
+		}
+		if !isFriend {
+			return errors.New("对方不是你的好友！")
+		}
+		inBlacklist, err := s.userService.ExistBlacklist(channelID, fromUID)
+		if err != nil {
+			s.Error("查询黑名单失败！", zap.Error(err))
+			return errors.New("查询黑名单失败！")
+		}
+		if inBlacklist {
+			return errors.New("存在黑名单关系，不能发送消息！")
+		}
+		return nil
+	}
+	if channelType != common.ChannelTypeGroup.Uint8() {
+		return errors.New("不支持的频道类型！")
+	}
+	groupResp, err := s.groupService.GetGroupDetail(channelID, fromUID)
+	if err != nil {
+		s.Error("查询群信息失败！", zap.Error(err))
+		return errors.New("查询群信息失败！")
+	}
+	if groupResp == nil {
+		return errors.New("群不存在！")
+	}
+	if groupResp.Quit == 1 {
+		return errors.New("不是群成员，不能发送消息！")
+	}
+	blacklistUIDs, err := s.groupService.GetBlacklistMemberUIDs(channelID)
+	if err != nil {
+		s.Error("查询群黑名单失败！", zap.Error(err))
+		return errors.New("查询群黑名单失败！")
+	}
+	for _, blacklistUID := range blacklistUIDs {
+		if blacklistUID == fromUID {
+			return errors.New("你已被移入群黑名单，不能发送消息！")
+		}
+	}
+	isManager := groupResp.Role == group.MemberRoleCreator || groupResp.Role == group.MemberRoleManager
+	if !isManager {
+		if groupResp.Forbidden == 1 {
+			return errors.New("群已开启全员禁言！")
+		}
+		if groupResp.ForbiddenExpirTime > time.Now().Unix() {
+			return errors.New("你已被禁言！")
+		}
+	}
+	return nil
+}
+
+// CheckSend 检查服务端代发的消息是否可以发送 代发不经过IM的检查 群消息还需要检查慢速模式和新成员观察期
+func (s *Service) CheckSend(fromUID string, channelID string, channelType uint8, payload []byte) error {
+	if err := s.CheckSendPermission(fromUID, channelID, channelType); err != nil {
+		return err
+	}
+	if channelType != common.ChannelTypeGroup.Uint8() {
+		return nil
+	}
+	checkResp, err := s.groupService.CheckSend(group.NewCheckSendReq(channelID, fromUID, payload))
+	if err != nil {
+		return err
+	}
+	if !checkResp.Allow {
+		return errors.New(checkResp.Reason)
+	}
+	return nil
+}
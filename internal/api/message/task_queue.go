@@ -0,0 +1,56 @@
+package message
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/pkg/log"
+	"go.uber.org/zap"
+)
+
+// taskQueue 有界的异步任务队列 固定数量的worker执行任务 队列满时丢弃新任务
+type taskQueue struct {
+	name  string
+	tasks chan func()
+	log.Log
+}
+
+func newTaskQueue(name string, workers int, size int) *taskQueue {
+	q := &taskQueue{
+		name:  name,
+		tasks: make(chan func(), size),
+		Log:   log.NewTLog("taskQueue"),
+	}
+	for i := 0; i < workers; i++ {
+		go q.run()
+	}
+	return q
+}
+
+// submit 提交任务 队列已满返回false
+func (q *taskQueue) submit(task func()) bool {
+	select {
+	case q.tasks <- task:
+		return true
+	default:
+		q.Warn("任务队列已满，丢弃任务！", zap.String("queue", q.name))
+		return false
+	}
+}
+
+// pending 排队中还未执行的任务数量
+func (q *taskQueue) pending() int {
+	return len(q.tasks)
+}
+
+func (q *taskQueue) run() {
+	for task := range q.tasks {
+		q.execute(task)
+	}
+}
+
+func (q *taskQueue) execute(task func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			q.Error("执行任务失败！", zap.String("queue", q.name), zap.Any("err", err))
+		}
+	}()
+	task()
+}
@@ -0,0 +1,27 @@
+package message
+
+import (
+	"context"
+	"errors"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+)
+
+// ITranscribeProvider 语音转文字提供商
+type ITranscribeProvider interface {
+	// Name 提供商名称
+	Name() string
+	// Transcribe 将本地语音文件转写为文本 lang为语言提示 可以为空
+	Transcribe(ctx context.Context, audioPath string, lang string) (string, error)
+}
+
+// newTranscribeProvider 根据配置创建语音转文字提供商
+func newTranscribeProvider(ctx *config.Context) (ITranscribeProvider, error) {
+	switch ctx.GetConfig().TranscribeProvider {
+	case config.TranscribeProviderStub:
+		return NewStubTranscribeProvider(""), nil
+	case config.TranscribeProviderCommand:
+		return NewCommandTranscribeProvider(ctx.GetConfig().Transcribe.Command, ctx.GetConfig().Transcribe.Args), nil
+	}
+	return nil, errors.New("没有找到语音转文字提供商！")
+}
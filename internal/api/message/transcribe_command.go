@@ -0,0 +1,54 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+)
+
+// CommandTranscribeProvider 调用本地命令转写（例如whisper.cpp、vosk）
+// 命令需要把转写结果输出到标准输出 如果需要转换音频格式可以用脚本包装ffmpeg
+type CommandTranscribeProvider struct {
+	command string
+	args    []string
+}
+
+// NewCommandTranscribeProvider 创建本地命令转写 args空格分隔 支持{file}和{lang}占位符
+func NewCommandTranscribeProvider(command string, args string) ITranscribeProvider {
+	return &CommandTranscribeProvider{
+		command: command,
+		args:    strings.Fields(args),
+	}
+}
+
+func (c *CommandTranscribeProvider) Name() string {
+	return "command"
+}
+
+func (c *CommandTranscribeProvider) Transcribe(ctx context.Context, audioPath string, lang string) (string, error) {
+	if c.command == "" {
+		return "", errors.New("没有配置转写命令！")
+	}
+	if !common.IsSupportedLanguage(lang) { // 语言来自用户设置 不在白名单内的不能拼到命令参数里
+		lang = "auto"
+	}
+	args := make([]string, 0, len(c.args))
+	for _, arg := range c.args {
+		arg = strings.ReplaceAll(arg, "{file}", audioPath)
+		arg = strings.ReplaceAll(arg, "{lang}", lang)
+		args = append(args, arg)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("执行转写命令失败！%w %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,28 @@
+package message
+
+import (
+	"context"
+)
+
+// StubTranscribeProvider 返回固定文本 用于测试
+type StubTranscribeProvider struct {
+	text string
+}
+
+// NewStubTranscribeProvider 创建固定结果的语音转文字 text为空时返回默认文本
+func NewStubTranscribeProvider(text string) ITranscribeProvider {
+	if text == "" {
+		text = "[语音转文字]"
+	}
+	return &StubTranscribeProvider{
+		text: text,
+	}
+}
+
+func (s *StubTranscribeProvider) Name() string {
+	return "stub"
+}
+
+func (s *StubTranscribeProvider) Transcribe(ctx context.Context, audioPath string, lang string) (string, error) {
+	return s.text, nil
+}
@@ -0,0 +1,33 @@
+package message
+
+import (
+	"context"
+	"errors"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+)
+
+// ITranslateProvider 翻译提供商
+type ITranslateProvider interface {
+	// Name 提供商名称
+	Name() string
+	// Translate 将文本翻译为目标语言
+	Translate(ctx context.Context, text string, targetLang string) (*TranslateResult, error)
+}
+
+// TranslateResult 翻译结果
+type TranslateResult struct {
+	Text       string // 译文
+	SourceLang string // 源语言
+}
+
+// newTranslateProvider 根据配置创建翻译提供商
+func newTranslateProvider(ctx *config.Context) (ITranslateProvider, error) {
+	switch ctx.GetConfig().TranslateProvider {
+	case config.TranslateProviderDict:
+		return NewDictTranslateProvider(nil), nil
+	case config.TranslateProviderLibre:
+		return NewLibreTranslateProvider(ctx), nil
+	}
+	return nil, errors.New("没有找到翻译提供商！")
+}
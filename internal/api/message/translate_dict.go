@@ -0,0 +1,38 @@
+package message
+
+import (
+	"context"
+	"fmt"
+)
+
+// DictTranslateProvider 字典翻译 结果是确定的，用于测试
+type DictTranslateProvider struct {
+	dict map[string]map[string]string // 目标语言 -> 原文 -> 译文
+}
+
+// NewDictTranslateProvider 创建字典翻译
+func NewDictTranslateProvider(dict map[string]map[string]string) ITranslateProvider {
+	return &DictTranslateProvider{
+		dict: dict,
+	}
+}
+
+func (d *DictTranslateProvider) Name() string {
+	return "dict"
+}
+
+// Translate 字典里没有的文本返回 [目标语言]原文
+func (d *DictTranslateProvider) Translate(ctx context.Context, text string, targetLang string) (*TranslateResult, error) {
+	if d.dict != nil && d.dict[targetLang] != nil {
+		if translated, ok := d.dict[targetLang][text]; ok {
+			return &TranslateResult{
+				Text:       translated,
+				SourceLang: "auto",
+			}, nil
+		}
+	}
+	return &TranslateResult{
+		Text:       fmt.Sprintf("[%s]%s", targetLang, text),
+		SourceLang: "auto",
+	}, nil
+}
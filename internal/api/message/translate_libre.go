@@ -0,0 +1,83 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/log"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"go.uber.org/zap"
+)
+
+const translateMaxResponseSize = 1024 * 1024 // 翻译服务返回内容的最大字节数
+
+// LibreTranslateProvider LibreTranslate翻译
+type LibreTranslateProvider struct {
+	ctx    *config.Context
+	client *http.Client
+	log.Log
+}
+
+// NewLibreTranslateProvider 创建LibreTranslate翻译
+func NewLibreTranslateProvider(ctx *config.Context) ITranslateProvider {
+	return &LibreTranslateProvider{
+		ctx:    ctx,
+		client: &http.Client{Timeout: ctx.GetConfig().TranslateTimeout},
+		Log:    log.NewTLog("LibreTranslateProvider"),
+	}
+}
+
+func (l *LibreTranslateProvider) Name() string {
+	return string(config.TranslateProviderLibre)
+}
+
+func (l *LibreTranslateProvider) Translate(ctx context.Context, text string, targetLang string) (*TranslateResult, error) {
+	translateCfg := l.ctx.GetConfig().Translate
+	if translateCfg.URL == "" {
+		return nil, errors.New("没有配置翻译服务地址！")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/translate", strings.TrimSuffix(translateCfg.URL, "/")), strings.NewReader(util.ToJson(map[string]interface{}{
+		"q":       text,
+		"source":  "auto",
+		"target":  targetLang,
+		"format":  "text",
+		"api_key": translateCfg.APIKey,
+	})))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		l.Error("调用翻译服务失败！", zap.Error(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, translateMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		l.Error("翻译服务返回状态码失败！", zap.Int("httpCode", resp.StatusCode), zap.String("body", string(body)))
+		return nil, fmt.Errorf("翻译服务返回状态[%d]失败！", resp.StatusCode)
+	}
+	var result struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	err = util.ReadJsonByByte(body, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &TranslateResult{
+		Text:       result.TranslatedText,
+		SourceLang: result.DetectedLanguage.Language,
+	}, nil
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/WuKongIM/WuKongChatServer/internal/api/base/app"
+	"github.com/WuKongIM/WuKongChatServer/internal/api/message"
 	"github.com/WuKongIM/WuKongChatServer/internal/api/user"
 	"github.com/WuKongIM/WuKongChatServer/internal/common"
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
@@ -31,6 +32,7 @@ type Robot struct {
 	robotEventPrefix                  string
 	userService                       user.IService
 	appService                        app.IService
+	messageService                    message.IService
 	inlineQueryEventsMap              map[string][]*robotEvent // inlineQuery事件
 	inlineQueryEventsMapLock          sync.RWMutex
 	inlineQueryEventResultChanMap     map[string]chan *InlineQueryResult
@@ -46,6 +48,7 @@ func New(ctx *config.Context) *Robot {
 		robotEventPrefix:              "robotEvent:",
 		userService:                   user.NewService(ctx),
 		appService:                    app.NewService(ctx),
+		messageService:                message.NewService(ctx),
 		inlineQueryEventsMap:          map[string][]*robotEvent{},
 		inlineQueryEventResultChanMap: map[string]chan *InlineQueryResult{},
 		mentionRegexp:                 regexp.MustCompile(`@\S+`),
@@ -75,6 +78,7 @@ func (rb *Robot) Route(r *wkhttp.WKHttp) {
 		robotAuth.POST("/answerInlineQuery", rb.answerInlineQuery) // 响应inlineQuery
 		robotAuth.POST("/sendMessage", rb.sendMessage)             // 发送消息
 		robotAuth.POST("/typing", rb.typing)                       // 输入中
+		robotAuth.POST("/editMessage", rb.editMessage)             // 编辑消息
 
 	}
 
@@ -224,6 +228,22 @@ func (rb *Robot) sendMessage(c *wkhttp.Context) {
 	c.Response(result)
 }
 
+// 编辑机器人自己发送的消息
+func (rb *Robot) editMessage(c *wkhttp.Context) {
+	var req message.EditMessageReq
+	if err := c.BindJSON(&req); err != nil {
+		rb.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	req.EditorUID = c.Param("robot_id")
+	if err := rb.messageService.EditMessage(&req); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.ResponseOK()
+}
+
 func (rb *Robot) supportContentType(contentType common.ContentType) bool {
 	return contentType == common.Text
 }
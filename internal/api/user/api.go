@@ -32,6 +32,7 @@ import (
 	"github.com/WuKongIM/WuKongChatServer/pkg/wkevent"
 	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -41,15 +42,16 @@ var qrcodeChanLock sync.RWMutex
 
 // User 用户相关API
 type User struct {
-	db            *DB
-	friendDB      *friendDB
-	deviceDB      *deviceDB
-	smsServie     commonapi.ISMSService
-	fileService   file.IService
-	settingDB     *SettingDB
-	onlineDB      *onlineDB
-	userService   IService
-	onlineService *OnlineService
+	db             *DB
+	friendDB       *friendDB
+	deviceDB       *deviceDB
+	smsServie      commonapi.ISMSService
+	captchaService commonapi.ICaptchaService
+	fileService    file.IService
+	settingDB      *SettingDB
+	onlineDB       *onlineDB
+	userService    IService
+	onlineService  *OnlineService
 
 	setting *Setting
 	log.Log
@@ -63,6 +65,8 @@ type User struct {
 	commonService         common2.IService
 	deviceFlagDB          *deviceFlagDB
 	deviceFlagsCache      []*deviceFlagModel
+	exportDB              *exportDB
+	destroyDB             *destroyDB
 }
 
 // New New
@@ -73,6 +77,7 @@ func New(ctx *config.Context) *User {
 		deviceDB:              newDeviceDB(ctx),
 		friendDB:              newFriendDB(ctx),
 		smsServie:             commonapi.NewSMSService(ctx),
+		captchaService:        commonapi.NewCaptchaService(ctx),
 		settingDB:             NewSettingDB(ctx.DB()),
 		setting:               NewSetting(ctx),
 		userDeviceTokenPrefix: common.UserDeviceTokenPrefix,
@@ -88,6 +93,8 @@ func New(ctx *config.Context) *User {
 		maillistDB:            newMaillistDB(ctx),
 		deviceFlagDB:          newDeviceFlagDB(ctx),
 		commonService:         common2.NewService(ctx),
+		exportDB:              newExportDB(ctx),
+		destroyDB:             newDestroyDB(ctx),
 	}
 	u.updateSystemUserToken()
 	source.SetUserProvider(u)
@@ -143,11 +150,22 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 		user.GET("/customerservices", u.customerservices)
 		// 注销用户
 		user.DELETE("/destroy/:code", u.destroyAccount)
+		// 获取注销申请
+		user.GET("/destroy", u.destroyGet)
+		// 撤销注销
+		user.POST("/destroy/cancel", u.destroyCancel)
 		//获取注销账号短信验证码
 		user.POST("/sms/destroy", u.sendDestroyCode)
+		// ---------- 账号数据导出 ----------
+		// 申请导出账号数据
+		user.POST("/export", u.exportApply)
+		// 获取最近一次导出任务
+		user.GET("/export", u.exportGet)
 		// ---------- 登录设备管理 ----------
 		// 用户登录设备
 		user.GET("/devices", u.deviceList)
+		// 登录历史
+		user.GET("/loginlog", u.loginLogList)
 		// 删除登录设备
 		user.DELETE("/devices/:device_id", u.deviceDelete)
 		// 用户在线列表（我的设备和我的好友）
@@ -170,14 +188,14 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 	{
 		//用户注册
 		v.POST("/user/register", u.register)
-		v.POST("/user/login", u.login)
+		v.POST("/user/login", u.ctx.RateLimit("user.login"), u.login)
 		// v.POST("user/wxlogin", u.wxLogin)
 		//获取忘记密码验证码
 		v.POST("/user/sms/forgetpwd", u.getForgetPwdSMS)
 		//重置登录密码
 		v.POST("/user/pwdforget", u.pwdforget)
 		// 搜索用户
-		v.GET("/user/search", u.search)
+		v.GET("/user/search", u.ctx.RateLimit("user.search"), u.search)
 
 		// 用户头像
 		v.GET("/users/:uid/avatar", u.UserAvatar)
@@ -194,13 +212,17 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 		v.POST("/user/sms/login_check_phone", u.sendLoginCheckPhoneCode)
 		//登录验证设备手机号
 		v.POST("/user/login/check_phone", u.loginCheckPhone)
+		// 下载导出的账号数据
+		v.GET("/user/export/download/:token", u.exportDownload)
 	}
 
 	// 监听在线状态
 	u.ctx.AddOnlineStatusListener(u.onlineService.listenOnlineStatus)
 	u.ctx.AddOnlineStatusListener(u.handleOnlineStatus) // 需要放在listenOnlineStatus之后
 
-	u.ctx.Schedule(time.Minute*5, u.onlineStatusCheck) // 在线状态定时检查
+	u.ctx.Schedule(time.Minute*5, u.onlineStatusCheck)                       // 在线状态定时检查
+	u.ctx.Schedule(time.Minute, u.destroyPurgeCheck)                         // 注销冷静期结束的账号数据清除
+	u.ctx.Schedule(u.ctx.GetConfig().UserExportCheckInterval, u.exportCheck) // 执行待导出和中断的导出任务
 
 }
 
@@ -576,6 +598,13 @@ func (u *User) userUpdateSetting(c *wkhttp.Context) {
 		return
 	}
 
+	if language, ok := reqMap["language"]; ok {
+		lang, _ := language.(string)
+		if lang != "" && !common.IsSupportedLanguage(lang) {
+			c.ResponseError(errors.New("不支持的语言！"))
+			return
+		}
+	}
 	for key, value := range reqMap {
 		if key == "device_lock" ||
 			key == "search_by_phone" ||
@@ -585,7 +614,11 @@ func (u *User) userUpdateSetting(c *wkhttp.Context) {
 			key == "offline_protection" ||
 			key == "voice_on" ||
 			key == "shock_on" ||
-			key == "mute_of_app" {
+			key == "mute_of_app" ||
+			key == "language" ||
+			key == "read_receipt" ||
+			key == "typing_indicator" ||
+			key == "last_seen_visibility" {
 			err = u.db.UpdateUsersWithField(key, fmt.Sprintf("%v", value), loginUID)
 			if err != nil {
 				u.Error("修改用户资料失败", zap.Error(err))
@@ -776,6 +809,9 @@ func (u *User) login(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	if !u.checkCaptcha(c, commonapi.CaptchaSceneLogin, commonapi.CaptchaBind(commonapi.CaptchaSceneLogin, "", "", "", req.Username), req.captchaReq) {
+		return
+	}
 	loginSpan := u.ctx.Tracer().StartSpan(
 		"login",
 		opentracing.ChildOf(c.GetSpanContext()),
@@ -799,12 +835,41 @@ func (u *User) login(c *wkhttp.Context) {
 		return
 	}
 	if util.MD5(util.MD5(req.Password)) != userInfo.Password {
+		u.captchaService.AddFailure(c.ClientIP())
 		c.ResponseError(errors.New("密码不正确！"))
 		return
 	}
 	u.checkLoginInfo(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx, c)
 }
 
+// checkCaptcha 风险场景下校验图形验证 未通过时返回false并响应请求
+func (u *User) checkCaptcha(c *wkhttp.Context, scene commonapi.CaptchaScene, bind string, req captchaReq) bool {
+	need, err := u.captchaService.Need(c.ClientIP())
+	if err != nil {
+		u.Error("查询是否需要图形验证失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否需要图形验证失败！"))
+		return false
+	}
+	if !need {
+		return true
+	}
+	if strings.TrimSpace(req.CaptchaToken) == "" {
+		c.ResponseWithStatus(http.StatusBadRequest, map[string]interface{}{
+			"status": 111,
+			"msg":    "需要图形验证！",
+			"scene":  scene,
+		})
+		return false
+	}
+	err = u.captchaService.Verify(scene, bind, req.CaptchaToken, req.CaptchaX)
+	if err != nil {
+		u.captchaService.AddFailure(c.ClientIP())
+		c.ResponseError(err)
+		return false
+	}
+	return true
+}
+
 // 验证登录用户信息
 func (u *User) checkLoginInfo(userInfo *Model, flag config.DeviceFlag, device *deviceReq, loginSpanCtx context.Context, c *wkhttp.Context) {
 	if userInfo.Status == int(common.UserDisable) {
@@ -938,12 +1003,12 @@ func (u *User) checkLoginInfo(userInfo *Model, flag config.DeviceFlag, device *d
 	}
 
 	publicIP := util.GetClientPublicIP(c.Request)
-	go u.sentWelcomeMsg(publicIP, userInfo.UID)
+	go u.sentWelcomeMsg(publicIP, userInfo.UID, flag, device)
 	c.Response(newLoginUserDetailResp(userInfo, token, u.ctx))
 }
 
 // sendWelcomeMsg 发送欢迎语
-func (u *User) sentWelcomeMsg(publicIP, uid string) {
+func (u *User) sentWelcomeMsg(publicIP, uid string, flag config.DeviceFlag, device *deviceReq) {
 	time.Sleep(time.Second * 2)
 	//发送登录欢迎消息
 	lastLoginLog := u.loginLog.getLastLoginIP(uid)
@@ -979,7 +1044,10 @@ func (u *User) sentWelcomeMsg(publicIP, uid string) {
 		u.Error("发送登录消息欢迎消息失败", zap.Error(err))
 	}
 	//保存登录日志
-	u.loginLog.add(uid, publicIP)
+	loginLogModel, anomaly := u.loginLog.add(uid, publicIP, flag, device)
+	if anomaly.Any() {
+		u.sendLoginAnomalyMsg(loginLogModel, anomaly)
+	}
 }
 
 // 注册
@@ -1028,6 +1096,7 @@ func (u *User) register(c *wkhttp.Context) {
 		//线上验证短信验证码
 		err = u.smsServie.Verify(registerSpanCtx, req.Zone, req.Phone, req.Code, commonapi.CodeTypeRegister)
 		if err != nil {
+			u.captchaService.AddFailure(c.ClientIP())
 			c.ResponseError(err)
 			return
 		}
@@ -1122,8 +1191,8 @@ func (u *User) registerUserDeviceToken(c *wkhttp.Context) {
 }
 
 // 注册用户设备红点数量
+// 红点由服务端根据最近会话未读数计算（设置未读、清除未读时刷新） 客户端上报的数量不再保存 保留接口兼容旧客户端
 func (u *User) registerUserDeviceBadge(c *wkhttp.Context) {
-	loginUID := c.MustGet("uid").(string)
 	var req struct {
 		Badge int `json:"badge"` // 设备红点数量
 	}
@@ -1132,23 +1201,9 @@ func (u *User) registerUserDeviceBadge(c *wkhttp.Context) {
 		c.ResponseError(errors.New("数据格式有误！"))
 		return
 	}
-	err := u.setUserBadge(loginUID, int64(req.Badge))
-	if err != nil {
-		u.Error("存储用户红点失败！", zap.Error(err))
-		c.ResponseError(errors.New("存储用户红点失败！"))
-		return
-	}
 	c.ResponseOK()
 }
 
-func (u *User) setUserBadge(uid string, badge int64) error {
-	err := u.ctx.GetRedisConn().Hset(common.UserDeviceBadgePrefix, uid, fmt.Sprintf("%d", badge))
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
 // 卸载注册设备token
 func (u *User) unregisterUserDeviceToken(c *wkhttp.Context) {
 	loginUID := c.MustGet("uid").(string)
@@ -1621,7 +1676,7 @@ func (u *User) blacklists(c *wkhttp.Context) {
 // sendRegisterCode 发送注册短信
 func (u *User) sendRegisterCode(c *wkhttp.Context) {
 	var req codeReq
-	if err := c.BindJSON(&req); err != nil {
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil { // 保留请求体 限流需要读取手机号
 		c.ResponseError(errors.New("请求数据格式有误！"))
 		return
 	}
@@ -1639,6 +1694,13 @@ func (u *User) sendRegisterCode(c *wkhttp.Context) {
 			return
 		}
 	}
+	if !u.checkCaptcha(c, commonapi.CaptchaSceneRegister, commonapi.CaptchaBind(commonapi.CaptchaSceneRegister, req.Zone, req.Phone, "", ""), req.captchaReq) {
+		return
+	}
+	// 图形验证通过后再计数 被要求图形验证的请求不占用发送次数
+	if !u.ctx.CheckRateLimit(c, "sms.registercode") {
+		return
+	}
 
 	span := u.ctx.Tracer().StartSpan(
 		"user.sendRegisterCode",
@@ -1773,6 +1835,7 @@ func (u *User) closeLockScreenPwd(c *wkhttp.Context) {
 func (u *User) sendLoginCheckPhoneCode(c *wkhttp.Context) {
 	var req struct {
 		UID string `json:"uid"`
+		captchaReq
 	}
 	if err := c.BindJSON(&req); err != nil {
 		u.Error("数据格式有误！", zap.Error(err))
@@ -1783,6 +1846,9 @@ func (u *User) sendLoginCheckPhoneCode(c *wkhttp.Context) {
 		c.ResponseError(errors.New("uid不能为空！"))
 		return
 	}
+	if !u.checkCaptcha(c, commonapi.CaptchaSceneLoginCheckPhone, commonapi.CaptchaBind(commonapi.CaptchaSceneLoginCheckPhone, "", "", req.UID, ""), req.captchaReq) {
+		return
+	}
 
 	span := u.ctx.Tracer().StartSpan(
 		"user.sendLoginCheckPhoneCode",
@@ -1857,6 +1923,7 @@ func (u *User) loginCheckPhone(c *wkhttp.Context) {
 	err = u.smsServie.Verify(spanCtx, userInfo.Zone, userInfo.Phone, req.Code, commonapi.CodeTypeCheckMobile)
 	if err != nil {
 		u.Error("验证短信失败", zap.Error(err))
+		u.captchaService.AddFailure(c.ClientIP())
 		c.ResponseError(err)
 		return
 	}
@@ -1982,30 +2049,33 @@ func (u *User) destroyAccount(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
-	t := time.Now()
-	time := fmt.Sprintf("%d%d%d%d%d", t.Year(), t.Month(), t.Day(), t.Minute(), t.Second())
-	phone := fmt.Sprintf("%s@%s@delete", userInfo.Phone, time)
-	username := fmt.Sprintf("%s%s", userInfo.Zone, phone)
-	err = u.db.destroyAccount(loginUID, username, phone)
+	pending, err := u.destroyDB.queryPendingWithUID(loginUID)
 	if err != nil {
-		u.Error("注销账号错误", zap.Error(err))
-		c.ResponseError(errors.New("注销账号错误"))
+		u.Error("查询注销申请错误", zap.Error(err))
+		c.ResponseError(errors.New("查询注销申请错误"))
 		return
 	}
-	// 更新聊天token
-	token := util.GenerUUID()
-	_, err = u.ctx.UpdateIMToken(config.UpdateIMTokenReq{
-		UID:         loginUID,
-		Token:       token,
-		DeviceFlag:  config.APP,
-		DeviceLevel: config.DeviceLevelMaster,
+	if pending != nil {
+		c.ResponseError(errors.New("账号已在注销冷静期中"))
+		return
+	}
+	purgeAt := time.Now().Add(u.ctx.GetConfig().DestroyGracePeriod).Unix()
+	err = u.destroyDB.insert(&destroyModel{
+		UID:     loginUID,
+		Status:  int(destroyStatusPending),
+		PurgeAt: purgeAt,
 	})
 	if err != nil {
-		u.Error("更新IM的token失败！", zap.Error(err))
-		c.ResponseError(errors.New("更新IM的token失败！"))
+		u.Error("添加注销申请错误", zap.Error(err))
+		c.ResponseError(errors.New("添加注销申请错误"))
 		return
 	}
-	c.ResponseOK()
+	if u.ctx.GetConfig().DestroyGracePeriod <= 0 { // 没有冷静期则立即清除
+		u.destroyPurgeCheck()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"purge_at": purgeAt,
+	})
 }
 
 // 处理注册用户和文件助手互为好友
@@ -2130,6 +2200,7 @@ func (u *User) pwdforget(c *wkhttp.Context) {
 	//线上验证短信验证码
 	err = u.smsServie.Verify(context.Background(), req.Zone, req.Phone, req.Code, commonapi.CodeTypeForgetLoginPWD)
 	if err != nil {
+		u.captchaService.AddFailure(c.ClientIP())
 		c.ResponseError(err)
 		return
 	}
@@ -2157,6 +2228,9 @@ func (u *User) getForgetPwdSMS(c *wkhttp.Context) {
 		c.ResponseError(errors.New("手机号不能为空！"))
 		return
 	}
+	if !u.checkCaptcha(c, commonapi.CaptchaSceneForgetPwd, commonapi.CaptchaBind(commonapi.CaptchaSceneForgetPwd, req.Zone, req.Phone, "", ""), req.captchaReq) {
+		return
+	}
 
 	span := u.ctx.Tracer().StartSpan(
 		"user.sendForgetPwdCode",
@@ -2327,7 +2401,7 @@ func (u *User) createUser(registerSpanCtx context.Context, createUser *createUse
 		return
 	}
 	publicIP := util.GetClientPublicIP(c.Request)
-	go u.sentWelcomeMsg(publicIP, createUser.UID)
+	go u.sentWelcomeMsg(publicIP, createUser.UID, config.DeviceFlag(createUser.Flag), createUser.Device)
 
 	if u.ctx.GetConfig().ShortnoNumOn {
 		err = u.commonService.SetShortnoUsed(userModel.ShortNo, "user")
@@ -2403,12 +2477,20 @@ type chatPwdReq struct {
 type codeReq struct {
 	Zone  string `json:"zone"`
 	Phone string `json:"phone"`
+	captchaReq
+}
+
+// captchaReq 图形验证参数（风险场景下必填）
+type captchaReq struct {
+	CaptchaToken string `json:"captcha_token"` // 图形验证令牌
+	CaptchaX     int    `json:"captcha_x"`     // 滑块横坐标
 }
 type loginReq struct {
 	Username string     `json:"username"`
 	Password string     `json:"password"`
 	Flag     int        `json:"flag"`   // 设备标示 0.APP 1.PC
 	Device   *deviceReq `json:"device"` //登录设备信息
+	captchaReq
 }
 
 func (r loginReq) Check() error {
@@ -2461,15 +2543,19 @@ type loginUserDetailResp struct {
 }
 
 type setting struct {
-	SearchByPhone     int `json:"search_by_phone"`    //是否可以通过手机号搜索0.否1.是
-	SearchByShort     int `json:"search_by_short"`    //是否可以通过短编号搜索0.否1.是
-	NewMsgNotice      int `json:"new_msg_notice"`     //新消息通知0.否1.是
-	MsgShowDetail     int `json:"msg_show_detail"`    //显示消息通知详情0.否1.是
-	VoiceOn           int `json:"voice_on"`           //声音0.否1.是
-	ShockOn           int `json:"shock_on"`           //震动0.否1.是
-	OfflineProtection int `json:"offline_protection"` //离线保护，断网屏保
-	DeviceLock        int `json:"device_lock"`        // 设备锁
-	MuteOfApp         int `json:"mute_of_app"`        // web登录 app是否静音
+	SearchByPhone      int    `json:"search_by_phone"`      //是否可以通过手机号搜索0.否1.是
+	SearchByShort      int    `json:"search_by_short"`      //是否可以通过短编号搜索0.否1.是
+	NewMsgNotice       int    `json:"new_msg_notice"`       //新消息通知0.否1.是
+	MsgShowDetail      int    `json:"msg_show_detail"`      //显示消息通知详情0.否1.是
+	VoiceOn            int    `json:"voice_on"`             //声音0.否1.是
+	ShockOn            int    `json:"shock_on"`             //震动0.否1.是
+	OfflineProtection  int    `json:"offline_protection"`   //离线保护，断网屏保
+	DeviceLock         int    `json:"device_lock"`          // 设备锁
+	MuteOfApp          int    `json:"mute_of_app"`          // web登录 app是否静音
+	Language           string `json:"language"`             // 偏好语言
+	ReadReceipt        int    `json:"read_receipt"`         // 是否发送已读回执
+	TypingIndicator    int    `json:"typing_indicator"`     // 是否发送输入中状态
+	LastSeenVisibility int    `json:"last_seen_visibility"` // 最后在线时间可见范围 0.所有人 1.好友 2.没有人
 }
 
 type blacklistResp struct {
@@ -2497,15 +2583,19 @@ func newLoginUserDetailResp(m *Model, token string, ctx *config.Context) loginUs
 		ShortStatus:     m.ShortStatus,
 		RSAPublicKey:    base64.StdEncoding.EncodeToString([]byte(ctx.GetConfig().AppRSAPubKey)),
 		Setting: setting{
-			SearchByPhone:     m.SearchByPhone,
-			SearchByShort:     m.SearchByShort,
-			NewMsgNotice:      m.NewMsgNotice,
-			MsgShowDetail:     m.MsgShowDetail,
-			VoiceOn:           m.VoiceOn,
-			ShockOn:           m.ShockOn,
-			OfflineProtection: m.OfflineProtection,
-			DeviceLock:        m.DeviceLock,
-			MuteOfApp:         m.MuteOfApp,
+			SearchByPhone:      m.SearchByPhone,
+			SearchByShort:      m.SearchByShort,
+			NewMsgNotice:       m.NewMsgNotice,
+			MsgShowDetail:      m.MsgShowDetail,
+			VoiceOn:            m.VoiceOn,
+			ShockOn:            m.ShockOn,
+			OfflineProtection:  m.OfflineProtection,
+			DeviceLock:         m.DeviceLock,
+			MuteOfApp:          m.MuteOfApp,
+			Language:           m.Language,
+			ReadReceipt:        m.ReadReceipt,
+			TypingIndicator:    m.TypingIndicator,
+			LastSeenVisibility: m.LastSeenVisibility,
 		},
 	}
 }
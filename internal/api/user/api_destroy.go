@@ -0,0 +1,231 @@
+package user
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/api/base/event"
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkevent"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// 注销后的用户名称
+const destroyedUserName = "已注销用户"
+
+// 获取冷静期中的注销申请
+func (u *User) destroyGet(c *wkhttp.Context) {
+	pending, err := u.destroyDB.queryPendingWithUID(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询注销申请错误", zap.Error(err))
+		c.ResponseError(errors.New("查询注销申请错误"))
+		return
+	}
+	if pending == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"pending": 0,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"pending":  1,
+		"purge_at": pending.PurgeAt,
+	})
+}
+
+// 撤销注销
+func (u *User) destroyCancel(c *wkhttp.Context) {
+	pending, err := u.destroyDB.queryPendingWithUID(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询注销申请错误", zap.Error(err))
+		c.ResponseError(errors.New("查询注销申请错误"))
+		return
+	}
+	if pending == nil {
+		c.ResponseError(errors.New("没有可撤销的注销申请"))
+		return
+	}
+	err = u.destroyDB.updateStatus(pending.Id, destroyStatusCanceled)
+	if err != nil {
+		u.Error("撤销注销申请错误", zap.Error(err))
+		c.ResponseError(errors.New("撤销注销申请错误"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// destroyPurgeCheck 清除冷静期已结束的注销账号
+func (u *User) destroyPurgeCheck() {
+	models, err := u.destroyDB.queryDue(time.Now().Unix(), 100)
+	if err != nil {
+		u.Error("查询待清除的注销账号失败！", zap.Error(err))
+		return
+	}
+	for _, model := range models {
+		err = u.purgeAccount(model)
+		if err != nil {
+			u.Error("清除注销账号数据失败！", zap.Error(err), zap.String("uid", model.UID))
+		}
+	}
+}
+
+// purgeAccount 匿名化用户资料、删除好友关系并移出所有群
+func (u *User) purgeAccount(destroyM *destroyModel) error {
+	uid := destroyM.UID
+	userInfo, err := u.db.QueryByUID(uid)
+	if err != nil {
+		return errors.Wrap(err, "查询用户信息错误")
+	}
+	if userInfo == nil {
+		return u.destroyDB.updateStatus(destroyM.Id, destroyStatusPurged)
+	}
+	friends, err := u.friendDB.QueryFriends(uid)
+	if err != nil {
+		return errors.Wrap(err, "查询用户好友错误")
+	}
+	// 占位的手机号和用户名不能包含原手机号等个人信息 只用uid保证唯一（username最长40）
+	placeholder := fmt.Sprintf("%s@del", util.MD5(uid))
+	phone := placeholder
+	username := placeholder
+
+	tx, _ := u.ctx.DB().Begin()
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	err = u.destroyDB.anonymizeTx(uid, destroyedUserName, username, phone, tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "匿名化用户资料错误")
+	}
+	err = u.destroyDB.deleteDevicesTx(uid, tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "删除用户设备错误")
+	}
+	err = u.destroyDB.deleteSignalKeysTx(uid, tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "删除用户signal key错误")
+	}
+	err = u.destroyDB.deleteMaillistTx(uid, tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "删除用户通讯录错误")
+	}
+	eventIDs := make([]int64, 0, len(friends)+1)
+	for _, friend := range friends {
+		version := u.ctx.GenSeq(common.FriendSeqKey)
+		err = u.friendDB.updateRelationship2Tx(uid, friend.ToUID, 1, 1, version, tx)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "删除好友错误")
+		}
+		err = u.friendDB.updateRelationship2Tx(friend.ToUID, uid, 1, 1, version, tx)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "删除好友错误")
+		}
+		eventID, err := u.ctx.EventBegin(&wkevent.Data{
+			Event: event.FriendDelete,
+			Type:  wkevent.Message,
+			Data: map[string]interface{}{
+				"uid":    uid,
+				"to_uid": friend.ToUID,
+			},
+		}, tx)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "发送删除好友事件失败")
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+	// 移出所有群
+	eventID, err := u.ctx.EventBegin(&wkevent.Data{
+		Event: event.EventUserDestroy,
+		Type:  wkevent.Message,
+		Data: map[string]interface{}{
+			"uid": uid,
+		},
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "发送用户注销事件失败")
+	}
+	eventIDs = append(eventIDs, eventID)
+	err = u.destroyDB.insertTombstoneTx(uid, tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "添加注销墓碑错误")
+	}
+	err = u.destroyDB.updateStatusTx(destroyM.Id, destroyStatusPurged, tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "更新注销申请状态错误")
+	}
+	if err := tx.Commit(); err != nil {
+		tx.RollbackUnlessCommitted()
+		return errors.Wrap(err, "提交事务失败")
+	}
+	for _, eventID := range eventIDs {
+		u.ctx.EventCommit(eventID)
+	}
+
+	// 删除推送设备token
+	err = u.ctx.GetRedisConn().Del(fmt.Sprintf("%s%s", u.userDeviceTokenPrefix, uid))
+	if err != nil {
+		u.Warn("删除用户设备token失败！", zap.Error(err))
+	}
+	for _, friend := range friends {
+		err = u.ctx.SendFriendDelete(&config.MsgFriendDeleteReq{
+			FromUID: friend.ToUID,
+			ToUID:   uid,
+		})
+		if err != nil {
+			u.Warn("发送删除好友的cmd失败！", zap.Error(err))
+		}
+	}
+	if userInfo.IsUploadAvatar == 1 { // 用默认头像覆盖已上传的头像
+		err = u.resetAvatar(uid)
+		if err != nil {
+			u.Warn("重置用户头像失败！", zap.Error(err))
+		}
+	}
+	// 更新聊天token 使已登录的设备失效
+	_, err = u.ctx.UpdateIMToken(config.UpdateIMTokenReq{
+		UID:         uid,
+		Token:       util.GenerUUID(),
+		DeviceFlag:  config.APP,
+		DeviceLevel: config.DeviceLevelMaster,
+	})
+	if err != nil {
+		return errors.Wrap(err, "更新IM的token失败")
+	}
+	return nil
+}
+
+// resetAvatar 用默认头像覆盖用户头像
+func (u *User) resetAvatar(uid string) error {
+	avatarFile, err := os.Open(u.ctx.GetConfig().DefaultAvatar)
+	if err != nil {
+		return err
+	}
+	defer avatarFile.Close()
+	avatarID := crc32.ChecksumIEEE([]byte(uid)) % 100
+	_, err = u.fileService.UploadFile(fmt.Sprintf("avatar/%d/%s.png", avatarID, uid), "image/png", func(w io.Writer) error {
+		_, err := io.Copy(w, avatarFile)
+		return err
+	})
+	return err
+}
@@ -0,0 +1,372 @@
+package user
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// 每次从消息表里读取的消息数量
+const exportMessageBatch = 500
+
+// 申请导出账号数据
+func (u *User) exportApply(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	lastExport, err := u.exportDB.queryLastWithUID(loginUID)
+	if err != nil {
+		u.Error("查询导出任务失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询导出任务失败！"))
+		return
+	}
+	if lastExport != nil && (lastExport.Status == int(exportStatusWait) || lastExport.Status == int(exportStatusProcessing)) {
+		c.ResponseError(errors.New("已有导出任务正在进行中，请稍后再试！"))
+		return
+	}
+	id, err := u.exportDB.insert(&exportModel{
+		UID:    loginUID,
+		Status: int(exportStatusWait),
+	})
+	if err != nil {
+		u.Error("添加导出任务失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加导出任务失败！"))
+		return
+	}
+	c.Response(&exportResp{
+		ID:     id,
+		Status: int(exportStatusWait),
+	})
+}
+
+// 获取最近一次导出任务状态
+func (u *User) exportGet(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	lastExport, err := u.exportDB.queryLastWithUID(loginUID)
+	if err != nil {
+		u.Error("查询导出任务失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询导出任务失败！"))
+		return
+	}
+	if lastExport == nil {
+		c.ResponseError(errors.New("没有导出任务！"))
+		return
+	}
+	c.Response(newExportResp(lastExport))
+}
+
+// 下载导出的账号数据
+func (u *User) exportDownload(c *wkhttp.Context) {
+	token := c.Param("token")
+	idStr, err := u.ctx.Cache().Get(fmt.Sprintf("%s%s", u.ctx.GetConfig().UserExportCachePrefix, token))
+	if err != nil {
+		u.Error("获取导出下载token失败！", zap.Error(err))
+		c.ResponseError(errors.New("获取导出下载token失败！"))
+		return
+	}
+	if idStr == "" {
+		c.ResponseError(errors.New("下载链接已失效！"))
+		return
+	}
+	id, _ := strconv.ParseInt(idStr, 10, 64)
+	exportM, err := u.exportDB.queryWithID(id)
+	if err != nil {
+		u.Error("查询导出任务失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询导出任务失败！"))
+		return
+	}
+	if exportM == nil || exportM.Status != int(exportStatusSuccess) {
+		c.ResponseError(errors.New("导出文件不存在！"))
+		return
+	}
+	downloadURL, err := u.fileService.DownloadURL(exportM.Path, fmt.Sprintf("%s.zip", exportM.UID))
+	if err != nil {
+		u.Error("获取下载地址失败！", zap.Error(err))
+		c.ResponseError(errors.New("获取下载地址失败！"))
+		return
+	}
+	c.Redirect(http.StatusFound, downloadURL)
+}
+
+// exportCheck 执行等待中的导出任务 服务重启等原因中断的任务超时后重新导出
+func (u *User) exportCheck() {
+	timeout := u.ctx.GetConfig().UserExportTimeout
+	models, err := u.exportDB.queryPending(timeout, 10)
+	if err != nil {
+		u.Error("查询待执行的导出任务失败！", zap.Error(err))
+		return
+	}
+	for _, model := range models {
+		claimed, err := u.exportDB.claim(model.Id, timeout)
+		if err != nil {
+			u.Error("更新导出任务状态失败！", zap.Error(err))
+			continue
+		}
+		if !claimed { // 已被其他检查执行
+			continue
+		}
+		u.exportUserData(model.Id, model.UID)
+	}
+}
+
+// exportUserData 导出用户数据并通知用户
+func (u *User) exportUserData(id int64, uid string) {
+	path, size, err := u.exportToFile(id, uid)
+	if err != nil {
+		u.Error("导出账号数据失败！", zap.Error(err), zap.String("uid", uid))
+		err = u.exportDB.updateStatus(id, exportStatusFail, "", 0, err.Error())
+		if err != nil {
+			u.Error("更新导出任务状态失败！", zap.Error(err))
+		}
+		return
+	}
+	err = u.exportDB.updateStatus(id, exportStatusSuccess, path, size, "")
+	if err != nil {
+		u.Error("更新导出任务状态失败！", zap.Error(err))
+		return
+	}
+
+	token := util.GenerUUID()
+	expire := u.ctx.GetConfig().UserExportLinkExpire
+	err = u.ctx.Cache().SetAndExpire(fmt.Sprintf("%s%s", u.ctx.GetConfig().UserExportCachePrefix, token), fmt.Sprintf("%d", id), expire)
+	if err != nil {
+		u.Error("设置导出下载token失败！", zap.Error(err))
+		return
+	}
+	downloadURL := fmt.Sprintf("%s/user/export/download/%s", u.ctx.GetConfig().APIBaseURL, token)
+	content := fmt.Sprintf("你的账号数据已导出完成，请在%s前通过以下链接下载：\n%s", util.ToyyyyMMddHHmmss(time.Now().Add(expire)), downloadURL)
+	err = u.ctx.SendMessage(&config.MsgSendReq{
+		FromUID:     u.ctx.GetConfig().SystemUID,
+		ChannelID:   uid,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"content": content,
+			"type":    common.Text,
+		})),
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+	})
+	if err != nil {
+		u.Error("发送导出完成消息失败！", zap.Error(err))
+	}
+}
+
+// exportToFile 将用户数据打包为zip并上传
+func (u *User) exportToFile(id int64, uid string) (string, int64, error) {
+	tmpFile, err := ioutil.TempFile("", "user_export_*.zip")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	zipWriter := zip.NewWriter(tmpFile)
+	if err = u.writeExportData(zipWriter, uid); err != nil {
+		return "", 0, err
+	}
+	if err = zipWriter.Close(); err != nil {
+		return "", 0, err
+	}
+	size, err := tmpFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err = tmpFile.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	path := fmt.Sprintf("export/%s/%d.zip", uid, id)
+	_, err = u.fileService.UploadFile(path, "application/zip", func(w io.Writer) error {
+		_, err := io.Copy(w, tmpFile)
+		return err
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("/%s", path), size, nil
+}
+
+func (u *User) writeExportData(zipWriter *zip.Writer, uid string) error {
+	userM, err := u.db.QueryByUID(uid)
+	if err != nil {
+		return errors.Wrap(err, "查询用户信息失败")
+	}
+	if userM == nil {
+		return errors.New("用户不存在")
+	}
+	if err = writeExportJSON(zipWriter, "profile.json", newExportProfile(userM)); err != nil {
+		return err
+	}
+	settings, err := u.exportDB.querySettings(uid)
+	if err != nil {
+		return errors.Wrap(err, "查询用户设置失败")
+	}
+	if err = writeExportJSON(zipWriter, "settings.json", settings); err != nil {
+		return err
+	}
+	friends, err := u.exportDB.queryFriends(uid)
+	if err != nil {
+		return errors.Wrap(err, "查询好友失败")
+	}
+	if err = writeExportJSON(zipWriter, "friends.json", friends); err != nil {
+		return err
+	}
+	groups, err := u.exportDB.queryGroups(uid)
+	if err != nil {
+		return errors.Wrap(err, "查询群聊失败")
+	}
+	if err = writeExportJSON(zipWriter, "groups.json", groups); err != nil {
+		return err
+	}
+	blacklists, err := u.db.Blacklists(uid)
+	if err != nil {
+		return errors.Wrap(err, "查询黑名单失败")
+	}
+	if err = writeExportJSON(zipWriter, "blacklists.json", blacklists); err != nil {
+		return err
+	}
+	loginLogs, err := u.exportDB.queryLoginLogs(uid)
+	if err != nil {
+		return errors.Wrap(err, "查询登录日志失败")
+	}
+	if err = writeExportJSON(zipWriter, "login_logs.json", loginLogs); err != nil {
+		return err
+	}
+	favorites, err := u.exportDB.queryFavorites(uid)
+	if err != nil {
+		return errors.Wrap(err, "查询收藏失败")
+	}
+	if err = writeExportJSON(zipWriter, "favorites.json", favorites); err != nil {
+		return err
+	}
+	return u.writeExportMessages(zipWriter, uid)
+}
+
+// writeExportMessages 分批读取用户在各消息分表内发送的消息 每行一条json
+func (u *User) writeExportMessages(zipWriter *zip.Writer, uid string) error {
+	w, err := zipWriter.Create("messages.jsonl")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for _, table := range u.exportDB.messageTables() {
+		var lastID int64
+		for {
+			messages, err := u.exportDB.queryMessages(table, uid, lastID, exportMessageBatch)
+			if err != nil {
+				return errors.Wrap(err, "查询消息失败")
+			}
+			for _, message := range messages {
+				if err = encoder.Encode(newExportMessage(message)); err != nil {
+					return err
+				}
+			}
+			if len(messages) < exportMessageBatch {
+				break
+			}
+			lastID = messages[len(messages)-1].Id
+		}
+	}
+	return nil
+}
+
+func writeExportJSON(zipWriter *zip.Writer, name string, data interface{}) error {
+	w, err := zipWriter.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+type exportResp struct {
+	ID        int64  `json:"id"`
+	Status    int    `json:"status"` // 状态 0.等待中 1.导出中 2.已完成 3.失败
+	Size      int64  `json:"size"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newExportResp(m *exportModel) *exportResp {
+	return &exportResp{
+		ID:        m.Id,
+		Status:    m.Status,
+		Size:      m.Size,
+		CreatedAt: m.CreatedAt.String(),
+	}
+}
+
+type exportProfile struct {
+	UID           string `json:"uid"`
+	Name          string `json:"name"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Sex           int    `json:"sex"`
+	ShortNo       string `json:"short_no"`
+	Zone          string `json:"zone"`
+	Phone         string `json:"phone"`
+	SearchByPhone int    `json:"search_by_phone"`
+	SearchByShort int    `json:"search_by_short"`
+	NewMsgNotice  int    `json:"new_msg_notice"`
+	MsgShowDetail int    `json:"msg_show_detail"`
+	VoiceOn       int    `json:"voice_on"`
+	ShockOn       int    `json:"shock_on"`
+	CreatedAt     string `json:"created_at"`
+}
+
+func newExportProfile(m *Model) *exportProfile {
+	return &exportProfile{
+		UID:           m.UID,
+		Name:          m.Name,
+		Username:      m.Username,
+		Email:         m.Email,
+		Sex:           m.Sex,
+		ShortNo:       m.ShortNo,
+		Zone:          m.Zone,
+		Phone:         m.Phone,
+		SearchByPhone: m.SearchByPhone,
+		SearchByShort: m.SearchByShort,
+		NewMsgNotice:  m.NewMsgNotice,
+		MsgShowDetail: m.MsgShowDetail,
+		VoiceOn:       m.VoiceOn,
+		ShockOn:       m.ShockOn,
+		CreatedAt:     m.CreatedAt.String(),
+	}
+}
+
+type exportMessage struct {
+	MessageID   string                 `json:"message_id"`
+	MessageSeq  uint32                 `json:"message_seq"`
+	ClientMsgNo string                 `json:"client_msg_no"`
+	ChannelID   string                 `json:"channel_id"`
+	ChannelType uint8                  `json:"channel_type"`
+	Timestamp   int64                  `json:"timestamp"`
+	Payload     map[string]interface{} `json:"payload"`
+	IsDeleted   int                    `json:"is_deleted"`
+}
+
+func newExportMessage(m *exportMessageModel) *exportMessage {
+	var payloadMap map[string]interface{}
+	_ = util.ReadJsonByByte(m.Payload, &payloadMap)
+	return &exportMessage{
+		MessageID:   strconv.FormatInt(m.MessageID, 10),
+		MessageSeq:  m.MessageSeq,
+		ClientMsgNo: m.ClientMsgNo,
+		ChannelID:   m.ChannelID,
+		ChannelType: m.ChannelType,
+		Timestamp:   m.Timestamp,
+		Payload:     payloadMap,
+		IsDeleted:   m.IsDeleted,
+	}
+}
@@ -1,8 +1,18 @@
 package user
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/common"
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/geoip"
 	"github.com/WuKongIM/WuKongChatServer/pkg/log"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
 	"go.uber.org/zap"
 )
 
@@ -11,6 +21,9 @@ type LoginLog struct {
 	ctx *config.Context
 	log.Log
 	loginLogDB *LoginLogDB
+
+	geoipOnce sync.Once
+	geoipDB   *geoip.DB
 }
 
 // NewLoginLog 创建
@@ -18,15 +31,41 @@ func NewLoginLog(ctx *config.Context) *LoginLog {
 	return &LoginLog{ctx: ctx, Log: log.NewTLog("loginLog"), loginLogDB: NewLoginLogDB(ctx.DB())}
 }
 
-// add 添加登录日志
-func (l *LoginLog) add(uid string, publicIP string) {
-	err := l.loginLogDB.insert(&LoginLogModel{
-		UID:     uid,
-		LoginIP: publicIP,
-	})
+// add 添加登录日志 并检测登录异常（新设备、新国家、异常位移）
+func (l *LoginLog) add(uid string, publicIP string, flag config.DeviceFlag, device *deviceReq) (*LoginLogModel, loginAnomaly) {
+	model := &LoginLogModel{
+		UID:        uid,
+		LoginIP:    publicIP,
+		DeviceFlag: int(flag),
+	}
+	if device != nil {
+		model.DeviceID = device.DeviceID
+		model.DeviceName = device.DeviceName
+		model.DeviceModel = device.DeviceModel
+	}
+	if loc := l.lookup(publicIP); loc != nil {
+		model.Country = loc.Country
+		model.Province = loc.Province
+		model.City = loc.City
+		model.Latitude = loc.Latitude
+		model.Longitude = loc.Longitude
+	}
+	var anomaly loginAnomaly
+	histories, err := l.loginLogDB.queryRecent(uid, uint64(l.ctx.GetConfig().LoginHistoryCount))
+	if err != nil {
+		l.Error("查询历史登录日志错误", zap.Error(err))
+	} else {
+		anomaly = detectLoginAnomaly(model, histories, time.Now(), l.ctx.GetConfig().ImpossibleTravelSpeed)
+	}
+	model.NewDevice = boolToInt(anomaly.NewDevice)
+	model.NewCountry = boolToInt(anomaly.NewCountry)
+	model.ImpossibleTravel = boolToInt(anomaly.ImpossibleTravel)
+
+	err = l.loginLogDB.insert(model)
 	if err != nil {
 		l.Error("添加登录日志错误", zap.Error(err))
 	}
+	return model, anomaly
 }
 
 // getLastLoginIp 获取最后一次登录ip
@@ -46,9 +85,195 @@ func (l *LoginLog) getLastLoginIP(uid string) *loginLogResp {
 	return nil
 }
 
+// lookup 通过本地GeoIP库查询IP的地理位置
+func (l *LoginLog) lookup(ip string) *geoip.Location {
+	l.geoipOnce.Do(func() {
+		path := l.ctx.GetConfig().GeoIPDBPath
+		if path == "" {
+			return
+		}
+		geoipDB, err := geoip.Open(path)
+		if err != nil {
+			l.Warn("加载GeoIP库失败！", zap.Error(err), zap.String("path", path))
+			return
+		}
+		l.geoipDB = geoipDB
+	})
+	if l.geoipDB == nil {
+		return nil
+	}
+	return l.geoipDB.Lookup(ip)
+}
+
+// 登录历史
+func (u *User) loginLogList(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	pageIndex, pageSize := c.GetPage()
+	models, err := u.loginLog.loginLogDB.queryWithPage(loginUID, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		u.Error("查询登录日志失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录日志失败！"))
+		return
+	}
+	count, err := u.loginLog.loginLogDB.queryCount(loginUID)
+	if err != nil {
+		u.Error("查询登录日志数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录日志数量失败！"))
+		return
+	}
+	list := make([]*loginHistoryResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newLoginHistoryResp(model))
+	}
+	c.Response(map[string]interface{}{
+		"list":  list,
+		"count": count,
+	})
+}
+
+// sendLoginAnomalyMsg 发送登录安全提醒
+func (u *User) sendLoginAnomalyMsg(model *LoginLogModel, anomaly loginAnomaly) {
+	reasons := make([]string, 0, 3)
+	if anomaly.NewDevice {
+		reasons = append(reasons, "新设备登录")
+	}
+	if anomaly.NewCountry {
+		reasons = append(reasons, "首次在该国家/地区登录")
+	}
+	if anomaly.ImpossibleTravel {
+		reasons = append(reasons, "登录地点与上次相距过远")
+	}
+	deviceName := model.DeviceName
+	if deviceName == "" {
+		deviceName = model.DeviceModel
+	}
+	if deviceName == "" {
+		deviceName = "未知设备"
+	}
+	location := strings.TrimSpace(strings.Join([]string{model.Country, model.Province, model.City}, " "))
+	if location == "" {
+		location = "未知"
+	}
+	content := fmt.Sprintf("安全提醒：你的账号于%s在%s上登录（%s）。\n登录IP：%s\n登录地点：%s\n如非本人操作，请尽快修改密码并在设备管理中移除该设备。", util.ToyyyyMMddHHmmss(time.Now()), deviceName, strings.Join(reasons, "、"), model.LoginIP, location)
+	err := u.ctx.SendMessage(&config.MsgSendReq{
+		FromUID:     u.ctx.GetConfig().SystemUID,
+		ChannelID:   model.UID,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"content": content,
+			"type":    common.Text,
+		})),
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+	})
+	if err != nil {
+		u.Error("发送登录安全提醒失败", zap.Error(err))
+	}
+}
+
+// loginAnomaly 登录异常
+type loginAnomaly struct {
+	NewDevice        bool // 新设备
+	NewCountry       bool // 新国家
+	ImpossibleTravel bool // 异常位移
+}
+
+// Any 是否存在异常
+func (a loginAnomaly) Any() bool {
+	return a.NewDevice || a.NewCountry || a.ImpossibleTravel
+}
+
+// detectLoginAnomaly 对比历史登录记录检测登录异常 histories按时间倒序 首次登录不算异常
+func detectLoginAnomaly(current *LoginLogModel, histories []*LoginLogModel, now time.Time, impossibleTravelSpeed float64) loginAnomaly {
+	var anomaly loginAnomaly
+	if len(histories) == 0 {
+		return anomaly
+	}
+	// 历史记录中没有设备或国家信息的（如旧数据）不参与对比
+	var deviceHistories, countryHistories int
+	knownDevice := false
+	knownCountry := false
+	for _, history := range histories {
+		if history.hasDeviceInfo() {
+			deviceHistories++
+			if sameLoginDevice(current, history) {
+				knownDevice = true
+			}
+		}
+		if history.Country != "" {
+			countryHistories++
+			if history.Country == current.Country {
+				knownCountry = true
+			}
+		}
+	}
+	anomaly.NewDevice = current.hasDeviceInfo() && deviceHistories > 0 && !knownDevice
+	anomaly.NewCountry = current.Country != "" && countryHistories > 0 && !knownCountry
+
+	last := histories[0]
+	if impossibleTravelSpeed > 0 && current.hasCoordinate() && last.hasCoordinate() {
+		distance := geoip.Distance(last.location(), current.location())
+		hours := now.Sub(time.Time(last.CreatedAt)).Hours()
+		// 距离过近的误差不计算（GeoIP精度有限）
+		if distance > 500 && (hours <= 0 || distance/hours > impossibleTravelSpeed) {
+			anomaly.ImpossibleTravel = true
+		}
+	}
+	return anomaly
+}
+
+// sameLoginDevice 是否为同一个登录设备 有设备ID的比较设备ID，否则比较设备类型、名称和型号
+func sameLoginDevice(a, b *LoginLogModel) bool {
+	if a.DeviceID != "" || b.DeviceID != "" {
+		return a.DeviceID == b.DeviceID
+	}
+	return a.DeviceFlag == b.DeviceFlag && a.DeviceModel == b.DeviceModel && a.DeviceName == b.DeviceName
+}
+
+func boolToInt(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
+
 // loginLogResp 登录日志
 type loginLogResp struct {
 	UID      string
 	CreateAt string
 	LoginIP  string
 }
+
+// loginHistoryResp 登录历史
+type loginHistoryResp struct {
+	LoginIP          string `json:"login_ip"`
+	DeviceID         string `json:"device_id"`
+	DeviceName       string `json:"device_name"`
+	DeviceModel      string `json:"device_model"`
+	DeviceFlag       int    `json:"device_flag"`
+	Country          string `json:"country"`
+	Province         string `json:"province"`
+	City             string `json:"city"`
+	NewDevice        int    `json:"new_device"`
+	NewCountry       int    `json:"new_country"`
+	ImpossibleTravel int    `json:"impossible_travel"`
+	CreatedAt        string `json:"created_at"`
+}
+
+func newLoginHistoryResp(m *LoginLogModel) *loginHistoryResp {
+	return &loginHistoryResp{
+		LoginIP:          m.LoginIP,
+		DeviceID:         m.DeviceID,
+		DeviceName:       m.DeviceName,
+		DeviceModel:      m.DeviceModel,
+		DeviceFlag:       m.DeviceFlag,
+		Country:          m.Country,
+		Province:         m.Province,
+		City:             m.City,
+		NewDevice:        m.NewDevice,
+		NewCountry:       m.NewCountry,
+		ImpossibleTravel: m.ImpossibleTravel,
+		CreatedAt:        m.CreatedAt.String(),
+	}
+}
@@ -56,8 +56,17 @@ func (u *User) onlinelistWithUIDs(c *wkhttp.Context) {
 			c.ResponseError(errors.New("查询用户在线状态失败！"))
 			return
 		}
+		hiddenUIDMap, err := u.queryLastSeenHiddenUIDs(c.GetLoginUID(), uids)
+		if err != nil {
+			u.Error("查询用户在线状态可见范围失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询用户在线状态可见范围失败！"))
+			return
+		}
 		if len(onlines) > 0 {
 			for _, online := range onlines {
+				if hiddenUIDMap[online.UID] {
+					continue
+				}
 				onlineResps = append(onlineResps, newUserOnlineResp(online))
 			}
 		}
@@ -88,6 +97,19 @@ func (u *User) onlineList(c *wkhttp.Context) {
 		c.ResponseErrorf("获取用户在线状态失败！", err)
 		return
 	}
+	hiddenUIDMap, err := u.queryLastSeenHiddenUIDs(loginUID, uids)
+	if err != nil {
+		u.Error("查询用户在线状态可见范围失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户在线状态可见范围失败！"))
+		return
+	}
+	visibleResps := make([]*config.OnlinestatusResp, 0, len(resps))
+	for _, resp := range resps {
+		if hiddenUIDMap[resp.UID] {
+			continue
+		}
+		visibleResps = append(visibleResps, resp)
+	}
 	pcOnlineB, err := u.onlineDB.exist(c.GetLoginUID(), config.PC.Uint8(), 1)
 	if err != nil {
 		c.ResponseErrorf("查询指定在线设备失败！", err)
@@ -123,11 +145,37 @@ func (u *User) onlineList(c *wkhttp.Context) {
 	}
 
 	c.Response(onlineFriendAndDeviceResp{
-		Friends: resps,
+		Friends: visibleResps,
 		PC:      pcResp,
 	})
 }
 
+// queryLastSeenHiddenUIDs 查询uids中对loginUID隐藏了在线状态和最后在线时间的用户
+func (u *User) queryLastSeenHiddenUIDs(loginUID string, uids []string) (map[string]bool, error) {
+	hiddenUIDMap := map[string]bool{}
+	if len(uids) == 0 {
+		return hiddenUIDMap, nil
+	}
+	users, err := u.db.QueryByUIDs(uids)
+	if err != nil {
+		return nil, err
+	}
+	toFriends, err := u.friendDB.queryWithToUIDAndUIDs(loginUID, uids)
+	if err != nil {
+		return nil, err
+	}
+	toFriendMap := make(map[string]bool, len(toFriends))
+	for _, toFriend := range toFriends {
+		toFriendMap[toFriend.UID] = toFriend.IsDeleted == 0
+	}
+	for _, user := range users {
+		if user.UID != loginUID && !lastSeenVisible(user.LastSeenVisibility, toFriendMap[user.UID]) {
+			hiddenUIDMap[user.UID] = true
+		}
+	}
+	return hiddenUIDMap, nil
+}
+
 func (u *User) onlineStatusCheck() {
 
 	u.Debug("开始检查在线状态...")
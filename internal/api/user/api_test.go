@@ -15,6 +15,7 @@ import (
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
 	"github.com/WuKongIM/WuKongChatServer/internal/server"
 	"github.com/WuKongIM/WuKongChatServer/internal/testutil"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
 	"github.com/WuKongIM/WuKongChatServer/pkg/util"
 	"github.com/stretchr/testify/assert"
 )
@@ -499,3 +500,104 @@ func TestUploadAvatar(t *testing.T) {
 	s.GetRoute().ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestUser_ExportApply(t *testing.T) {
+	s, ctx := testutil.NewTestServer()
+	u := New(ctx)
+	u.Route(s.GetRoute())
+	//清除数据
+	err := testutil.CleanAllTables(ctx)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/user/export", nil)
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), `"status":0`))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/user/export", nil)
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), `"id":`))
+}
+
+func TestUser_DestroyCancel(t *testing.T) {
+	s, ctx := testutil.NewTestServer()
+	u := New(ctx)
+	u.Route(s.GetRoute())
+	//清除数据
+	err := testutil.CleanAllTables(ctx)
+	assert.NoError(t, err)
+	err = u.destroyDB.insert(&destroyModel{
+		UID:     testutil.UID,
+		Status:  int(destroyStatusPending),
+		PurgeAt: time.Now().Add(time.Hour).Unix(),
+	})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/user/destroy", nil)
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), `"pending":1`))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/user/destroy/cancel", nil)
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	pending, err := u.destroyDB.queryPendingWithUID(testutil.UID)
+	assert.NoError(t, err)
+	assert.Nil(t, pending)
+}
+
+func TestUser_LoginLogList(t *testing.T) {
+	s, ctx := testutil.NewTestServer()
+	u := New(ctx)
+	u.Route(s.GetRoute())
+	//清除数据
+	err := testutil.CleanAllTables(ctx)
+	assert.NoError(t, err)
+	_, anomaly := u.loginLog.add(testutil.UID, "127.0.0.1", config.APP, &deviceReq{DeviceID: "device1", DeviceName: "iPhone"})
+	assert.False(t, anomaly.Any())
+	_, anomaly = u.loginLog.add(testutil.UID, "127.0.0.1", config.APP, &deviceReq{DeviceID: "device2", DeviceName: "Android"})
+	assert.True(t, anomaly.NewDevice)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/user/loginlog", nil)
+	req.Header.Set("token", testutil.Token)
+	s.GetRoute().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), `"device_id":"device2"`))
+	assert.Equal(t, true, strings.Contains(w.Body.String(), `"count":2`))
+}
+
+func TestDetectLoginAnomaly(t *testing.T) {
+	now := time.Now()
+	histories := []*LoginLogModel{
+		{DeviceID: "device1", Country: "CN", Latitude: 31.23, Longitude: 121.47, BaseModel: db.BaseModel{CreatedAt: db.Time(now.Add(-time.Hour * 2))}},
+	}
+	// 同设备同国家
+	anomaly := detectLoginAnomaly(&LoginLogModel{DeviceID: "device1", Country: "CN", Latitude: 39.9, Longitude: 116.4}, histories, now, 1000)
+	assert.False(t, anomaly.Any())
+	// 新设备、新国家、两小时内从上海到旧金山
+	anomaly = detectLoginAnomaly(&LoginLogModel{DeviceID: "device2", Country: "US", Latitude: 37.77, Longitude: -122.42}, histories, now, 1000)
+	assert.True(t, anomaly.NewDevice)
+	assert.True(t, anomaly.NewCountry)
+	assert.True(t, anomaly.ImpossibleTravel)
+	// 旧数据没有设备和国家信息
+	anomaly = detectLoginAnomaly(&LoginLogModel{DeviceID: "device2", Country: "US"}, []*LoginLogModel{{LoginIP: "127.0.0.1"}}, now, 1000)
+	assert.False(t, anomaly.Any())
+}
+
+func TestLastSeenVisible(t *testing.T) {
+	assert.True(t, lastSeenVisible(LastSeenVisibilityEveryone, false))
+	assert.True(t, lastSeenVisible(LastSeenVisibilityFriends, true))
+	assert.False(t, lastSeenVisible(LastSeenVisibilityFriends, false))
+	assert.False(t, lastSeenVisible(LastSeenVisibilityNobody, true))
+}
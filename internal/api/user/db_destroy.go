@@ -0,0 +1,116 @@
+package user
+
+import (
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type destroyDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newDestroyDB(ctx *config.Context) *destroyDB {
+	return &destroyDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+// insert 添加注销申请
+func (d *destroyDB) insert(m *destroyModel) error {
+	_, err := d.session.InsertInto("user_destroy").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+// queryPendingWithUID 查询用户冷静期中的注销申请
+func (d *destroyDB) queryPendingWithUID(uid string) (*destroyModel, error) {
+	var model *destroyModel
+	_, err := d.session.Select("*").From("user_destroy").Where("uid=? and status=?", uid, destroyStatusPending).OrderDir("id", false).Limit(1).Load(&model)
+	return model, err
+}
+
+// queryDue 查询冷静期已结束的注销申请
+func (d *destroyDB) queryDue(now int64, limit uint64) ([]*destroyModel, error) {
+	var models []*destroyModel
+	_, err := d.session.Select("*").From("user_destroy").Where("status=? and purge_at<=?", destroyStatusPending, now).OrderDir("id", true).Limit(limit).Load(&models)
+	return models, err
+}
+
+// updateStatus 更新注销申请状态
+func (d *destroyDB) updateStatus(id int64, status destroyStatus) error {
+	_, err := d.session.Update("user_destroy").Set("status", status).Where("id=?", id).Exec()
+	return err
+}
+
+// updateStatusTx 更新注销申请状态
+func (d *destroyDB) updateStatusTx(id int64, status destroyStatus, tx *dbr.Tx) error {
+	_, err := tx.Update("user_destroy").Set("status", status).Where("id=?", id).Exec()
+	return err
+}
+
+// insertTombstoneTx 添加注销墓碑
+func (d *destroyDB) insertTombstoneTx(uid string, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("insert ignore into user_tombstone(uid) values(?)", uid).Exec()
+	return err
+}
+
+// anonymizeTx 匿名化用户资料
+func (d *destroyDB) anonymizeTx(uid, name, username, phone string, tx *dbr.Tx) error {
+	_, err := tx.Update("user").SetMap(map[string]interface{}{
+		"name":             name,
+		"username":         username,
+		"zone":             "",
+		"phone":            phone,
+		"email":            "",
+		"sex":              0,
+		"password":         "",
+		"chat_pwd":         "",
+		"lock_screen_pwd":  "",
+		"is_upload_avatar": 0,
+		"wx_openid":        "",
+		"wx_unionid":       "",
+		"is_destroy":       1,
+	}).Where("uid=?", uid).Exec()
+	return err
+}
+
+// deleteDevicesTx 删除用户的登录设备
+func (d *destroyDB) deleteDevicesTx(uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("device").Where("uid=?", uid).Exec()
+	return err
+}
+
+// deleteSignalKeysTx 删除用户的signal key
+func (d *destroyDB) deleteSignalKeysTx(uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("signal_identities").Where("uid=?", uid).Exec()
+	if err != nil {
+		return err
+	}
+	_, err = tx.DeleteFrom("signal_onetime_prekeys").Where("uid=?", uid).Exec()
+	return err
+}
+
+// deleteMaillistTx 删除用户上传的通讯录
+func (d *destroyDB) deleteMaillistTx(uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("user_maillist").Where("uid=?", uid).Exec()
+	return err
+}
+
+type destroyStatus int
+
+const (
+	destroyStatusPending  destroyStatus = iota // 冷静期中
+	destroyStatusCanceled                      // 已撤销
+	destroyStatusPurged                        // 已清除
+)
+
+// destroyModel 注销申请
+type destroyModel struct {
+	UID     string
+	Status  int
+	PurgeAt int64
+	db.BaseModel
+}
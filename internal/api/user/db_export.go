@@ -0,0 +1,186 @@
+package user
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/internal/config"
+	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/util"
+	"github.com/gocraft/dbr/v2"
+)
+
+type exportDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newExportDB(ctx *config.Context) *exportDB {
+	return &exportDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+// insert 添加导出任务
+func (e *exportDB) insert(m *exportModel) (int64, error) {
+	result, err := e.session.InsertInto("user_export").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// updateStatus 更新导出任务状态
+func (e *exportDB) updateStatus(id int64, status exportStatus, path string, size int64, failReason string) error {
+	_, err := e.session.Update("user_export").SetMap(map[string]interface{}{
+		"status":      status,
+		"path":        path,
+		"size":        size,
+		"fail_reason": failReason,
+	}).Where("id=?", id).Exec()
+	return err
+}
+
+// queryPending 查询等待中和已中断（导出中但超时）的导出任务
+func (e *exportDB) queryPending(timeout time.Duration, limit uint64) ([]*exportModel, error) {
+	var models []*exportModel
+	_, err := e.session.Select("*").From("user_export").Where("status=? or (status=? and updated_at<DATE_SUB(NOW(),INTERVAL ? SECOND))", exportStatusWait, exportStatusProcessing, int64(timeout.Seconds())).OrderDir("id", true).Limit(limit).Load(&models)
+	return models, err
+}
+
+// claim 将导出任务标记为导出中 返回false表示任务已被执行
+func (e *exportDB) claim(id int64, timeout time.Duration) (bool, error) {
+	result, err := e.session.Update("user_export").SetMap(map[string]interface{}{
+		"status":     exportStatusProcessing,
+		"updated_at": dbr.Expr("NOW()"),
+	}).Where("id=? and (status=? or (status=? and updated_at<DATE_SUB(NOW(),INTERVAL ? SECOND)))", id, exportStatusWait, exportStatusProcessing, int64(timeout.Seconds())).Exec()
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// queryLastWithUID 查询用户最近一次导出任务
+func (e *exportDB) queryLastWithUID(uid string) (*exportModel, error) {
+	var model *exportModel
+	_, err := e.session.Select("*").From("user_export").Where("uid=?", uid).OrderDir("id", false).Limit(1).Load(&model)
+	return model, err
+}
+
+// queryWithID 通过id查询导出任务
+func (e *exportDB) queryWithID(id int64) (*exportModel, error) {
+	var model *exportModel
+	_, err := e.session.Select("*").From("user_export").Where("id=?", id).Load(&model)
+	return model, err
+}
+
+// querySettings 查询用户的所有设置
+func (e *exportDB) querySettings(uid string) ([]*SettingModel, error) {
+	var models []*SettingModel
+	_, err := e.session.Select("*").From("user_setting").Where("uid=?", uid).Load(&models)
+	return models, err
+}
+
+// queryFriends 查询用户的好友关系（包含已删除）
+func (e *exportDB) queryFriends(uid string) ([]*FriendModel, error) {
+	var models []*FriendModel
+	_, err := e.session.Select("*").From("friend").Where("uid=?", uid).Load(&models)
+	return models, err
+}
+
+// queryGroups 查询用户加入的群
+func (e *exportDB) queryGroups(uid string) ([]*exportGroupModel, error) {
+	var models []*exportGroupModel
+	_, err := e.session.Select("group_member.group_no,IFNULL(`group`.name,'') name,group_member.role,group_member.remark,group_member.created_at").From("group_member").LeftJoin("group", "group_member.group_no=`group`.group_no").Where("group_member.uid=? and group_member.is_deleted=0", uid).Load(&models)
+	return models, err
+}
+
+// queryLoginLogs 查询用户登录日志
+func (e *exportDB) queryLoginLogs(uid string) ([]*LoginLogModel, error) {
+	var models []*LoginLogModel
+	_, err := e.session.Select("*").From("login_log").Where("uid=?", uid).OrderDir("id", true).Load(&models)
+	return models, err
+}
+
+// queryFavorites 查询用户收藏
+func (e *exportDB) queryFavorites(uid string) ([]*exportFavoriteModel, error) {
+	var models []*exportFavoriteModel
+	_, err := e.session.Select("*").From("favorite").Where("uid=?", uid).OrderDir("id", true).Load(&models)
+	return models, err
+}
+
+// queryMessages 查询用户在某个消息分表内发送的消息
+func (e *exportDB) queryMessages(table string, uid string, lastID int64, limit uint64) ([]*exportMessageModel, error) {
+	var models []*exportMessageModel
+	_, err := e.session.Select("id,message_id,message_seq,client_msg_no,from_uid,channel_id,channel_type,timestamp,payload,is_deleted,created_at").From(table).Where("from_uid=? and id>?", uid, lastID).OrderDir("id", true).Limit(limit).Load(&models)
+	return models, err
+}
+
+// messageTables 所有消息分表
+func (e *exportDB) messageTables() []string {
+	count := e.ctx.GetConfig().TablePartitionConfig.MessageTableCount
+	tables := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if i == 0 {
+			tables = append(tables, "message")
+			continue
+		}
+		tables = append(tables, fmt.Sprintf("message%d", i))
+	}
+	return tables
+}
+
+type exportStatus int
+
+const (
+	exportStatusWait       exportStatus = iota // 等待中
+	exportStatusProcessing                     // 导出中
+	exportStatusSuccess                        // 已完成
+	exportStatusFail                           // 失败
+)
+
+// exportModel 导出任务
+type exportModel struct {
+	UID        string
+	Status     int
+	Path       string
+	Size       int64
+	FailReason string
+	db.BaseModel
+}
+
+type exportGroupModel struct {
+	GroupNo   string
+	Name      string
+	Role      int
+	Remark    string
+	CreatedAt db.Time
+}
+
+type exportFavoriteModel struct {
+	Type       int
+	UniqueKey  string
+	AuthorUID  string
+	AuthorName string
+	Payload    string
+	db.BaseModel
+}
+
+type exportMessageModel struct {
+	Id          int64
+	MessageID   int64
+	MessageSeq  uint32
+	ClientMsgNo string
+	FromUID     string
+	ChannelID   string
+	ChannelType uint8
+	Timestamp   int64
+	Payload     []byte
+	IsDeleted   int
+	CreatedAt   db.Time
+}
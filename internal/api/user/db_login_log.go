@@ -2,6 +2,7 @@ package user
 
 import (
 	"github.com/WuKongIM/WuKongChatServer/pkg/db"
+	"github.com/WuKongIM/WuKongChatServer/pkg/geoip"
 	"github.com/WuKongIM/WuKongChatServer/pkg/util"
 	"github.com/gocraft/dbr/v2"
 )
@@ -34,9 +35,60 @@ func (l *LoginLogDB) queryLastLoginIP(uid string) (*LoginLogModel, error) {
 	return model, nil
 }
 
+// queryRecent 查询用户最近的登录日志
+func (l *LoginLogDB) queryRecent(uid string, limit uint64) ([]*LoginLogModel, error) {
+	var models []*LoginLogModel
+	_, err := l.session.Select("*").From("login_log").Where("uid=?", uid).OrderDir("id", false).Limit(limit).Load(&models)
+	return models, err
+}
+
+// queryWithPage 分页查询用户登录日志
+func (l *LoginLogDB) queryWithPage(uid string, pageSize, page uint64) ([]*LoginLogModel, error) {
+	var models []*LoginLogModel
+	_, err := l.session.Select("*").From("login_log").Where("uid=?", uid).OrderDir("id", false).Offset((page - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// queryCount 查询用户登录日志数量
+func (l *LoginLogDB) queryCount(uid string) (int64, error) {
+	var count int64
+	_, err := l.session.Select("count(*)").From("login_log").Where("uid=?", uid).Load(&count)
+	return count, err
+}
+
 // LoginLogModel 登录日志
 type LoginLogModel struct {
-	LoginIP string //登录IP
-	UID     string
+	LoginIP          string //登录IP
+	UID              string
+	DeviceID         string  // 设备ID
+	DeviceName       string  // 设备名称
+	DeviceModel      string  // 设备型号
+	DeviceFlag       int     // 设备标记
+	Country          string  // 国家代码
+	Province         string  // 省/州
+	City             string  // 城市
+	Latitude         float64 // 纬度
+	Longitude        float64 // 经度
+	NewDevice        int     // 是否新设备
+	NewCountry       int     // 是否新国家
+	ImpossibleTravel int     // 是否异常位移
 	db.BaseModel
 }
+
+func (m *LoginLogModel) hasDeviceInfo() bool {
+	return m.DeviceID != "" || m.DeviceName != "" || m.DeviceModel != ""
+}
+
+func (m *LoginLogModel) hasCoordinate() bool {
+	return m.location().HasCoordinate()
+}
+
+func (m *LoginLogModel) location() *geoip.Location {
+	return &geoip.Location{
+		Country:   m.Country,
+		Province:  m.Province,
+		City:      m.City,
+		Latitude:  m.Latitude,
+		Longitude: m.Longitude,
+	}
+}
@@ -15,6 +15,24 @@ import (
 
 var ErrorUserNotExist = errors.New("用户不存在！")
 
+// 最后在线时间可见范围
+const (
+	LastSeenVisibilityEveryone = 0 // 所有人可见
+	LastSeenVisibilityFriends  = 1 // 仅好友可见
+	LastSeenVisibilityNobody   = 2 // 所有人不可见
+)
+
+// lastSeenVisible 对方是否可以看到用户的在线状态和最后在线时间 isFriend表示用户是否把对方加为好友
+func lastSeenVisible(visibility int, isFriend bool) bool {
+	switch visibility {
+	case LastSeenVisibilityFriends:
+		return isFriend
+	case LastSeenVisibilityNobody:
+		return false
+	}
+	return true
+}
+
 // IService 用户服务接口
 type IService interface {
 	//获取用户
@@ -216,6 +234,11 @@ func (s *Service) GetUserDetail(uid string, loginUID string) (*UserDetailResp, e
 	if toUserSetting != nil {
 		beBlacklist = toUserSetting.Blacklist
 	}
+	if uid != loginUID && !lastSeenVisible(model.LastSeenVisibility, toFriend != nil && toFriend.IsDeleted == 0) {
+		online = 0
+		lastOffline = 0
+		deviceFlag = 0
+	}
 	return NewUserDetailResp(model, remark, loginUID, sourceFrom, online, lastOffline, deviceFlag, follow, blacklist, beDeleted, beBlacklist, userSetting, vercode), nil
 }
 
@@ -296,7 +319,7 @@ func (s *Service) GetUserDetails(uids []string, loginUID string) ([]*UserDetailR
 		return nil, err
 	}
 	toFriendMap := map[string]*FriendModel{}
-	if len(friends) > 0 {
+	if len(toFriends) > 0 {
 		for _, toFriend := range toFriends {
 			toFriendMap[toFriend.UID] = toFriend
 		}
@@ -351,6 +374,11 @@ func (s *Service) GetUserDetails(uids []string, loginUID string) ([]*UserDetailR
 		} else {
 			beDeleted = 1
 		}
+		if uid != loginUID && !lastSeenVisible(userDetail.LastSeenVisibility, beDeleted == 0) {
+			online = 0
+			lastOffline = 0
+			deviceFlag = 0
+		}
 		userDetailResps = append(userDetailResps, NewUserDetailResp(userDetail, nameRemark, loginUID, sourceFrom, online, lastOffline, deviceFlag, follow, status, beDeleted, beBlacklist, setting, vercode))
 	}
 
@@ -696,24 +724,30 @@ func (s *Service) ExistBlacklist(uid string, toUID string) (bool, error) {
 
 // Resp 用户返回
 type Resp struct {
-	UID            string
-	Name           string
-	Zone           string
-	Phone          string
-	Email          string
-	IsUploadAvatar int
-	NewMsgNotice   int
+	UID             string
+	Name            string
+	Zone            string
+	Phone           string
+	Email           string
+	IsUploadAvatar  int
+	NewMsgNotice    int
+	Language        string // 偏好语言
+	ReadReceipt     int    // 是否发送已读回执
+	TypingIndicator int    // 是否发送输入中状态
 }
 
 func newResp(m *Model) *Resp {
 	return &Resp{
-		UID:            m.UID,
-		Name:           m.Name,
-		Zone:           m.Zone,
-		Phone:          m.Phone,
-		Email:          m.Email,
-		IsUploadAvatar: m.IsUploadAvatar,
-		NewMsgNotice:   m.NewMsgNotice,
+		UID:             m.UID,
+		Name:            m.Name,
+		Zone:            m.Zone,
+		Phone:           m.Phone,
+		Email:           m.Email,
+		IsUploadAvatar:  m.IsUploadAvatar,
+		NewMsgNotice:    m.NewMsgNotice,
+		Language:        m.Language,
+		ReadReceipt:     m.ReadReceipt,
+		TypingIndicator: m.TypingIndicator,
 	}
 }
 
@@ -763,6 +797,8 @@ type SettingResp struct {
 	RevokeRemind int    //撤回提醒
 	Blacklist    int    //黑名单
 	Receipt      int    //消息是否回执
+	Flame        int    // 是否开启阅后即焚
+	FlameSecond  int    // 阅后即焚秒数
 	Version      int64  // 版本
 }
 
@@ -784,6 +820,8 @@ func toSettingResp(m *SettingModel) *SettingResp {
 		RevokeRemind: m.RevokeRemind,
 		Blacklist:    m.Blacklist,
 		Receipt:      m.Receipt,
+		Flame:        m.Flame,
+		FlameSecond:  m.FlameSecond,
 		Version:      m.Version,
 	}
 }
@@ -50,15 +50,23 @@ func (u *User) handleOnlineStatus(onlineStatuses []config.OnlineStatus) {
 			u.Error("获取好友uid集合失败！", zap.Error(err))
 			return
 		}
+		userM, err := u.db.QueryByUID(onlineStatus.UID)
+		if err != nil {
+			u.Error("查询用户信息失败！", zap.Error(err), zap.String("uid", onlineStatus.UID))
+			continue
+		}
+		if userM != nil && !lastSeenVisible(userM.LastSeenVisibility, true) { // 好友集合都是该用户自己加的好友 只有所有人不可见时不通知
+			friendUids = make([]string, 0)
+		}
+		if onlineStatus.DeviceFlag != config.APP.Uint8() { // 如果是pc端或web端，则通知到自己的其他设备
+			friendUids = append(friendUids, onlineStatus.UID) // 如果是pc端或web端在线，则消息也推送给在线者的其他设备
+		}
 
 		if len(friendUids) > 0 {
 			var online int
 			if onlineStatus.Online {
 				online = 1
 			}
-			if onlineStatus.DeviceFlag != config.APP.Uint8() { // 如果是pc端或web端，则通知到自己的其他设备
-				friendUids = append(friendUids, onlineStatus.UID) // 如果是pc端或web端在线，则消息也推送给在线者的其他设备
-			}
 			param := map[string]interface{}{
 				"online":      online,
 				"device_flag": onlineStatus.DeviceFlag,
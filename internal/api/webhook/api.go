@@ -35,6 +35,7 @@ type Webhook struct {
 	pushMap          map[common.DeviceType]map[string]Push
 	groupService     group.IService
 	userService      user.IService
+	transcriptWaiter chan struct{} // 限制同时等待语音转写结果的推送数量
 	wkhook.UnimplementedWebhookServiceServer
 }
 
@@ -70,18 +71,19 @@ func New(ctx *config.Context) *Webhook {
 		},
 	}
 	return &Webhook{
-		db:           NewDB(ctx.DB()),
-		supportTypes: supportTypes,
-		ctx:          ctx,
-		Log:          log.NewTLog("Webhook"),
-		pushMap:      pushMap,
-		messageDB:    newMessageDB(ctx),
-		groupService: group.NewService(ctx),
-		userService:  user.NewService(ctx),
+		db:               NewDB(ctx.DB()),
+		supportTypes:     supportTypes,
+		ctx:              ctx,
+		Log:              log.NewTLog("Webhook"),
+		pushMap:          pushMap,
+		messageDB:        newMessageDB(ctx),
+		groupService:     group.NewService(ctx),
+		userService:      user.NewService(ctx),
+		transcriptWaiter: make(chan struct{}, 100),
 	}
 }
 func getSupportTypes() []common.ContentType {
-	return []common.ContentType{common.Text, common.Image, common.GIF, common.Voice, common.Video, common.File, common.Location, common.Card, common.RedPacket, common.MultipleForward, common.VectorSticker, common.EmojiSticker}
+	return []common.ContentType{common.Text, common.Image, common.GIF, common.Voice, common.Video, common.File, common.Location, common.Card, common.RedPacket, common.MultipleForward, common.VectorSticker, common.EmojiSticker, common.Poll}
 }
 
 // Route 路由配置
@@ -310,6 +312,7 @@ func (w *Webhook) handleMsgOffline(data []byte) error {
 func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 	setting := config.SettingFromUint8(msgResp.Setting)
 	isVideoCall := false
+	isAnnouncement := false
 	if !setting.Signal { // 只解析未加密的消息
 		contentMap, err := util.JsonToMap(string(msgResp.Payload))
 		if err != nil {
@@ -323,8 +326,30 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 		contentTypeInt64, _ := contentMap["type"].(json.Number).Int64()
 		contentType := common.ContentType(contentTypeInt64)
 		msgResp.ContentType = int(contentType)
+		// 只有系统发出的群公告才忽略免打扰 防止成员伪造公告类型绕过免打扰
+		isAnnouncement = contentType == common.GroupAnnouncement && (msgResp.FromUID == "" || msgResp.FromUID == w.ctx.GetConfig().SystemUID)
+		if contentType == common.Voice && w.ctx.GetConfig().TranscribeProvider != "" { // 语音消息等待转写结果 推送内容显示转写的文本
+			select {
+			case w.transcriptWaiter <- struct{}{}:
+				go func() {
+					defer func() {
+						<-w.transcriptWaiter
+					}()
+					msgResp.Transcript = w.waitVoiceTranscript(msgResp.MessageID)
+					err := w.pushToUsers(msgResp, toUids, isVideoCall, isAnnouncement)
+					if err != nil {
+						w.Warn("推送语音消息失败！", zap.Error(err))
+					}
+				}()
+				return nil
+			default: // 等待的推送太多 直接推送不显示转写文本
+			}
+		}
 	}
+	return w.pushToUsers(msgResp, toUids, isVideoCall, isAnnouncement)
+}
 
+func (w *Webhook) pushToUsers(msgResp msgOfflineNotify, toUids []string, isVideoCall bool, isAnnouncement bool) error {
 	var err error
 	var users []*user.Resp
 	userSettings := make([]*user.SettingResp, 0)
@@ -360,9 +385,20 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 
 	for _, toUID := range toUids {
 		if !isVideoCall {
-			if !w.allowPush(users, userSettings, groupSettings, toUID) {
+			pushGroupSettings := groupSettings
+			if isAnnouncement { // 群公告忽略群免打扰
+				pushGroupSettings = nil
+			}
+			if !w.allowPush(users, userSettings, pushGroupSettings, toUID) {
 				continue
 			}
+			// 有红点的消息才计入未读 免打扰的会话不计入（与清除未读后重新计算的红点保持一致）
+			if msgResp.Header.RedDot == 1 && !isGroupMuted(groupSettings, toUID) {
+				err = increaseUserBadge(toUID, w.ctx)
+				if err != nil {
+					w.Warn("增加用户红点失败！", zap.Error(err), zap.String("uid", toUID))
+				}
+			}
 		} else {
 			w.Info("开始音视频推送...")
 		}
@@ -389,6 +425,25 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 	return nil
 }
 
+// waitVoiceTranscript 等待语音转写结果 转写完成（成功或失败）或超时后返回
+func (w *Webhook) waitVoiceTranscript(messageID int64) string {
+	deadline := time.Now().Add(w.ctx.GetConfig().TranscribePushWait)
+	for {
+		transcriptM, err := w.messageDB.queryTranscript(messageID)
+		if err != nil {
+			w.Warn("查询语音转写结果失败！", zap.Error(err))
+			return ""
+		}
+		if transcriptM != nil && (transcriptM.TranscriptStatus == transcriptStatusSuccess || transcriptM.TranscriptStatus == transcriptStatusFail) {
+			return transcriptM.Transcript
+		}
+		if time.Now().After(deadline) {
+			return ""
+		}
+		time.Sleep(time.Millisecond * 500)
+	}
+}
+
 // 是否允许推送
 func (w *Webhook) allowPush(users []*user.Resp, userSettings []*user.SettingResp, groupSettings []*group.SettingResp, toUID string) bool {
 	isPush := true
@@ -426,6 +481,16 @@ func (w *Webhook) allowPush(users []*user.Resp, userSettings []*user.SettingResp
 	return isPush
 }
 
+// isGroupMuted 用户是否设置了群免打扰
+func isGroupMuted(groupSettings []*group.SettingResp, uid string) bool {
+	for _, groupSetting := range groupSettings {
+		if groupSetting.UID == uid {
+			return groupSetting.Mute == 1
+		}
+	}
+	return false
+}
+
 func (w *Webhook) push(toUID string, msgResp msgOfflineNotify) (pushResp, error) {
 
 	var deviceMap map[string]string
@@ -519,23 +584,46 @@ func (m *MsgResp) toModel() *messageModel {
 	setting := config.SettingFromUint8(m.Setting)
 
 	var signal uint8 = 0
+	var rootMessageID string
 	if setting.Signal {
 		signal = 1
+	} else {
+		rootMessageID = getRootMessageID(m.Payload)
 	}
 	return &messageModel{
-		MessageID:   fmt.Sprintf("%d", m.MessageID),
-		MessageSeq:  int64(m.MessageSeq),
-		ClientMsgNo: m.ClientMsgNo,
-		Header:      util.ToJson(m.Header),
-		Setting:     m.Setting,
-		Signal:      signal,
-		FromUID:     m.FromUID,
-		ChannelID:   m.ChannelID,
-		ChannelType: m.ChannelType,
-		Timestamp:   m.Timestamp,
-		Payload:     string(m.Payload),
-		IsDeleted:   0,
+		MessageID:     fmt.Sprintf("%d", m.MessageID),
+		MessageSeq:    int64(m.MessageSeq),
+		ClientMsgNo:   m.ClientMsgNo,
+		Header:        util.ToJson(m.Header),
+		Setting:       m.Setting,
+		Signal:        signal,
+		FromUID:       m.FromUID,
+		ChannelID:     m.ChannelID,
+		ChannelType:   m.ChannelType,
+		Timestamp:     m.Timestamp,
+		Payload:       string(m.Payload),
+		IsDeleted:     0,
+		RootMessageID: rootMessageID,
+	}
+}
+
+// getRootMessageID 获取话题回复消息的根消息ID
+func getRootMessageID(payload []byte) string {
+	if len(payload) == 0 {
+		return ""
+	}
+	var payloadMap map[string]interface{}
+	if err := util.ReadJsonByByte(payload, &payloadMap); err != nil {
+		return ""
+	}
+	if payloadMap["root_message_id"] == nil {
+		return ""
+	}
+	rootMessageID := strings.TrimSpace(fmt.Sprintf("%v", payloadMap["root_message_id"]))
+	if _, err := strconv.ParseInt(rootMessageID, 10, 64); err != nil {
+		return ""
 	}
+	return rootMessageID
 }
 
 func (m *MsgResp) toConfigMessageResp() *config.MessageResp {
@@ -563,6 +651,7 @@ type msgOfflineNotify struct {
 	Compress        string   `json:"compress,omitempty"`         // 压缩ToUIDs 如果为空 表示不压缩 为gzip则采用gzip压缩
 	CompresssToUIDs []byte   `json:"compress_to_uids,omitempty"` // 已压缩的to_uids
 	SourceID        int64    `json:"source_id,omitempty"`        // 来源节点ID
+	Transcript      string   `json:"-"`                          // 语音转写的文本
 }
 
 type pushResp struct {
@@ -41,6 +41,8 @@ func (w *Webhook) datasource(c *wkhttp.Context) {
 		result, err = w.getWhitelist(cmdReq.Data)
 	case "getSystemUIDs":
 		result, err = w.getSystemUIDs()
+	case "checkSend":
+		result, err = w.checkSend(cmdReq.Data)
 	}
 
 	if err != nil {
@@ -170,6 +172,24 @@ func (w *Webhook) getSystemUIDs() ([]string, error) {
 	return uids, nil
 }
 
+// checkSend 检查发送者是否可以在频道内发送此消息（群慢速模式、新成员观察期）
+// WuKongIM的数据源默认不会请求此命令 客户端直接发给IM的消息需要IM在投递前以cmd=checkSend请求数据源（allow=false时拒绝投递）
+// 服务端代发的消息（定时消息、转发、话题回复、投票）在发送前通过message.IService.CheckSend检查
+func (w *Webhook) checkSend(data map[string]interface{}) (*group.CheckSendResp, error) {
+	var req struct {
+		ChannelReq
+		FromUID string `json:"from_uid"`
+		Payload []byte `json:"payload"`
+	}
+	if err := util.ReadJsonByByte([]byte(util.ToJson(data)), &req); err != nil {
+		return nil, err
+	}
+	if req.ChannelType != common.ChannelTypeGroup.Uint8() || req.FromUID == "" {
+		return &group.CheckSendResp{Allow: true}, nil
+	}
+	return w.groupService.CheckSend(group.NewCheckSendReq(req.ChannelID, req.FromUID, req.Payload))
+}
+
 type ChannelReq struct {
 	ChannelID   string `json:"channel_id"`
 	ChannelType uint8  `json:"channel_type"`
@@ -3,6 +3,7 @@ package webhook
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/WuKongIM/WuKongChatServer/internal/common"
 	"github.com/WuKongIM/WuKongChatServer/internal/config"
@@ -125,6 +126,9 @@ func getMessageAlert(msg msgOfflineNotify, ctx *config.Context) (string, error)
 		alert = "[GIF]"
 	case common.Voice:
 		alert = "[语音]"
+		if msg.Transcript != "" {
+			alert = fmt.Sprintf("[语音]%s", msg.Transcript)
+		}
 	case common.Video:
 		alert = "[视频]"
 	case common.Card:
@@ -143,6 +147,11 @@ func getMessageAlert(msg msgOfflineNotify, ctx *config.Context) (string, error)
 		alert = "[emoji表情]"
 	case common.MultipleForward:
 		alert = "[聊天记录]"
+	case common.Poll:
+		alert = "[投票]"
+		if title, ok := msg.PayloadMap["title"].(string); ok && title != "" {
+			alert = fmt.Sprintf("[投票]%s", title)
+		}
 	}
 	return alert, nil
 }
@@ -251,11 +260,22 @@ func getAndCacheGroupName(msgResp msgOfflineNotify, ctx *config.Context) (string
 	return groupName, nil
 }
 
+// getUserBadge 获取用户红点（由服务端根据未读数维护）
 func getUserBadge(uid string, ctx *config.Context) (int, error) {
-	badge, err := ctx.GetRedisConn().Hincrby(common.UserDeviceBadgePrefix, uid, 1)
+	badgeStr, err := ctx.GetRedisConn().Hget(common.UserDeviceBadgePrefix, uid)
 	if err != nil {
 		log.Error("获取红点数失败！", zap.Error(err))
 		return 0, err
 	}
-	return int(badge), nil
+	if badgeStr == "" {
+		return 0, nil
+	}
+	badge, _ := strconv.Atoi(badgeStr)
+	return badge, nil
+}
+
+// increaseUserBadge 新消息到达时增加用户红点
+func increaseUserBadge(uid string, ctx *config.Context) error {
+	_, err := ctx.GetRedisConn().Hincrby(common.UserDeviceBadgePrefix, uid, 1)
+	return err
 }
@@ -24,10 +24,27 @@ func newMessageDB(ctx *config.Context) *messageDB {
 
 func (m *messageDB) insertOrUpdateTx(model *messageModel, tx *dbr.Tx) error {
 	tbl := m.getTable(model.ChannelID)
-	_, err := tx.InsertBySql(fmt.Sprintf("insert into %s(message_id,message_seq,client_msg_no,header,setting,`signal`,from_uid,channel_id,channel_type,timestamp,payload,is_deleted) values(?,?,?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE payload=payload", tbl), model.MessageID, model.MessageSeq, model.ClientMsgNo, model.Header, model.Setting, model.Signal, model.FromUID, model.ChannelID, model.ChannelType, model.Timestamp, model.Payload, model.IsDeleted).Exec()
+	_, err := tx.InsertBySql(fmt.Sprintf("insert into %s(message_id,message_seq,client_msg_no,header,setting,`signal`,from_uid,channel_id,channel_type,timestamp,payload,is_deleted,root_message_id) values(?,?,?,?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE payload=payload", tbl), model.MessageID, model.MessageSeq, model.ClientMsgNo, model.Header, model.Setting, model.Signal, model.FromUID, model.ChannelID, model.ChannelType, model.Timestamp, model.Payload, model.IsDeleted, model.RootMessageID).Exec()
 	return err
 }
 
+// 查询语音转写的结果和状态
+func (m *messageDB) queryTranscript(messageID int64) (*transcriptModel, error) {
+	var model *transcriptModel
+	_, err := m.db.Select("IFNULL(transcript,'') transcript,transcript_status").From("message_extra").Where("message_id=?", messageID).Load(&model)
+	return model, err
+}
+
+const (
+	transcriptStatusSuccess = 1 // 转写成功
+	transcriptStatusFail    = 2 // 转写失败
+)
+
+type transcriptModel struct {
+	Transcript       string // 语音转写的文本
+	TranscriptStatus int    // 语音转写状态 0.未转写 1.转写成功 2.转写失败 3.转写中
+}
+
 // 通过频道ID获取表
 func (m *messageDB) getTable(channelID string) string {
 	tableIndex := crc32.ChecksumIEEE([]byte(channelID)) % uint32(m.ctx.GetConfig().TablePartitionConfig.MessageTableCount)
@@ -38,17 +55,18 @@ func (m *messageDB) getTable(channelID string) string {
 }
 
 type messageModel struct {
-	MessageID   string
-	MessageSeq  int64
-	ClientMsgNo string
-	Header      string
-	Setting     uint8
-	Signal      uint8 // 是否signal加密
-	FromUID     string
-	ChannelID   string
-	ChannelType uint8
-	Timestamp   int32
-	Payload     string
-	IsDeleted   int
+	MessageID     string
+	MessageSeq    int64
+	ClientMsgNo   string
+	Header        string
+	Setting       uint8
+	Signal        uint8 // 是否signal加密
+	FromUID       string
+	ChannelID     string
+	ChannelType   uint8
+	Timestamp     int32
+	Payload       string
+	IsDeleted     int
+	RootMessageID string // 话题根消息ID（话题回复消息才有值）
 	db.BaseModel
 }
@@ -103,7 +103,7 @@ func (h *HMSPush) Push(deviceToken string, payload Payload) error {
 						"type": 3,
 					},
 					"badge": map[string]interface{}{
-						"add_num": 1,
+						"set_num": payload.GetBadge(),
 						"class":   fmt.Sprintf("%s%s", h.packageName, ".MainActivity"),
 					},
 				},
@@ -74,6 +74,9 @@ func (v *VIVOPush) Push(deviceToken string, payload Payload) error {
 		"classification": "1",
 		"pushMode":       "1",
 		"requestId":      util.GenerUUID(),
+		"clientCustomMap": map[string]string{
+			"badge": fmt.Sprintf("%d", vivoPayload.GetBadge()),
+		},
 	})), map[string]string{
 		"authToken": authToken,
 	})
@@ -83,6 +83,14 @@ const (
 	MessageExtraSeqKey = "messageExtra"
 	// MessageReactionSeqKey 消息回应序号
 	MessageReactionSeqKey = "messageReaction"
+	// PinnedMessageSeqKey 置顶消息序号
+	PinnedMessageSeqKey = "pinnedMessage"
+	// ThreadSeqKey 话题序号
+	ThreadSeqKey = "thread"
+	// FavoriteSeqKey 收藏序号
+	FavoriteSeqKey = "favorite"
+	// LabelSeqKey 标签序号
+	LabelSeqKey = "label"
 	// RobotSeqKey 机器人序号
 	RobotSeqKey = "robot"
 	// RobotEventSeqKey 机器人事件序号
@@ -111,8 +119,16 @@ const (
 	GroupAttrKeyForbiddenAddFriend = "forbidden_add_friend"
 	// GroupAttrKeyStatus 群状态
 	GroupAttrKeyStatus = "status"
+	// GroupAttrKeyJoinMode 入群方式
+	GroupAttrKeyJoinMode = "join_mode"
+	// GroupAttrKeySlowMode 慢速模式（每位成员发言间隔秒数）
+	GroupAttrKeySlowMode = "slow_mode"
+	// GroupAttrKeyNewMemberProbation 新成员观察期（秒）观察期内不能发送链接和媒体消息
+	GroupAttrKeyNewMemberProbation = "new_member_probation"
 	// GroupAllowViewHistoryMsg 是否允许新成员查看历史消息
 	GroupAllowViewHistoryMsg = "allow_view_history_msg"
+	// GroupAttrKeyForbiddenForward 禁止转发和保存群消息
+	GroupAttrKeyForbiddenForward = "forbidden_forward"
 )
 
 // 命令消息
@@ -157,6 +173,18 @@ const (
 	CMDSyncReminders = "syncReminders"
 	// 同步最近会话扩展
 	CMDSyncConversationExtra = "syncConversationExtra"
+	// 同步置顶消息
+	CMDSyncPinnedMessage = "syncPinnedMessage"
+	// 同步话题
+	CMDSyncThread = "syncThread"
+	// 同步收藏
+	CMDSyncFavorite = "syncFavorite"
+	// 同步标签
+	CMDSyncLabel = "syncLabel"
+	// 入群申请
+	CMDGroupJoinRequest = "groupJoinRequest"
+	// 群公告更新
+	CMDGroupAnnouncementUpdate = "groupAnnouncementUpdate"
 )
 
 // UserDeviceTokenPrefix 用户设备token缓存前缀
@@ -311,3 +339,16 @@ const (
 	RTCResultTypeMissed RTCResultType = 2 // 未接听
 	RTCResultTypeRefuse RTCResultType = 3 // 拒绝接听
 )
+
+// supportedLanguages 支持的偏好语言代码（消息翻译、语音转写使用）
+var supportedLanguages = map[string]bool{
+	"zh": true, "zh-CN": true, "zh-TW": true, "en": true, "ja": true, "ko": true,
+	"fr": true, "de": true, "es": true, "it": true, "pt": true, "ru": true,
+	"ar": true, "th": true, "vi": true, "id": true, "ms": true, "tr": true,
+	"hi": true, "nl": true, "pl": true, "uk": true,
+}
+
+// IsSupportedLanguage 是否是支持的语言代码
+func IsSupportedLanguage(lang string) bool {
+	return supportedLanguages[lang]
+}
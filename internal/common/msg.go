@@ -41,6 +41,8 @@ const (
 	VectorSticker ContentType = 12
 	// EmojiSticker 矢量emoji表情
 	EmojiSticker ContentType = 13
+	// Poll 投票
+	Poll ContentType = 14
 
 	// 消息正文错误
 	ContentError ContentType = 97
@@ -79,6 +81,10 @@ const (
 	GroupMemberQuit ContentType = 1021
 	// 群升级
 	GroupUpgrade ContentType = 1022
+	// PinnedMessage 置顶消息
+	PinnedMessage ContentType = 1023
+	// GroupAnnouncement 群公告
+	GroupAnnouncement ContentType = 1024
 
 	// ---------- 红包类 ----------
 
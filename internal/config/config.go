@@ -42,17 +42,63 @@ func (u UploadService) String() string {
 }
 
 type TablePartitionConfig struct {
-	MessageTableCount         int // 消息表数量
-	MessageUserEditTableCount int // 用户消息编辑表
-	ChannelOffsetTableCount   int // 频道偏移表
+	MessageTableCount            int // 消息表数量
+	MessageUserEditTableCount    int // 用户消息编辑表
+	ChannelOffsetTableCount      int // 频道偏移表
+	MessageTranslationTableCount int // 消息翻译表
 }
 
 func newTablePartitionConfig() TablePartitionConfig {
 
 	return TablePartitionConfig{
-		MessageTableCount:         5,
-		MessageUserEditTableCount: 3,
-		ChannelOffsetTableCount:   3,
+		MessageTableCount:            5,
+		MessageUserEditTableCount:    3,
+		ChannelOffsetTableCount:      3,
+		MessageTranslationTableCount: 3,
+	}
+}
+
+// RateLimitConfig 限流配置
+type RateLimitConfig struct {
+	Key    string        // 限流维度 ip uid phone device
+	Limit  int           // 窗口内允许的请求次数
+	Window time.Duration // 窗口大小
+}
+
+func newRateLimits() map[string][]RateLimitConfig {
+
+	return map[string][]RateLimitConfig{
+		// 图形验证（生成验证图片开销较大且未登录可访问）
+		"common.captcha": {
+			{Key: "phone", Limit: 10, Window: time.Minute},
+			{Key: "ip", Limit: 60, Window: time.Minute},
+		},
+		// 注册短信验证码
+		"sms.registercode": {
+			{Key: "phone", Limit: 1, Window: time.Minute},
+			{Key: "ip", Limit: 20, Window: time.Hour},
+		},
+		// 登录
+		"user.login": {
+			{Key: "phone", Limit: 10, Window: time.Minute * 10},
+			{Key: "ip", Limit: 60, Window: time.Minute},
+		},
+		// 搜索用户（未登录也可访问 按IP限流）
+		"user.search": {
+			{Key: "ip", Limit: 30, Window: time.Minute},
+		},
+		// 输入中
+		"message.typing": {
+			{Key: "uid", Limit: 60, Window: time.Minute},
+		},
+		// 翻译消息（调用付费的翻译服务）
+		"message.translate": {
+			{Key: "uid", Limit: 20, Window: time.Minute},
+		},
+		// 链接预览
+		"message.linkpreview": {
+			{Key: "uid", Limit: 30, Window: time.Minute},
+		},
 	}
 }
 
@@ -104,6 +150,10 @@ type Config struct {
 	TokenExpire                 time.Duration // token失效时间
 	PayTokenExpire              time.Duration // 支付token失效时间
 	NameCacheExpire             time.Duration // 名字缓存过期时间
+	UserExportCachePrefix       string        // 账号数据导出下载token的前缀
+	UserExportLinkExpire        time.Duration // 账号数据导出下载链接有效期
+	UserExportCheckInterval     time.Duration // 检查待导出任务的间隔
+	UserExportTimeout           time.Duration // 导出任务超过此时间未完成则视为中断 重新导出
 	// -------- 推送 ---------
 	APNSDev      bool   // apns是否是开发模式
 	APNSPassword string // apns的密码
@@ -175,6 +225,67 @@ type Config struct {
 	ShortnoEditOff              bool // 是否关闭短编号编辑
 	PhoneSearchOff              bool // 是否关闭手机号搜索
 
+	DestroyGracePeriod time.Duration // 账号注销冷静期，冷静期内可撤销注销，为0则立即清除数据
+
+	// ---------- 限流 ----------
+	RateLimitOn     bool                         // 是否开启接口限流
+	RateLimitPrefix string                       // 限流redis key的前缀
+	RateLimits      map[string][]RateLimitConfig // 接口限流策略 key为策略名
+
+	// ---------- 图形验证 ----------
+	CaptchaOn            bool          // 是否开启图形验证
+	CaptchaAlways        bool          // 是否每次发送短信都需要图形验证（否则仅风险场景需要）
+	CaptchaPrefix        string        // 图形验证redis key的前缀
+	CaptchaExpire        time.Duration // 图形验证有效期
+	CaptchaTolerance     int           // 滑块位置允许的误差（像素）
+	CaptchaFailThreshold int           // 失败多少次后需要图形验证
+	CaptchaRiskExpire    time.Duration // 失败次数和风险IP标记的有效期
+
+	// ---------- 登录异常检测 ----------
+	GeoIPDBPath           string  // 本地GeoIP库路径（db-ip lite city csv格式），为空则不解析地理位置
+	LoginHistoryCount     int     // 检测新设备/新国家时参考的历史登录条数
+	ImpossibleTravelSpeed float64 // 两次登录之间的移动速度超过此值（公里/小时）视为异常位移
+
+	FlameCheckInterval time.Duration // 阅后即焚销毁检查间隔
+
+	ScheduledMessageCheckInterval time.Duration // 定时消息发送检查间隔
+	ScheduledMessageMaxPending    int           // 每个用户最多可有的待发送定时消息数量
+	ScheduledMessageMaxAhead      time.Duration // 定时消息最远可设置的发送时间
+
+	PinnedMessageMaxCount int // 每个频道最多可置顶的消息数量
+
+	ForwardMaxMessageCount int // 每次最多可转发的消息数量
+	ForwardMaxTargetCount  int // 每次最多可转发到的频道数量
+
+	PollOptionMaxCount int           // 投票最多可设置的选项数量
+	PollCheckInterval  time.Duration // 投票截止检查间隔
+
+	GroupJoinRequestExpire        time.Duration // 入群申请有效期
+	GroupJoinRequestCheckInterval time.Duration // 入群申请过期检查间隔
+
+	// ---------- 消息翻译 ----------
+	TranslateProvider      TranslateProvider // 翻译提供商 为空则不开启翻译
+	Translate              TranslateConfig
+	TranslateAutoMaxCount  int           // 同步消息时每次最多自动翻译的消息数量
+	TranslateTextMaxLength int           // 可翻译的文本最大长度
+	TranslateTimeout       time.Duration // 调用翻译服务的超时时间
+
+	// ---------- 链接预览 ----------
+	LinkPreviewOn           bool          // 是否开启链接预览
+	LinkPreviewTimeout      time.Duration // 抓取链接的超时时间
+	LinkPreviewMaxHTMLSize  int64         // 网页最多读取的字节数
+	LinkPreviewMaxImageSize int64         // 预览图最大字节数
+	LinkPreviewCacheExpire  time.Duration // 预览结果缓存时间
+
+	// ---------- 语音转文字 ----------
+	TranscribeProvider      TranscribeProvider // 语音转文字提供商 为空则不开启
+	Transcribe              TranscribeConfig
+	TranscribeTimeout       time.Duration // 单条语音转写超时时间
+	TranscribeMaxAudioSize  int64         // 语音文件最大字节数
+	TranscribeMaxDuration   int           // 可转写的语音最大时长（秒）
+	TranscribePushWait      time.Duration // 离线推送语音消息时等待转写结果的最长时间
+	TranscribeCheckInterval time.Duration // 检查中断的转写任务的间隔
+
 	GithubAPI string // github api地址
 }
 
@@ -216,6 +327,10 @@ func New() *Config {
 		APNSPassword:                GetEnv("APNSPassword", "123456"),
 		APNSTopic:                   GetEnv("APNSTopic", "com.xinbida.wukongchat"),
 		NameCacheExpire:             time.Hour * 24 * 7,
+		UserExportCachePrefix:       "user_export:",
+		UserExportLinkExpire:        time.Hour * 24,
+		UserExportCheckInterval:     time.Second * 10,
+		UserExportTimeout:           time.Hour,
 		SMSProvider:                 SMSProvider(GetEnv("SMSProvider", string(SMSProviderAliyun))),
 		VisitorUIDPrefix:            "_vt_",
 		OnlineStatusOn:              GetEnvBool("OnlineStatusOn", true),
@@ -283,16 +398,64 @@ func New() *Config {
 		RobotInlineQueryExpire: time.Second * 10,
 		RobotEventPoolSize:     100,
 		// ---------- other ----------
-		RegisterOnlyChina:           GetEnvBool("RegisterOnlyChina", false),
-		GRPCAddr:                    GetEnv("GRPCAddr", "0.0.0.0:6979"),
-		RegisterOff:                 GetEnvBool("RegisterOff", false),
-		StickerAddOffOfRegister:     GetEnvBool("StickerAddOffOfRegister", false),
-		GroupUpgradeWhenMemberCount: GetEnvInt("GroupUpgradeWhenMemberCount", 1000),
-		ShortnoNumOn:                GetEnvBool("ShortnoNumOn", false),
-		ShortnoNumLen:               GetEnvInt("ShortnoNumLen", 7),
-		ShortnoEditOff:              GetEnvBool("ShortnoEditOff", false),
-		PhoneSearchOff:              GetEnvBool("PhoneSearchOff", false),
-		GithubAPI:                   GetEnv("GithubAPI", "https://api.github.com"),
+		RegisterOnlyChina:             GetEnvBool("RegisterOnlyChina", false),
+		GRPCAddr:                      GetEnv("GRPCAddr", "0.0.0.0:6979"),
+		RegisterOff:                   GetEnvBool("RegisterOff", false),
+		StickerAddOffOfRegister:       GetEnvBool("StickerAddOffOfRegister", false),
+		GroupUpgradeWhenMemberCount:   GetEnvInt("GroupUpgradeWhenMemberCount", 1000),
+		ShortnoNumOn:                  GetEnvBool("ShortnoNumOn", false),
+		ShortnoNumLen:                 GetEnvInt("ShortnoNumLen", 7),
+		ShortnoEditOff:                GetEnvBool("ShortnoEditOff", false),
+		PhoneSearchOff:                GetEnvBool("PhoneSearchOff", false),
+		DestroyGracePeriod:            GetEnvDuration("DestroyGracePeriod", time.Hour*24*7),
+		RateLimitOn:                   GetEnvBool("RateLimitOn", true),
+		RateLimitPrefix:               "ratelimit:",
+		RateLimits:                    newRateLimits(),
+		CaptchaOn:                     GetEnvBool("CaptchaOn", true),
+		CaptchaAlways:                 GetEnvBool("CaptchaAlways", false),
+		CaptchaPrefix:                 "captcha:",
+		CaptchaExpire:                 time.Minute * 2,
+		CaptchaTolerance:              6,
+		CaptchaFailThreshold:          GetEnvInt("CaptchaFailThreshold", 3),
+		CaptchaRiskExpire:             GetEnvDuration("CaptchaRiskExpire", time.Minute*30),
+		GeoIPDBPath:                   GetEnv("GeoIPDBPath", ""),
+		LoginHistoryCount:             100,
+		ImpossibleTravelSpeed:         1000,
+		FlameCheckInterval:            time.Second * 5,
+		ScheduledMessageCheckInterval: time.Second * 5,
+		ScheduledMessageMaxPending:    100,
+		ScheduledMessageMaxAhead:      time.Hour * 24 * 365,
+		PinnedMessageMaxCount:         10,
+		ForwardMaxMessageCount:        100,
+		ForwardMaxTargetCount:         9,
+		PollOptionMaxCount:            20,
+		PollCheckInterval:             time.Second * 30,
+		GroupJoinRequestExpire:        time.Hour * 24 * 7,
+		GroupJoinRequestCheckInterval: time.Minute,
+		TranslateProvider:             TranslateProvider(GetEnv("TranslateProvider", "")),
+		TranslateAutoMaxCount:         20,
+		TranslateTextMaxLength:        5000,
+		TranslateTimeout:              time.Second * 10,
+		LinkPreviewOn:                 GetEnvBool("LinkPreviewOn", false),
+		LinkPreviewTimeout:            time.Second * 5,
+		LinkPreviewMaxHTMLSize:        512 * 1024,
+		LinkPreviewMaxImageSize:       2 * 1024 * 1024,
+		LinkPreviewCacheExpire:        time.Hour * 24,
+		TranscribeProvider:            TranscribeProvider(GetEnv("TranscribeProvider", "")),
+		TranscribeTimeout:             time.Second * 60,
+		TranscribeMaxAudioSize:        10 * 1024 * 1024,
+		TranscribeMaxDuration:         120,
+		TranscribePushWait:            time.Second * 3,
+		TranscribeCheckInterval:       time.Minute,
+		GithubAPI:                     GetEnv("GithubAPI", "https://api.github.com"),
+		Translate: TranslateConfig{
+			URL:    GetEnv("Translate.URL", ""),
+			APIKey: GetEnv("Translate.APIKey", ""),
+		},
+		Transcribe: TranscribeConfig{
+			Command: GetEnv("Transcribe.Command", ""),
+			Args:    GetEnv("Transcribe.Args", "{file}"),
+		},
 	}
 
 	cfg.TablePartitionConfig = newTablePartitionConfig()
@@ -436,6 +599,19 @@ func GetEnvFloat64(key string, defaultValue float64) float64 {
 	return i
 }
 
+// GetEnvDuration 环境变量获取 格式如 10s 5m 24h
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if strings.TrimSpace(v) == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return defaultValue
+	}
+	return d
+}
+
 // StringEnv StringEnv
 func StringEnv(v *string, key string) {
 	vv := os.Getenv(key)
@@ -465,6 +641,34 @@ const (
 	SMSProviderUnisms SMSProvider = "unisms" // 联合短信(https://unisms.apistd.com/docs/api/send/)
 )
 
+// TranslateProvider 翻译供应者
+type TranslateProvider string
+
+const (
+	TranslateProviderDict  TranslateProvider = "dict"  // 字典翻译（测试用）
+	TranslateProviderLibre TranslateProvider = "libre" // LibreTranslate(https://libretranslate.com/docs)
+)
+
+// TranslateConfig 翻译配置
+type TranslateConfig struct {
+	URL    string // 翻译服务地址
+	APIKey string // 翻译服务的api key
+}
+
+// TranscribeProvider 语音转文字供应者
+type TranscribeProvider string
+
+const (
+	TranscribeProviderStub    TranscribeProvider = "stub"    // 固定结果（测试用）
+	TranscribeProviderCommand TranscribeProvider = "command" // 本地命令（例如whisper.cpp、vosk）
+)
+
+// TranscribeConfig 语音转文字配置
+type TranscribeConfig struct {
+	Command string // 本地转写命令
+	Args    string // 命令参数 空格分隔 {file}为语音文件路径 {lang}为语言
+}
+
 // AliyunSMSConfig 阿里云短信
 type AliyunSMSConfig struct {
 	AccessKeyID  string // aliyun的AccessKeyID
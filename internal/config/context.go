@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/RussellLuo/timingwheel"
@@ -12,10 +13,12 @@ import (
 	"github.com/WuKongIM/WuKongChatServer/pkg/pool"
 	"github.com/WuKongIM/WuKongChatServer/pkg/redis"
 	"github.com/WuKongIM/WuKongChatServer/pkg/wkevent"
+	"github.com/WuKongIM/WuKongChatServer/pkg/wkhttp"
 	"github.com/bwmarrin/snowflake"
 	"github.com/gocraft/dbr/v2"
 	"github.com/olivere/elastic"
 	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
 )
 
 // Context 配置上下文
@@ -35,6 +38,7 @@ type Context struct {
 	tracer         *Tracer                  // 调用链追踪
 	aysncTask      *AsyncTask               // 异步任务
 	timingWheel    *timingwheel.TimingWheel // Time wheel delay task
+	rateLimiter    wkhttp.RateLimiter       // 接口限流器
 
 }
 
@@ -119,6 +123,98 @@ func (c *Context) GetRedisConn() *redis.Conn {
 	return c.NewRedisCache().GetRedisConn()
 }
 
+// SetRateLimiter 设置接口限流器
+func (c *Context) SetRateLimiter(limiter wkhttp.RateLimiter) {
+	c.rateLimiter = limiter
+}
+
+// GetRateLimiter 获取接口限流器 测试模式下使用内存限流器
+func (c *Context) GetRateLimiter() wkhttp.RateLimiter {
+	if c.rateLimiter == nil {
+		if c.cfg.Test {
+			c.rateLimiter = wkhttp.NewMemoryRateLimiter()
+		} else {
+			c.rateLimiter = wkhttp.NewRedisRateLimiter(c.GetRedisConn(), c.cfg.RateLimitPrefix)
+		}
+	}
+	return c.rateLimiter
+}
+
+// RateLimit 获取某个策略的限流中间件
+func (c *Context) RateLimit(name string) wkhttp.HandlerFunc {
+	policies := c.rateLimitPolicies(name)
+	if len(policies) == 0 {
+		return func(ctx *wkhttp.Context) {
+			ctx.Next()
+		}
+	}
+	rateLimitMiddleware := wkhttp.RateLimitMiddleware(c.GetRateLimiter(), policies...)
+	return func(ctx *wkhttp.Context) {
+		rateLimitMiddleware(ctx)
+		if ctx.GetBool(wkhttp.RateLimitedKey) {
+			c.MarkRiskIP(ctx.ClientIP())
+		}
+	}
+}
+
+// CheckRateLimit 在处理函数内做某个策略的限流检查（例如需要在图形验证之后再计数） 超限时已响应请求并返回false
+func (c *Context) CheckRateLimit(ctx *wkhttp.Context, name string) bool {
+	policies := c.rateLimitPolicies(name)
+	if len(policies) == 0 {
+		return true
+	}
+	if !wkhttp.CheckRateLimit(ctx, c.GetRateLimiter(), policies...) {
+		c.MarkRiskIP(ctx.ClientIP())
+		return false
+	}
+	return true
+}
+
+// rateLimitPolicies 获取某个策略的限流规则 未开启限流时返回空
+func (c *Context) rateLimitPolicies(name string) []wkhttp.RateLimitPolicy {
+	rateLimits := c.cfg.RateLimits[name]
+	if !c.cfg.RateLimitOn || len(rateLimits) == 0 {
+		return nil
+	}
+	policies := make([]wkhttp.RateLimitPolicy, 0, len(rateLimits))
+	for _, rateLimit := range rateLimits {
+		policies = append(policies, wkhttp.RateLimitPolicy{
+			Name:   name,
+			Key:    wkhttp.RateLimitKey(rateLimit.Key),
+			Limit:  rateLimit.Limit,
+			Window: rateLimit.Window,
+		})
+	}
+	return policies
+}
+
+// MarkRiskIP 标记风险IP（被限流的IP），在有效期内需要图形验证
+func (c *Context) MarkRiskIP(ip string) {
+	if ip == "" {
+		return
+	}
+	err := c.GetRedisConn().SetAndExpire(c.riskIPKey(ip), "1", c.cfg.CaptchaRiskExpire)
+	if err != nil {
+		c.Warn("标记风险IP失败！", zap.Error(err), zap.String("ip", ip))
+	}
+}
+
+// IsRiskIP 是否为风险IP
+func (c *Context) IsRiskIP(ip string) (bool, error) {
+	if ip == "" {
+		return false, nil
+	}
+	value, err := c.GetRedisConn().GetString(c.riskIPKey(ip))
+	if err != nil {
+		return false, err
+	}
+	return value != "", nil
+}
+
+func (c *Context) riskIPKey(ip string) string {
+	return fmt.Sprintf("%sriskip:%s", c.cfg.CaptchaPrefix, ip)
+}
+
 // EventBegin 开启事件
 func (c *Context) EventBegin(data *wkevent.Data, tx *dbr.Tx) (int64, error) {
 	return c.Event.Begin(data, tx)
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/WuKongIM/WuKongChatServer/internal/common"
@@ -119,6 +120,40 @@ func (c *Context) SendGroupUpdate(req *MsgGroupUpdateReq) error {
 		}
 		break
 
+	case common.GroupAttrKeyJoinMode:
+		switch req.Data[common.GroupAttrKeyJoinMode] {
+		case "1":
+			content += `将入群方式设置为“仅限邀请”`
+		case "2":
+			content += `将入群方式设置为“需要审批”，申请入群需群主或管理员同意。`
+		default:
+			content += `将入群方式设置为“公开”`
+		}
+		break
+
+	case common.GroupAttrKeySlowMode:
+		seconds, _ := strconv.ParseInt(req.Data[common.GroupAttrKeySlowMode], 10, 64)
+		if seconds > 0 {
+			content += fmt.Sprintf(`开启了慢速模式，每位成员每%s只能发送一条消息`, durationText(seconds))
+		} else {
+			content += `关闭了慢速模式`
+		}
+		break
+	case common.GroupAttrKeyNewMemberProbation:
+		seconds, _ := strconv.ParseInt(req.Data[common.GroupAttrKeyNewMemberProbation], 10, 64)
+		if seconds > 0 {
+			content += fmt.Sprintf(`设置新成员入群%s内不能发送链接、图片等消息`, durationText(seconds))
+		} else {
+			content += `取消了新成员发言限制`
+		}
+		break
+	case common.GroupAttrKeyForbiddenForward:
+		if req.Data[common.GroupAttrKeyForbiddenForward] == "1" {
+			content += `开启了禁止转发，群成员不能转发和保存群内的消息`
+		} else {
+			content += `关闭了禁止转发`
+		}
+		break
 	case common.GroupAttrKeyStatus:
 		status, _ := req.Data[common.GroupAttrKeyStatus]
 		if status == "1" {
@@ -432,3 +467,14 @@ type MsgGroupMemberScanJoin struct {
 	Scaner        string `json:"scaner"`         // 扫码者uid
 	ScanerName    string `json:"scaner_name"`    // 扫码者名称
 }
+
+// durationText 将秒数转换为可读的时长
+func durationText(seconds int64) string {
+	if seconds >= 3600 && seconds%3600 == 0 {
+		return fmt.Sprintf("%d小时", seconds/3600)
+	}
+	if seconds >= 60 && seconds%60 == 0 {
+		return fmt.Sprintf("%d分钟", seconds/60)
+	}
+	return fmt.Sprintf("%d秒", seconds)
+}
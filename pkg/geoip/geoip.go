@@ -0,0 +1,122 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Location IP对应的粗略地理位置
+type Location struct {
+	Country   string  // 国家代码（如CN）
+	Province  string  // 省/州
+	City      string  // 城市
+	Latitude  float64 // 纬度
+	Longitude float64 // 经度
+}
+
+// HasCoordinate 是否有经纬度
+func (l *Location) HasCoordinate() bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
+
+type ipRange struct {
+	start net.IP
+	end   net.IP
+	loc   *Location
+}
+
+// DB 本地GeoIP库
+// 使用db-ip lite city的csv格式：ip_start,ip_end,continent,country,stateprov,city,latitude,longitude
+type DB struct {
+	ranges []ipRange
+}
+
+// Open 打开本地GeoIP库文件
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Load 从reader加载GeoIP库
+func Load(r io.Reader) (*DB, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	db := &DB{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 6 {
+			continue
+		}
+		start := net.ParseIP(record[0])
+		end := net.ParseIP(record[1])
+		if start == nil || end == nil {
+			continue
+		}
+		loc := &Location{
+			Country:  record[3],
+			Province: record[4],
+			City:     record[5],
+		}
+		if len(record) >= 8 {
+			loc.Latitude, _ = strconv.ParseFloat(record[6], 64)
+			loc.Longitude, _ = strconv.ParseFloat(record[7], 64)
+		}
+		db.ranges = append(db.ranges, ipRange{start: start.To16(), end: end.To16(), loc: loc})
+	}
+	if len(db.ranges) == 0 {
+		return nil, errors.New("geoip库为空！")
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+	return db, nil
+}
+
+// Lookup 查询IP的地理位置 查不到返回nil
+func (d *DB) Lookup(ipStr string) *Location {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil
+	}
+	ip = ip.To16()
+	// 找到最后一个start<=ip的区间
+	index := sort.Search(len(d.ranges), func(i int) bool {
+		return bytes.Compare(d.ranges[i].start, ip) > 0
+	}) - 1
+	if index < 0 {
+		return nil
+	}
+	if bytes.Compare(ip, d.ranges[index].end) > 0 {
+		return nil
+	}
+	return d.ranges[index].loc
+}
+
+// Distance 两个位置之间的球面距离（公里）
+func Distance(a, b *Location) float64 {
+	const earthRadius = 6371.0
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,44 @@
+package geoip
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCSV = `1.0.0.0,1.0.0.255,OC,AU,Queensland,South Brisbane,-27.4767,153.017
+1.0.1.0,1.0.3.255,AS,CN,Fujian,Fuzhou,26.0614,119.306
+8.8.8.0,8.8.8.255,NA,US,California,Mountain View,37.4223,-122.085
+2001:200::,2001:200:ffff:ffff:ffff:ffff:ffff:ffff,AS,JP,Tokyo,Tokyo,35.6895,139.692
+`
+
+func TestLookup(t *testing.T) {
+	db, err := Load(strings.NewReader(testCSV))
+	assert.NoError(t, err)
+
+	loc := db.Lookup("1.0.2.3")
+	assert.NotNil(t, loc)
+	assert.Equal(t, "CN", loc.Country)
+	assert.Equal(t, "Fuzhou", loc.City)
+
+	loc = db.Lookup("8.8.8.8")
+	assert.NotNil(t, loc)
+	assert.Equal(t, "US", loc.Country)
+
+	loc = db.Lookup("2001:200::1")
+	assert.NotNil(t, loc)
+	assert.Equal(t, "JP", loc.Country)
+
+	assert.Nil(t, db.Lookup("1.0.4.1"))
+	assert.Nil(t, db.Lookup("0.0.0.1"))
+	assert.Nil(t, db.Lookup("invalid"))
+}
+
+func TestDistance(t *testing.T) {
+	fuzhou := &Location{Latitude: 26.0614, Longitude: 119.306}
+	mountainView := &Location{Latitude: 37.4223, Longitude: -122.085}
+	distance := Distance(fuzhou, mountainView)
+	assert.InDelta(t, 10500, distance, 300)
+	assert.Equal(t, float64(0), Distance(fuzhou, fuzhou))
+}
@@ -381,3 +381,8 @@ func (rc *Conn) BRPoplpush(source string, destination string, timeout time.Durat
 func (rc *Conn) LPUSH(key string, values ...interface{}) (int64, error) {
 	return rc.client.LPush(key, values...).Result()
 }
+
+// Eval 执行lua脚本
+func (rc *Conn) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return rc.client.Eval(script, keys, args...).Result()
+}
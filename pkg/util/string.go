@@ -114,3 +114,8 @@ var names = []string{"独角王", "老鼋", "灵感大王", "如意真仙", "蝎
 func GetRandomName() string {
 	return names[rand.Intn(len(names)-1)]
 }
+
+// EscapeLike 转义like语句里的通配符
+func EscapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
@@ -0,0 +1,12 @@
+package util
+
+import (
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `50\%\_a\\b`, EscapeLike(`50%_a\b`))
+	assert.Equal(t, "abc", EscapeLike("abc"))
+}
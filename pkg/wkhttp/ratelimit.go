@@ -0,0 +1,247 @@
+package wkhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WuKongIM/WuKongChatServer/pkg/redis"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RateLimitKey 限流维度
+type RateLimitKey string
+
+const (
+	// RateLimitKeyIP 按客户端IP限流
+	RateLimitKeyIP RateLimitKey = "ip"
+	// RateLimitKeyUID 按登录用户限流
+	RateLimitKeyUID RateLimitKey = "uid"
+	// RateLimitKeyPhone 按请求里的手机号限流
+	RateLimitKeyPhone RateLimitKey = "phone"
+	// RateLimitKeyDevice 按请求里的设备ID限流
+	RateLimitKeyDevice RateLimitKey = "device"
+)
+
+// RateLimitPolicy 限流策略
+type RateLimitPolicy struct {
+	Name   string        // 策略名
+	Key    RateLimitKey  // 限流维度
+	Limit  int           // 窗口内允许的请求次数
+	Window time.Duration // 窗口大小
+}
+
+// RateLimiter 限流器
+type RateLimiter interface {
+	// Allow 判断请求是否允许通过 不允许时返回需要等待的时间
+	Allow(key string, limit int, window time.Duration) (bool, time.Duration, error)
+}
+
+// RateLimitMiddleware 限流中间件 任意一个策略超限则返回429
+func RateLimitMiddleware(limiter RateLimiter, policies ...RateLimitPolicy) HandlerFunc {
+	return func(c *Context) {
+		if !CheckRateLimit(c, limiter, policies...) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// CheckRateLimit 在处理函数内做限流检查 任意一个策略超限则返回429并返回false
+func CheckRateLimit(c *Context, limiter RateLimiter, policies ...RateLimitPolicy) bool {
+	for _, policy := range policies {
+		value := rateLimitKeyValue(c, policy.Key)
+		key := fmt.Sprintf("%s:%s:%s", policy.Name, policy.Key, value)
+		allowed, retryAfter, err := limiter.Allow(key, policy.Limit, policy.Window)
+		if err != nil { // 限流器异常时不影响正常请求
+			c.lg.Warn("限流器异常！", zap.Error(err), zap.String("key", key))
+			continue
+		}
+		if !allowed {
+			c.Set(RateLimitedKey, true)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"msg":    "请求过于频繁，请稍后再试！",
+				"status": http.StatusTooManyRequests,
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// RateLimitedKey 请求被限流时在上下文里设置的标记
+const RateLimitedKey = "rate_limited"
+
+// rateLimitKeyValue 获取限流维度对应的值 取不到时退化为按IP限流
+func rateLimitKeyValue(c *Context, key RateLimitKey) string {
+	var value string
+	switch key {
+	case RateLimitKeyUID:
+		value = c.GetString("uid")
+	case RateLimitKeyPhone:
+		body := c.peekJSONBody()
+		zone, _ := body["zone"].(string)
+		phone, _ := body["phone"].(string)
+		if phone != "" {
+			value = zone + phone
+		} else {
+			value, _ = body["username"].(string)
+		}
+	case RateLimitKeyDevice:
+		body := c.peekJSONBody()
+		value, _ = body["device_id"].(string)
+		if value == "" {
+			if device, ok := body["device"].(map[string]interface{}); ok {
+				value, _ = device["device_id"].(string)
+			}
+		}
+	}
+	if value == "" {
+		value = c.ClientIP()
+	}
+	return value
+}
+
+// peekJSONBody 读取json请求体且不影响后续的BindJSON
+func (c *Context) peekJSONBody() map[string]interface{} {
+	var bodyBytes []byte
+	if cached, ok := c.Get(gin.BodyBytesKey); ok { // 已通过ShouldBindBodyWith读取过的请求体
+		bodyBytes, _ = cached.([]byte)
+	} else {
+		if c.Request.Body == nil {
+			return nil
+		}
+		var err error
+		bodyBytes, err = ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
+	}
+	var body map[string]interface{}
+	_ = json.Unmarshal(bodyBytes, &body)
+	return body
+}
+
+// 滑动窗口限流脚本 返回0表示允许 否则返回需要等待的毫秒数
+const slidingWindowScript = `
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+if redis.call('ZCARD', key) < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local wait = tonumber(oldest[2]) + window - now
+if wait < 1 then
+	wait = 1
+end
+return wait
+`
+
+// RedisRateLimiter 基于redis的滑动窗口限流器
+type RedisRateLimiter struct {
+	conn   *redis.Conn
+	prefix string
+	seq    uint64
+	seqMu  sync.Mutex
+}
+
+// NewRedisRateLimiter 创建redis限流器
+func NewRedisRateLimiter(conn *redis.Conn, prefix string) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		conn:   conn,
+		prefix: prefix,
+	}
+}
+
+// Allow Allow
+func (r *RedisRateLimiter) Allow(key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	r.seqMu.Lock()
+	r.seq++
+	member := fmt.Sprintf("%d-%d", now, r.seq)
+	r.seqMu.Unlock()
+	result, err := r.conn.Eval(slidingWindowScript, []string{r.prefix + key}, now, window.Milliseconds(), limit, member)
+	if err != nil {
+		return true, 0, err
+	}
+	wait, _ := result.(int64)
+	if wait <= 0 {
+		return true, 0, nil
+	}
+	return false, time.Duration(wait) * time.Millisecond, nil
+}
+
+// memoryRateLimitSweepInterval 内存限流器清理过期key的间隔
+const memoryRateLimitSweepInterval = time.Minute
+
+// MemoryRateLimiter 基于内存的滑动窗口限流器（单机或测试使用）
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*memoryWindow
+	lastSweep time.Time
+	nowFnc    func() time.Time
+}
+
+type memoryWindow struct {
+	hits   []time.Time
+	window time.Duration
+}
+
+// NewMemoryRateLimiter 创建内存限流器
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		windows: map[string]*memoryWindow{},
+		nowFnc:  time.Now,
+	}
+}
+
+// Allow Allow
+func (m *MemoryRateLimiter) Allow(key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.nowFnc()
+	m.sweep(now)
+	w := m.windows[key]
+	if w == nil {
+		w = &memoryWindow{}
+		m.windows[key] = w
+	}
+	w.window = window
+	start := 0
+	for start < len(w.hits) && !w.hits[start].After(now.Add(-window)) {
+		start++
+	}
+	w.hits = w.hits[start:]
+	if len(w.hits) < limit {
+		w.hits = append(w.hits, now)
+		return true, 0, nil
+	}
+	return false, w.hits[0].Add(window).Sub(now), nil
+}
+
+// sweep 定期清理窗口内已没有请求的key 避免按IP等维度限流时内存无限增长
+func (m *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < memoryRateLimitSweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, w := range m.windows {
+		if len(w.hits) == 0 || !w.hits[len(w.hits)-1].After(now.Add(-w.window)) {
+			delete(m.windows, key)
+		}
+	}
+}
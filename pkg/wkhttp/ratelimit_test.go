@@ -0,0 +1,113 @@
+package wkhttp
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	limiter := NewMemoryRateLimiter()
+	now := time.Now()
+	limiter.nowFnc = func() time.Time { return now }
+
+	allowed, _, _ := limiter.Allow("k", 2, time.Minute)
+	assert.True(t, allowed)
+	allowed, _, _ = limiter.Allow("k", 2, time.Minute)
+	assert.True(t, allowed)
+	allowed, retryAfter, _ := limiter.Allow("k", 2, time.Minute)
+	assert.False(t, allowed)
+	assert.Equal(t, time.Minute, retryAfter)
+
+	now = now.Add(time.Minute + time.Second)
+	allowed, _, _ = limiter.Allow("k", 2, time.Minute)
+	assert.True(t, allowed)
+}
+
+func TestMemoryRateLimiterSweep(t *testing.T) {
+	limiter := NewMemoryRateLimiter()
+	now := time.Now()
+	limiter.nowFnc = func() time.Time { return now }
+
+	limiter.Allow("k1", 1, time.Second)
+	limiter.Allow("k2", 1, time.Hour)
+	assert.Len(t, limiter.windows, 2)
+
+	now = now.Add(memoryRateLimitSweepInterval)
+	limiter.Allow("k3", 1, time.Second)
+	assert.Len(t, limiter.windows, 2)
+	assert.NotContains(t, limiter.windows, "k1")
+	assert.Contains(t, limiter.windows, "k2")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	l := New()
+	limiter := NewMemoryRateLimiter()
+	l.POST("/limit", RateLimitMiddleware(limiter, RateLimitPolicy{
+		Name:   "test",
+		Key:    RateLimitKeyPhone,
+		Limit:  1,
+		Window: time.Minute,
+	}), func(c *Context) {
+		var req struct {
+			Phone string `json:"phone"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.ResponseError(err)
+			return
+		}
+		c.ResponseOK()
+	})
+
+	send := func(phone string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/limit", bytes.NewReader([]byte(`{"zone":"0086","phone":"`+phone+`"}`)))
+		l.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, send("13600000001").Code)
+
+	w := send("13600000001")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, send("13600000002").Code)
+}
+
+func TestCheckRateLimitAfterBind(t *testing.T) {
+	l := New()
+	limiter := NewMemoryRateLimiter()
+	l.POST("/limit", func(c *Context) {
+		var req struct {
+			Phone string `json:"phone"`
+		}
+		if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+			c.ResponseError(err)
+			return
+		}
+		if !CheckRateLimit(c, limiter, RateLimitPolicy{
+			Name:   "test",
+			Key:    RateLimitKeyPhone,
+			Limit:  1,
+			Window: time.Minute,
+		}) {
+			return
+		}
+		c.ResponseOK()
+	})
+
+	send := func(phone string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/limit", bytes.NewReader([]byte(`{"zone":"0086","phone":"`+phone+`"}`)))
+		l.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, send("13600000001").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("13600000001").Code)
+	assert.Equal(t, http.StatusOK, send("13600000002").Code) // 按手机号而不是IP计数
+}